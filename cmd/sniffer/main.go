@@ -58,7 +58,7 @@ func main() {
 	cap := capture.New(cfg, st)
 
 	// Create scheduler
-	sched := scheduler.New(st, cfg)
+	sched := scheduler.New(st, cfg, cap)
 
 	// Create app
 	app := server.NewApp(cfg, cap, sched, st, dashboard)
@@ -44,9 +44,19 @@ export function DeleteAlertRule(arg1) {
   return http.post(`/api/deleteAlertRule`, {id:arg1});
 }
 
-export function ExportPCAP(arg1, arg2) {
-  //return window['go']['server']['App']['ExportPCAP'](arg1, arg2);
-  return http.post(`/api/exportPCAP`, {startTime:arg1, endTime: arg2});
+export function DownloadAlertEvidence(arg1) {
+  // return window['go']['server']['App']['GetAlertEvidence'](arg1);
+  return http.downLoadFile(`/api/downloadAlertEvidence?id=${arg1}`, `alert_${arg1}.pcapng`);
+}
+
+export function ExportPCAP(arg1, arg2, arg3) {
+  //return window['go']['server']['App']['ExportPCAP'](arg1, arg2, arg3);
+  return http.post(`/api/exportPCAP`, {startTime:arg1, endTime: arg2, filter: arg3});
+}
+
+export function GetARPTable() {
+  // return window['go']['server']['App']['GetARPTable']();
+  return http.get(`/api/getARPTable`);
 }
 
 export function GetAlertRule(arg1) {
@@ -59,6 +69,16 @@ export function GetAlertStats() {
   return http.get(`/api/getAlertStats`);
 }
 
+export function GetCaptureSettings() {
+  // return window['go']['server']['App']['GetCaptureSettings']();
+  return http.get(`/api/getCaptureSettings`);
+}
+
+export function GetCaptureStatus() {
+  // return window['go']['server']['App']['GetCaptureStatus']();
+  return http.get(`/api/getCaptureStatus`);
+}
+
 export function GetConfig() {
   // return window['go']['server']['App']['GetConfig']();
   return http.get(`/api/getConfig`);
@@ -99,6 +119,11 @@ export function GetNpcapDownloadURL() {
   return http.get(`/api/getNpcapDownloadURL`);
 }
 
+export function GetPingStats() {
+  // return window['go']['server']['App']['GetPingStats']();
+  return http.get(`/api/getPingStats`);
+}
+
 export function GetProcessStats(arg1, arg2) {
   // return window['go']['server']['App']['GetProcessStats'](arg1, arg2);
   return http.get(`/api/getProcessStats`, {page: arg1, size: arg2});
@@ -114,6 +139,11 @@ export function GetRawPackets(arg1) {
   return http.get(`/api/getRawPackets`, {limit: arg1});
 }
 
+export function GetReplayStatus() {
+  // return window['go']['server']['App']['GetReplayStatus']();
+  return http.get(`/api/getReplayStatus`);
+}
+
 export function GetSessions(arg1, arg2) {
   // return window['go']['server']['App']['GetSessions'](arg1, arg2);
   return http.get(`/api/getSessions`, {table: arg1, limit : arg2});
@@ -134,6 +164,11 @@ export function GetTopProcessesByTraffic(arg1) {
   return http.get(`/api/getTopProcessesByTraffic`, {limit: arg1});
 }
 
+export function GetTraceRoutes() {
+  // return window['go']['server']['App']['GetTraceRoutes']();
+  return http.get(`/api/getTraceRoutes`);
+}
+
 export function IsCapturing() {
   // return window['go']['server']['App']['IsCapturing']();
   return http.get(`/api/isCapturing`);
@@ -159,6 +194,31 @@ export function QueryAlertRules(arg1) {
   return http.postJson(`/api/queryAlertRules`, arg1);
 }
 
+export function QueryDNSNXDomains(arg1) {
+  // return window['go']['server']['App']['QueryDNSNXDomains'](arg1);
+  return http.postJson(`/api/queryDNSNXDomains`, arg1);
+}
+
+export function QueryDNSRecords(arg1) {
+  // return window['go']['server']['App']['QueryDNSRecords'](arg1);
+  return http.postJson(`/api/queryDNSRecords`, arg1);
+}
+
+export function QueryDNSStats(arg1) {
+  // return window['go']['server']['App']['QueryDNSStats'](arg1);
+  return http.postJson(`/api/queryDNSStats`, arg1);
+}
+
+export function QueryHTTPLatency(arg1) {
+  // return window['go']['server']['App']['QueryHTTPLatency'](arg1);
+  return http.postJson(`/api/queryHTTPLatency`, arg1);
+}
+
+export function QueryHosts(arg1) {
+  // return window['go']['server']['App']['QueryHosts'](arg1);
+  return http.postJson(`/api/queryHosts`, arg1);
+}
+
 export function QuerySessionFlows(arg1) {
  // return window['go']['server']['App']['QuerySessionFlows'](arg1);
   return http.postJson(`/api/querySessionFlows`, arg1);
@@ -174,9 +234,27 @@ export function ResumeCapture() {
   return http.get(`/api/resumeCapture`);
 }
 
-export function StartCapture(arg1) {
-  // return window['go']['server']['App']['StartCapture'](arg1);
-  return http.post(`/api/startCapture`, {iface: arg1});
+export function SetCaptureFilter(arg1, arg2) {
+  // return window['go']['server']['App']['SetCaptureFilter'](arg1, arg2);
+  return http.post(`/api/setCaptureFilter`, {iface: arg1, filter: arg2});
+}
+
+export function StartCapture(arg1, arg2, arg3) {
+  // return window['go']['server']['App']['StartCapture'](arg1, arg2, arg3);
+  const stop = arg3 || {};
+  return http.post(`/api/startCapture`, {
+    iface: arg1,
+    filter: arg2,
+    stopDuration: stop.duration || 0,
+    stopPackets: stop.packets || 0,
+    stopBytes: stop.bytes || 0,
+    stopFiles: stop.files || 0
+  });
+}
+
+export function StartReplay(arg1, arg2) {
+  // return window['go']['server']['App']['StartReplay'](arg1, arg2);
+  return http.post(`/api/startReplay`, {path: arg1, speed: arg2});
 }
 
 export function StopCapture() {
@@ -184,6 +262,11 @@ export function StopCapture() {
   return http.get(`/api/stopCapture`);
 }
 
+export function StopInterface(arg1) {
+  // return window['go']['server']['App']['StopInterface'](arg1);
+  return http.post(`/api/stopInterface`, {iface: arg1});
+}
+
 export function UpdateAlertRule(arg1) {
   // return window['go']['server']['App']['UpdateAlertRule'](arg1);
   return http.postJson(`/api/updateAlertRule`, arg1);
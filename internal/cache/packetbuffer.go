@@ -0,0 +1,95 @@
+package cache
+
+import (
+	"sync"
+	"time"
+
+	"sniffer/pkg/model"
+)
+
+// PacketBuffer keeps the raw packets of a rolling time window
+// 按时间窗口保留最近的原始数据包，用于告警触发前的快照
+type PacketBuffer struct {
+	mu      sync.Mutex
+	window  time.Duration
+	packets []*model.Packet // 环形存储，容量即最大数据包数
+	start   int
+	count   int
+}
+
+// NewPacketBuffer creates a buffer holding at most maxPackets packets of the last window
+func NewPacketBuffer(window time.Duration, maxPackets int) *PacketBuffer {
+	if maxPackets <= 0 {
+		maxPackets = 1000
+	}
+	return &PacketBuffer{
+		window:  window,
+		packets: make([]*model.Packet, maxPackets),
+	}
+}
+
+// Push adds a packet and evicts the packets that fell out of the window
+// If the buffer is full, it overwrites the oldest packet
+func (b *PacketBuffer) Push(pkt *model.Packet) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	capacity := len(b.packets)
+	if b.count == capacity {
+		b.start = (b.start + 1) % capacity
+		b.count--
+	}
+	b.packets[(b.start+b.count)%capacity] = pkt
+	b.count++
+
+	// 按数据包时间戳淘汰（离线回放时同样有效）
+	cutoff := pkt.Timestamp.Add(-b.window)
+	for b.count > 0 {
+		oldest := b.packets[b.start]
+		if !oldest.Timestamp.Before(cutoff) {
+			break
+		}
+		b.packets[b.start] = nil
+		b.start = (b.start + 1) % capacity
+		b.count--
+	}
+}
+
+// Since returns the buffered packets captured at or after t, oldest first
+func (b *PacketBuffer) Since(t time.Time) []*model.Packet {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	capacity := len(b.packets)
+	result := make([]*model.Packet, 0, b.count)
+	for i := 0; i < b.count; i++ {
+		pkt := b.packets[(b.start+i)%capacity]
+		if !pkt.Timestamp.Before(t) {
+			result = append(result, pkt)
+		}
+	}
+	return result
+}
+
+// Window returns the maximum time span kept in the buffer
+func (b *PacketBuffer) Window() time.Duration {
+	return b.window
+}
+
+// Len returns the current number of packets
+func (b *PacketBuffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.count
+}
+
+// Clear removes all packets from the buffer
+func (b *PacketBuffer) Clear() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i := range b.packets {
+		b.packets[i] = nil
+	}
+	b.start = 0
+	b.count = 0
+}
@@ -129,23 +129,23 @@ func (r *Ring) Resize(newCapacity int) *Ring {
 }
 
 // RingSet manages multiple Ring buffers with atomic swapping
-// 环形缓冲区集合，支持原子替换
+// 环形缓冲区集合：原始数据包一个，会话按表名各一个，支持原子替换
 type RingSet struct {
-	mu   sync.RWMutex
-	raw  *Ring
-	dns  *Ring
-	http *Ring
-	icmp *Ring
-}
-
-// NewRingSet creates a new RingSet with specified capacities
-func NewRingSet(rawCap, dnsCap, httpCap, icmpCap int) *RingSet {
-	return &RingSet{
-		raw:  New(rawCap),
-		dns:  New(dnsCap),
-		http: New(httpCap),
-		icmp: New(icmpCap),
+	mu       sync.RWMutex
+	raw      *Ring
+	sessions map[string]*Ring
+}
+
+// NewRingSet creates a new RingSet with the raw packet capacity and the capacity of each session table
+func NewRingSet(rawCap int, sessionCaps map[string]int) *RingSet {
+	rs := &RingSet{
+		raw:      New(rawCap),
+		sessions: make(map[string]*Ring, len(sessionCaps)),
+	}
+	for table, capacity := range sessionCaps {
+		rs.sessions[table] = New(capacity)
 	}
+	return rs
 }
 
 // GetRaw returns the raw packet ring
@@ -155,25 +155,22 @@ func (rs *RingSet) GetRaw() *Ring {
 	return rs.raw
 }
 
-// GetDNS returns the DNS session ring
-func (rs *RingSet) GetDNS() *Ring {
-	rs.mu.RLock()
-	defer rs.mu.RUnlock()
-	return rs.dns
-}
-
-// GetHTTP returns the HTTP session ring
-func (rs *RingSet) GetHTTP() *Ring {
+// GetSession returns the session ring of a table, nil 表示该表没有环形缓冲区
+func (rs *RingSet) GetSession(table string) *Ring {
 	rs.mu.RLock()
 	defer rs.mu.RUnlock()
-	return rs.http
+	return rs.sessions[table]
 }
 
-// GetICMP returns the ICMP session ring
-func (rs *RingSet) GetICMP() *Ring {
+// SessionLens returns the number of items in each session ring
+func (rs *RingSet) SessionLens() map[string]int {
 	rs.mu.RLock()
 	defer rs.mu.RUnlock()
-	return rs.icmp
+	lens := make(map[string]int, len(rs.sessions))
+	for table, r := range rs.sessions {
+		lens[table] = r.Len()
+	}
+	return lens
 }
 
 // ResizeRaw resizes the raw packet ring with smooth migration
@@ -183,25 +180,15 @@ func (rs *RingSet) ResizeRaw(newCap int) {
 	rs.raw = rs.raw.Resize(newCap)
 }
 
-// ResizeDNS resizes the DNS session ring
-func (rs *RingSet) ResizeDNS(newCap int) {
-	rs.mu.Lock()
-	defer rs.mu.Unlock()
-	rs.dns = rs.dns.Resize(newCap)
-}
-
-// ResizeHTTP resizes the HTTP session ring
-func (rs *RingSet) ResizeHTTP(newCap int) {
-	rs.mu.Lock()
-	defer rs.mu.Unlock()
-	rs.http = rs.http.Resize(newCap)
-}
-
-// ResizeICMP resizes the ICMP session ring
-func (rs *RingSet) ResizeICMP(newCap int) {
+// ResizeSession resizes the session ring of a table, 不存在时创建
+func (rs *RingSet) ResizeSession(table string, newCap int) {
 	rs.mu.Lock()
 	defer rs.mu.Unlock()
-	rs.icmp = rs.icmp.Resize(newCap)
+	if r, ok := rs.sessions[table]; ok {
+		rs.sessions[table] = r.Resize(newCap)
+	} else {
+		rs.sessions[table] = New(newCap)
+	}
 }
 
 // ClearAll clears all ring buffers
@@ -209,8 +196,7 @@ func (rs *RingSet) ClearAll() {
 	rs.mu.Lock()
 	defer rs.mu.Unlock()
 	rs.raw.Clear()
-	rs.dns.Clear()
-	rs.http.Clear()
-	rs.icmp.Clear()
+	for _, r := range rs.sessions {
+		r.Clear()
+	}
 }
-
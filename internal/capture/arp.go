@@ -0,0 +1,73 @@
+package capture
+
+import (
+	"fmt"
+	"time"
+
+	"sniffer/internal/parser"
+	"sniffer/pkg/model"
+)
+
+// ARP alert rule names and levels, 由 ARP 监测产生，不对应 alert_rules 中的规则（rule_id 为 0）
+var arpAlerts = map[string]struct{ name, level string }{
+	parser.ARPEventFlood:         {"免费 ARP 泛洪", "warning"},
+	parser.ARPEventConflict:      {"IP 地址冲突", "warning"},
+	parser.ARPEventGatewayChange: {"网关 MAC 变更", "critical"},
+}
+
+// observeARP feeds an ARP packet to the monitor and keeps the events for the alert stage
+func (c *Capture) observeARP(job *packetJob) {
+	if c.arp == nil || job.pkt.Protocol != "ARP" {
+		return
+	}
+	msg, err := parser.ParseARP(job.pkt)
+	if err != nil {
+		return
+	}
+	job.arpEvents = c.arp.Observe(job.pkt, msg)
+}
+
+// alertARP raises an alert for each suspicious ARP event
+// 同一 IP 的同类未确认告警只累加触发次数
+func (c *Capture) alertARP(events []parser.ARPEvent) {
+	for _, ev := range events {
+		alert := arpAlerts[ev.Kind]
+
+		var details string
+		switch ev.Kind {
+		case parser.ARPEventFlood:
+			details = fmt.Sprintf("MAC %s 在短时间内发送 %d 个免费 ARP (声明 %s)", ev.MAC, ev.Count, ev.IP)
+		case parser.ARPEventConflict:
+			details = fmt.Sprintf("IP %s 同时被 %s 和 %s 声明，可能存在 ARP 欺骗", ev.IP, ev.PreviousMAC, ev.MAC)
+		case parser.ARPEventGatewayChange:
+			details = fmt.Sprintf("网关 %s 的 MAC 由 %s 变为 %s，可能存在 ARP 欺骗", ev.IP, ev.PreviousMAC, ev.MAC)
+		}
+		if ev.Interface != "" {
+			details += fmt.Sprintf(", 网卡: %s", ev.Interface)
+		}
+		if ev.VLANID != 0 {
+			details += fmt.Sprintf(", VLAN: %d", ev.VLANID)
+		}
+
+		log := &model.AlertLog{
+			RuleName:    alert.name,
+			RuleType:    "arp",
+			AlertLevel:  alert.level,
+			TriggeredAt: time.Now(),
+			SrcIP:       ev.IP,
+			Protocol:    "ARP",
+			Details:     details,
+		}
+		if err := c.store.GetDB().CreateAlertLog(log); err != nil {
+			fmt.Printf("Warning: failed to create ARP alert: %v\n", err)
+		}
+	}
+}
+
+// GetARPTable returns the IP-MAC bindings learned from ARP traffic
+func (c *Capture) GetARPTable() []model.ARPEntry {
+	if c.arp == nil {
+		return []model.ARPEntry{}
+	}
+	return c.arp.Entries()
+}
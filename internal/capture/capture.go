@@ -4,6 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -32,12 +37,19 @@ type Capture struct {
 	rings  *cache.RingSet
 
 	// Runtime state
-	handle        netio.Handle
-	interfaceName string
-	isRunning     atomic.Bool
-	isPaused      atomic.Bool
-	ctx           context.Context
-	cancel        context.CancelFunc
+	sources   map[string]*captureSource // 按网卡名索引的抓包源
+	isRunning atomic.Bool
+	isPaused  atomic.Bool
+	ctx       context.Context // 抓包会话上下文，首个抓包源启动时创建
+	cancel    context.CancelFunc
+
+	// 离线回放状态
+	replay         *netio.FileHandle
+	replayStarted  time.Time
+	replayEnded    *time.Time
+	replayFinished bool // 文件已完整回放
+	replayErr      error
+	replayDone     chan struct{}
 
 	// Metrics
 	packetsTotal   atomic.Int64
@@ -47,6 +59,39 @@ type Capture struct {
 	lastPackets    int64
 	lastBytes      int64
 	metricsC       chan model.Metrics
+
+	// 数据包处理流水线
+	pipeline *pipeline
+
+	// 告警快照（触发前缓冲 + 触发后录制）
+	snapshots *snapshotter
+
+	// 自动停止条件与会话状态
+	stop sessionStop
+
+	// 过载采样
+	sampler *sampler
+
+	// TCP 流重组（关闭时为 nil）
+	reassembler *parser.Reassembler
+
+	// IP 分片重组，解码协程共用（关闭时为 nil）
+	defrag *parser.Defragmenter
+
+	// DNS 查询与响应配对（关闭时为 nil）
+	dnsTracker *parser.DNSTracker
+
+	// ICMP 回显配对与路由跳发现（关闭时为 nil）
+	icmpTracker *parser.ICMPTracker
+
+	// 载荷特征识别应用层协议（按流缓存）
+	classifier *parser.Classifier
+
+	// ARP 表与欺骗检测（关闭时为 nil）
+	arp *parser.ARPMonitor
+
+	// 注册的协议解析器共享的状态（DNS 配对、QUIC 解密、TCP 重组）
+	dissectCtx *parser.DissectContext
 	
 	// 进程映射器 (100%准确方案)
 	processMapper  *process.ProcessMapper
@@ -60,56 +105,197 @@ func New(cfg *config.Config, s store.Store) *Capture {
 	// 获取数据库连接
 	db := s.GetDB().GetRawDB()
 	
-	return &Capture{
+	c := &Capture{
 		cfg:           cfg,
 		store:         s,
-		rings:         cache.NewRingSet(limits.RawMax, limits.DNSMax, limits.HTTPMax, limits.ICMPMax),
+		rings:         cache.NewRingSet(limits.RawMax, sessionRingCaps(limits)),
+		sources:       make(map[string]*captureSource),
 		lastMetrics:   time.Now(),
 		metricsC:      make(chan model.Metrics, 10),
 		processMapper: process.NewProcessMapper(),                // 初始化进程映射器
 		processStats:  process.NewProcessStatsManager(db),        // 初始化进程统计
+		classifier:    parser.NewClassifier(),
+	}
+	// 解码协程创建时取得分片重组器，需在流水线之前创建
+	if dc, maxMemory, timeout := cfg.GetDefrag(); dc.Enabled {
+		c.defrag = parser.NewDefragmenter(parser.DefragOptions{
+			MaxMemory:    int(maxMemory),
+			MaxFragments: dc.MaxFragments,
+			Timeout:      timeout,
+		})
 	}
+	c.pipeline = newPipeline(c, cfg.GetPipeline())
+
+	samplingCfg, cooldown := cfg.GetSampling()
+	c.sampler = newSampler(samplingCfg, cooldown)
+
+	if rc, maxBuffer, timeout := cfg.GetReassembly(); rc.Enabled {
+		c.reassembler = parser.NewReassembler(parser.ReassemblyOptions{
+			MaxPagesTotal:   rc.MaxPagesTotal,
+			MaxPagesPerConn: rc.MaxPagesPerConn,
+			MaxBuffer:       int(maxBuffer),
+			Timeout:         timeout,
+		})
+	}
+
+	if dc, timeout := cfg.GetDNS(); dc.Correlate {
+		c.dnsTracker = parser.NewDNSTracker(parser.DNSTrackerOptions{
+			Timeout:    timeout,
+			MaxPending: dc.MaxPending,
+		})
+	}
+	if ic, timeout := cfg.GetICMP(); ic.Correlate {
+		c.icmpTracker = parser.NewICMPTracker(parser.ICMPTrackerOptions{
+			Timeout:         timeout,
+			MaxPending:      ic.MaxPending,
+			MaxDestinations: ic.MaxDestinations,
+		})
+	}
+	if ac, conflict, floodWindow := cfg.GetARP(); ac.Enabled {
+		c.arp = parser.NewARPMonitor(parser.ARPMonitorOptions{
+			Gateways:       ac.Gateways,
+			ConflictWindow: conflict,
+			FloodThreshold: ac.FloodThreshold,
+			FloodWindow:    floodWindow,
+			MaxEntries:     ac.MaxEntries,
+		})
+	}
+	// QUIC Initial 包解密（ClientHello 可能跨多个数据包）
+	c.dissectCtx = &parser.DissectContext{
+		DNSTracker:  c.dnsTracker,
+		ICMPTracker: c.icmpTracker,
+		QUICTracker: parser.NewQUICTracker(),
+		Reassembler: c.reassembler,
+	}
+
+	snapshotCfg, window := cfg.GetSnapshot()
+	c.snapshots = newSnapshotter(s.GetDB(), snapshotCfg, window)
+	s.GetDB().SetAlertHandler(c.snapshots.trigger)
+
+	return c
 }
 
 // Start starts packet capture on the specified interface
-func (c *Capture) Start(iface string) error {
-	if c.isRunning.Load() {
-		return ErrAlreadyRunning
+// 可多次调用以同时抓取多个网卡，每个网卡拥有独立的句柄和过滤器
+// filter 为BPF过滤表达式，为空表示不过滤
+// stop 为会话的自动停止条件，向运行中的会话添加网卡时非零条件会替换原有条件
+func (c *Capture) Start(iface, filter string, stop model.StopConditions) error {
+	if err := validateStopConditions(stop); err != nil {
+		return err
 	}
 
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	// Open interface
-	handle, err := netio.Open(iface, int32(c.cfg.SnapshotLen), c.cfg.Promiscuous, int(c.cfg.GetTimeout()))
+	if _, ok := c.sources[iface]; ok {
+		return fmt.Errorf("%w: %s", ErrAlreadyRunning, iface)
+	}
+	// 离线回放期间不允许叠加实时抓包
+	if c.replay != nil && c.replayEnded == nil {
+		return fmt.Errorf("%w: replay in progress", ErrAlreadyRunning)
+	}
+
+	// Open interface (pcap 或 afpacket，由配置决定)
+	handles, err := c.openInterface(iface)
 	if err != nil {
 		return fmt.Errorf("open interface: %w", err)
 	}
 
-	c.handle = handle
-	c.interfaceName = iface
-	c.ctx, c.cancel = context.WithCancel(context.Background())
-	c.isRunning.Store(true)
-	c.isPaused.Store(false)
+	// 过滤器按网卡的链路层类型编译（如 any 网卡为 SLL / SLL2），只能在打开后校验
+	for _, handle := range handles {
+		if err := handle.SetBPFFilter(filter); err != nil {
+			closeHandles(handles)
+			return err
+		}
+	}
+
+	c.addSourceLocked(iface, c.cfg.GetBackend(), handles, filter)
+	if stop != (model.StopConditions{}) {
+		c.setStopConditionsLocked(stop)
+	}
 
-	// Reset metrics
-	c.packetsTotal.Store(0)
-	c.packetsDropped.Store(0)
-	c.bytesTotal.Store(0)
-	c.lastMetrics = time.Now()
-	c.lastPackets = 0
-	c.lastBytes = 0
+	return nil
+}
+
+// StartFromFile replays a saved .pcap / .pcap.gz / pcapng file through the capture pipeline
+// speed <= 0 回放尽可能快, 1 按原始时序, >1 按倍速加速
+// 回放使用配置中的默认过滤器（bpf_filter），且不能与实时抓包同时进行
+func (c *Capture) StartFromFile(path string, speed float64) error {
+	if speed < 0 || math.IsNaN(speed) {
+		return fmt.Errorf("invalid replay speed: %v", speed)
+	}
 
-	// Start capture goroutine
-	go c.captureLoop()
+	filter := c.cfg.GetBPFFilter()
 
-	// Start metrics goroutine
-	go c.metricsLoop()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// 与 Start 在同一把锁下检查，避免并发启动时同时通过检查
+	if len(c.sources) > 0 {
+		return ErrAlreadyRunning
+	}
+
+	handle, err := netio.OpenFile(path, speed)
+	if err != nil {
+		return fmt.Errorf("open capture file: %w", err)
+	}
+
+	// 过滤器按文件的链路层类型编译
+	if err := handle.SetBPFFilter(filter); err != nil {
+		handle.Close()
+		return err
+	}
+
+	c.replay = handle
+	c.replayStarted = time.Now()
+	c.replayEnded = nil
+	c.replayFinished = false
+	c.replayErr = nil
+	c.replayDone = make(chan struct{})
+	c.addSourceLocked("file:"+filepath.Base(path), "file", []netio.Handle{handle}, filter)
 
 	return nil
 }
 
-// Stop stops packet capture
+// addSourceLocked registers the opened handles and starts a capture loop per handle (c.mu must be held)
+func (c *Capture) addSourceLocked(name, backend string, handles []netio.Handle, filter string) {
+	// 首个抓包源：开启新的抓包会话并重置汇总指标
+	if len(c.sources) == 0 {
+		c.ctx, c.cancel = context.WithCancel(context.Background())
+		c.isRunning.Store(true)
+		c.isPaused.Store(false)
+
+		// Reset metrics
+		c.packetsTotal.Store(0)
+		c.packetsDropped.Store(0)
+		c.bytesTotal.Store(0)
+		c.lastMetrics = time.Now()
+		c.lastPackets = 0
+		c.lastBytes = 0
+		c.resetStopLocked()
+		c.sampler.reset()
+
+		// Start metrics goroutine
+		go c.metricsLoop(c.ctx)
+		if c.reassembler != nil {
+			go c.reassemblyLoop(c.ctx)
+		}
+		if c.dnsTracker != nil {
+			go c.dnsLoop(c.ctx)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(c.ctx)
+	src := newCaptureSource(name, backend, handles, filter, cancel)
+	c.sources[name] = src
+
+	// Start capture goroutines
+	for _, handle := range handles {
+		go c.captureLoop(ctx, src, handle)
+	}
+}
+
+// Stop stops packet capture on all interfaces
 func (c *Capture) Stop() error {
 	if !c.isRunning.Load() {
 		return ErrNotRunning
@@ -118,16 +304,170 @@ func (c *Capture) Stop() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	for _, src := range c.sources {
+		c.removeSourceLocked(src)
+	}
+	c.stopSessionLocked(model.StopReasonManual)
+
+	return nil
+}
+
+// StopInterface stops packet capture on a single interface, leaving the others running
+func (c *Capture) StopInterface(iface string) error {
+	return c.StopInterfaceWithReason(iface, model.StopReasonManual)
+}
+
+// StopInterfaceWithReason stops a single interface and records the reason if the session ends
+func (c *Capture) StopInterfaceWithReason(iface, reason string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	src, ok := c.sources[iface]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotRunning, iface)
+	}
+
+	c.removeSourceLocked(src)
+	if len(c.sources) == 0 {
+		c.stopSessionLocked(reason)
+	}
+
+	return nil
+}
+
+// removeSourceLocked stops a capture source and closes its handles (c.mu must be held)
+func (c *Capture) removeSourceLocked(src *captureSource) {
+	src.cancel()
+	src.close()
+	delete(c.sources, src.name)
+
+	// 回放结束（完成或被手动停止）
+	if c.replay != nil && netio.Handle(c.replay) == src.handles[0] && c.replayEnded == nil {
+		now := time.Now()
+		c.replayEnded = &now
+		close(c.replayDone)
+	}
+}
+
+// stopSessionLocked ends the capture session after the last source stopped (c.mu must be held)
+func (c *Capture) stopSessionLocked(reason string) {
 	c.isRunning.Store(false)
 	c.isPaused.Store(false)
 
 	if c.cancel != nil {
 		c.cancel()
 	}
+	c.endStopLocked(reason)
+
+	// 结束进行中的告警快照录制
+	c.snapshots.finishAll()
+
+	// 结束所有重组中的连接，输出未完成的消息
+	if c.reassembler != nil {
+		go c.handleFlushedSessions(c.reassembler.FlushAll())
+	}
+	// 输出仍在等待响应的 DNS 查询
+	if c.dnsTracker != nil {
+		go c.handleFlushedSessions(c.dnsTracker.FlushAll())
+	}
+	c.classifier.Reset()
+}
+
+// finishReplay is called by the capture loop when the replayed file is exhausted
+// 等待已读取的数据包全部处理完（解码、富化、持久化和告警）后再结束回放
+func (c *Capture) finishReplay(src *captureSource, err error) {
+	src.inflight.Wait()
+
+	c.mu.Lock()
+	c.replayFinished = err == nil
+	c.replayErr = err
+	c.mu.Unlock()
 
-	if c.handle != nil {
-		c.handle.Close()
-		c.handle = nil
+	reason := model.StopReasonReplay
+	if err != nil {
+		fmt.Printf("[Replay] stopped with error: %v\n", err)
+		reason = model.StopReasonError
+	}
+
+	_ = c.StopInterfaceWithReason(src.name, reason)
+}
+
+// ReplayDone returns a channel that is closed when the current replay completes or is stopped
+// 非回放模式下返回 nil
+func (c *Capture) ReplayDone() <-chan struct{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.replayDone
+}
+
+// GetReplayStatus returns the progress of the current (or last) offline replay
+func (c *Capture) GetReplayStatus() model.ReplayStatus {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.replay == nil {
+		return model.ReplayStatus{}
+	}
+
+	packets, readBytes, totalBytes := c.replay.Progress()
+	status := model.ReplayStatus{
+		Path:        c.replay.Path(),
+		Speed:       c.replay.Speed(),
+		Running:     c.replayEnded == nil,
+		Done:        c.replayFinished,
+		PacketsRead: packets,
+		BytesRead:   readBytes,
+		TotalBytes:  totalBytes,
+		StartedAt:   c.replayStarted,
+		FinishedAt:  c.replayEnded,
+	}
+	if totalBytes > 0 {
+		status.Progress = float64(readBytes) / float64(totalBytes) * 100
+	}
+	if c.replayFinished {
+		status.Progress = 100
+	}
+	if c.replayErr != nil {
+		status.Error = c.replayErr.Error()
+	}
+
+	return status
+}
+
+// SetFilter changes the BPF filter of all running interfaces without restarting them
+func (c *Capture) SetFilter(filter string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// 先按各网卡的链路层类型校验，避免部分网卡已更新后才失败
+	for _, src := range c.sources {
+		if err := src.validateFilter(filter, c.cfg.SnapshotLen); err != nil {
+			return fmt.Errorf("%s: %w", src.name, err)
+		}
+	}
+	for _, src := range c.sources {
+		if err := src.setFilter(filter); err != nil {
+			return fmt.Errorf("%s: %w", src.name, err)
+		}
+	}
+
+	return nil
+}
+
+// SetInterfaceFilter changes the BPF filter of a single running interface
+func (c *Capture) SetInterfaceFilter(iface, filter string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	src, ok := c.sources[iface]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotRunning, iface)
+	}
+	if err := src.validateFilter(filter, c.cfg.SnapshotLen); err != nil {
+		return err
+	}
+	if err := src.setFilter(filter); err != nil {
+		return err
 	}
 
 	return nil
@@ -153,11 +493,37 @@ func (c *Capture) IsPaused() bool {
 	return c.isPaused.Load()
 }
 
-// GetInterfaceName returns the current interface name
+// GetInterfaceName returns the names of all capturing interfaces, comma separated
 func (c *Capture) GetInterfaceName() string {
+	return strings.Join(c.GetInterfaceNames(), ",")
+}
+
+// GetInterfaceNames returns the names of all capturing interfaces
+func (c *Capture) GetInterfaceNames() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	names := make([]string, 0, len(c.sources))
+	for name := range c.sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetCaptureSettings returns the effective handle settings of all capturing interfaces
+func (c *Capture) GetCaptureSettings() []model.CaptureSettings {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	return c.interfaceName
+
+	settings := make([]model.CaptureSettings, 0, len(c.sources))
+	for _, src := range c.sources {
+		settings = append(settings, src.settings())
+	}
+	sort.Slice(settings, func(i, j int) bool {
+		return settings[i].Interface < settings[j].Interface
+	})
+	return settings
 }
 
 // StreamMetrics returns a channel for streaming metrics
@@ -170,18 +536,13 @@ func (c *Capture) Snapshot(table model.TableType) []interface{} {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	switch table {
-	case model.TableRaw:
+	if table == model.TableRaw {
 		return c.rings.GetRaw().Snapshot()
-	case model.TableDNS:
-		return c.rings.GetDNS().Snapshot()
-	case model.TableHTTP:
-		return c.rings.GetHTTP().Snapshot()
-	case model.TableICMP:
-		return c.rings.GetICMP().Snapshot()
-	default:
-		return nil
 	}
+	if ring := c.rings.GetSession(string(table)); ring != nil {
+		return ring.Snapshot()
+	}
+	return nil
 }
 
 // UpdateLimits updates the ring buffer limits with smooth migration
@@ -190,18 +551,20 @@ func (c *Capture) UpdateLimits(limits config.Limits) {
 	defer c.mu.Unlock()
 
 	c.rings.ResizeRaw(limits.RawMax)
-	c.rings.ResizeDNS(limits.DNSMax)
-	c.rings.ResizeHTTP(limits.HTTPMax)
-	c.rings.ResizeICMP(limits.ICMPMax)
+	for table, capacity := range sessionRingCaps(limits) {
+		c.rings.ResizeSession(table, capacity)
+	}
 
 	c.cfg.UpdateLimits(limits)
 }
 
-// captureLoop is the main packet capture loop
-func (c *Capture) captureLoop() {
+// captureLoop is the main packet capture loop of a single handle of a capture source
+func (c *Capture) captureLoop(ctx context.Context, src *captureSource, handle netio.Handle) {
+	_, isReplay := handle.(*netio.FileHandle)
+
 	for {
 		select {
-		case <-c.ctx.Done():
+		case <-ctx.Done():
 			return
 		default:
 		}
@@ -213,203 +576,84 @@ func (c *Capture) captureLoop() {
 		}
 
 		// Read packet
-		data, ci, err := c.handle.ReadPacketData()
+		data, ci, err := handle.ReadPacketData()
 		if err != nil {
 			// Check if it's a timeout or actual error
 			if errors.Is(err, context.Canceled) {
 				return
 			}
+			// 离线回放：文件读完或出错即结束
+			if isReplay {
+				if errors.Is(err, netio.ErrHandleClosed) {
+					return
+				}
+				if errors.Is(err, io.EOF) {
+					err = nil
+				}
+				c.finishReplay(src, err)
+				return
+			}
 			// Timeout is normal, continue
 			continue
 		}
 
 		// Update metrics
-		c.packetsTotal.Add(1)
-		c.bytesTotal.Add(int64(ci.Length))
-
-		// Parse packet
-		timestamp := time.Unix(0, ci.Timestamp)
-		pkt, err := parser.ParsePacket(data, timestamp)
-		if err != nil {
-			continue
-		}
-
-		pkt.CaptureLen = ci.CaptureLength
-		pkt.Length = ci.Length
-
-		// ========== 100%准确进程关联 ==========
-		// 方案1: 优先使用完整五元组进行精确匹配
-		if pkt.Protocol == "TCP" || pkt.Protocol == "UDP" {
-			// 判断数据包方向（入站/出站）
-			srcIsLocal := process.IsLocalIP(pkt.SrcIP)
-			dstIsLocal := process.IsLocalIP(pkt.DstIP)
-			
-			if srcIsLocal || dstIsLocal {
-				// 尝试完整五元组匹配（最准确）
-				if pid, procInfo, ok := c.processMapper.GetPIDByConnection(
-					pkt.Protocol,
-					pkt.SrcIP,
-					pkt.DstIP,
-					uint32(pkt.SrcPort),
-					uint32(pkt.DstPort),
-				); ok {
-					pkt.ProcessPID = pid
-					if procInfo != nil {
-						pkt.ProcessName = procInfo.Name
-						pkt.ProcessExe = procInfo.Exe
-						
-						// 记录进程统计（性能优化：仅更新内存）
-						c.processStats.RecordPacket(pid, procInfo, srcIsLocal, pkt.Length)
-					}
-				} else {
-					// 方案2: 五元组失败，使用本地端口匹配
-					localPort := uint32(pkt.SrcPort)
-					if dstIsLocal {
-						localPort = uint32(pkt.DstPort)
-					}
-					
-					if pid, procInfo, ok := c.processMapper.GetPIDByPort(pkt.Protocol, localPort); ok {
-						pkt.ProcessPID = pid
-						if procInfo != nil {
-							pkt.ProcessName = procInfo.Name
-							pkt.ProcessExe = procInfo.Exe
-							
-							// 记录进程统计
-							c.processStats.RecordPacket(pid, procInfo, srcIsLocal, pkt.Length)
-						}
-					}
-				}
-			}
-		}
-		// ICMP等其他协议：根据源IP判断
-		if pkt.ProcessPID == 0 && pkt.Protocol == "ICMP" {
-			if process.IsLocalIP(pkt.SrcIP) {
-				// ICMP通常由系统进程或特定应用发出
-				// 可以尝试通过ICMP ID字段进一步关联，这里简化处理
-			}
+		packets := c.packetsTotal.Add(1)
+		bytes := c.bytesTotal.Add(int64(ci.Length))
+		src.packetsTotal.Add(1)
+		src.bytesTotal.Add(int64(ci.Length))
+
+		// 交给处理流水线（解码 -> 富化 -> 持久化 / 告警）
+		// 1/N 采样在解码前进行，离线回放不采样
+		job := &packetJob{data: data, ci: ci, iface: src.name, lossless: isReplay, sampleRate: 1}
+		job.hash = parser.FlowHash(data, ci.LinkType)
+		keep := true
+		if isReplay {
+			job.track(&src.inflight)
+		} else {
+			job.sampleRate, keep = c.sampler.keepCount()
 		}
-		// ========== 进程关联结束 ==========
-
-		// Store raw packet
-		c.rings.GetRaw().Push(pkt)
-		
-		// Write to persistent storage (non-blocking)
-		go func(p *model.Packet) {
-			if err := c.store.WriteRaw(p); err != nil {
-				// Log error but don't stop capture
-				fmt.Printf("Error writing raw packet: %v\n", err)
-			}
-		}(pkt)
-
-		// 实时更新会话流统计（异步）
-		go func(p *model.Packet) {
-			sqliteStore := c.store.GetDB()
-			if err := sqliteStore.UpsertSessionFlow(p); err != nil {
-				// 不打印太多日志，避免影响性能
-				if c.packetsTotal.Load()%1000 == 0 {
-					fmt.Printf("[WARN] Session flow upsert failed: %v\n", err)
-				}
-			}
-		}(pkt)
-
-		// Try to parse as DNS (立即持久化)
-		if dnsSession, err := parser.ParseDNS(pkt); err == nil {
-			// 先写入环形缓冲区（用于实时显示）
-			c.rings.GetDNS().Push(dnsSession)
-			
-			// 立即异步写入数据库（永久保存）
-			go func(s *model.Session) {
-				startTime := time.Now()
-				if err := c.store.WriteSession(model.TableDNS, s); err != nil {
-					// 只在失败时打印错误
-					fmt.Printf("[ERROR] ❌ DNS写入数据库失败: %v | domain=%s\n", err, s.Domain)
-				} else {
-					duration := time.Since(startTime)
-					// 只在写入慢时打印警告
-					if duration > 100*time.Millisecond {
-						fmt.Printf("[WARN] DNS写入慢: %v | domain=%s\n", duration, s.Domain)
-					}
-				}
-			}(dnsSession)
-			
-			// 检查告警规则
-			go func(p *model.Packet, s *model.Session) {
-				sqliteStore := c.store.GetDB()
-				if err := sqliteStore.CheckAlertRules(p, s); err != nil {
-					// 忽略告警检查错误，不影响主流程
-				}
-			}(pkt, dnsSession)
-		}
-
-		// Try to parse as HTTP (立即持久化)
-		if httpSession, err := parser.ParseHTTP(pkt); err == nil {
-			// 先写入环形缓冲区
-			c.rings.GetHTTP().Push(httpSession)
-			
-			// 立即异步写入数据库
-			go func(s *model.Session) {
-				startTime := time.Now()
-				if err := c.store.WriteSession(model.TableHTTP, s); err != nil {
-					fmt.Printf("[ERROR] HTTP写入失败: %v | method=%s, host=%s\n", err, s.Method, s.Host)
-				} else {
-					duration := time.Since(startTime)
-					if duration > 100*time.Millisecond {
-						fmt.Printf("[WARN] HTTP写入慢: %v | host=%s\n", duration, s.Host)
-					}
-				}
-			}(httpSession)
-			
-			// 检查告警规则
-			go func(p *model.Packet, s *model.Session) {
-				sqliteStore := c.store.GetDB()
-				sqliteStore.CheckAlertRules(p, s)
-			}(pkt, httpSession)
+		if keep {
+			c.pipeline.decode.push(job)
 		}
 
-		// Try to parse as ICMP (立即持久化)
-		if icmpSession, err := parser.ParseICMP(pkt); err == nil {
-			// 先写入环形缓冲区
-			c.rings.GetICMP().Push(icmpSession)
-			
-			// 立即异步写入数据库
-			go func(s *model.Session) {
-				startTime := time.Now()
-				if err := c.store.WriteSession(model.TableICMP, s); err != nil {
-					fmt.Printf("[ERROR] ICMP写入失败: %v | type=%s, src=%s\n", err, s.ICMPType, s.FiveTuple.SrcIP)
-				} else {
-					duration := time.Since(startTime)
-					if duration > 100*time.Millisecond {
-						fmt.Printf("[WARN] ICMP写入慢: %v | src=%s\n", duration, s.FiveTuple.SrcIP)
-					}
-				}
-			}(icmpSession)
-			
-			// 检查告警规则
-			go func(p *model.Packet, s *model.Session) {
-				sqliteStore := c.store.GetDB()
-				sqliteStore.CheckAlertRules(p, s)
-			}(pkt, icmpSession)
+		// 达到数据包数或字节数停止条件
+		if reason := c.stop.checkCounters(packets, bytes); reason != "" {
+			c.autoStop(reason)
+			return
 		}
-		
-		// 检查目标IP告警（对所有数据包）
-		go func(p *model.Packet) {
-			sqliteStore := c.store.GetDB()
-			sqliteStore.CheckAlertRules(p, nil)
-		}(pkt)
 	}
 }
 
 // metricsLoop periodically calculates and sends metrics
-func (c *Capture) metricsLoop() {
+func (c *Capture) metricsLoop(ctx context.Context) {
 	ticker := time.NewTicker(1 * time.Second)
 	defer ticker.Stop()
 
 	for {
 		select {
-		case <-c.ctx.Done():
+		case <-ctx.Done():
 			return
 		case <-ticker.C:
+			// 达到文件数停止条件
+			if files := c.stop.files.Load(); files > 0 && c.store.FilesCreated()-c.stop.filesBase.Load() >= files {
+				c.autoStop(model.StopReasonFiles)
+				return
+			}
+
 			metrics := c.calculateMetrics()
+
+			// 自动采样：根据队列占用率和丢包数开启或关闭
+			var queueFill float64
+			drops := metrics.PacketsDropped
+			for _, st := range metrics.Pipeline {
+				if st.QueueSize > 0 {
+					queueFill = max(queueFill, float64(st.QueueDepth)/float64(st.QueueSize))
+				}
+				drops += st.Dropped
+			}
+			c.sampler.evaluate(metrics.Timestamp, queueFill, drops)
+			metrics.Sampling = c.sampler.status()
 			
 			// Non-blocking send
 			select {
@@ -421,10 +665,10 @@ func (c *Capture) metricsLoop() {
 	}
 }
 
-// calculateMetrics calculates current metrics
+// calculateMetrics calculates current metrics (aggregate and per interface)
 func (c *Capture) calculateMetrics() model.Metrics {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
 	now := time.Now()
 	elapsed := now.Sub(c.lastMetrics).Seconds()
@@ -442,29 +686,65 @@ func (c *Capture) calculateMetrics() model.Metrics {
 	c.lastPackets = currentPackets
 	c.lastBytes = currentBytes
 
-	// Get dropped packets from handle
+	// Per-interface metrics, dropped packets are summed from each handle
 	var dropped int64
-	if c.handle != nil {
-		if stats, err := c.handle.Stats(); err == nil {
-			dropped = int64(stats.PacketsDropped)
+	names := make([]string, 0, len(c.sources))
+	for name := range c.sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	interfaces := make([]model.InterfaceMetrics, 0, len(names))
+	for _, name := range names {
+		im := c.sources[name].calculateMetrics(now)
+		dropped += im.PacketsDropped
+		interfaces = append(interfaces, im)
+	}
+
+	// 各网卡过滤器一致时才在汇总中展示
+	var filter string
+	for i, im := range interfaces {
+		if i == 0 {
+			filter = im.BPFFilter
+		} else if im.BPFFilter != filter {
+			filter = ""
+			break
 		}
 	}
 
-	return model.Metrics{
+	metrics := model.Metrics{
 		Timestamp:      now,
-		Interface:      c.interfaceName,
+		Interface:      strings.Join(names, ","),
 		IsCapturing:    c.isRunning.Load(),
 		IsPaused:       c.isPaused.Load(),
+		BPFFilter:      filter,
 		PacketsTotal:   currentPackets,
 		PacketsDropped: dropped,
 		BytesTotal:     currentBytes,
 		PacketsPerSec:  pps,
 		BytesPerSec:    bps,
 		RawCount:       c.rings.GetRaw().Len(),
-		DNSCount:       c.rings.GetDNS().Len(),
-		HTTPCount:      c.rings.GetHTTP().Len(),
-		ICMPCount:      c.rings.GetICMP().Len(),
+		SessionCounts:  make(map[model.TableType]int),
+		Interfaces:     interfaces,
+		Pipeline:       c.pipeline.metrics(),
+		Sampling:       c.sampler.status(),
+	}
+	for table, n := range c.rings.SessionLens() {
+		metrics.SessionCounts[model.TableType(table)] = n
+	}
+	metrics.DNSCount = metrics.SessionCounts[model.TableDNS]
+	metrics.HTTPCount = metrics.SessionCounts[model.TableHTTP]
+	metrics.ICMPCount = metrics.SessionCounts[model.TableICMP]
+	if c.reassembler != nil {
+		metrics.Reassembly = c.reassembler.Stats()
+	}
+	if c.defrag != nil {
+		metrics.Defrag = c.defrag.Stats()
+	}
+	if c.dnsTracker != nil {
+		metrics.DNSTracker = c.dnsTracker.Stats()
 	}
+	return metrics
 }
 
 // GetMetrics returns the current metrics snapshot
@@ -474,10 +754,8 @@ func (c *Capture) GetMetrics() model.Metrics {
 
 // ClearAll clears all ring buffers
 func (c *Capture) ClearAll() {
-	c.rings.GetRaw().Clear()
-	c.rings.GetDNS().Clear()
-	c.rings.GetHTTP().Clear()
-	c.rings.GetICMP().Clear()
+	c.rings.ClearAll()
+	c.snapshots.clear()
 }
 
 // GetProcessStats 获取进程统计（代理到ProcessStatsManager）
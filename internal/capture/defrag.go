@@ -0,0 +1,59 @@
+package capture
+
+import (
+	"fmt"
+	"time"
+
+	"sniffer/internal/parser"
+	"sniffer/pkg/model"
+)
+
+// defragEvents copies the overlapping fragments found while decoding the packet for the alert stage
+// 解码器的事件切片在下次解码时复用
+func (c *Capture) defragEvents(d *parser.Decoder, pkt *model.Packet) []parser.DefragEvent {
+	found := d.DefragEvents()
+	if len(found) == 0 {
+		return nil
+	}
+	events := make([]parser.DefragEvent, len(found))
+	for i, ev := range found {
+		ev.VLANID = pkt.VLANID
+		ev.Interface = pkt.Interface
+		events[i] = ev
+	}
+	return events
+}
+
+// alertDefrag raises an alert for each overlapping fragment
+// 由分片重组产生，不对应 alert_rules 中的规则（rule_id 为 0）；重叠部分内容不一致时为严重告警
+func (c *Capture) alertDefrag(events []parser.DefragEvent) {
+	for _, ev := range events {
+		level := "warning"
+		details := fmt.Sprintf("%s -> %s 的 %s 分片 (标识 %d, 偏移 %d, 长度 %d) 与已收到的分片重叠",
+			ev.SrcIP, ev.DstIP, ev.Protocol, ev.ID, ev.Offset, ev.Length)
+		if ev.Conflict {
+			level = "critical"
+			details += "，重叠部分内容不一致，可能为分片重叠攻击"
+		}
+		if ev.Interface != "" {
+			details += fmt.Sprintf(", 网卡: %s", ev.Interface)
+		}
+		if ev.VLANID != 0 {
+			details += fmt.Sprintf(", VLAN: %d", ev.VLANID)
+		}
+
+		log := &model.AlertLog{
+			RuleName:    "IP 分片重叠",
+			RuleType:    "defrag",
+			AlertLevel:  level,
+			TriggeredAt: time.Now(),
+			SrcIP:       ev.SrcIP,
+			DstIP:       ev.DstIP,
+			Protocol:    ev.Protocol,
+			Details:     details,
+		}
+		if err := c.store.GetDB().CreateAlertLog(log); err != nil {
+			fmt.Printf("Warning: failed to create fragment overlap alert: %v\n", err)
+		}
+	}
+}
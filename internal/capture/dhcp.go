@@ -0,0 +1,42 @@
+package capture
+
+import (
+	"fmt"
+	"time"
+
+	"sniffer/internal/parser"
+	"sniffer/pkg/model"
+)
+
+// rogueDHCPRuleName is the rule name of the unauthorized DHCP server alerts
+// 该告警由白名单检测产生，不对应 alert_rules 中的规则（rule_id 为 0）
+const rogueDHCPRuleName = "非法 DHCP 服务器"
+
+// checkRogueDHCP raises an alert when a DHCP server that is not on the allowlist offers or grants a lease
+func (c *Capture) checkRogueDHCP(pkt *model.Packet, session *model.Session) {
+	if session.Type != "DHCP" || !parser.IsDHCPServerReply(session) {
+		return
+	}
+	if c.cfg.GetDHCP().Allows(session.DHCPServer, session.DHCPServerMAC) {
+		return
+	}
+
+	details := fmt.Sprintf("未授权的 DHCP 服务器 %s (MAC: %s) 发送 %s", session.DHCPServer, session.DHCPServerMAC, session.DHCPMessageType)
+	if session.AssignedIP != "" {
+		details += fmt.Sprintf(", 分配地址 %s 给 %s", session.AssignedIP, session.ClientMAC)
+	}
+
+	// 同一服务器的未确认告警只累加触发次数
+	log := &model.AlertLog{
+		RuleName:    rogueDHCPRuleName,
+		RuleType:    string(model.TableDHCP),
+		AlertLevel:  "critical",
+		TriggeredAt: time.Now(),
+		SrcIP:       session.DHCPServer,
+		Protocol:    pkt.Protocol,
+		Details:     details,
+	}
+	if err := c.store.GetDB().CreateAlertLog(log); err != nil {
+		fmt.Printf("Warning: failed to create rogue DHCP alert: %v\n", err)
+	}
+}
@@ -0,0 +1,24 @@
+package capture
+
+import (
+	"context"
+	"time"
+)
+
+// dnsFlushInterval is how often unanswered DNS queries are checked
+const dnsFlushInterval = time.Second
+
+// dnsLoop periodically outputs the DNS queries that exceeded the response timeout
+func (c *Capture) dnsLoop(ctx context.Context) {
+	ticker := time.NewTicker(dnsFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.handleFlushedSessions(c.dnsTracker.Flush())
+		}
+	}
+}
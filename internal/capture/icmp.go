@@ -0,0 +1,21 @@
+package capture
+
+import (
+	"sniffer/pkg/model"
+)
+
+// GetPingStats returns the echo RTT and loss statistics per destination
+func (c *Capture) GetPingStats() []model.PingStat {
+	if c.icmpTracker == nil {
+		return []model.PingStat{}
+	}
+	return c.icmpTracker.PingStats()
+}
+
+// GetTraceRoutes returns the hops discovered from traceroute probes per destination
+func (c *Capture) GetTraceRoutes() []model.TraceRoute {
+	if c.icmpTracker == nil {
+		return []model.TraceRoute{}
+	}
+	return c.icmpTracker.TraceRoutes()
+}
@@ -0,0 +1,383 @@
+package capture
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"sniffer/internal/config"
+	"sniffer/internal/netio"
+	"sniffer/internal/parser"
+	"sniffer/internal/process"
+	"sniffer/pkg/model"
+)
+
+// packetJob carries a captured packet through the processing pipeline
+type packetJob struct {
+	data  []byte
+	ci    netio.CaptureInfo
+	iface string
+	// 离线回放的数据包不丢弃，队列满时阻塞读取
+	lossless bool
+	// 地址对的对称哈希，各阶段据此选择工作协程
+	hash uint32
+	// 1/N 采样保留的数据包代表的包数（未采样为 1）
+	sampleRate int
+
+	// 回放时统计未处理完的数据包；refs 为尚未完成的阶段数（持久化与告警并行）
+	inflight *sync.WaitGroup
+	refs     atomic.Int32
+
+	// Filled by the decode and enrich stages
+	pkt          *model.Packet
+	sessions     []sessionItem
+	arpEvents    []parser.ARPEvent
+	defragEvents []parser.DefragEvent
+}
+
+// track counts the job in the given wait group until it is released
+func (j *packetJob) track(inflight *sync.WaitGroup) {
+	inflight.Add(1)
+	j.inflight = inflight
+	j.refs.Store(1)
+}
+
+// release finishes one reference of the job: 解码失败、被采样跳过或丢弃、持久化或告警完成时调用
+func (j *packetJob) release() {
+	if j.inflight != nil && j.refs.Add(-1) == 0 {
+		j.inflight.Done()
+	}
+}
+
+// sessionItem is a protocol session parsed from a packet
+type sessionItem struct {
+	table   model.TableType
+	session *model.Session
+}
+
+// stage is a pipeline stage with a bounded queue per worker
+// 流水线阶段：每个工作协程一个有界队列，按 packetJob.hash 分派，
+// 同一连接（地址对）的数据包始终由同一协程按到达顺序处理（TCP 重组、DNS / HTTP 配对依赖顺序）
+type stage struct {
+	name      string
+	queues    []chan *packetJob
+	policy    string
+	processed atomic.Int64
+	dropped   atomic.Int64
+}
+
+func newStage(name string, cfg config.StageConfig, policy string, handle func(*packetJob)) *stage {
+	return newWorkerStage(name, cfg, policy, func() func(*packetJob) { return handle })
+}
+
+// newWorkerStage creates a stage whose workers each get their own handler
+// 每个工作协程调用一次 newHandler，可持有不能并发使用的状态（如解码器）
+// 队列长度按协程数均分
+func newWorkerStage(name string, cfg config.StageConfig, policy string, newHandler func() func(*packetJob)) *stage {
+	workers := max(cfg.Workers, 1)
+	size := (cfg.QueueSize + workers - 1) / workers
+	s := &stage{
+		name:   name,
+		queues: make([]chan *packetJob, workers),
+		policy: policy,
+	}
+	for i := range s.queues {
+		s.queues[i] = make(chan *packetJob, size)
+		go s.run(s.queues[i], newHandler())
+	}
+	return s
+}
+
+func (s *stage) run(queue chan *packetJob, handle func(*packetJob)) {
+	for job := range queue {
+		handle(job)
+		s.processed.Add(1)
+	}
+}
+
+// push enqueues a job to the queue of its flow according to the drop policy.
+// Returns false if the job was dropped.
+func (s *stage) push(job *packetJob) bool {
+	queue := s.queues[job.hash%uint32(len(s.queues))]
+	policy := s.policy
+	if job.lossless {
+		policy = config.DropBlock
+	}
+
+	switch policy {
+	case config.DropBlock:
+		queue <- job
+		return true
+
+	case config.DropOldest:
+		for {
+			select {
+			case queue <- job:
+				return true
+			default:
+			}
+			// 队列已满：丢弃最旧的任务腾出空间
+			select {
+			case old := <-queue:
+				s.dropped.Add(1)
+				old.release()
+			default:
+			}
+		}
+
+	default: // config.DropNewest
+		select {
+		case queue <- job:
+			return true
+		default:
+			s.dropped.Add(1)
+			return false
+		}
+	}
+}
+
+// metrics returns the stage metrics; 队列深度和容量为各协程队列之和
+func (s *stage) metrics() model.StageMetrics {
+	m := model.StageMetrics{
+		Name:      s.name,
+		Workers:   len(s.queues),
+		Processed: s.processed.Load(),
+		Dropped:   s.dropped.Load(),
+	}
+	for _, queue := range s.queues {
+		m.QueueDepth += len(queue)
+		m.QueueSize += cap(queue)
+	}
+	return m
+}
+
+// pipeline processes captured packets in stages: decode -> enrich -> persist / alert
+// 替代每个数据包启动多个协程的做法，过载时按丢弃策略处理并计数
+type pipeline struct {
+	decode  *stage
+	enrich  *stage
+	persist *stage
+	alert   *stage
+}
+
+// newPipeline creates the processing pipeline and starts its workers
+func newPipeline(c *Capture, cfg config.PipelineConfig) *pipeline {
+	return &pipeline{
+		decode:  newWorkerStage("decode", cfg.Decode, cfg.DropPolicy, c.newDecodeWorker),
+		enrich:  newStage("enrich", cfg.Enrich, cfg.DropPolicy, c.enrichPacket),
+		persist: newStage("persist", cfg.Persist, cfg.DropPolicy, c.persistPacket),
+		alert:   newStage("alert", cfg.Alert, cfg.DropPolicy, c.alertPacket),
+	}
+}
+
+// metrics returns the metrics of all stages in pipeline order
+func (p *pipeline) metrics() []model.StageMetrics {
+	return []model.StageMetrics{
+		p.decode.metrics(),
+		p.enrich.metrics(),
+		p.persist.metrics(),
+		p.alert.metrics(),
+	}
+}
+
+// newDecodeWorker returns the handler of a decode worker with its own decoder
+func (c *Capture) newDecodeWorker() func(*packetJob) {
+	d := parser.NewDecoder()
+	d.Defrag = c.defrag
+	return func(job *packetJob) {
+		c.decodePacket(d, job)
+	}
+}
+
+// decodePacket parses the raw packet data
+func (c *Capture) decodePacket(d *parser.Decoder, job *packetJob) {
+	timestamp := time.Unix(0, job.ci.Timestamp)
+	pkt, err := d.Decode(job.data, timestamp, job.ci.LinkType)
+	if err != nil {
+		job.release()
+		return
+	}
+
+	// 网卡卸载的 VLAN 标签（数据包中已无 802.1Q 头）
+	if pkt.VLANID == 0 && job.ci.VLANID != 0 {
+		pkt.VLANID = job.ci.VLANID
+	}
+
+	pkt.CaptureLen = job.ci.CaptureLength
+	pkt.Length = job.ci.Length
+	pkt.Interface = job.iface
+	job.pkt = pkt
+	job.defragEvents = c.defragEvents(d, pkt)
+
+	// 标记采样信息，会话流统计据此放大
+	if job.sampleRate > 1 {
+		pkt.SampleMode = config.SamplingCount
+		pkt.SampleRate = job.sampleRate
+	} else if !job.lossless {
+		rate, keep := c.sampler.keepFlow(pkt)
+		if !keep {
+			job.release()
+			return
+		}
+		if rate > 1 {
+			pkt.SampleMode = config.SamplingFlow
+			pkt.SampleRate = rate
+		}
+	}
+
+	if !c.pipeline.enrich.push(job) {
+		job.release()
+	}
+}
+
+// enrichPacket associates the packet with a process and parses protocol sessions
+func (c *Capture) enrichPacket(job *packetJob) {
+	pkt := job.pkt
+
+	// ========== 100%准确进程关联 ==========
+	// 方案1: 优先使用完整五元组进行精确匹配
+	if pkt.Protocol == "TCP" || pkt.Protocol == "UDP" {
+		// 判断数据包方向（入站/出站）
+		srcIsLocal := process.IsLocalIP(pkt.SrcIP)
+		dstIsLocal := process.IsLocalIP(pkt.DstIP)
+
+		if srcIsLocal || dstIsLocal {
+			// 尝试完整五元组匹配（最准确）
+			if pid, procInfo, ok := c.processMapper.GetPIDByConnection(
+				pkt.Protocol,
+				pkt.SrcIP,
+				pkt.DstIP,
+				uint32(pkt.SrcPort),
+				uint32(pkt.DstPort),
+			); ok {
+				pkt.ProcessPID = pid
+				if procInfo != nil {
+					pkt.ProcessName = procInfo.Name
+					pkt.ProcessExe = procInfo.Exe
+
+					// 记录进程统计（性能优化：仅更新内存）
+					c.processStats.RecordPacket(pid, procInfo, srcIsLocal, pkt.Length)
+				}
+			} else {
+				// 方案2: 五元组失败，使用本地端口匹配
+				localPort := uint32(pkt.SrcPort)
+				if dstIsLocal {
+					localPort = uint32(pkt.DstPort)
+				}
+
+				if pid, procInfo, ok := c.processMapper.GetPIDByPort(pkt.Protocol, localPort); ok {
+					pkt.ProcessPID = pid
+					if procInfo != nil {
+						pkt.ProcessName = procInfo.Name
+						pkt.ProcessExe = procInfo.Exe
+
+						// 记录进程统计
+						c.processStats.RecordPacket(pid, procInfo, srcIsLocal, pkt.Length)
+					}
+				}
+			}
+		}
+	}
+	// ========== 进程关联结束 ==========
+
+	// 按载荷识别应用层协议，解析器据此处理非标准端口上的流量，会话流统计据此记录类型
+	// 须在数据包发布到环形缓冲区之前完成，发布后其它 goroutine 会并发读取
+	cls := c.classifier.Classify(pkt)
+	pkt.AppProtocol, pkt.AppConfidence = cls.Protocol, cls.Confidence
+
+	// Store raw packet
+	c.rings.GetRaw().Push(pkt)
+	c.snapshots.observe(job.hash, pkt)
+
+	// ARP 表与欺骗检测
+	c.observeARP(job)
+
+	// 低 TTL 的 TCP/UDP 探测包，与随后的 ICMP 超时差错配对得到路由跳
+	if c.icmpTracker != nil {
+		c.icmpTracker.Probe(pkt)
+	}
+
+	// 注册的协议解析器（DNS / HTTP / ICMP / TLS ...），先写入环形缓冲区（用于实时显示）
+	for _, d := range parser.Dissectors() {
+		if !d.Claims(pkt) {
+			continue
+		}
+		sessions, err := d.Dissect(pkt, c.dissectCtx)
+		if err != nil {
+			continue
+		}
+		for _, s := range sessions {
+			c.pushSession(d.Table(), s)
+			job.sessions = append(job.sessions, sessionItem{d.Table(), s})
+		}
+	}
+
+	// TCP 重组器：HTTP / TLS 等基于重组后的字节流解析，会话在消息完整时产生
+	if c.reassembler != nil {
+		for _, s := range c.reassembler.Assemble(pkt) {
+			if table, ok := sessionTable(s); ok {
+				c.pushSession(table, s)
+				job.sessions = append(job.sessions, sessionItem{table, s})
+			}
+		}
+	}
+
+	// 持久化与告警互不依赖，分别入队
+	job.refs.Add(1)
+	if !c.pipeline.persist.push(job) {
+		job.release()
+	}
+	if !c.pipeline.alert.push(job) {
+		job.release()
+	}
+}
+
+// persistPacket writes the packet, its session flow and parsed sessions to storage
+func (c *Capture) persistPacket(job *packetJob) {
+	defer job.release()
+	pkt := job.pkt
+
+	if err := c.store.WriteRaw(pkt); err != nil {
+		// Log error but don't stop capture
+		fmt.Printf("Error writing raw packet: %v\n", err)
+	}
+
+	// 实时更新会话流统计
+	if err := c.store.GetDB().UpsertSessionFlow(pkt); err != nil {
+		// 不打印太多日志，避免影响性能
+		if c.packetsTotal.Load()%1000 == 0 {
+			fmt.Printf("[WARN] Session flow upsert failed: %v\n", err)
+		}
+	}
+
+	for _, item := range job.sessions {
+		s := item.session
+		startTime := time.Now()
+		if err := c.store.WriteSession(item.table, s); err != nil {
+			fmt.Printf("[ERROR] %s写入数据库失败: %v | src=%s, dst=%s\n", s.Type, err, s.FiveTuple.SrcIP, s.FiveTuple.DstIP)
+			continue
+		}
+		// 只在写入慢时打印警告
+		if duration := time.Since(startTime); duration > 100*time.Millisecond {
+			fmt.Printf("[WARN] %s写入慢: %v | src=%s\n", s.Type, duration, s.FiveTuple.SrcIP)
+		}
+	}
+}
+
+// alertPacket checks alert rules against the packet and its parsed sessions
+func (c *Capture) alertPacket(job *packetJob) {
+	defer job.release()
+	sqliteStore := c.store.GetDB()
+
+	// 忽略告警检查错误，不影响主流程
+	for _, item := range job.sessions {
+		_ = sqliteStore.CheckAlertRules(job.pkt, item.session)
+		c.checkRogueDHCP(job.pkt, item.session)
+	}
+	c.alertARP(job.arpEvents)
+	c.alertDefrag(job.defragEvents)
+
+	// 检查目标IP告警（对所有数据包）
+	_ = sqliteStore.CheckAlertRules(job.pkt, nil)
+}
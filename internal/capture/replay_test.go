@@ -0,0 +1,172 @@
+package capture
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"sniffer/internal/config"
+	"sniffer/internal/store"
+)
+
+// newTestCapture creates a capture whose data directories are in a temporary directory
+func newTestCapture(t *testing.T) *Capture {
+	t.Helper()
+	dir := t.TempDir()
+	yaml := fmt.Sprintf("data_dir: %[1]s\npcap_dir: %[1]s/pcap\ndb_path: %[1]s/sniffer.db\nsnapshot:\n  dir: %[1]s/evidence\n", dir)
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("config.Load: %v", err)
+	}
+	st, err := store.NewComposite(cfg)
+	if err != nil {
+		t.Fatalf("store.NewComposite: %v", err)
+	}
+
+	c := New(cfg, st)
+	t.Cleanup(func() {
+		c.Stop()
+		st.Close()
+	})
+	return c
+}
+
+// writeReplayFile writes n UDP packets spaced by gap to a pcap file
+func writeReplayFile(t *testing.T, n int, gap time.Duration) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "replay.pcap")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w := pcapgo.NewWriter(f)
+	if err := w.WriteFileHeader(65535, layers.LinkTypeEthernet); err != nil {
+		t.Fatal(err)
+	}
+	ts := time.Unix(1700000000, 0)
+	for i := 0; i < n; i++ {
+		eth := &layers.Ethernet{
+			SrcMAC:       net.HardwareAddr{0, 1, 2, 3, 4, 5},
+			DstMAC:       net.HardwareAddr{0, 1, 2, 3, 4, 6},
+			EthernetType: layers.EthernetTypeIPv4,
+		}
+		ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolUDP, SrcIP: net.IP{192, 0, 2, 1}, DstIP: net.IP{192, 0, 2, 2}}
+		udp := &layers.UDP{SrcPort: layers.UDPPort(40000 + i), DstPort: 9999}
+		udp.SetNetworkLayerForChecksum(ip)
+		buf := gopacket.NewSerializeBuffer()
+		opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+		if err := gopacket.SerializeLayers(buf, opts, eth, ip, udp, gopacket.Payload("replay")); err != nil {
+			t.Fatal(err)
+		}
+		ci := gopacket.CaptureInfo{Timestamp: ts, CaptureLength: len(buf.Bytes()), Length: len(buf.Bytes())}
+		if err := w.WritePacket(ci, buf.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+		ts = ts.Add(gap)
+	}
+	return path
+}
+
+// waitReplay waits until the current replay of c ends
+func waitReplay(t *testing.T, c *Capture) {
+	t.Helper()
+	select {
+	case <-c.ReplayDone():
+	case <-time.After(10 * time.Second):
+		t.Fatal("replay did not end")
+	}
+}
+
+func TestReplayCompletes(t *testing.T) {
+	c := newTestCapture(t)
+	path := writeReplayFile(t, 5, time.Millisecond)
+
+	if err := c.StartFromFile(path, 0); err != nil {
+		t.Fatalf("StartFromFile: %v", err)
+	}
+	waitReplay(t, c)
+
+	status := c.GetReplayStatus()
+	if !status.Done || status.Running || status.Error != "" || status.FinishedAt == nil {
+		t.Errorf("status = %+v, want done", status)
+	}
+	if status.PacketsRead != 5 || status.Progress != 100 || status.BytesRead != status.TotalBytes {
+		t.Errorf("progress = %d packets, %d/%d bytes, %.0f%%", status.PacketsRead, status.BytesRead, status.TotalBytes, status.Progress)
+	}
+	if status.Path != path {
+		t.Errorf("Path = %q", status.Path)
+	}
+	if c.IsRunning() {
+		t.Error("capture still running after the replay completed")
+	}
+
+	// 回放结束后可以再次回放
+	if err := c.StartFromFile(path, 0); err != nil {
+		t.Fatalf("second StartFromFile: %v", err)
+	}
+	waitReplay(t, c)
+	if status := c.GetReplayStatus(); !status.Done || status.PacketsRead != 5 {
+		t.Errorf("second replay status = %+v", status)
+	}
+}
+
+func TestReplayStartedConcurrently(t *testing.T) {
+	c := newTestCapture(t)
+	// 原始时序回放，两个数据包相隔一小时，停止前回放一直进行
+	path := writeReplayFile(t, 2, time.Hour)
+
+	var wg sync.WaitGroup
+	ready := make(chan struct{})
+	errs := make([]error, 8)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-ready
+			errs[i] = c.StartFromFile(path, 1)
+		}(i)
+	}
+	close(ready)
+	wg.Wait()
+
+	started := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			started++
+		case !errors.Is(err, ErrAlreadyRunning):
+			t.Errorf("StartFromFile: %v", err)
+		}
+	}
+	if started != 1 {
+		t.Fatalf("%d replays started, want 1", started)
+	}
+	if names := c.GetInterfaceNames(); len(names) != 1 {
+		t.Errorf("sources = %v, want one replay", names)
+	}
+
+	if err := c.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	waitReplay(t, c)
+	if status := c.GetReplayStatus(); status.Done || status.Running || status.FinishedAt == nil {
+		t.Errorf("status after Stop = %+v, want stopped before completion", status)
+	}
+	if err := c.StartFromFile(path, -1); err == nil {
+		t.Error("StartFromFile accepted a negative speed")
+	}
+}
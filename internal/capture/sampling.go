@@ -0,0 +1,182 @@
+package capture
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"sniffer/internal/config"
+	"sniffer/pkg/model"
+)
+
+// sampler decides which packets are processed while sampling is active
+// 过载时以确定性采样代替随机丢包：count 每 N 个包保留 1 个，flow 按五元组哈希保留 1/N 的流
+type sampler struct {
+	mode      string // off, count, flow, auto
+	method    string // 生效的采样方式: count, flow
+	rate      int
+	queueHigh float64
+	queueLow  float64
+	dropRate  int64
+	cooldown  time.Duration
+
+	active  atomic.Bool
+	counter atomic.Uint64
+	kept    atomic.Int64
+	skipped atomic.Int64
+
+	// auto 模式状态，由指标协程更新
+	mu           sync.Mutex
+	reason       string
+	since        *time.Time
+	lastOverload time.Time
+	lastDrops    int64
+}
+
+func newSampler(cfg config.SamplingConfig, cooldown time.Duration) *sampler {
+	s := &sampler{
+		mode:      cfg.Mode,
+		method:    cfg.Mode,
+		rate:      cfg.Rate,
+		queueHigh: cfg.QueueHigh,
+		queueLow:  cfg.QueueLow,
+		dropRate:  cfg.DropRate,
+		cooldown:  cooldown,
+	}
+	if cfg.Mode == config.SamplingAuto {
+		s.method = cfg.AutoMethod
+	}
+
+	// 固定采样模式始终生效
+	if (cfg.Mode == config.SamplingCount || cfg.Mode == config.SamplingFlow) && cfg.Rate > 1 {
+		now := time.Now()
+		s.since = &now
+		s.active.Store(true)
+	}
+	return s
+}
+
+// keepCount applies 1-in-N sampling before decoding.
+// Returns the sampling rate the kept packet stands for (1 when not sampling) and whether to keep it.
+func (s *sampler) keepCount() (int, bool) {
+	if !s.active.Load() || s.method != config.SamplingCount {
+		return 1, true
+	}
+	if (s.counter.Add(1)-1)%uint64(s.rate) != 0 {
+		s.skipped.Add(1)
+		return 0, false
+	}
+	s.kept.Add(1)
+	return s.rate, true
+}
+
+// keepFlow applies flow-hash sampling after decoding.
+// 同一条流（双向）的所有数据包哈希相同，保留的流统计是完整的
+func (s *sampler) keepFlow(pkt *model.Packet) (int, bool) {
+	if !s.active.Load() || s.method != config.SamplingFlow {
+		return 1, true
+	}
+	// 无 IP 层的数据包不参与流采样，ARP 保留供 ARP 表和欺骗检测使用
+	if pkt.SrcIP == "" || pkt.Protocol == "ARP" {
+		return 1, true
+	}
+	if flowHash(pkt)%uint64(s.rate) != 0 {
+		s.skipped.Add(1)
+		return 0, false
+	}
+	s.kept.Add(1)
+	return s.rate, true
+}
+
+// flowHash returns a direction independent hash of the packet's 5-tuple
+func flowHash(pkt *model.Packet) uint64 {
+	a := pkt.SrcIP + ":" + strconv.Itoa(int(pkt.SrcPort))
+	b := pkt.DstIP + ":" + strconv.Itoa(int(pkt.DstPort))
+	if a > b {
+		a, b = b, a
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(pkt.Protocol))
+	h.Write([]byte{0})
+	h.Write([]byte(a))
+	h.Write([]byte{0})
+	h.Write([]byte(b))
+	return h.Sum64()
+}
+
+// evaluate turns automatic sampling on or off from the pipeline queue fill and the drop counters
+// 每秒由指标协程调用；queueFill 为各阶段队列占用率的最大值，drops 为累计丢包数（内核 + 队列）
+func (s *sampler) evaluate(now time.Time, queueFill float64, drops int64) {
+	if s.mode != config.SamplingAuto || s.rate <= 1 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dropDelta := drops - s.lastDrops
+	if dropDelta < 0 {
+		// 新的抓包会话，计数已重置
+		dropDelta = drops
+	}
+	s.lastDrops = drops
+
+	overload := ""
+	if queueFill >= s.queueHigh {
+		overload = fmt.Sprintf("queue %.0f%% full", queueFill*100)
+	} else if s.dropRate > 0 && dropDelta > s.dropRate {
+		overload = fmt.Sprintf("%d drops/s", dropDelta)
+	}
+
+	if overload != "" {
+		s.lastOverload = now
+		if !s.active.Load() {
+			s.reason = overload
+			s.since = &now
+			s.active.Store(true)
+			fmt.Printf("[Sampling] %s sampling 1/%d enabled: %s\n", s.method, s.rate, overload)
+		}
+		return
+	}
+
+	if s.active.Load() && queueFill < s.queueLow && dropDelta == 0 && now.Sub(s.lastOverload) >= s.cooldown {
+		s.active.Store(false)
+		s.reason = ""
+		s.since = nil
+		fmt.Println("[Sampling] sampling disabled: load back to normal")
+	}
+}
+
+// reset clears the counters at the start of a capture session
+func (s *sampler) reset() {
+	s.counter.Store(0)
+	s.kept.Store(0)
+	s.skipped.Store(0)
+
+	s.mu.Lock()
+	s.lastDrops = 0
+	s.mu.Unlock()
+}
+
+func (s *sampler) status() model.SamplingStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := model.SamplingStatus{
+		Mode:    s.mode,
+		Active:  s.active.Load(),
+		Rate:    s.rate,
+		Kept:    s.kept.Load(),
+		Skipped: s.skipped.Load(),
+	}
+	if status.Active {
+		status.Method = s.method
+		status.Reason = s.reason
+		status.Since = s.since
+	}
+	return status
+}
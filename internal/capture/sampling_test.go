@@ -0,0 +1,164 @@
+package capture
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"sniffer/internal/config"
+	"sniffer/pkg/model"
+)
+
+func TestSamplerKeepCount(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        config.SamplingConfig
+		wantKept   []int // 保留的数据包下标（共 10 个）
+		wantWeight int
+	}{
+		{"off", config.SamplingConfig{Mode: config.SamplingOff, Rate: 4}, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, 1},
+		{"count", config.SamplingConfig{Mode: config.SamplingCount, Rate: 4}, []int{0, 4, 8}, 4},
+		{"count rate 1", config.SamplingConfig{Mode: config.SamplingCount, Rate: 1}, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, 1},
+		{"flow", config.SamplingConfig{Mode: config.SamplingFlow, Rate: 4}, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, 1},
+		{"auto before overload", config.SamplingConfig{Mode: config.SamplingAuto, AutoMethod: config.SamplingCount, Rate: 4}, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSampler(tt.cfg, time.Second)
+			var kept []int
+			for i := 0; i < 10; i++ {
+				weight, keep := s.keepCount()
+				if !keep {
+					continue
+				}
+				if weight != tt.wantWeight {
+					t.Errorf("packet %d: weight %d, want %d", i, weight, tt.wantWeight)
+				}
+				kept = append(kept, i)
+			}
+			if !reflect.DeepEqual(kept, tt.wantKept) {
+				t.Errorf("kept %v, want %v", kept, tt.wantKept)
+			}
+
+			// 未采样时不计数
+			status := s.status()
+			if tt.wantWeight > 1 && (status.Kept != int64(len(kept)) || status.Skipped != int64(10-len(kept))) {
+				t.Errorf("status = %+v", status)
+			}
+			if tt.wantWeight == 1 && (status.Kept != 0 || status.Skipped != 0) {
+				t.Errorf("status = %+v, want no counts", status)
+			}
+		})
+	}
+}
+
+func TestFlowHash(t *testing.T) {
+	packet := func(proto, src string, srcPort uint16, dst string, dstPort uint16) *model.Packet {
+		return &model.Packet{SrcIP: src, DstIP: dst, SrcPort: srcPort, DstPort: dstPort, Protocol: proto}
+	}
+
+	forward := packet("TCP", "192.168.1.10", 40000, "10.0.0.1", 443)
+	reverse := packet("TCP", "10.0.0.1", 443, "192.168.1.10", 40000)
+	if flowHash(forward) != flowHash(reverse) {
+		t.Error("the two directions of a flow hash differently")
+	}
+	for _, other := range []*model.Packet{
+		packet("UDP", "192.168.1.10", 40000, "10.0.0.1", 443),
+		packet("TCP", "192.168.1.10", 40001, "10.0.0.1", 443),
+		packet("TCP", "192.168.1.11", 40000, "10.0.0.1", 443),
+		// 端口与地址交换后不应与原流相同
+		packet("TCP", "192.168.1.10", 443, "10.0.0.1", 40000),
+	} {
+		if flowHash(other) == flowHash(forward) {
+			t.Errorf("%s %s:%d > %s:%d hashes like the original flow", other.Protocol, other.SrcIP, other.SrcPort, other.DstIP, other.DstPort)
+		}
+	}
+
+	// 流采样对同一条流的两个方向做出相同的决定，约保留 1/N 的流
+	s := newSampler(config.SamplingConfig{Mode: config.SamplingFlow, Rate: 4}, time.Second)
+	keptFlows := 0
+	for port := uint16(1); port <= 400; port++ {
+		rate, keep := s.keepFlow(packet("UDP", "192.168.1.10", port, "10.0.0.1", 53))
+		reverseRate, reverseKeep := s.keepFlow(packet("UDP", "10.0.0.1", 53, "192.168.1.10", port))
+		if keep != reverseKeep || rate != reverseRate {
+			t.Fatalf("port %d: forward %d, %v; reverse %d, %v", port, rate, keep, reverseRate, reverseKeep)
+		}
+		if keep {
+			if rate != 4 {
+				t.Fatalf("port %d: kept with rate %d", port, rate)
+			}
+			keptFlows++
+		}
+	}
+	if keptFlows < 50 || keptFlows > 150 {
+		t.Errorf("kept %d of 400 flows, want about 100", keptFlows)
+	}
+
+	// 无 IP 层的数据包和 ARP 不参与流采样
+	for _, pkt := range []*model.Packet{
+		{Protocol: "LLDP"},
+		packet("ARP", "192.168.1.1", 0, "192.168.1.10", 0),
+	} {
+		if rate, keep := s.keepFlow(pkt); !keep || rate != 1 {
+			t.Errorf("%s: keepFlow = %d, %v", pkt.Protocol, rate, keep)
+		}
+	}
+}
+
+func TestSamplerEvaluate(t *testing.T) {
+	cfg := config.SamplingConfig{
+		Mode:       config.SamplingAuto,
+		AutoMethod: config.SamplingFlow,
+		Rate:       10,
+		QueueHigh:  0.8,
+		QueueLow:   0.5,
+		DropRate:   100,
+	}
+	s := newSampler(cfg, 5*time.Second)
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	steps := []struct {
+		name       string
+		offset     time.Duration
+		queueFill  float64
+		drops      int64
+		wantActive bool
+		wantReason string
+	}{
+		{"normal load", 0, 0.5, 0, false, ""},
+		{"queue full", 1 * time.Second, 0.9, 0, true, "queue 90% full"},
+		{"above the low mark", 2 * time.Second, 0.6, 0, true, "queue 90% full"},
+		{"cooldown after the last overload", 4 * time.Second, 0.1, 0, true, "queue 90% full"},
+		{"overload extends the cooldown", 5 * time.Second, 0.85, 0, true, "queue 90% full"},
+		{"still in the cooldown", 9 * time.Second, 0.1, 0, true, "queue 90% full"},
+		{"cooldown over", 10 * time.Second, 0.1, 0, false, ""},
+		{"drops below the threshold", 11 * time.Second, 0.1, 100, false, ""},
+		{"drop burst", 12 * time.Second, 0.1, 250, true, "150 drops/s"},
+		{"drops after the cooldown", 20 * time.Second, 0.1, 260, true, "150 drops/s"},
+		{"no more drops", 21 * time.Second, 0.1, 260, false, ""},
+		{"counters reset by a new session", 22 * time.Second, 0.1, 120, true, "120 drops/s"},
+	}
+
+	for _, step := range steps {
+		now := start.Add(step.offset)
+		s.evaluate(now, step.queueFill, step.drops)
+		status := s.status()
+		if status.Active != step.wantActive || status.Reason != step.wantReason {
+			t.Fatalf("%s: active %v, reason %q; want %v, %q", step.name, status.Active, status.Reason, step.wantActive, step.wantReason)
+		}
+		if status.Active && (status.Method != config.SamplingFlow || status.Since == nil) {
+			t.Errorf("%s: status = %+v", step.name, status)
+		}
+		if !status.Active && (status.Method != "" || status.Since != nil) {
+			t.Errorf("%s: inactive status = %+v", step.name, status)
+		}
+	}
+
+	// 固定采样模式不受负载影响
+	fixed := newSampler(config.SamplingConfig{Mode: config.SamplingCount, Rate: 10, QueueHigh: 0.8, QueueLow: 0.5}, 0)
+	fixed.evaluate(start, 0, 0)
+	if status := fixed.status(); !status.Active || status.Method != config.SamplingCount {
+		t.Errorf("fixed sampling status = %+v", status)
+	}
+}
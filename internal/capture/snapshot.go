@@ -0,0 +1,227 @@
+package capture
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"sniffer/internal/cache"
+	"sniffer/internal/config"
+	"sniffer/internal/store"
+	"sniffer/pkg/model"
+)
+
+// snapshotShards is the number of pre-trigger buffers, 按流哈希分片以减少富化协程之间的锁竞争
+const snapshotShards = 16
+
+// snapshotter writes alert-triggered capture snapshots to evidence files
+// 告警快照：规则触发时写入触发前缓冲的数据包，并继续录制触发后的数据包
+type snapshotter struct {
+	mu        sync.Mutex
+	db        *store.SQLiteStore
+	shards    [snapshotShards]snapshotShard
+	window    time.Duration
+	dir       string
+	maxPost   time.Duration
+	recorders map[int64]*snapshotRecorder // 按告警记录ID索引的录制任务
+}
+
+// snapshotShard buffers the packets of the flows hashed to it and feeds the active recordings
+type snapshotShard struct {
+	mu        sync.Mutex
+	buffer    *cache.PacketBuffer
+	recorders []*snapshotRecorder
+}
+
+// snapshotRecorder records the post-trigger packets of an alert
+// 各分片并发写入同一个证据文件，写入由 mu 串行化
+type snapshotRecorder struct {
+	mu       sync.Mutex
+	logID    int64
+	writer   *store.EvidenceWriter
+	deadline time.Time // 数据包时间戳晚于此时间时停止录制
+	timer    *time.Timer
+	done     bool
+}
+
+func newSnapshotter(db *store.SQLiteStore, cfg config.SnapshotConfig, window time.Duration) *snapshotter {
+	s := &snapshotter{
+		db:        db,
+		window:    window,
+		dir:       cfg.Dir,
+		maxPost:   time.Duration(cfg.MaxPost) * time.Second,
+		recorders: make(map[int64]*snapshotRecorder),
+	}
+	// max_packets 为所有分片的总数
+	perShard := 0
+	if cfg.MaxPackets > 0 {
+		perShard = (cfg.MaxPackets + snapshotShards - 1) / snapshotShards
+	}
+	for i := range s.shards {
+		s.shards[i].buffer = cache.NewPacketBuffer(window, perShard)
+	}
+	return s
+}
+
+// observe adds a packet to the pre-trigger buffer of its flow and to the active recordings
+func (s *snapshotter) observe(hash uint32, pkt *model.Packet) {
+	shard := &s.shards[hash%snapshotShards]
+
+	shard.mu.Lock()
+	shard.buffer.Push(pkt)
+	recorders := shard.recorders
+	shard.mu.Unlock()
+
+	for _, r := range recorders {
+		if expired := r.write(pkt); expired {
+			s.finish(r.logID)
+		}
+	}
+}
+
+// write writes a post-trigger packet, returns true if the recording is past its deadline
+func (r *snapshotRecorder) write(pkt *model.Packet) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.done {
+		return false
+	}
+	if pkt.Timestamp.After(r.deadline) {
+		return true
+	}
+	if err := r.writer.WritePacket(pkt); err != nil {
+		fmt.Printf("[Snapshot] alert %d: %v\n", r.logID, err)
+		return true
+	}
+	return false
+}
+
+// trigger starts the snapshot of a new alert log if the rule enables it
+// 作为 store.AlertHandler 在告警记录写入后调用
+func (s *snapshotter) trigger(rule *model.AlertRule, log *model.AlertLog, pkt *model.Packet) {
+	if !rule.SnapshotEnabled {
+		return
+	}
+
+	pre := time.Duration(rule.SnapshotPre) * time.Second
+	if pre > s.window {
+		pre = s.window
+	}
+	post := time.Duration(rule.SnapshotPost) * time.Second
+	if post > s.maxPost {
+		post = s.maxPost
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.recorders[log.ID]; ok {
+		return
+	}
+
+	writer, err := store.CreateEvidence(s.dir, log.ID, log.TriggeredAt)
+	if err != nil {
+		fmt.Printf("[Snapshot] alert %d: %v\n", log.ID, err)
+		return
+	}
+
+	r := &snapshotRecorder{
+		logID:    log.ID,
+		writer:   writer,
+		deadline: pkt.Timestamp.Add(post),
+	}
+	s.recorders[log.ID] = r
+
+	// 先写完触发前的数据包，再处理触发后的数据包：
+	// 每个分片在同一把锁内取出缓冲并登记录制任务，数据包恰好写入一次
+	r.mu.Lock()
+	var buffered []*model.Packet
+	since := pkt.Timestamp.Add(-pre) // 触发时间以数据包时间戳为准，离线回放时同样准确
+	for i := range s.shards {
+		shard := &s.shards[i]
+		shard.mu.Lock()
+		buffered = append(buffered, shard.buffer.Since(since)...)
+		shard.recorders = append(shard.recorders[:len(shard.recorders):len(shard.recorders)], r)
+		shard.mu.Unlock()
+	}
+	sort.SliceStable(buffered, func(i, j int) bool {
+		return buffered[i].Timestamp.Before(buffered[j].Timestamp)
+	})
+	for _, p := range buffered {
+		if err := writer.WritePacket(p); err != nil {
+			fmt.Printf("[Snapshot] alert %d: %v\n", log.ID, err)
+			break
+		}
+	}
+	r.mu.Unlock()
+
+	// 没有后续流量时按墙钟时间结束录制
+	r.timer = time.AfterFunc(post+time.Second, func() {
+		s.finish(r.logID)
+	})
+}
+
+// finish ends the recording of an alert log
+func (s *snapshotter) finish(logID int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.finishLocked(logID)
+}
+
+// finishLocked closes the evidence file and links it to the alert log
+func (s *snapshotter) finishLocked(logID int64) {
+	r, ok := s.recorders[logID]
+	if !ok {
+		return
+	}
+	delete(s.recorders, logID)
+	if r.timer != nil {
+		r.timer.Stop()
+	}
+
+	// 从各分片移除（复制切片，observe 可能仍在遍历旧切片）
+	for i := range s.shards {
+		shard := &s.shards[i]
+		shard.mu.Lock()
+		recorders := make([]*snapshotRecorder, 0, len(shard.recorders))
+		for _, other := range shard.recorders {
+			if other != r {
+				recorders = append(recorders, other)
+			}
+		}
+		shard.recorders = recorders
+		shard.mu.Unlock()
+	}
+
+	r.mu.Lock()
+	r.done = true
+	err := r.writer.Close()
+	r.mu.Unlock()
+
+	if err != nil {
+		fmt.Printf("[Snapshot] alert %d: close evidence: %v\n", logID, err)
+	}
+	if err := s.db.SetAlertEvidence(logID, r.writer.Path()); err != nil {
+		fmt.Printf("[Snapshot] alert %d: %v\n", logID, err)
+		return
+	}
+	fmt.Printf("[Snapshot] alert %d: %d packets written to %s\n", logID, r.writer.Count(), r.writer.Path())
+}
+
+// finishAll finishes all active recordings (capture stopped)
+func (s *snapshotter) finishAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id := range s.recorders {
+		s.finishLocked(id)
+	}
+}
+
+// clear removes all packets from the pre-trigger buffers
+func (s *snapshotter) clear() {
+	for i := range s.shards {
+		s.shards[i].buffer.Clear()
+	}
+}
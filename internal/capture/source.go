@@ -0,0 +1,179 @@
+package capture
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"sniffer/internal/netio"
+	"sniffer/pkg/model"
+)
+
+// captureSource is a single capture source (network interface or replayed file)
+// 单个抓包源：每个网卡拥有独立的句柄、过滤器和指标
+type captureSource struct {
+	name      string
+	backend   string
+	handles   []netio.Handle // afpacket fanout 时同一网卡有多个句柄
+	filter    string
+	startedAt time.Time
+	cancel    context.CancelFunc
+
+	// Metrics
+	packetsTotal atomic.Int64
+	bytesTotal   atomic.Int64
+	lastMetrics  time.Time
+	lastPackets  int64
+	lastBytes    int64
+
+	// 已读取但尚未处理完的数据包（仅离线回放统计）
+	inflight sync.WaitGroup
+}
+
+// newCaptureSource creates a capture source for the opened handles
+func newCaptureSource(name, backend string, handles []netio.Handle, filter string, cancel context.CancelFunc) *captureSource {
+	now := time.Now()
+	return &captureSource{
+		name:        name,
+		backend:     backend,
+		handles:     handles,
+		filter:      filter,
+		startedAt:   now,
+		cancel:      cancel,
+		lastMetrics: now,
+	}
+}
+
+// calculateMetrics calculates the metrics of this source (caller must serialize calls)
+func (s *captureSource) calculateMetrics(now time.Time) model.InterfaceMetrics {
+	elapsed := now.Sub(s.lastMetrics).Seconds()
+
+	currentPackets := s.packetsTotal.Load()
+	currentBytes := s.bytesTotal.Load()
+
+	var pps, bps float64
+	if elapsed > 0 {
+		pps = float64(currentPackets-s.lastPackets) / elapsed
+		bps = float64(currentBytes-s.lastBytes) / elapsed
+	}
+
+	s.lastMetrics = now
+	s.lastPackets = currentPackets
+	s.lastBytes = currentBytes
+
+	// Get dropped packets from handles
+	var dropped, freezes int64
+	for _, handle := range s.handles {
+		if stats, err := handle.Stats(); err == nil {
+			dropped += int64(stats.PacketsDropped)
+			freezes += int64(stats.QueueFreezes)
+		}
+	}
+
+	return model.InterfaceMetrics{
+		Name:           s.name,
+		Backend:        s.backend,
+		Workers:        len(s.handles),
+		BPFFilter:      s.filter,
+		StartedAt:      s.startedAt,
+		PacketsTotal:   currentPackets,
+		PacketsDropped: dropped,
+		QueueFreezes:   freezes,
+		BytesTotal:     currentBytes,
+		PacketsPerSec:  pps,
+		BytesPerSec:    bps,
+	}
+}
+
+// setFilter applies the BPF filter to all handles of this source
+func (s *captureSource) setFilter(filter string) error {
+	for _, handle := range s.handles {
+		if err := handle.SetBPFFilter(filter); err != nil {
+			return err
+		}
+	}
+	s.filter = filter
+	return nil
+}
+
+// validateFilter compiles the filter for the link type of each handle
+func (s *captureSource) validateFilter(filter string, snaplen int) error {
+	for _, handle := range s.handles {
+		if err := netio.ValidateBPFFilter(filter, handle.LinkType(), snaplen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// close closes all handles of this source
+func (s *captureSource) close() {
+	for _, handle := range s.handles {
+		handle.Close()
+	}
+}
+
+// closeHandles closes handles opened for a source that failed to start
+func closeHandles(handles []netio.Handle) {
+	for _, handle := range handles {
+		handle.Close()
+	}
+}
+
+// openInterface opens the handles of a network interface with the configured backend
+func (c *Capture) openInterface(iface string) ([]netio.Handle, error) {
+	if c.cfg.GetBackend() != netio.BackendAFPacket {
+		handle, err := netio.Open(iface, netio.OpenOptions{
+			SnapLen:         c.cfg.SnapshotLen,
+			Promiscuous:     c.cfg.Promiscuous,
+			Timeout:         c.cfg.GetTimeout(),
+			BufferSize:      int(c.cfg.GetBufferSizeBytes()),
+			ImmediateMode:   c.cfg.ImmediateMode,
+			TimestampSource: c.cfg.TimestampSource,
+			NanoPrecision:   c.cfg.NanoPrecision,
+			Direction:       c.cfg.Direction,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return []netio.Handle{handle}, nil
+	}
+
+	afcfg, blockSize := c.cfg.GetAFPacket()
+	opts := netio.AFPacketOptions{
+		SnapLen:       c.cfg.SnapshotLen,
+		Promiscuous:   c.cfg.Promiscuous,
+		BlockSize:     int(blockSize),
+		NumBlocks:     afcfg.NumBlocks,
+		PollTimeout:   c.cfg.GetTimeout(),
+		Direction:     c.cfg.Direction,
+		FanoutWorkers: afcfg.FanoutWorkers,
+		FanoutGroup:   uint16(afcfg.FanoutGroup),
+		FanoutMode:    afcfg.FanoutMode,
+	}
+	if opts.FanoutGroup == 0 {
+		opts.FanoutGroup = netio.FanoutGroupID(iface)
+	} else {
+		opts.FanoutGroup = netio.FanoutGroupOffset(opts.FanoutGroup, iface)
+	}
+
+	// 同一 fanout 分组的多个句柄，每个句柄由独立的抓包协程读取
+	handles := make([]netio.Handle, 0, opts.FanoutWorkers)
+	for i := 0; i < opts.FanoutWorkers; i++ {
+		handle, err := netio.OpenAFPacket(iface, opts)
+		if err != nil {
+			closeHandles(handles)
+			return nil, err
+		}
+		handles = append(handles, handle)
+	}
+	return handles, nil
+}
+
+// settings returns the effective settings of this source's handles
+func (s *captureSource) settings() model.CaptureSettings {
+	settings := s.handles[0].Settings()
+	settings.Interface = s.name
+	return settings
+}
@@ -0,0 +1,145 @@
+package capture
+
+import (
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"sniffer/pkg/model"
+)
+
+// sessionStop holds the auto-stop conditions and the stop state of a capture session
+// 会话级自动停止条件（类似 tshark -a duration/packets/filesize/files）
+type sessionStop struct {
+	// 计数条件使用原子变量，抓包协程无锁检查
+	packets   atomic.Int64
+	bytes     atomic.Int64
+	files     atomic.Int64
+	filesBase atomic.Int64 // 会话开始时已创建的文件数
+	stopping  atomic.Bool
+
+	// 以下字段由 c.mu 保护
+	conds     model.StopConditions
+	timer     *time.Timer
+	startedAt *time.Time
+	stoppedAt *time.Time
+	reason    string
+}
+
+// checkCounters returns the stop reason if a packet or byte limit is reached
+func (s *sessionStop) checkCounters(packets, bytes int64) string {
+	if n := s.packets.Load(); n > 0 && packets >= n {
+		return model.StopReasonPackets
+	}
+	if n := s.bytes.Load(); n > 0 && bytes >= n {
+		return model.StopReasonBytes
+	}
+	return ""
+}
+
+func validateStopConditions(stop model.StopConditions) error {
+	if stop.Duration < 0 || stop.Packets < 0 || stop.Bytes < 0 || stop.Files < 0 {
+		return fmt.Errorf("stop conditions must not be negative: %+v", stop)
+	}
+	return nil
+}
+
+// resetStopLocked starts the stop state of a new session (c.mu must be held)
+func (c *Capture) resetStopLocked() {
+	if c.stop.timer != nil {
+		c.stop.timer.Stop()
+		c.stop.timer = nil
+	}
+
+	now := time.Now()
+	c.stop.startedAt = &now
+	c.stop.stoppedAt = nil
+	c.stop.reason = ""
+	c.stop.conds = model.StopConditions{}
+	c.stop.packets.Store(0)
+	c.stop.bytes.Store(0)
+	c.stop.files.Store(0)
+	c.stop.filesBase.Store(c.store.FilesCreated())
+	c.stop.stopping.Store(false)
+}
+
+// setStopConditionsLocked applies the stop conditions to the running session (c.mu must be held)
+// 时长从会话开始计算
+func (c *Capture) setStopConditionsLocked(stop model.StopConditions) {
+	c.stop.conds = stop
+	c.stop.packets.Store(stop.Packets)
+	c.stop.bytes.Store(stop.Bytes)
+	c.stop.files.Store(stop.Files)
+
+	if c.stop.timer != nil {
+		c.stop.timer.Stop()
+		c.stop.timer = nil
+	}
+	if stop.Duration > 0 {
+		remaining := time.Until(c.stop.startedAt.Add(time.Duration(stop.Duration) * time.Second))
+		if remaining < 0 {
+			remaining = 0
+		}
+		sessionCtx := c.ctx
+		c.stop.timer = time.AfterFunc(remaining, func() {
+			// 会话已结束（或已开始新会话）时忽略
+			if sessionCtx.Err() == nil {
+				c.autoStop(model.StopReasonDuration)
+			}
+		})
+	}
+}
+
+// endStopLocked records why the session ended (c.mu must be held)
+func (c *Capture) endStopLocked(reason string) {
+	if c.stop.timer != nil {
+		c.stop.timer.Stop()
+		c.stop.timer = nil
+	}
+
+	now := time.Now()
+	c.stop.stoppedAt = &now
+	c.stop.reason = reason
+}
+
+// autoStop stops all interfaces because a stop condition was reached
+func (c *Capture) autoStop(reason string) {
+	if !c.stop.stopping.CompareAndSwap(false, true) {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.isRunning.Load() {
+		return
+	}
+
+	fmt.Printf("[Capture] stop condition reached: %s\n", reason)
+	for _, src := range c.sources {
+		c.removeSourceLocked(src)
+	}
+	c.stopSessionLocked(reason)
+}
+
+// GetCaptureStatus returns the state of the current (or last) capture session
+func (c *Capture) GetCaptureStatus() model.CaptureStatus {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	names := make([]string, 0, len(c.sources))
+	for name := range c.sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return model.CaptureStatus{
+		Running:        c.isRunning.Load(),
+		Interfaces:     names,
+		StartedAt:      c.stop.startedAt,
+		StoppedAt:      c.stop.stoppedAt,
+		StopReason:     c.stop.reason,
+		StopConditions: c.stop.conds,
+	}
+}
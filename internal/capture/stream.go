@@ -0,0 +1,100 @@
+package capture
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"sniffer/internal/config"
+	"sniffer/internal/parser"
+	"sniffer/pkg/model"
+)
+
+// reassemblyFlushInterval is how often idle reassembled connections are flushed
+const reassemblyFlushInterval = 5 * time.Second
+
+// reassemblyLoop periodically flushes the connections that exceeded the reassembly timeout
+func (c *Capture) reassemblyLoop(ctx context.Context) {
+	ticker := time.NewTicker(reassemblyFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.handleFlushedSessions(c.reassembler.Flush())
+		}
+	}
+}
+
+// handleFlushedSessions stores and checks the sessions completed by a reassembler or DNS tracker flush
+// 连接超时、查询超时或抓包停止时输出的会话没有触发它的数据包，在这里直接写入并检查告警
+func (c *Capture) handleFlushedSessions(sessions []*model.Session) {
+	db := c.store.GetDB()
+	for _, s := range sessions {
+		table, ok := sessionTable(s)
+		if !ok {
+			continue
+		}
+		c.pushSession(table, s)
+
+		if err := c.store.WriteSession(table, s); err != nil {
+			fmt.Printf("[ERROR] %s写入数据库失败: %v | src=%s, dst=%s\n", s.Type, err, s.FiveTuple.SrcIP, s.FiveTuple.DstIP)
+		}
+		_ = db.CheckAlertRules(sessionPacket(s), s)
+	}
+}
+
+// pushSession adds a parsed session to its ring buffer for live display
+func (c *Capture) pushSession(table model.TableType, s *model.Session) {
+	if ring := c.rings.GetSession(string(table)); ring != nil {
+		ring.Push(s)
+	}
+}
+
+// sessionRingCap returns the ring buffer capacity of a session table
+// DNS / HTTP / ICMP 沿用各自的上限，其它协议使用 session_max
+func sessionRingCap(limits config.Limits, table model.TableType) int {
+	switch table {
+	case model.TableDNS:
+		return limits.DNSMax
+	case model.TableHTTP:
+		return limits.HTTPMax
+	case model.TableICMP:
+		return limits.ICMPMax
+	}
+	return limits.SessionMax
+}
+
+// sessionRingCaps returns the ring buffer capacities of the tables of the registered dissectors
+func sessionRingCaps(limits config.Limits) map[string]int {
+	caps := make(map[string]int)
+	for _, d := range parser.Dissectors() {
+		caps[string(d.Table())] = sessionRingCap(limits, d.Table())
+	}
+	return caps
+}
+
+// sessionTable returns the table of a session completed by the reassembler or the DNS tracker
+func sessionTable(s *model.Session) (model.TableType, bool) {
+	if d, ok := parser.DissectorForSession(s); ok {
+		return d.Table(), true
+	}
+	return "", false
+}
+
+// sessionPacket builds the packet summary of a session for alert checks
+func sessionPacket(s *model.Session) *model.Packet {
+	return &model.Packet{
+		Timestamp:   s.Timestamp,
+		SrcIP:       s.FiveTuple.SrcIP,
+		DstIP:       s.FiveTuple.DstIP,
+		SrcPort:     s.FiveTuple.SrcPort,
+		DstPort:     s.FiveTuple.DstPort,
+		Protocol:    s.FiveTuple.Protocol,
+		ProcessPID:  s.ProcessPID,
+		ProcessName: s.ProcessName,
+		ProcessExe:  s.ProcessExe,
+	}
+}
@@ -3,8 +3,10 @@ package config
 import (
 	"context"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -18,10 +20,11 @@ type Config struct {
 	mu sync.RWMutex
 
 	// Ring buffer limits
-	RawMax  int `yaml:"raw_max" env:"SNIF_RAW_MAX"`
-	DNSMax  int `yaml:"dns_max" env:"SNIF_DNS_MAX"`
-	HTTPMax int `yaml:"http_max" env:"SNIF_HTTP_MAX"`
-	ICMPMax int `yaml:"icmp_max" env:"SNIF_ICMP_MAX"`
+	RawMax     int `yaml:"raw_max" env:"SNIF_RAW_MAX"`
+	DNSMax     int `yaml:"dns_max" env:"SNIF_DNS_MAX"`
+	HTTPMax    int `yaml:"http_max" env:"SNIF_HTTP_MAX"`
+	ICMPMax    int `yaml:"icmp_max" env:"SNIF_ICMP_MAX"`
+	SessionMax int `yaml:"session_max" env:"SNIF_SESSION_MAX"` // 其它协议（TLS、SSH、邮件等）每种的会话条数
 
 	// PCAP rotation
 	PcapRotate   int    `yaml:"pcap_rotate"`
@@ -38,24 +41,311 @@ type Config struct {
 	DBPath  string `yaml:"db_path"`
 
 	// Capture settings
-	SnapshotLen  int    `yaml:"snapshot_len"`
-	Promiscuous  bool   `yaml:"promiscuous"`
-	Timeout      string `yaml:"timeout"`
-	BufferSize   string `yaml:"buffer_size"`
+	SnapshotLen int    `yaml:"snapshot_len"`
+	Promiscuous bool   `yaml:"promiscuous"`
+	Timeout     string `yaml:"timeout"`
+	BufferSize  string `yaml:"buffer_size"`
+	BPFFilter   string `yaml:"bpf_filter"` // 默认抓包过滤器（BPF语法），为空表示不过滤
+	Backend     string `yaml:"backend"`    // 抓包后端: pcap, afpacket (仅Linux)
+
+	ImmediateMode   bool   `yaml:"immediate_mode"` // 立即模式，降低延迟但增加系统调用
+	TimestampSource string `yaml:"tstamp_source"`  // 时间戳来源: host, host_lowprec, host_hiprec, adapter, adapter_unsynced；为空使用默认值
+	NanoPrecision   bool   `yaml:"nano_precision"` // 纳秒精度时间戳
+	Direction       string `yaml:"direction"`      // 抓包方向: in, out, both
+
+	// AF_PACKET backend
+	AFPacket AFPacketConfig `yaml:"afpacket"`
+
+	// Processing pipeline
+	Pipeline PipelineConfig `yaml:"pipeline"`
+
+	// Packet sampling
+	Sampling SamplingConfig `yaml:"sampling"`
+
+	// TCP stream reassembly
+	Reassembly ReassemblyConfig `yaml:"reassembly"`
+
+	// IP fragment reassembly
+	Defrag DefragConfig `yaml:"defrag"`
+
+	// DNS transaction correlation
+	DNS DNSConfig `yaml:"dns"`
+
+	// ICMP echo pairing and traceroute hop discovery
+	ICMP ICMPConfig `yaml:"icmp"`
+
+	// DHCP server allowlist
+	DHCP DHCPConfig `yaml:"dhcp"`
+
+	// ARP monitoring
+	ARP ARPConfig `yaml:"arp"`
+
+	// Alert snapshots
+	Snapshot SnapshotConfig `yaml:"snapshot"`
+
+	// Scheduled capture windows
+	Schedules []ScheduleConfig `yaml:"schedules"`
 
 	// Parsed values
 	pcapSizeBytes   bytesize.ByteSize
 	bufferSizeBytes bytesize.ByteSize
+	afpacketBlock   bytesize.ByteSize
 	timeout         time.Duration
 	vacuumInterval  time.Duration
+	snapshotWindow  time.Duration
+	samplingCool    time.Duration
+	streamBuffer    bytesize.ByteSize
+	streamTimeout   time.Duration
+	defragMemory    bytesize.ByteSize
+	defragTimeout   time.Duration
+	dnsTimeout      time.Duration
+	icmpTimeout     time.Duration
+	arpConflict     time.Duration
+	arpFloodWindow  time.Duration
 }
 
 // Limits represents the ring buffer limits
 type Limits struct {
-	RawMax  int `json:"raw_max"`
-	DNSMax  int `json:"dns_max"`
-	HTTPMax int `json:"http_max"`
-	ICMPMax int `json:"icmp_max"`
+	RawMax     int `json:"raw_max"`
+	DNSMax     int `json:"dns_max"`
+	HTTPMax    int `json:"http_max"`
+	ICMPMax    int `json:"icmp_max"`
+	SessionMax int `json:"session_max"`
+}
+
+// AFPacketConfig represents the AF_PACKET TPACKET_V3 backend settings
+// 环形缓冲区总大小 = block_size * num_blocks
+type AFPacketConfig struct {
+	BlockSize     string `yaml:"block_size" json:"block_size"`
+	NumBlocks     int    `yaml:"num_blocks" json:"num_blocks"`
+	FanoutWorkers int    `yaml:"fanout_workers" json:"fanout_workers"` // 每个网卡的抓包协程数，>1 时启用 PACKET_FANOUT
+	FanoutMode    string `yaml:"fanout_mode" json:"fanout_mode"`       // hash, lb, cpu, rollover, random, qm
+	FanoutGroup   int    `yaml:"fanout_group" json:"fanout_group"`     // 0 表示按进程和网卡自动生成，非 0 时加上网卡索引
+}
+
+// Drop policies applied when a pipeline stage queue is full
+const (
+	DropNewest = "drop_newest" // 丢弃新到达的任务
+	DropOldest = "drop_oldest" // 丢弃队列中最旧的任务
+	DropBlock  = "block"       // 阻塞上游，由内核缓冲区承担丢包
+)
+
+// StageConfig represents the worker count and queue size of a pipeline stage
+type StageConfig struct {
+	Workers   int `yaml:"workers" json:"workers"`
+	QueueSize int `yaml:"queue_size" json:"queue_size"`
+}
+
+// PipelineConfig represents the packet processing pipeline settings
+// 数据包处理流水线：解码 -> 富化 -> 持久化 / 告警
+type PipelineConfig struct {
+	Decode     StageConfig `yaml:"decode" json:"decode"`
+	Enrich     StageConfig `yaml:"enrich" json:"enrich"`
+	Persist    StageConfig `yaml:"persist" json:"persist"`
+	Alert      StageConfig `yaml:"alert" json:"alert"`
+	DropPolicy string      `yaml:"drop_policy" json:"drop_policy"` // drop_newest, drop_oldest, block
+}
+
+// Sampling modes
+const (
+	SamplingOff   = "off"   // 不采样
+	SamplingCount = "count" // 确定性 1/N 采样
+	SamplingFlow  = "flow"  // 按五元组哈希采样，保留完整的流
+	SamplingAuto  = "auto"  // 过载时自动开启
+)
+
+// SamplingConfig represents the packet sampling settings
+// 过载时以采样代替随机丢包，采样期间的统计按采样率放大并标记
+type SamplingConfig struct {
+	Mode       string  `yaml:"mode" json:"mode"`               // off, count, flow, auto
+	Rate       int     `yaml:"rate" json:"rate"`               // 每 N 个数据包（或 N 条流）保留 1 个
+	AutoMethod string  `yaml:"auto_method" json:"auto_method"` // auto 模式使用的采样方式: count, flow
+	QueueHigh  float64 `yaml:"queue_high" json:"queue_high"`   // 任一流水线队列占用率超过此值时开启采样 (0-1)
+	QueueLow   float64 `yaml:"queue_low" json:"queue_low"`     // 所有队列占用率低于此值且无丢包时关闭采样 (0-1)
+	DropRate   int64   `yaml:"drop_rate" json:"drop_rate"`     // 每秒内核/队列丢包数超过此值时开启采样
+	Cooldown   string  `yaml:"cooldown" json:"cooldown"`       // 恢复正常后保持采样的时长
+}
+
+// ReassemblyConfig represents the TCP stream reassembly settings
+// TCP 流重组：将乱序、重传的报文段还原为有序字节流后交给应用层解析器（HTTP、TLS）
+// 乱序报文按页缓存，每页约 1900 字节
+type ReassemblyConfig struct {
+	Enabled         bool   `yaml:"enabled" json:"enabled"`
+	MaxPagesTotal   int    `yaml:"max_pages_total" json:"max_pages_total"`       // 所有连接缓存的乱序报文页数上限
+	MaxPagesPerConn int    `yaml:"max_pages_per_conn" json:"max_pages_per_conn"` // 单个连接缓存的乱序报文页数上限
+	MaxBuffer       string `yaml:"max_buffer" json:"max_buffer"`                 // 单个方向解析器缓存的未解析数据上限（如 HTTP 头部）
+	Timeout         string `yaml:"timeout" json:"timeout"`                       // 连接空闲超时，超时后刷新并结束连接
+}
+
+// DefragConfig represents the IPv4/IPv6 fragment reassembly settings
+// IP 分片重组：在解码阶段合并分片，重组后的报文按完整的传输层和应用层解析
+type DefragConfig struct {
+	Enabled      bool   `yaml:"enabled" json:"enabled"`
+	MaxMemory    string `yaml:"max_memory" json:"max_memory"`       // 所有未完成数据报缓存的分片数据上限，超出时丢弃最早的数据报
+	MaxFragments int    `yaml:"max_fragments" json:"max_fragments"` // 单个数据报的分片数上限，超出时丢弃该数据报
+	Timeout      string `yaml:"timeout" json:"timeout"`             // 等待剩余分片的超时，超时后丢弃未完成的数据报
+}
+
+// DNSConfig represents the DNS transaction correlation settings
+// DNS 事务配对：按事务 ID 和五元组将查询与响应合并为一条记录，计算解析延迟
+type DNSConfig struct {
+	Correlate  bool   `yaml:"correlate" json:"correlate"`     // 是否配对查询与响应，关闭后查询和响应分别记录
+	Timeout    string `yaml:"timeout" json:"timeout"`         // 查询等待响应的超时，超时后记为未响应
+	MaxPending int    `yaml:"max_pending" json:"max_pending"` // 等待响应的查询数上限
+}
+
+// ICMPConfig represents the ICMP analysis settings
+// ICMP 分析：回显请求与应答配对计算每个目的地址的 RTT 和丢包率，低 TTL 探测包与超时差错配对发现路由跳
+type ICMPConfig struct {
+	Correlate       bool   `yaml:"correlate" json:"correlate"`               // 是否配对回显和探测包，关闭后只记录单个报文
+	Timeout         string `yaml:"timeout" json:"timeout"`                   // 回显请求等待应答的超时，超时后记为丢包
+	MaxPending      int    `yaml:"max_pending" json:"max_pending"`           // 等待应答的回显请求和探测包数上限
+	MaxDestinations int    `yaml:"max_destinations" json:"max_destinations"` // 统计的目的地址数上限，超出时淘汰最久未出现的地址
+}
+
+// DHCPConfig represents the DHCP monitoring settings
+// 非法 DHCP 服务器检测：不在白名单中的服务器发出 OFFER/ACK 时产生告警
+type DHCPConfig struct {
+	AllowedServers []string `yaml:"allowed_servers" json:"allowed_servers"` // 合法 DHCP 服务器的 IP 或 MAC 地址，为空时不检测
+}
+
+// Allows reports whether a DHCP server identified by ip or mac is on the allowlist
+// 白名单为空时不检测，视为全部允许
+func (d DHCPConfig) Allows(ip, mac string) bool {
+	if len(d.AllowedServers) == 0 {
+		return true
+	}
+	for _, entry := range d.AllowedServers {
+		if allowed := net.ParseIP(entry); allowed != nil {
+			if addr := net.ParseIP(ip); addr != nil && addr.Equal(allowed) {
+				return true
+			}
+		} else if allowed, err := net.ParseMAC(entry); err == nil {
+			if hw, err := net.ParseMAC(mac); err == nil && hw.String() == allowed.String() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ARPConfig represents the ARP monitoring settings
+// ARP 监测：从 ARP 报文学习 IP-MAC 绑定，检测免费 ARP 泛洪、IP 冲突和网关 MAC 变更
+type ARPConfig struct {
+	Enabled        bool     `yaml:"enabled" json:"enabled"`
+	Gateways       []string `yaml:"gateways" json:"gateways"`               // 网关 IP，其 MAC 改变时告警
+	ConflictWindow string   `yaml:"conflict_window" json:"conflict_window"` // 同一 IP 的原 MAC 在此时间内仍出现过时，新 MAC 视为冲突
+	FloodThreshold int      `yaml:"flood_threshold" json:"flood_threshold"` // 单个 MAC 在 flood_window 内发送的免费 ARP 数达到此值时告警
+	FloodWindow    string   `yaml:"flood_window" json:"flood_window"`
+	MaxEntries     int      `yaml:"max_entries" json:"max_entries"` // IP-MAC 绑定数上限
+}
+
+// SnapshotConfig represents the alert-triggered capture snapshot settings
+// 告警快照：保留最近一段时间的数据包，规则触发时连同触发后的数据包写入证据文件
+type SnapshotConfig struct {
+	Window     string `yaml:"window" json:"window"`           // 触发前缓冲的时长上限
+	MaxPackets int    `yaml:"max_packets" json:"max_packets"` // 触发前缓冲的最大数据包数
+	MaxPost    int    `yaml:"max_post" json:"max_post"`       // 触发后录制秒数上限
+	Dir        string `yaml:"dir" json:"dir"`                 // 证据文件目录
+}
+
+// ScheduleConfig represents a recurring capture window
+// 计划抓包窗口，如 "工作日 09:00-18:00 抓取 eth0"；end 早于 start 表示跨越午夜
+type ScheduleConfig struct {
+	Name       string   `yaml:"name" json:"name"`
+	Interfaces []string `yaml:"interfaces" json:"interfaces"`
+	Days       []string `yaml:"days" json:"days"`     // mon..sun, weekdays, weekends, daily；为空表示每天
+	Start      string   `yaml:"start" json:"start"`   // HH:MM
+	End        string   `yaml:"end" json:"end"`       // HH:MM
+	Filter     string   `yaml:"filter" json:"filter"` // BPF 过滤器，为空使用 bpf_filter
+
+	// Parsed values
+	weekdays [7]bool
+	start    time.Duration
+	end      time.Duration
+}
+
+var scheduleDays = map[string][]time.Weekday{
+	"sun":      {time.Sunday},
+	"mon":      {time.Monday},
+	"tue":      {time.Tuesday},
+	"wed":      {time.Wednesday},
+	"thu":      {time.Thursday},
+	"fri":      {time.Friday},
+	"sat":      {time.Saturday},
+	"weekdays": {time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+	"weekends": {time.Saturday, time.Sunday},
+	"daily":    {time.Sunday, time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday},
+}
+
+// parse validates the window and fills the parsed values
+func (w *ScheduleConfig) parse() error {
+	if len(w.Interfaces) == 0 {
+		return fmt.Errorf("no interfaces")
+	}
+
+	days := w.Days
+	if len(days) == 0 {
+		days = []string{"daily"}
+	}
+	w.weekdays = [7]bool{}
+	for _, day := range days {
+		weekdays, ok := scheduleDays[strings.ToLower(day)]
+		if !ok {
+			return fmt.Errorf("unknown day %q", day)
+		}
+		for _, wd := range weekdays {
+			w.weekdays[wd] = true
+		}
+	}
+
+	var err error
+	if w.start, err = parseClock(w.Start); err != nil {
+		return fmt.Errorf("parse start: %w", err)
+	}
+	if w.end, err = parseClock(w.End); err != nil {
+		return fmt.Errorf("parse end: %w", err)
+	}
+	if w.start == w.end {
+		return fmt.Errorf("start and end must differ")
+	}
+	return nil
+}
+
+// parseClock parses a HH:MM time of day
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Next returns the occurrence of the window that contains t, or the next one after t
+// 按本地时区计算，窗口开始日期由 days 决定
+func (w ScheduleConfig) Next(t time.Time) (start, end time.Time, ok bool) {
+	// 从前一天开始查找，以包含跨越午夜的窗口
+	for i := -1; i <= 7; i++ {
+		day := time.Date(t.Year(), t.Month(), t.Day()+i, 0, 0, 0, 0, t.Location())
+		if !w.weekdays[day.Weekday()] {
+			continue
+		}
+		start = clockOn(day, w.start)
+		end = clockOn(day, w.end)
+		if !end.After(start) {
+			end = clockOn(day.AddDate(0, 0, 1), w.end)
+		}
+		if end.After(t) {
+			return start, end, true
+		}
+	}
+	return time.Time{}, time.Time{}, false
+}
+
+// clockOn returns the time of day on the given date (DST safe)
+func clockOn(day time.Time, clock time.Duration) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(),
+		int(clock/time.Hour), int(clock%time.Hour/time.Minute), 0, 0, day.Location())
 }
 
 // Default returns a config with default values
@@ -65,6 +355,7 @@ func Default() *Config {
 		DNSMax:           5000,
 		HTTPMax:          5000,
 		ICMPMax:          5000,
+		SessionMax:       5000,
 		PcapRotate:       10,
 		PcapSize:         "100MiB",
 		PcapCompress:     3,
@@ -77,6 +368,68 @@ func Default() *Config {
 		Promiscuous:      true,
 		Timeout:          "30ms",
 		BufferSize:       "10MiB",
+		Backend:          "pcap",
+		NanoPrecision:    true,
+		Direction:        "both",
+		AFPacket: AFPacketConfig{
+			BlockSize:     "1MiB",
+			NumBlocks:     64,
+			FanoutWorkers: 1,
+			FanoutMode:    "hash",
+		},
+		Pipeline: PipelineConfig{
+			Decode:     StageConfig{Workers: 2, QueueSize: 4096},
+			Enrich:     StageConfig{Workers: 2, QueueSize: 4096},
+			Persist:    StageConfig{Workers: 4, QueueSize: 8192},
+			Alert:      StageConfig{Workers: 2, QueueSize: 4096},
+			DropPolicy: DropNewest,
+		},
+		Sampling: SamplingConfig{
+			Mode:       SamplingOff,
+			Rate:       10,
+			AutoMethod: SamplingFlow,
+			QueueHigh:  0.8,
+			QueueLow:   0.3,
+			DropRate:   100,
+			Cooldown:   "30s",
+		},
+		Reassembly: ReassemblyConfig{
+			Enabled:         true,
+			MaxPagesTotal:   16384,
+			MaxPagesPerConn: 256,
+			MaxBuffer:       "64KiB",
+			Timeout:         "2m",
+		},
+		Defrag: DefragConfig{
+			Enabled:      true,
+			MaxMemory:    "4MiB",
+			MaxFragments: 64,
+			Timeout:      "30s",
+		},
+		DNS: DNSConfig{
+			Correlate:  true,
+			Timeout:    "5s",
+			MaxPending: 65536,
+		},
+		ICMP: ICMPConfig{
+			Correlate:       true,
+			Timeout:         "5s",
+			MaxPending:      65536,
+			MaxDestinations: 4096,
+		},
+		ARP: ARPConfig{
+			Enabled:        true,
+			ConflictWindow: "5m",
+			FloodThreshold: 20,
+			FloodWindow:    "10s",
+			MaxEntries:     65536,
+		},
+		Snapshot: SnapshotConfig{
+			Window:     "30s",
+			MaxPackets: 50000,
+			MaxPost:    300,
+			Dir:        "./data/evidence",
+		},
 	}
 }
 
@@ -137,6 +490,9 @@ func (c *Config) loadFromEnv() {
 	if v := os.Getenv("SNIF_ICMP_MAX"); v != "" {
 		fmt.Sscanf(v, "%d", &c.ICMPMax)
 	}
+	if v := os.Getenv("SNIF_SESSION_MAX"); v != "" {
+		fmt.Sscanf(v, "%d", &c.SessionMax)
+	}
 	if v := os.Getenv("SNIF_DATA_DIR"); v != "" {
 		c.DataDir = v
 	}
@@ -157,6 +513,21 @@ func (c *Config) parse() error {
 		return fmt.Errorf("parse buffer_size: %w", err)
 	}
 
+	c.afpacketBlock, err = bytesize.Parse(c.AFPacket.BlockSize)
+	if err != nil {
+		return fmt.Errorf("parse afpacket.block_size: %w", err)
+	}
+
+	c.streamBuffer, err = bytesize.Parse(c.Reassembly.MaxBuffer)
+	if err != nil {
+		return fmt.Errorf("parse reassembly.max_buffer: %w", err)
+	}
+
+	c.defragMemory, err = bytesize.Parse(c.Defrag.MaxMemory)
+	if err != nil {
+		return fmt.Errorf("parse defrag.max_memory: %w", err)
+	}
+
 	// Parse durations
 	c.timeout, err = time.ParseDuration(c.Timeout)
 	if err != nil {
@@ -168,17 +539,200 @@ func (c *Config) parse() error {
 		return fmt.Errorf("parse db_vacuum_interval: %w", err)
 	}
 
+	c.samplingCool, err = time.ParseDuration(c.Sampling.Cooldown)
+	if err != nil {
+		return fmt.Errorf("parse sampling.cooldown: %w", err)
+	}
+
+	c.streamTimeout, err = time.ParseDuration(c.Reassembly.Timeout)
+	if err != nil {
+		return fmt.Errorf("parse reassembly.timeout: %w", err)
+	}
+
+	c.defragTimeout, err = time.ParseDuration(c.Defrag.Timeout)
+	if err != nil {
+		return fmt.Errorf("parse defrag.timeout: %w", err)
+	}
+
+	c.dnsTimeout, err = time.ParseDuration(c.DNS.Timeout)
+	if err != nil {
+		return fmt.Errorf("parse dns.timeout: %w", err)
+	}
+
+	c.icmpTimeout, err = time.ParseDuration(c.ICMP.Timeout)
+	if err != nil {
+		return fmt.Errorf("parse icmp.timeout: %w", err)
+	}
+
+	c.arpConflict, err = time.ParseDuration(c.ARP.ConflictWindow)
+	if err != nil {
+		return fmt.Errorf("parse arp.conflict_window: %w", err)
+	}
+
+	c.arpFloodWindow, err = time.ParseDuration(c.ARP.FloodWindow)
+	if err != nil {
+		return fmt.Errorf("parse arp.flood_window: %w", err)
+	}
+
+	c.snapshotWindow, err = time.ParseDuration(c.Snapshot.Window)
+	if err != nil {
+		return fmt.Errorf("parse snapshot.window: %w", err)
+	}
+
 	// Validate ranges
 	if c.PcapCompress < 0 || c.PcapCompress > 9 {
 		return fmt.Errorf("pcap_compress must be 0-9, got %d", c.PcapCompress)
 	}
 
+	switch c.Direction {
+	case "in", "out", "both":
+	default:
+		return fmt.Errorf("direction must be in, out or both, got %q", c.Direction)
+	}
+
+	switch c.Backend {
+	case "pcap", "afpacket":
+	default:
+		return fmt.Errorf("backend must be pcap or afpacket, got %q", c.Backend)
+	}
+	if c.afpacketBlock.Bytes()%4096 != 0 || c.afpacketBlock.Bytes() == 0 {
+		return fmt.Errorf("afpacket.block_size must be a positive multiple of 4KiB, got %s", c.AFPacket.BlockSize)
+	}
+	if c.AFPacket.NumBlocks < 1 {
+		return fmt.Errorf("afpacket.num_blocks must be >= 1, got %d", c.AFPacket.NumBlocks)
+	}
+	if c.AFPacket.FanoutWorkers < 1 {
+		return fmt.Errorf("afpacket.fanout_workers must be >= 1, got %d", c.AFPacket.FanoutWorkers)
+	}
+	if c.AFPacket.FanoutGroup < 0 || c.AFPacket.FanoutGroup > 0xffff {
+		return fmt.Errorf("afpacket.fanout_group must be 0-65535, got %d", c.AFPacket.FanoutGroup)
+	}
+
+	stages := map[string]StageConfig{
+		"decode":  c.Pipeline.Decode,
+		"enrich":  c.Pipeline.Enrich,
+		"persist": c.Pipeline.Persist,
+		"alert":   c.Pipeline.Alert,
+	}
+	for name, stage := range stages {
+		if stage.Workers < 1 {
+			return fmt.Errorf("pipeline.%s.workers must be >= 1, got %d", name, stage.Workers)
+		}
+		if stage.QueueSize < 1 {
+			return fmt.Errorf("pipeline.%s.queue_size must be >= 1, got %d", name, stage.QueueSize)
+		}
+	}
+
+	switch c.Pipeline.DropPolicy {
+	case DropNewest, DropOldest, DropBlock:
+	default:
+		return fmt.Errorf("pipeline.drop_policy must be one of %s, %s, %s, got %q",
+			DropNewest, DropOldest, DropBlock, c.Pipeline.DropPolicy)
+	}
+
+	switch c.Sampling.Mode {
+	case SamplingOff, SamplingCount, SamplingFlow, SamplingAuto:
+	default:
+		return fmt.Errorf("sampling.mode must be one of off, count, flow, auto, got %q", c.Sampling.Mode)
+	}
+	switch c.Sampling.AutoMethod {
+	case SamplingCount, SamplingFlow:
+	default:
+		return fmt.Errorf("sampling.auto_method must be count or flow, got %q", c.Sampling.AutoMethod)
+	}
+	if c.Sampling.Rate < 1 {
+		return fmt.Errorf("sampling.rate must be >= 1, got %d", c.Sampling.Rate)
+	}
+	if c.Sampling.QueueHigh <= 0 || c.Sampling.QueueHigh > 1 || c.Sampling.QueueLow < 0 || c.Sampling.QueueLow >= c.Sampling.QueueHigh {
+		return fmt.Errorf("sampling thresholds must satisfy 0 <= queue_low < queue_high <= 1, got %v / %v",
+			c.Sampling.QueueLow, c.Sampling.QueueHigh)
+	}
+
+	if c.Reassembly.MaxPagesTotal < 0 || c.Reassembly.MaxPagesPerConn < 0 {
+		return fmt.Errorf("reassembly page limits must not be negative, got %d / %d",
+			c.Reassembly.MaxPagesTotal, c.Reassembly.MaxPagesPerConn)
+	}
+	if c.streamBuffer.Bytes() < 1024 {
+		return fmt.Errorf("reassembly.max_buffer must be at least 1KiB, got %s", c.Reassembly.MaxBuffer)
+	}
+	if c.streamTimeout <= 0 {
+		return fmt.Errorf("reassembly.timeout must be positive, got %s", c.Reassembly.Timeout)
+	}
+
+	if c.defragMemory.Bytes() < 64*1024 {
+		return fmt.Errorf("defrag.max_memory must be at least 64KiB, got %s", c.Defrag.MaxMemory)
+	}
+	if c.Defrag.MaxFragments < 2 {
+		return fmt.Errorf("defrag.max_fragments must be >= 2, got %d", c.Defrag.MaxFragments)
+	}
+	if c.defragTimeout <= 0 {
+		return fmt.Errorf("defrag.timeout must be positive, got %s", c.Defrag.Timeout)
+	}
+
+	if c.dnsTimeout <= 0 {
+		return fmt.Errorf("dns.timeout must be positive, got %s", c.DNS.Timeout)
+	}
+	if c.DNS.MaxPending < 1 {
+		return fmt.Errorf("dns.max_pending must be >= 1, got %d", c.DNS.MaxPending)
+	}
+
+	if c.icmpTimeout <= 0 {
+		return fmt.Errorf("icmp.timeout must be positive, got %s", c.ICMP.Timeout)
+	}
+	if c.ICMP.MaxPending < 1 {
+		return fmt.Errorf("icmp.max_pending must be >= 1, got %d", c.ICMP.MaxPending)
+	}
+	if c.ICMP.MaxDestinations < 1 {
+		return fmt.Errorf("icmp.max_destinations must be >= 1, got %d", c.ICMP.MaxDestinations)
+	}
+	if c.arpConflict <= 0 {
+		return fmt.Errorf("arp.conflict_window must be positive, got %s", c.ARP.ConflictWindow)
+	}
+	if c.arpFloodWindow <= 0 {
+		return fmt.Errorf("arp.flood_window must be positive, got %s", c.ARP.FloodWindow)
+	}
+	if c.ARP.FloodThreshold < 1 {
+		return fmt.Errorf("arp.flood_threshold must be >= 1, got %d", c.ARP.FloodThreshold)
+	}
+	if c.ARP.MaxEntries < 1 {
+		return fmt.Errorf("arp.max_entries must be >= 1, got %d", c.ARP.MaxEntries)
+	}
+	for i, gw := range c.ARP.Gateways {
+		if net.ParseIP(gw) == nil {
+			return fmt.Errorf("arp.gateways[%d] %q is not an IP address", i, gw)
+		}
+	}
+
+	for i, entry := range c.DHCP.AllowedServers {
+		if net.ParseIP(entry) == nil {
+			if _, err := net.ParseMAC(entry); err != nil {
+				return fmt.Errorf("dhcp.allowed_servers[%d] %q is neither an IP nor a MAC address", i, entry)
+			}
+		}
+	}
+
+	if c.snapshotWindow <= 0 {
+		return fmt.Errorf("snapshot.window must be positive, got %s", c.Snapshot.Window)
+	}
+	if c.Snapshot.MaxPackets < 1 {
+		return fmt.Errorf("snapshot.max_packets must be >= 1, got %d", c.Snapshot.MaxPackets)
+	}
+	if c.Snapshot.MaxPost < 0 {
+		return fmt.Errorf("snapshot.max_post must be >= 0, got %d", c.Snapshot.MaxPost)
+	}
+
+	for i := range c.Schedules {
+		if err := c.Schedules[i].parse(); err != nil {
+			return fmt.Errorf("schedules[%d] %q: %w", i, c.Schedules[i].Name, err)
+		}
+	}
+
 	return nil
 }
 
 // ensureDirectories creates necessary directories
 func (c *Config) ensureDirectories() error {
-	dirs := []string{c.DataDir, c.PcapDir}
+	dirs := []string{c.DataDir, c.PcapDir, c.Snapshot.Dir}
 	for _, dir := range dirs {
 		if err := os.MkdirAll(dir, 0755); err != nil {
 			return fmt.Errorf("create directory %s: %w", dir, err)
@@ -192,10 +746,11 @@ func (c *Config) GetLimits() Limits {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 	return Limits{
-		RawMax:  c.RawMax,
-		DNSMax:  c.DNSMax,
-		HTTPMax: c.HTTPMax,
-		ICMPMax: c.ICMPMax,
+		RawMax:     c.RawMax,
+		DNSMax:     c.DNSMax,
+		HTTPMax:    c.HTTPMax,
+		ICMPMax:    c.ICMPMax,
+		SessionMax: c.SessionMax,
 	}
 }
 
@@ -207,6 +762,7 @@ func (c *Config) UpdateLimits(limits Limits) {
 	c.DNSMax = limits.DNSMax
 	c.HTTPMax = limits.HTTPMax
 	c.ICMPMax = limits.ICMPMax
+	c.SessionMax = limits.SessionMax
 }
 
 // GetPcapSizeBytes returns the parsed PCAP size in bytes
@@ -230,6 +786,97 @@ func (c *Config) GetTimeout() time.Duration {
 	return c.timeout
 }
 
+// GetBackend returns the configured capture backend
+func (c *Config) GetBackend() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Backend
+}
+
+// GetBPFFilter returns the default capture filter
+func (c *Config) GetBPFFilter() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.BPFFilter
+}
+
+// GetAFPacket returns the AF_PACKET backend settings and the parsed block size in bytes
+func (c *Config) GetAFPacket() (AFPacketConfig, int64) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.AFPacket, c.afpacketBlock.Bytes()
+}
+
+// GetPipeline returns the processing pipeline settings
+func (c *Config) GetPipeline() PipelineConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Pipeline
+}
+
+// GetSampling returns the packet sampling settings and the parsed cooldown
+func (c *Config) GetSampling() (SamplingConfig, time.Duration) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Sampling, c.samplingCool
+}
+
+// GetReassembly returns the TCP reassembly settings, the parsed parser buffer limit in bytes and the idle timeout
+func (c *Config) GetReassembly() (ReassemblyConfig, int64, time.Duration) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Reassembly, c.streamBuffer.Bytes(), c.streamTimeout
+}
+
+// GetDefrag returns the IP fragment reassembly settings, the parsed memory limit in bytes and the fragment timeout
+func (c *Config) GetDefrag() (DefragConfig, int64, time.Duration) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Defrag, c.defragMemory.Bytes(), c.defragTimeout
+}
+
+// GetDNS returns the DNS correlation settings and the parsed response timeout
+func (c *Config) GetDNS() (DNSConfig, time.Duration) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.DNS, c.dnsTimeout
+}
+
+// GetICMP returns the ICMP analysis settings and the parsed echo timeout
+func (c *Config) GetICMP() (ICMPConfig, time.Duration) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.ICMP, c.icmpTimeout
+}
+
+// GetARP returns the ARP monitoring settings, the parsed conflict window and flood window
+func (c *Config) GetARP() (ARPConfig, time.Duration, time.Duration) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.ARP, c.arpConflict, c.arpFloodWindow
+}
+
+// GetDHCP returns the DHCP monitoring settings
+func (c *Config) GetDHCP() DHCPConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.DHCP
+}
+
+// GetSnapshot returns the alert snapshot settings and the parsed pre-trigger window
+func (c *Config) GetSnapshot() (SnapshotConfig, time.Duration) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Snapshot, c.snapshotWindow
+}
+
+// GetSchedules returns the scheduled capture windows
+func (c *Config) GetSchedules() []ScheduleConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]ScheduleConfig(nil), c.Schedules...)
+}
+
 // GetVacuumInterval returns the parsed vacuum interval
 func (c *Config) GetVacuumInterval() time.Duration {
 	c.mu.RLock()
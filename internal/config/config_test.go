@@ -0,0 +1,64 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	// 2024-01-01 为周一
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, 1, day, hour, minute, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name       string
+		days       []string
+		start, end string
+		t          time.Time
+		wantStart  time.Time
+		wantEnd    time.Time
+	}{
+		{"inside a weekday window", []string{"weekdays"}, "09:00", "18:00", at(1, 10, 0), at(1, 9, 0), at(1, 18, 0)},
+		{"before the window", []string{"weekdays"}, "09:00", "18:00", at(1, 8, 59), at(1, 9, 0), at(1, 18, 0)},
+		{"at the end of the window", []string{"weekdays"}, "09:00", "18:00", at(1, 18, 0), at(2, 9, 0), at(2, 18, 0)},
+		{"friday evening skips the weekend", []string{"weekdays"}, "09:00", "18:00", at(5, 19, 0), at(8, 9, 0), at(8, 18, 0)},
+		{"weekend", []string{"weekends"}, "10:00", "12:00", at(3, 11, 0), at(6, 10, 0), at(6, 12, 0)},
+		{"overnight before midnight", nil, "22:00", "06:00", at(1, 23, 0), at(1, 22, 0), at(2, 6, 0)},
+		{"overnight after midnight", nil, "22:00", "06:00", at(2, 2, 0), at(1, 22, 0), at(2, 6, 0)},
+		{"overnight ended, next the same evening", nil, "22:00", "06:00", at(2, 6, 0), at(2, 22, 0), at(3, 6, 0)},
+		{"overnight started on an allowed day ends on another", []string{"sat"}, "22:00", "02:00", at(7, 1, 0), at(6, 22, 0), at(7, 2, 0)},
+		{"overnight next week", []string{"sat"}, "22:00", "02:00", at(7, 3, 0), at(13, 22, 0), at(14, 2, 0)},
+		{"consecutive days", []string{"mon", "tue"}, "00:00", "23:59", at(1, 23, 59), at(2, 0, 0), at(2, 23, 59)},
+		{"after the last day of the week", []string{"mon", "tue"}, "00:00", "23:59", at(2, 23, 59), at(8, 0, 0), at(8, 23, 59)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := ScheduleConfig{Name: tt.name, Interfaces: []string{"eth0"}, Days: tt.days, Start: tt.start, End: tt.end}
+			if err := w.parse(); err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			start, end, ok := w.Next(tt.t)
+			if !ok || !start.Equal(tt.wantStart) || !end.Equal(tt.wantEnd) {
+				t.Errorf("Next(%v) = %v - %v, %v; want %v - %v", tt.t, start, end, ok, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestScheduleParseInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		w    ScheduleConfig
+	}{
+		{"no interfaces", ScheduleConfig{Start: "09:00", End: "18:00"}},
+		{"unknown day", ScheduleConfig{Interfaces: []string{"eth0"}, Days: []string{"someday"}, Start: "09:00", End: "18:00"}},
+		{"bad clock", ScheduleConfig{Interfaces: []string{"eth0"}, Start: "9am", End: "18:00"}},
+		{"empty window", ScheduleConfig{Interfaces: []string{"eth0"}, Start: "09:00", End: "09:00"}},
+	}
+	for _, tt := range tests {
+		if err := tt.w.parse(); err == nil {
+			t.Errorf("%s: parse succeeded", tt.name)
+		}
+	}
+}
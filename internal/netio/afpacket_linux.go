@@ -0,0 +1,337 @@
+//go:build linux
+
+package netio
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/gopacket/afpacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+	"golang.org/x/net/bpf"
+	"golang.org/x/sys/unix"
+	"sniffer/pkg/model"
+)
+
+// afpacketHandle captures packets from an AF_PACKET TPACKET_V3 memory-mapped ring
+// Linux 内核环形缓冲区抓包句柄，可通过 PACKET_FANOUT 让多个句柄分担同一网卡
+type afpacketHandle struct {
+	// mu 保证 Close 时没有正在进行的读取（关闭会 munmap 环形缓冲区）
+	mu        sync.Mutex
+	tpacket   *afpacket.TPacket
+	promiscFD int
+	snaplen   int
+	direction string          // in, out, both；通过过滤器中的包类型判断实现
+	linkType  layers.LinkType // 由网卡的 ARPHRD 类型确定
+	settings  model.CaptureSettings
+	closed    atomic.Bool
+}
+
+// OpenAFPacket opens a network interface using an AF_PACKET TPACKET_V3 ring
+func OpenAFPacket(name string, opts AFPacketOptions) (Handle, error) {
+	fanoutType, err := parseFanoutMode(opts.FanoutMode)
+	if err != nil {
+		return nil, err
+	}
+	direction := opts.Direction
+	if direction == "" {
+		direction = DirectionBoth
+	}
+	if direction != DirectionIn && direction != DirectionOut && direction != DirectionBoth {
+		return nil, fmt.Errorf("unknown direction %q", opts.Direction)
+	}
+
+	pollTimeout := opts.PollTimeout
+	if pollTimeout <= 0 {
+		pollTimeout = 100 * time.Millisecond
+	}
+
+	linkType, err := interfaceLinkType(name)
+	if err != nil {
+		return nil, err
+	}
+
+	tpacket, err := afpacket.NewTPacket(
+		afpacket.OptInterface(name),
+		afpacket.OptTPacketVersion(afpacket.TPacketVersion3),
+		afpacket.OptBlockSize(opts.BlockSize),
+		afpacket.OptNumBlocks(opts.NumBlocks),
+		afpacket.OptPollTimeout(pollTimeout),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("open af_packet on %s: %w", name, err)
+	}
+
+	h := &afpacketHandle{
+		tpacket:   tpacket,
+		promiscFD: -1,
+		snaplen:   opts.SnapLen,
+		direction: direction,
+		linkType:  linkType,
+		settings: model.CaptureSettings{
+			Backend:         BackendAFPacket,
+			LinkType:        linkType.String(),
+			SnapLen:         opts.SnapLen,
+			Promiscuous:     opts.Promiscuous,
+			Timeout:         pollTimeout.String(),
+			BufferSize:      int64(opts.BlockSize) * int64(opts.NumBlocks),
+			ImmediateMode:   false,
+			TimestampSource: "host",
+			Precision:       "nano", // TPACKET_V3 始终提供纳秒时间戳
+			Direction:       direction,
+		},
+	}
+
+	// 只抓一个方向时即使没有过滤器也要下发包类型判断
+	if direction != DirectionBoth {
+		if err := h.SetBPFFilter(""); err != nil {
+			tpacket.Close()
+			return nil, fmt.Errorf("set direction %s on %s: %w", direction, name, err)
+		}
+	}
+
+	if opts.FanoutWorkers > 1 {
+		if err := tpacket.SetFanout(fanoutType, opts.FanoutGroup); err != nil {
+			tpacket.Close()
+			return nil, fmt.Errorf("join fanout group %d on %s: %w", opts.FanoutGroup, name, err)
+		}
+	}
+
+	if opts.Promiscuous {
+		fd, err := enablePromisc(name)
+		if err != nil {
+			tpacket.Close()
+			return nil, fmt.Errorf("enable promiscuous mode on %s: %w", name, err)
+		}
+		h.promiscFD = fd
+	}
+
+	return h, nil
+}
+
+// ARPHRD_* device types (include/uapi/linux/if_arp.h)
+const (
+	arphrdEther     = 1
+	arphrdIEEE802   = 6
+	arphrdPPP       = 512
+	arphrdRawIP     = 519
+	arphrdTunnel    = 768
+	arphrdTunnel6   = 769
+	arphrdLoopback  = 772
+	arphrdFDDI      = 774
+	arphrdSIT       = 776
+	arphrdIEEE80211 = 801
+	arphrdRadiotap  = 803
+	arphrdNone      = 0xfffe
+)
+
+// arphrdLinkType maps the ARPHRD type of an interface to the link type of its AF_PACKET SOCK_RAW frames
+// 参考 libpcap map_arphrd_to_dlt；没有链路层头部的设备（TUN、PPP、IP 隧道）交付的是裸 IP 报文
+func arphrdLinkType(arphrd int) (layers.LinkType, bool) {
+	switch arphrd {
+	case arphrdEther, arphrdLoopback:
+		// 回环网卡同样带有（全零地址的）以太网头部
+		return layers.LinkTypeEthernet, true
+	case arphrdIEEE802:
+		return layers.LinkTypeTokenRing, true
+	case arphrdFDDI:
+		return layers.LinkTypeFDDI, true
+	case arphrdIEEE80211:
+		return layers.LinkTypeIEEE802_11, true
+	case arphrdRadiotap:
+		return layers.LinkTypeIEEE80211Radio, true
+	case arphrdNone, arphrdRawIP, arphrdPPP, arphrdTunnel, arphrdTunnel6, arphrdSIT:
+		return layers.LinkTypeRaw, true
+	}
+	return 0, false
+}
+
+// interfaceLinkType reads the ARPHRD type of an interface from sysfs and maps it to a link type
+func interfaceLinkType(name string) (layers.LinkType, error) {
+	data, err := os.ReadFile(filepath.Join("/sys/class/net", name, "type"))
+	if err != nil {
+		return 0, fmt.Errorf("read device type of %s: %w", name, err)
+	}
+	arphrd, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("parse device type of %s: %w", name, err)
+	}
+	linkType, ok := arphrdLinkType(arphrd)
+	if !ok {
+		return 0, fmt.Errorf("af_packet on %s: unsupported device type %d", name, arphrd)
+	}
+	return linkType, nil
+}
+
+// enablePromisc keeps the interface in promiscuous mode while the returned socket is open
+// 通过 PACKET_MR_PROMISC 成员关系开启混杂模式，套接字关闭后内核自动恢复
+func enablePromisc(name string) (int, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return -1, err
+	}
+
+	// protocol 0: 该套接字不接收任何数据包，仅用于持有混杂模式
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_RAW, 0)
+	if err != nil {
+		return -1, err
+	}
+
+	mreq := unix.PacketMreq{
+		Ifindex: int32(iface.Index),
+		Type:    unix.PACKET_MR_PROMISC,
+	}
+	if err := unix.SetsockoptPacketMreq(fd, unix.SOL_PACKET, unix.PACKET_ADD_MEMBERSHIP, &mreq); err != nil {
+		unix.Close(fd)
+		return -1, err
+	}
+
+	return fd, nil
+}
+
+func parseFanoutMode(mode string) (afpacket.FanoutType, error) {
+	switch mode {
+	case "", "hash":
+		return afpacket.FanoutHash, nil
+	case "lb":
+		return afpacket.FanoutLoadBalance, nil
+	case "cpu":
+		return afpacket.FanoutCPU, nil
+	case "rollover":
+		return afpacket.FanoutRollover, nil
+	case "random":
+		return afpacket.FanoutRandom, nil
+	case "qm":
+		return afpacket.FanoutQueueMapping, nil
+	default:
+		return 0, fmt.Errorf("unknown fanout mode %q", mode)
+	}
+}
+
+func (h *afpacketHandle) ReadPacketData() ([]byte, CaptureInfo, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed.Load() {
+		return nil, CaptureInfo{}, ErrHandleClosed
+	}
+
+	data, ci, err := h.tpacket.ReadPacketData()
+	if err != nil {
+		return nil, CaptureInfo{}, err
+	}
+
+	// AF_PACKET 不按 snaplen 截断，这里与 pcap 行为保持一致
+	if h.snaplen > 0 && len(data) > h.snaplen {
+		data = data[:h.snaplen]
+	}
+
+	info := CaptureInfo{
+		Timestamp:      ci.Timestamp.UnixNano(),
+		CaptureLength:  len(data),
+		Length:         ci.Length,
+		InterfaceIndex: ci.InterfaceIndex,
+		LinkType:       int(h.linkType),
+	}
+	// 网卡卸载的 VLAN 标签通过辅助数据返回
+	for _, ad := range ci.AncillaryData {
+		if vlan, ok := ad.(afpacket.AncillaryVLAN); ok {
+			info.VLANID = uint16(vlan.VLAN)
+		}
+	}
+
+	return data, info, nil
+}
+
+// directionFilter returns the instructions put in front of the filter to capture a single direction
+// 读取包类型（SKF_AD_PKTTYPE）：本机发出的数据包为 PACKET_OUTGOING，方向不符时返回 0 丢弃
+func directionFilter(direction string) ([]bpf.RawInstruction, error) {
+	var skipIfOutgoing, skipIfIncoming uint8
+	switch direction {
+	case DirectionIn:
+		skipIfIncoming = 1
+	case DirectionOut:
+		skipIfOutgoing = 1
+	default:
+		return nil, nil
+	}
+	return bpf.Assemble([]bpf.Instruction{
+		bpf.LoadExtension{Num: bpf.ExtType},
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: unix.PACKET_OUTGOING, SkipTrue: skipIfOutgoing, SkipFalse: skipIfIncoming},
+		bpf.RetConstant{Val: 0},
+	})
+}
+
+// SetBPFFilter compiles the filter with libpcap and attaches it to the socket
+// 空过滤器编译为接受全部数据包的程序，用于清除已设置的过滤器；只抓一个方向时在前面加上包类型判断
+func (h *afpacketHandle) SetBPFFilter(filter string) error {
+	snaplen := h.snaplen
+	if snaplen <= 0 {
+		snaplen = 65535
+	}
+
+	insns, err := pcap.CompileBPFFilter(h.linkType, snaplen, filter)
+	if err != nil {
+		return fmt.Errorf("%w %q: %v", ErrInvalidFilter, filter, err)
+	}
+
+	// cBPF 只有向前的相对跳转，前置指令不影响过滤器内的跳转目标
+	raw, err := directionFilter(h.direction)
+	if err != nil {
+		return fmt.Errorf("assemble direction filter: %w", err)
+	}
+	for _, ins := range insns {
+		raw = append(raw, bpf.RawInstruction{Op: ins.Code, Jt: ins.Jt, Jf: ins.Jf, K: ins.K})
+	}
+
+	if err := h.tpacket.SetBPF(raw); err != nil {
+		return fmt.Errorf("attach filter %q: %w", filter, err)
+	}
+	return nil
+}
+
+// Stats returns the socket statistics, including TPACKET_V3 queue freezes
+func (h *afpacketHandle) Stats() (Stats, error) {
+	_, stats, err := h.tpacket.SocketStats()
+	if err != nil {
+		return Stats{}, err
+	}
+
+	return Stats{
+		PacketsReceived: int(stats.Packets()),
+		PacketsDropped:  int(stats.Drops()),
+		QueueFreezes:    int(stats.QueueFreezes()),
+	}, nil
+}
+
+func (h *afpacketHandle) Settings() model.CaptureSettings {
+	return h.settings
+}
+
+// LinkType returns the link type of the interface: AF_PACKET SOCK_RAW 套接字交付设备的完整链路层帧
+func (h *afpacketHandle) LinkType() int {
+	return int(h.linkType)
+}
+
+func (h *afpacketHandle) Close() {
+	if h.closed.Swap(true) {
+		return
+	}
+
+	// 等待进行中的读取返回（最长一个 poll 超时）
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.tpacket.Close()
+	if h.promiscFD >= 0 {
+		unix.Close(h.promiscFD)
+	}
+}
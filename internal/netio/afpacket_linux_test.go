@@ -0,0 +1,107 @@
+//go:build linux
+
+package netio
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/gopacket/layers"
+	"golang.org/x/sys/unix"
+)
+
+func TestDirectionFilter(t *testing.T) {
+	tests := []struct {
+		direction string
+		incoming  bool // 是否接受其他主机发来的数据包
+		outgoing  bool // 是否接受本机发出的数据包
+	}{
+		{DirectionIn, true, false},
+		{DirectionOut, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.direction, func(t *testing.T) {
+			raw, err := directionFilter(tt.direction)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(raw) != 3 {
+				t.Fatalf("got %d instructions, want 3", len(raw))
+			}
+			// 按条件跳转的结果判断：落在第 3 条（ret 0）为丢弃，跳过它进入过滤器为接受
+			accepts := func(pktType uint32) bool {
+				skip := raw[1].Jf
+				if pktType == raw[1].K {
+					skip = raw[1].Jt
+				}
+				return skip == 1
+			}
+			if raw[1].K != unix.PACKET_OUTGOING {
+				t.Fatalf("compares packet type with %d, want PACKET_OUTGOING", raw[1].K)
+			}
+			if got := accepts(unix.PACKET_HOST); got != tt.incoming {
+				t.Errorf("accepts incoming = %v, want %v", got, tt.incoming)
+			}
+			if got := accepts(unix.PACKET_OUTGOING); got != tt.outgoing {
+				t.Errorf("accepts outgoing = %v, want %v", got, tt.outgoing)
+			}
+		})
+	}
+
+	if raw, err := directionFilter(DirectionBoth); err != nil || raw != nil {
+		t.Errorf("directionFilter(both) = %v, %v; want no instructions", raw, err)
+	}
+}
+
+func TestFanoutGroupOffset(t *testing.T) {
+	lo, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Skip("no loopback interface")
+	}
+	if got, want := FanoutGroupOffset(100, "lo"), uint16(100+lo.Index); got != want {
+		t.Errorf("FanoutGroupOffset(100, lo) = %d, want %d", got, want)
+	}
+	if got := FanoutGroupOffset(100, "no-such-interface0"); got != FanoutGroupID("no-such-interface0") {
+		t.Errorf("FanoutGroupOffset for a missing interface = %d, want the generated group", got)
+	}
+}
+
+func TestARPHRDLinkType(t *testing.T) {
+	tests := []struct {
+		name   string
+		arphrd int
+		want   layers.LinkType
+		ok     bool
+	}{
+		{"ethernet", arphrdEther, layers.LinkTypeEthernet, true},
+		{"loopback", arphrdLoopback, layers.LinkTypeEthernet, true},
+		{"tun", arphrdNone, layers.LinkTypeRaw, true},
+		{"raw IP", arphrdRawIP, layers.LinkTypeRaw, true},
+		{"PPP", arphrdPPP, layers.LinkTypeRaw, true},
+		{"IPIP tunnel", arphrdTunnel, layers.LinkTypeRaw, true},
+		{"SIT tunnel", arphrdSIT, layers.LinkTypeRaw, true},
+		{"802.11 monitor", arphrdRadiotap, layers.LinkTypeIEEE80211Radio, true},
+		{"802.11", arphrdIEEE80211, layers.LinkTypeIEEE802_11, true},
+		{"token ring", arphrdIEEE802, layers.LinkTypeTokenRing, true},
+		{"FDDI", arphrdFDDI, layers.LinkTypeFDDI, true},
+		{"CAN", 280, 0, false},
+		{"InfiniBand", 32, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := arphrdLinkType(tt.arphrd)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("arphrdLinkType(%d) = %v, %v; want %v, %v", tt.arphrd, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+
+	if _, err := net.InterfaceByName("lo"); err == nil {
+		if got, err := interfaceLinkType("lo"); err != nil || got != layers.LinkTypeEthernet {
+			t.Errorf("interfaceLinkType(lo) = %v, %v; want Ethernet", got, err)
+		}
+	}
+	if _, err := interfaceLinkType("no-such-interface0"); err == nil {
+		t.Error("interfaceLinkType accepted a missing interface")
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package netio
+
+import "fmt"
+
+// OpenAFPacket is only available on Linux
+func OpenAFPacket(name string, opts AFPacketOptions) (Handle, error) {
+	return nil, fmt.Errorf("open %s: %w", name, ErrBackendUnsupported)
+}
@@ -0,0 +1,86 @@
+package netio
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+)
+
+// LINKTYPE_LINUX_SLL2 header lengths
+const (
+	linkTypeSLL2  = 276
+	sllHeaderLen  = 16
+	sll2HeaderLen = 20
+)
+
+// bpfLinkType returns the gopacket link type a filter is compiled for
+// gopacket 的链路类型为 uint8，无法编译 SLL2；SLL2 按 SLL 编译，匹配前转换报文头
+func bpfLinkType(linkType int) (layers.LinkType, error) {
+	if linkType == linkTypeSLL2 {
+		return layers.LinkTypeLinuxSLL, nil
+	}
+	if linkType < 0 || linkType > 0xff {
+		return 0, fmt.Errorf("BPF filter is not supported for link type %d", linkType)
+	}
+	return layers.LinkType(linkType), nil
+}
+
+// CanFilter reports whether BPF filters can be compiled for the link type
+func CanFilter(linkType int) bool {
+	_, err := bpfLinkType(linkType)
+	return err == nil
+}
+
+// BPFFilter is a BPF filter compiled for a link type and matched in user space
+// 不能并发使用（SLL2 转换复用缓冲区）
+type BPFFilter struct {
+	bpf  *pcap.BPF
+	sll2 bool
+	buf  []byte
+}
+
+// NewBPFFilter compiles the filter for the given LINKTYPE_* value
+func NewBPFFilter(linkType, snaplen int, filter string) (*BPFFilter, error) {
+	lt, err := bpfLinkType(linkType)
+	if err != nil {
+		return nil, err
+	}
+	if snaplen <= 0 {
+		snaplen = 65535
+	}
+	bpf, err := pcap.NewBPF(lt, snaplen, filter)
+	if err != nil {
+		return nil, fmt.Errorf("%w %q: %v", ErrInvalidFilter, filter, err)
+	}
+	return &BPFFilter{bpf: bpf, sll2: linkType == linkTypeSLL2}, nil
+}
+
+// Matches reports whether the packet matches the filter
+func (f *BPFFilter) Matches(ci gopacket.CaptureInfo, data []byte) bool {
+	if f.sll2 {
+		if len(data) < sll2HeaderLen {
+			return false
+		}
+		f.buf = sll2ToSLL(f.buf[:0], data)
+		ci.CaptureLength -= sll2HeaderLen - sllHeaderLen
+		ci.Length -= sll2HeaderLen - sllHeaderLen
+		data = f.buf
+	}
+	return f.bpf.Matches(ci, data)
+}
+
+// sll2ToSLL appends the packet with its SLL2 header replaced by the equivalent SLL header to dst
+// SLL 没有网卡索引，其余字段一一对应
+func sll2ToSLL(dst, data []byte) []byte {
+	var header [sllHeaderLen]byte
+	binary.BigEndian.PutUint16(header[0:2], uint16(data[10])) // 包类型
+	copy(header[2:4], data[8:10])                             // ARPHRD 类型
+	header[5] = data[11]                                      // 地址长度
+	copy(header[6:14], data[12:20])                           // 链路层地址
+	copy(header[14:16], data[0:2])                            // 协议类型
+	dst = append(dst, header[:]...)
+	return append(dst, data[sll2HeaderLen:]...)
+}
@@ -0,0 +1,68 @@
+package netio
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+func TestSLL2ToSLL(t *testing.T) {
+	payload := []byte{0x45, 0x00, 0x00, 0x14}
+	sll2 := append([]byte{
+		0x08, 0x00, // 协议类型 IPv4
+		0x00, 0x00, // 保留
+		0x00, 0x00, 0x00, 0x03, // 网卡索引
+		0x00, 0x01, // ARPHRD_ETHER
+		0x04,                                           // PACKET_OUTGOING
+		0x06,                                           // 地址长度
+		0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x00, 0x00, // 地址
+	}, payload...)
+
+	got := sll2ToSLL(nil, sll2)
+	want := append([]byte{
+		0x00, 0x04, // PACKET_OUTGOING
+		0x00, 0x01, // ARPHRD_ETHER
+		0x00, 0x06, // 地址长度
+		0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x00, 0x00,
+		0x08, 0x00,
+	}, payload...)
+	if !bytes.Equal(got, want) {
+		t.Fatalf("sll2ToSLL = % x, want % x", got, want)
+	}
+
+	// 转换结果按 SLL 解码应得到相同的字段
+	packet := gopacket.NewPacket(got, layers.LayerTypeLinuxSLL, gopacket.Default)
+	sll, ok := packet.Layer(layers.LayerTypeLinuxSLL).(*layers.LinuxSLL)
+	if !ok {
+		t.Fatalf("converted packet is not SLL: %v", packet)
+	}
+	if sll.PacketType != layers.LinuxSLLPacketTypeOutgoing || sll.EthernetType != layers.EthernetTypeIPv4 ||
+		sll.AddrType != 1 || !bytes.Equal(sll.Addr, sll2[12:18]) {
+		t.Errorf("converted header = %+v", sll)
+	}
+}
+
+func TestBPFLinkType(t *testing.T) {
+	tests := []struct {
+		linkType int
+		want     layers.LinkType
+		ok       bool
+	}{
+		{int(layers.LinkTypeEthernet), layers.LinkTypeEthernet, true},
+		{int(layers.LinkTypeLinuxSLL), layers.LinkTypeLinuxSLL, true},
+		{linkTypeSLL2, layers.LinkTypeLinuxSLL, true},
+		{int(layers.LinkTypeRaw), layers.LinkTypeRaw, true},
+		{300, 0, false},
+	}
+	for _, tt := range tests {
+		got, err := bpfLinkType(tt.linkType)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("bpfLinkType(%d) = %v, %v; want %v, ok=%v", tt.linkType, got, err, tt.want, tt.ok)
+		}
+		if CanFilter(tt.linkType) != tt.ok {
+			t.Errorf("CanFilter(%d) = %v, want %v", tt.linkType, !tt.ok, tt.ok)
+		}
+	}
+}
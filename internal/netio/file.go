@@ -0,0 +1,306 @@
+package netio
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"sniffer/pkg/model"
+)
+
+var ErrHandleClosed = errors.New("capture handle closed")
+
+// packetReader is implemented by both pcapgo.Reader and pcapgo.NgReader
+type packetReader interface {
+	ReadPacketData() ([]byte, gopacket.CaptureInfo, error)
+	LinkType() layers.LinkType
+}
+
+// FileHandle replays packets from a saved .pcap / .pcap.gz / pcapng file
+// 离线文件回放句柄
+type FileHandle struct {
+	mu       sync.Mutex
+	path     string
+	file     *os.File
+	gzReader *gzip.Reader
+	reader   packetReader
+	linkType int  // LINKTYPE_* 值（不受 layers.LinkType uint8 截断影响）
+	nanos    bool // pcap 文件头表明时间戳为纳秒精度
+	bpf      *BPFFilter
+
+	// Replay pacing
+	// speed <= 0: 尽可能快; 1: 原始时序; >1: 加速回放
+	speed     float64
+	firstTS   time.Time
+	wallStart time.Time
+
+	// Progress
+	totalBytes int64
+	readBytes  atomic.Int64
+	packets    atomic.Int64
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// countingReader counts bytes read from the underlying file for progress reporting
+type countingReader struct {
+	r io.Reader
+	n *atomic.Int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n.Add(int64(n))
+	return n, err
+}
+
+// OpenFile opens a capture file for replay.
+// The format (pcap / pcapng, optionally gzip-compressed) is detected from the file content.
+func OpenFile(path string, speed float64) (*FileHandle, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open file %s: %w", path, err)
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("stat file %s: %w", path, err)
+	}
+
+	h := &FileHandle{
+		path:       path,
+		file:       file,
+		speed:      speed,
+		totalBytes: stat.Size(),
+		closed:     make(chan struct{}),
+	}
+
+	br := bufio.NewReader(&countingReader{r: file, n: &h.readBytes})
+
+	// gzip magic: 1f 8b
+	var r io.Reader = br
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gzReader, err := gzip.NewReader(br)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("create gzip reader: %w", err)
+		}
+		h.gzReader = gzReader
+		r = gzReader
+	}
+
+	// pcapng section header block: 0a 0d 0d 0a
+	pr := bufio.NewReader(r)
+	magic, err := pr.Peek(4)
+	if err != nil {
+		h.Close()
+		return nil, fmt.Errorf("read file header: %w", err)
+	}
+
+	if bytes.Equal(magic, []byte{0x0a, 0x0d, 0x0d, 0x0a}) {
+		ngReader, err := pcapgo.NewNgReader(pr, pcapgo.DefaultNgReaderOptions)
+		if err != nil {
+			h.Close()
+			return nil, fmt.Errorf("create pcapng reader: %w", err)
+		}
+		h.reader = ngReader
+		h.linkType = linkTypeValue(ngReader.LinkType())
+	} else {
+		// pcap 文件头第 20-24 字节为完整的链路层类型
+		header, err := pr.Peek(24)
+		if err != nil {
+			h.Close()
+			return nil, fmt.Errorf("read pcap header: %w", err)
+		}
+		pcapReader, err := pcapgo.NewReader(pr)
+		if err != nil {
+			h.Close()
+			return nil, fmt.Errorf("create pcap reader: %w", err)
+		}
+		h.reader = pcapReader
+		h.linkType = pcapHeaderLinkType(header)
+		h.nanos = pcapHeaderNanos(header)
+	}
+
+	return h, nil
+}
+
+func (h *FileHandle) ReadPacketData() ([]byte, CaptureInfo, error) {
+	for {
+		select {
+		case <-h.closed:
+			return nil, CaptureInfo{}, ErrHandleClosed
+		default:
+		}
+
+		h.mu.Lock()
+		data, ci, err := h.reader.ReadPacketData()
+		bpf := h.bpf
+		h.mu.Unlock()
+		if err != nil {
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				// 截断的文件按正常结束处理
+				err = io.EOF
+			}
+			return nil, CaptureInfo{}, err
+		}
+
+		if bpf != nil && !bpf.Matches(ci, data) {
+			continue
+		}
+
+		if !h.pace(ci.Timestamp) {
+			return nil, CaptureInfo{}, ErrHandleClosed
+		}
+
+		h.packets.Add(1)
+		return data, CaptureInfo{
+			Timestamp:      ci.Timestamp.UnixNano(),
+			CaptureLength:  ci.CaptureLength,
+			Length:         ci.Length,
+			InterfaceIndex: ci.InterfaceIndex,
+			LinkType:       h.linkType,
+		}, nil
+	}
+}
+
+// pcapHeaderLinkType extracts the link type from a classic pcap file header
+func pcapHeaderLinkType(header []byte) int {
+	var order binary.ByteOrder = binary.BigEndian
+	// 小端序文件的 magic 为 d4 c3 b2 a1 (微秒) 或 4d 3c b2 a1 (纳秒)
+	if header[0] == 0xd4 || header[0] == 0x4d {
+		order = binary.LittleEndian
+	}
+	return int(order.Uint32(header[20:24]) & 0xffff)
+}
+
+// pcapHeaderNanos reports whether a classic pcap file header has the nanosecond magic (a1 b2 3c 4d)
+// pcapgo.Reader.Resolution 在 gopacket v1.1.19 中结果相反，不能使用
+func pcapHeaderNanos(header []byte) bool {
+	return bytes.Equal(header[:4], []byte{0xa1, 0xb2, 0x3c, 0x4d}) || bytes.Equal(header[:4], []byte{0x4d, 0x3c, 0xb2, 0xa1})
+}
+
+// pace sleeps until the packet is due according to the replay speed.
+// Returns false if the handle was closed while waiting.
+func (h *FileHandle) pace(ts time.Time) bool {
+	if h.speed <= 0 {
+		return true
+	}
+
+	if h.wallStart.IsZero() {
+		h.firstTS = ts
+		h.wallStart = time.Now()
+		return true
+	}
+
+	offset := time.Duration(float64(ts.Sub(h.firstTS)) / h.speed)
+	wait := time.Until(h.wallStart.Add(offset))
+	if wait <= 0 {
+		return true
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-h.closed:
+		return false
+	}
+}
+
+// SetBPFFilter compiles the filter for the file's link type and applies it in user space
+func (h *FileHandle) SetBPFFilter(filter string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if filter == "" {
+		h.bpf = nil
+		return nil
+	}
+
+	bpf, err := NewBPFFilter(h.linkType, 65535, filter)
+	if err != nil {
+		return err
+	}
+	h.bpf = bpf
+	return nil
+}
+
+func (h *FileHandle) Stats() (Stats, error) {
+	return Stats{
+		PacketsReceived: int(h.packets.Load()),
+	}, nil
+}
+
+func (h *FileHandle) LinkType() int {
+	return h.linkType
+}
+
+// Settings reports the properties of the replayed file
+func (h *FileHandle) Settings() model.CaptureSettings {
+	settings := model.CaptureSettings{
+		Backend:         "file",
+		LinkType:        linkTypeName(h.linkType),
+		TimestampSource: "file",
+		Precision:       "micro",
+		Direction:       DirectionBoth,
+	}
+	switch r := h.reader.(type) {
+	case *pcapgo.Reader:
+		settings.SnapLen = int(r.Snaplen())
+		if h.nanos {
+			settings.Precision = "nano"
+		}
+	case *pcapgo.NgReader:
+		if intf, err := r.Interface(0); err == nil {
+			settings.SnapLen = int(intf.SnapLength)
+			if intf.TimestampResolution.ToTimestampResolution().ToDuration() < time.Microsecond {
+				settings.Precision = "nano"
+			}
+		}
+	}
+	return settings
+}
+
+func (h *FileHandle) Close() {
+	h.closeOnce.Do(func() {
+		close(h.closed)
+		if h.gzReader != nil {
+			h.gzReader.Close()
+		}
+		h.file.Close()
+	})
+}
+
+// Path returns the replayed file path
+func (h *FileHandle) Path() string {
+	return h.path
+}
+
+// Speed returns the replay speed multiplier
+func (h *FileHandle) Speed() float64 {
+	return h.speed
+}
+
+// Progress returns the number of packets replayed, bytes consumed from the file and the file size
+func (h *FileHandle) Progress() (packets, readBytes, totalBytes int64) {
+	readBytes = h.readBytes.Load()
+	if readBytes > h.totalBytes {
+		readBytes = h.totalBytes
+	}
+	return h.packets.Load(), readBytes, h.totalBytes
+}
@@ -0,0 +1,251 @@
+package netio
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+// testFrame returns an Ethernet/IPv4/UDP frame to the given destination port
+func testFrame(t *testing.T, dstPort uint16) []byte {
+	t.Helper()
+	eth := &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{0, 1, 2, 3, 4, 5},
+		DstMAC:       net.HardwareAddr{0, 1, 2, 3, 4, 6},
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolUDP, SrcIP: net.IP{10, 0, 0, 1}, DstIP: net.IP{10, 0, 0, 2}}
+	udp := &layers.UDP{SrcPort: 5000, DstPort: layers.UDPPort(dstPort)}
+	udp.SetNetworkLayerForChecksum(ip)
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, eth, ip, udp, gopacket.Payload("payload")); err != nil {
+		t.Fatalf("serialize: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// testCapture is a packet written to a test capture file
+type testCapture struct {
+	ts   time.Time
+	data []byte
+}
+
+// writeCaptureFile writes packets in the given format (pcap, pcap-nano, pcapng), optionally gzip-compressed
+func writeCaptureFile(t *testing.T, format string, compress bool, packets []testCapture) string {
+	t.Helper()
+	var buf bytes.Buffer
+	switch format {
+	case "pcap", "pcap-nano":
+		w := pcapgo.NewWriter(&buf)
+		if format == "pcap-nano" {
+			w = pcapgo.NewWriterNanos(&buf)
+		}
+		if err := w.WriteFileHeader(65535, layers.LinkTypeEthernet); err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range packets {
+			ci := gopacket.CaptureInfo{Timestamp: p.ts, CaptureLength: len(p.data), Length: len(p.data)}
+			if err := w.WritePacket(ci, p.data); err != nil {
+				t.Fatal(err)
+			}
+		}
+	case "pcapng":
+		w, err := pcapgo.NewNgWriter(&buf, layers.LinkTypeEthernet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range packets {
+			ci := gopacket.CaptureInfo{Timestamp: p.ts, CaptureLength: len(p.data), Length: len(p.data)}
+			if err := w.WritePacket(ci, p.data); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data := buf.Bytes()
+	if compress {
+		var gz bytes.Buffer
+		zw := gzip.NewWriter(&gz)
+		zw.Write(data)
+		zw.Close()
+		data = gz.Bytes()
+	}
+	path := filepath.Join(t.TempDir(), "capture")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestOpenFile(t *testing.T) {
+	start := time.Unix(1700000000, 123456789)
+	packets := []testCapture{
+		{start, testFrame(t, 53)},
+		{start.Add(time.Second), testFrame(t, 123)},
+		{start.Add(2 * time.Second), testFrame(t, 53)},
+	}
+
+	tests := []struct {
+		name      string
+		format    string
+		compress  bool
+		filter    string
+		precision string
+		want      []int // 读出的数据包下标
+	}{
+		{name: "pcap", format: "pcap", precision: "micro", want: []int{0, 1, 2}},
+		{name: "pcap nanosecond", format: "pcap-nano", precision: "nano", want: []int{0, 1, 2}},
+		{name: "pcapng", format: "pcapng", precision: "nano", want: []int{0, 1, 2}},
+		{name: "gzip pcap", format: "pcap", compress: true, precision: "micro", want: []int{0, 1, 2}},
+		{name: "gzip pcapng", format: "pcapng", compress: true, precision: "nano", want: []int{0, 1, 2}},
+		{name: "filtered", format: "pcap", filter: "udp port 53", precision: "micro", want: []int{0, 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeCaptureFile(t, tt.format, tt.compress, packets)
+			h, err := OpenFile(path, 0)
+			if err != nil {
+				t.Fatalf("OpenFile: %v", err)
+			}
+			defer h.Close()
+
+			if err := h.SetBPFFilter(tt.filter); err != nil {
+				t.Fatalf("SetBPFFilter: %v", err)
+			}
+			if h.LinkType() != int(layers.LinkTypeEthernet) {
+				t.Errorf("LinkType = %d", h.LinkType())
+			}
+			if s := h.Settings(); s.Backend != "file" || s.LinkType != "Ethernet" || s.Precision != tt.precision {
+				t.Errorf("Settings = %+v", s)
+			}
+
+			var got []int
+			for {
+				data, ci, err := h.ReadPacketData()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				if err != nil {
+					t.Fatalf("ReadPacketData: %v", err)
+				}
+				if len(got) == len(tt.want) {
+					t.Fatalf("read more than %d packets", len(tt.want))
+				}
+				i := tt.want[len(got)]
+				if !bytes.Equal(data, packets[i].data) || ci.CaptureLength != len(data) || ci.LinkType != int(layers.LinkTypeEthernet) {
+					t.Errorf("packet %d: %d bytes, %+v", i, len(data), ci)
+				}
+				// 微秒精度的文件截断纳秒部分
+				want := packets[i].ts
+				if tt.precision == "micro" {
+					want = want.Truncate(time.Microsecond)
+				}
+				if ci.Timestamp != want.UnixNano() {
+					t.Errorf("packet %d: timestamp %d, want %d", i, ci.Timestamp, want.UnixNano())
+				}
+				got = append(got, i)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("read packets %v, want %v", got, tt.want)
+			}
+
+			read, readBytes, total := h.Progress()
+			info, _ := os.Stat(path)
+			if read != int64(len(tt.want)) || readBytes != total || total != info.Size() {
+				t.Errorf("Progress = %d packets, %d/%d bytes; file is %d bytes", read, readBytes, total, info.Size())
+			}
+		})
+	}
+}
+
+func TestOpenFileInvalid(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string][]byte{
+		"empty":     nil,
+		"text":      []byte("not a capture file at all"),
+		"bad gzip":  {0x1f, 0x8b, 0, 0},
+		"truncated": {0xd4, 0xc3, 0xb2, 0xa1, 2, 0},
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if h, err := OpenFile(path, 0); err == nil {
+			h.Close()
+			t.Errorf("%s: OpenFile succeeded", name)
+		}
+	}
+	if _, err := OpenFile(filepath.Join(dir, "missing"), 0); err == nil {
+		t.Error("OpenFile succeeded for a missing file")
+	}
+}
+
+func TestFileHandlePacing(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	packets := []testCapture{
+		{start, testFrame(t, 53)},
+		{start.Add(200 * time.Millisecond), testFrame(t, 53)},
+		{start.Add(400 * time.Millisecond), testFrame(t, 53)},
+	}
+	path := writeCaptureFile(t, "pcap", false, packets)
+
+	replay := func(speed float64) time.Duration {
+		h, err := OpenFile(path, speed)
+		if err != nil {
+			t.Fatalf("OpenFile: %v", err)
+		}
+		defer h.Close()
+		begin := time.Now()
+		for {
+			if _, _, err := h.ReadPacketData(); err != nil {
+				if !errors.Is(err, io.EOF) {
+					t.Fatalf("ReadPacketData: %v", err)
+				}
+				return time.Since(begin)
+			}
+		}
+	}
+
+	// 原始时序回放 400ms，4 倍速 100ms，不限速立即完成
+	if d := replay(1); d < 400*time.Millisecond {
+		t.Errorf("speed 1 took %v, want at least 400ms", d)
+	}
+	if d := replay(4); d < 100*time.Millisecond || d >= 400*time.Millisecond {
+		t.Errorf("speed 4 took %v, want 100ms-400ms", d)
+	}
+	if d := replay(0); d >= 100*time.Millisecond {
+		t.Errorf("unpaced replay took %v", d)
+	}
+
+	// 等待期间关闭句柄，读取立即返回
+	h, err := OpenFile(path, 0.01)
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	if _, _, err := h.ReadPacketData(); err != nil {
+		t.Fatalf("ReadPacketData: %v", err)
+	}
+	time.AfterFunc(50*time.Millisecond, h.Close)
+	begin := time.Now()
+	if _, _, err := h.ReadPacketData(); !errors.Is(err, ErrHandleClosed) {
+		t.Errorf("ReadPacketData after Close = %v, want ErrHandleClosed", err)
+	}
+	if d := time.Since(begin); d > time.Second {
+		t.Errorf("Close took %v to interrupt the wait", d)
+	}
+}
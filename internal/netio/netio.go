@@ -3,17 +3,30 @@ package netio
 import (
 	"errors"
 	"fmt"
+	"hash/fnv"
+	"net"
 	"os"
 	"runtime"
 	"strings"
+	"time"
 
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
 	"github.com/google/gopacket/pcap"
 	"sniffer/pkg/model"
 )
 
 var (
-	ErrNoPermission = errors.New("insufficient permissions to capture packets")
-	ErrNpcapMissing = errors.New("Npcap/WinPcap not installed or version too old")
+	ErrNoPermission       = errors.New("insufficient permissions to capture packets")
+	ErrNpcapMissing       = errors.New("Npcap/WinPcap not installed or version too old")
+	ErrInvalidFilter      = errors.New("invalid BPF filter")
+	ErrBackendUnsupported = errors.New("capture backend not supported on this platform")
+)
+
+// Capture backends
+const (
+	BackendPcap     = "pcap"     // libpcap / Npcap
+	BackendAFPacket = "afpacket" // Linux AF_PACKET TPACKET_V3 内存映射环形缓冲区
 )
 
 // List returns all available network interfaces
@@ -152,15 +165,50 @@ type Handle interface {
 	ReadPacketData() ([]byte, CaptureInfo, error)
 	SetBPFFilter(filter string) error
 	Stats() (Stats, error)
+	Settings() model.CaptureSettings // 句柄实际生效的参数
+	LinkType() int                   // 链路层类型 (LINKTYPE_* 值)
 	Close()
 }
 
+// Capture directions
+const (
+	DirectionIn   = "in"
+	DirectionOut  = "out"
+	DirectionBoth = "both"
+)
+
+// OpenOptions contains the settings applied to a pcap handle before activation
+type OpenOptions struct {
+	SnapLen         int
+	Promiscuous     bool
+	Timeout         time.Duration // 读取超时，<=0 表示一直阻塞
+	BufferSize      int           // 内核缓冲区大小（字节），0 使用系统默认值
+	ImmediateMode   bool          // 立即模式：数据包到达即交付，不等待缓冲区填满
+	TimestampSource string        // 时间戳来源，如 host, adapter；为空使用默认值
+	NanoPrecision   bool          // 纳秒精度时间戳（设备不支持时回退为微秒）
+	Direction       string        // in, out, both
+}
+
 // CaptureInfo contains metadata about a captured packet
 type CaptureInfo struct {
 	Timestamp      int64 // Unix timestamp in nanoseconds
 	CaptureLength  int
 	Length         int
 	InterfaceIndex int
+	LinkType       int    // 链路层类型 (LINKTYPE_* 值)
+	VLANID         uint16 // 被网卡卸载的 VLAN 标签（afpacket 辅助数据），0 表示无
+}
+
+// linkTypeSLL2Truncated is LINKTYPE_LINUX_SLL2 (276) truncated to gopacket's uint8 layers.LinkType
+const linkTypeSLL2Truncated = 276 & 0xff
+
+// linkTypeValue converts a gopacket link type to its LINKTYPE_* value.
+// layers.LinkType 为 uint8，LINUX_SLL2(276) 会被截断为 20；20 本身未被分配，因此按 SLL2 还原
+func linkTypeValue(lt layers.LinkType) int {
+	if lt == linkTypeSLL2Truncated {
+		return linkTypeSLL2
+	}
+	return int(lt)
 }
 
 // Stats contains capture statistics
@@ -168,24 +216,144 @@ type Stats struct {
 	PacketsReceived  int
 	PacketsDropped   int
 	PacketsIfDropped int
+	QueueFreezes     int // TPACKET_V3 环形缓冲区冻结次数（仅 afpacket）
+}
+
+// AFPacketOptions contains the settings of an AF_PACKET capture handle
+type AFPacketOptions struct {
+	SnapLen     int
+	Promiscuous bool
+	BlockSize   int // 单个内存块大小，需为页大小的整数倍
+	NumBlocks   int
+	PollTimeout time.Duration
+	Direction   string // in, out, both
+
+	// PACKET_FANOUT: 同一分组内的多个句柄分担同一网卡的流量
+	FanoutWorkers int
+	FanoutGroup   uint16
+	FanoutMode    string // hash, lb, cpu, rollover, random, qm
+}
+
+// FanoutGroupOffset derives the fanout group id of an interface from a configured base
+// 内核的 fanout 分组不能跨网卡共用，按网卡索引偏移；无法获取索引时使用自动生成的分组
+func FanoutGroupOffset(base uint16, iface string) uint16 {
+	ifi, err := net.InterfaceByName(iface)
+	if err != nil {
+		return FanoutGroupID(iface)
+	}
+	return base + uint16(ifi.Index)
+}
+
+// FanoutGroupID derives a fanout group id that is unique per process and interface
+func FanoutGroupID(iface string) uint16 {
+	h := fnv.New32a()
+	h.Write([]byte(iface))
+	return uint16(uint32(os.Getpid()) ^ h.Sum32())
 }
 
 // pcapHandle wraps a pcap.Handle
 type pcapHandle struct {
-	handle *pcap.Handle
+	handle   *pcap.Handle
+	filter   string
+	linkType int
+	settings model.CaptureSettings
 }
 
-// Open opens a network interface for packet capture
-func Open(name string, snaplen int32, promisc bool, timeout int) (Handle, error) {
-	handle, err := pcap.OpenLive(name, snaplen, promisc, pcap.BlockForever)
+// Open opens a network interface for packet capture.
+// The handle is configured through an inactive handle so that all options take effect before activation.
+func Open(name string, opts OpenOptions) (Handle, error) {
+	inactive, err := pcap.NewInactiveHandle(name)
 	if err != nil {
 		return nil, fmt.Errorf("open interface %s: %w", name, err)
 	}
+	defer inactive.CleanUp()
 
-	// Set buffer size if possible
-	// Note: This is platform-specific and may not work on all systems
-	
-	return &pcapHandle{handle: handle}, nil
+	if err := inactive.SetSnapLen(opts.SnapLen); err != nil {
+		return nil, fmt.Errorf("set snaplen %d: %w", opts.SnapLen, err)
+	}
+	if err := inactive.SetPromisc(opts.Promiscuous); err != nil {
+		return nil, fmt.Errorf("set promiscuous mode: %w", err)
+	}
+
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = pcap.BlockForever
+	}
+	if err := inactive.SetTimeout(timeout); err != nil {
+		return nil, fmt.Errorf("set timeout %v: %w", opts.Timeout, err)
+	}
+
+	if opts.BufferSize > 0 {
+		if err := inactive.SetBufferSize(opts.BufferSize); err != nil {
+			return nil, fmt.Errorf("set buffer size %d: %w", opts.BufferSize, err)
+		}
+	}
+
+	if opts.ImmediateMode {
+		if err := inactive.SetImmediateMode(true); err != nil {
+			return nil, fmt.Errorf("set immediate mode: %w", err)
+		}
+	}
+
+	tstampSource := "default"
+	if opts.TimestampSource != "" {
+		source, err := pcap.TimestampSourceFromString(opts.TimestampSource)
+		if err != nil {
+			return nil, fmt.Errorf("unknown timestamp source %q: %w", opts.TimestampSource, err)
+		}
+		if err := inactive.SetTimestampSource(source); err != nil {
+			supported := make([]string, 0)
+			for _, s := range inactive.SupportedTimestamps() {
+				supported = append(supported, s.String())
+			}
+			return nil, fmt.Errorf("set timestamp source %q (supported: %s): %w",
+				opts.TimestampSource, strings.Join(supported, ", "), err)
+		}
+		tstampSource = source.String()
+	}
+
+	handle, err := inactive.Activate()
+	if err != nil {
+		return nil, fmt.Errorf("activate interface %s: %w", name, err)
+	}
+
+	direction := opts.Direction
+	if direction == "" {
+		direction = DirectionBoth
+	}
+	if direction != DirectionBoth {
+		pcapDirection := pcap.DirectionIn
+		if direction == DirectionOut {
+			pcapDirection = pcap.DirectionOut
+		}
+		if err := handle.SetDirection(pcapDirection); err != nil {
+			handle.Close()
+			return nil, fmt.Errorf("set direction %s: %w", direction, err)
+		}
+	}
+
+	// 激活时总是请求纳秒精度，这里以设备实际支持的精度为准
+	precision := "micro"
+	if opts.NanoPrecision && handle.Resolution() == gopacket.TimestampResolutionNanosecond {
+		precision = "nano"
+	}
+
+	return &pcapHandle{
+		handle:   handle,
+		linkType: linkTypeValue(handle.LinkType()),
+		settings: model.CaptureSettings{
+			Backend:         BackendPcap,
+			LinkType:        linkTypeName(linkTypeValue(handle.LinkType())),
+			SnapLen:         handle.SnapLen(),
+			Promiscuous:     opts.Promiscuous,
+			Timeout:         opts.Timeout.String(),
+			BufferSize:      int64(opts.BufferSize),
+			ImmediateMode:   opts.ImmediateMode,
+			TimestampSource: tstampSource,
+			Precision:       precision,
+			Direction:       direction,
+		},
+	}, nil
 }
 
 func (h *pcapHandle) ReadPacketData() ([]byte, CaptureInfo, error) {
@@ -194,21 +362,32 @@ func (h *pcapHandle) ReadPacketData() ([]byte, CaptureInfo, error) {
 		return nil, CaptureInfo{}, err
 	}
 
+	timestamp := ci.Timestamp
+	if h.settings.Precision != "nano" {
+		timestamp = timestamp.Truncate(time.Microsecond)
+	}
+
 	info := CaptureInfo{
-		Timestamp:      ci.Timestamp.UnixNano(),
+		Timestamp:      timestamp.UnixNano(),
 		CaptureLength:  ci.CaptureLength,
 		Length:         ci.Length,
 		InterfaceIndex: ci.InterfaceIndex,
+		LinkType:       h.linkType,
 	}
 
 	return data, info, nil
 }
 
 func (h *pcapHandle) SetBPFFilter(filter string) error {
-	if filter == "" {
+	// 未设置过过滤器时无需下发空过滤器；已设置时空字符串表示清除（匹配全部）
+	if filter == "" && h.filter == "" {
 		return nil
 	}
-	return h.handle.SetBPFFilter(filter)
+	if err := h.handle.SetBPFFilter(filter); err != nil {
+		return fmt.Errorf("%w %q: %v", ErrInvalidFilter, filter, err)
+	}
+	h.filter = filter
+	return nil
 }
 
 func (h *pcapHandle) Stats() (Stats, error) {
@@ -224,12 +403,52 @@ func (h *pcapHandle) Stats() (Stats, error) {
 	}, nil
 }
 
+func (h *pcapHandle) Settings() model.CaptureSettings {
+	return h.settings
+}
+
+func (h *pcapHandle) LinkType() int {
+	return h.linkType
+}
+
 func (h *pcapHandle) Close() {
 	if h.handle != nil {
 		h.handle.Close()
 	}
 }
 
+// linkTypeName returns a readable name of a LINKTYPE_* value
+func linkTypeName(linkType int) string {
+	switch linkType {
+	case 228:
+		return "IPv4"
+	case 229:
+		return "IPv6"
+	case linkTypeSLL2:
+		return "Linux SLL2"
+	}
+	return layers.LinkType(linkType).String()
+}
+
+// ValidateBPFFilter compiles the filter for the link type (LINKTYPE_* 值) of a handle or file
+// to check it before it is applied; 部分过滤原语（如 inbound、ether host）只对特定链路类型有效
+func ValidateBPFFilter(filter string, linkType, snaplen int) error {
+	if filter == "" {
+		return nil
+	}
+	lt, err := bpfLinkType(linkType)
+	if err != nil {
+		return fmt.Errorf("%w %q: %v", ErrInvalidFilter, filter, err)
+	}
+	if snaplen <= 0 {
+		snaplen = 65535
+	}
+	if _, err := pcap.CompileBPFFilter(lt, snaplen, filter); err != nil {
+		return fmt.Errorf("%w %q: %v", ErrInvalidFilter, filter, err)
+	}
+	return nil
+}
+
 // isLoopback checks if an interface is a loopback interface
 func isLoopback(name string) bool {
 	name = strings.ToLower(name)
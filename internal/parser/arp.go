@@ -0,0 +1,240 @@
+package parser
+
+import (
+	"bytes"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"sniffer/pkg/model"
+)
+
+// ARPMessage is an Ethernet/IPv4 ARP request or reply
+type ARPMessage struct {
+	Operation  uint16 // 1 = request, 2 = reply
+	SenderMAC  string
+	SenderIP   string
+	TargetMAC  string
+	TargetIP   string
+	Gratuitous bool // 免费 ARP：发送方声明自己的地址（sender IP == target IP）
+}
+
+// ParseARP parses an Ethernet/IPv4 ARP packet
+func ParseARP(pkt *model.Packet) (*ARPMessage, error) {
+	if pkt.Protocol != "ARP" {
+		return nil, ErrNotARP
+	}
+
+	// ARP 头部由解码阶段取得
+	var arp layers.ARP
+	if err := arp.DecodeFromBytes(pkt.Transport, gopacket.NilDecodeFeedback); err != nil ||
+		arp.AddrType != layers.LinkTypeEthernet || arp.Protocol != layers.EthernetTypeIPv4 ||
+		len(arp.SourceHwAddress) != 6 || len(arp.DstHwAddress) != 6 ||
+		len(arp.SourceProtAddress) != 4 || len(arp.DstProtAddress) != 4 {
+		return nil, ErrNotARP
+	}
+
+	return &ARPMessage{
+		Operation:  arp.Operation,
+		SenderMAC:  net.HardwareAddr(arp.SourceHwAddress).String(),
+		SenderIP:   net.IP(arp.SourceProtAddress).String(),
+		TargetMAC:  net.HardwareAddr(arp.DstHwAddress).String(),
+		TargetIP:   net.IP(arp.DstProtAddress).String(),
+		Gratuitous: bytes.Equal(arp.SourceProtAddress, arp.DstProtAddress),
+	}, nil
+}
+
+// ARP event kinds
+const (
+	ARPEventFlood         = "gratuitous_flood"   // 免费 ARP 泛洪
+	ARPEventConflict      = "ip_conflict"        // 同一 IP 短时间内被多个 MAC 声明
+	ARPEventGatewayChange = "gateway_mac_change" // 网关 IP 对应的 MAC 改变
+)
+
+// ARPEvent is a suspicious ARP observation reported by the monitor
+type ARPEvent struct {
+	Kind        string
+	IP          string
+	MAC         string
+	PreviousMAC string // 冲突或变更前的 MAC
+	Count       int    // 泛洪窗口内的免费 ARP 数
+	VLANID      uint16
+	Interface   string
+}
+
+// ARPMonitorOptions represents the detection thresholds of the ARP monitor
+type ARPMonitorOptions struct {
+	Gateways       []string      // 网关 IP，其 MAC 改变时报告 gateway_mac_change
+	ConflictWindow time.Duration // 原 MAC 在此时间内仍出现过时，新 MAC 的声明视为冲突而非地址重新分配
+	FloodThreshold int           // 单个 MAC 在 FloodWindow 内发送的免费 ARP 数达到此值时报告泛洪
+	FloodWindow    time.Duration
+	MaxEntries     int // IP-MAC 绑定数上限，超出时淘汰最久未出现的绑定
+}
+
+// arpKey identifies an IP-MAC binding
+type arpKey struct {
+	vlan uint16
+	ip   string
+	mac  string
+}
+
+// arpIPKey identifies an IP address in a VLAN
+type arpIPKey struct {
+	vlan uint16
+	ip   string
+}
+
+// arpFlood counts the gratuitous ARPs of a MAC in the current window
+type arpFlood struct {
+	start time.Time
+	count int
+}
+
+// ARPMonitor maintains the IP-MAC table learned from ARP senders and detects spoofing
+// 只从发送方地址学习（目标地址可能是伪造或未知的）；时间按数据包时间计算（离线回放同样适用）
+type ARPMonitor struct {
+	mu       sync.Mutex
+	opts     ARPMonitorOptions
+	gateways map[string]bool
+	entries  map[arpKey]*model.ARPEntry
+	current  map[arpIPKey]*model.ARPEntry // 每个 IP 最近一次声明的绑定
+	floods   map[string]*arpFlood         // 按发送方 MAC
+}
+
+// NewARPMonitor creates an ARP monitor with the given thresholds
+func NewARPMonitor(opts ARPMonitorOptions) *ARPMonitor {
+	m := &ARPMonitor{
+		opts:     opts,
+		gateways: make(map[string]bool, len(opts.Gateways)),
+		entries:  make(map[arpKey]*model.ARPEntry),
+		current:  make(map[arpIPKey]*model.ARPEntry),
+		floods:   make(map[string]*arpFlood),
+	}
+	for _, gw := range opts.Gateways {
+		if ip := net.ParseIP(gw); ip != nil {
+			m.gateways[ip.String()] = true
+		}
+	}
+	return m
+}
+
+// Observe records an ARP message seen in pkt and returns the suspicious events it caused
+func (m *ARPMonitor) Observe(pkt *model.Packet, msg *ARPMessage) []ARPEvent {
+	// ARP 探测（RFC 5227）的发送方 IP 为 0.0.0.0，不声明任何绑定
+	if msg.SenderIP == "0.0.0.0" {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var events []ARPEvent
+	event := func(kind, previous string, count int) {
+		events = append(events, ARPEvent{
+			Kind:        kind,
+			IP:          msg.SenderIP,
+			MAC:         msg.SenderMAC,
+			PreviousMAC: previous,
+			Count:       count,
+			VLANID:      pkt.VLANID,
+			Interface:   pkt.Interface,
+		})
+	}
+
+	ts := pkt.Timestamp
+	if msg.Gratuitous && m.opts.FloodThreshold > 0 {
+		f := m.floods[msg.SenderMAC]
+		if f == nil || ts.Sub(f.start) > m.opts.FloodWindow {
+			f = &arpFlood{start: ts}
+			m.floods[msg.SenderMAC] = f
+		}
+		f.count++
+		// 每个窗口只在达到阈值时报告一次
+		if f.count == m.opts.FloodThreshold {
+			event(ARPEventFlood, "", f.count)
+		}
+	}
+
+	ipKey := arpIPKey{pkt.VLANID, msg.SenderIP}
+	key := arpKey{pkt.VLANID, msg.SenderIP, msg.SenderMAC}
+	entry := m.entries[key]
+	if entry == nil {
+		if len(m.entries) >= m.opts.MaxEntries && m.opts.MaxEntries > 0 {
+			m.evictLocked()
+		}
+		entry = &model.ARPEntry{
+			IP:        msg.SenderIP,
+			MAC:       msg.SenderMAC,
+			VLANID:    pkt.VLANID,
+			FirstSeen: ts,
+			Gateway:   m.gateways[msg.SenderIP],
+		}
+		m.entries[key] = entry
+	}
+
+	if prev := m.current[ipKey]; prev != nil && prev != entry {
+		switch {
+		case entry.Gateway:
+			event(ARPEventGatewayChange, prev.MAC, 0)
+		case ts.Sub(prev.LastSeen) <= m.opts.ConflictWindow:
+			event(ARPEventConflict, prev.MAC, 0)
+		}
+		prev.Current = false
+	}
+	m.current[ipKey] = entry
+
+	entry.Current = true
+	entry.Packets++
+	entry.Interface = pkt.Interface
+	if ts.After(entry.LastSeen) {
+		entry.LastSeen = ts
+	}
+	return events
+}
+
+// Entries returns a copy of the ARP table ordered by IP, then by last seen time (最近的在前)
+func (m *ARPMonitor) Entries() []model.ARPEntry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entries := make([]model.ARPEntry, 0, len(m.entries))
+	for _, e := range m.entries {
+		entries = append(entries, *e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.IP != b.IP {
+			return bytes.Compare(net.ParseIP(a.IP).To16(), net.ParseIP(b.IP).To16()) < 0
+		}
+		if a.VLANID != b.VLANID {
+			return a.VLANID < b.VLANID
+		}
+		return a.LastSeen.After(b.LastSeen)
+	})
+	return entries
+}
+
+// evictLocked removes the least recently seen binding
+func (m *ARPMonitor) evictLocked() {
+	var oldest arpKey
+	var oldestSeen time.Time
+	for k, e := range m.entries {
+		if oldestSeen.IsZero() || e.LastSeen.Before(oldestSeen) {
+			oldest, oldestSeen = k, e.LastSeen
+		}
+	}
+	if e := m.entries[oldest]; e != nil && e.Current {
+		delete(m.current, arpIPKey{oldest.vlan, oldest.ip})
+	}
+	delete(m.entries, oldest)
+
+	// 泛洪计数随绑定一起清理过期窗口
+	for mac, f := range m.floods {
+		if oldestSeen.Sub(f.start) > m.opts.FloodWindow {
+			delete(m.floods, mac)
+		}
+	}
+}
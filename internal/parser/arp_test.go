@@ -0,0 +1,258 @@
+package parser
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"sniffer/pkg/model"
+)
+
+func arpFrame(t *testing.T, op uint16, senderMAC net.HardwareAddr, senderIP string, targetMAC net.HardwareAddr, targetIP string) []byte {
+	return serialize(t, ethernet(layers.EthernetTypeARP), &layers.ARP{
+		AddrType:          layers.LinkTypeEthernet,
+		Protocol:          layers.EthernetTypeIPv4,
+		HwAddressSize:     6,
+		ProtAddressSize:   4,
+		Operation:         op,
+		SourceHwAddress:   senderMAC,
+		SourceProtAddress: net.ParseIP(senderIP).To4(),
+		DstHwAddress:      targetMAC,
+		DstProtAddress:    net.ParseIP(targetIP).To4(),
+	})
+}
+
+func TestParseARP(t *testing.T) {
+	zeroMAC := make(net.HardwareAddr, 6)
+	tests := []struct {
+		name string
+		data func(t *testing.T) []byte
+		want *ARPMessage
+	}{
+		{
+			name: "request",
+			data: func(t *testing.T) []byte {
+				return arpFrame(t, layers.ARPRequest, testSrcMAC, "192.168.1.10", zeroMAC, "192.168.1.1")
+			},
+			want: &ARPMessage{Operation: 1, SenderMAC: "00:11:22:33:44:55", SenderIP: "192.168.1.10", TargetMAC: "00:00:00:00:00:00", TargetIP: "192.168.1.1"},
+		},
+		{
+			name: "reply",
+			data: func(t *testing.T) []byte {
+				return arpFrame(t, layers.ARPReply, testDstMAC, "192.168.1.1", testSrcMAC, "192.168.1.10")
+			},
+			want: &ARPMessage{Operation: 2, SenderMAC: "66:77:88:99:aa:bb", SenderIP: "192.168.1.1", TargetMAC: "00:11:22:33:44:55", TargetIP: "192.168.1.10"},
+		},
+		{
+			name: "gratuitous",
+			data: func(t *testing.T) []byte {
+				return arpFrame(t, layers.ARPRequest, testSrcMAC, "192.168.1.10", zeroMAC, "192.168.1.10")
+			},
+			want: &ARPMessage{Operation: 1, SenderMAC: "00:11:22:33:44:55", SenderIP: "192.168.1.10", TargetMAC: "00:00:00:00:00:00", TargetIP: "192.168.1.10", Gratuitous: true},
+		},
+		{
+			name: "probe",
+			data: func(t *testing.T) []byte {
+				return arpFrame(t, layers.ARPRequest, testSrcMAC, "0.0.0.0", zeroMAC, "192.168.1.10")
+			},
+			want: &ARPMessage{Operation: 1, SenderMAC: "00:11:22:33:44:55", SenderIP: "0.0.0.0", TargetMAC: "00:00:00:00:00:00", TargetIP: "192.168.1.10"},
+		},
+		{
+			name: "not IPv4 over Ethernet",
+			data: func(t *testing.T) []byte {
+				return serialize(t, ethernet(layers.EthernetTypeARP), &layers.ARP{
+					AddrType: layers.LinkTypeEthernet, Protocol: layers.EthernetTypeIPv6,
+					HwAddressSize: 6, ProtAddressSize: 16, Operation: layers.ARPRequest,
+					SourceHwAddress: testSrcMAC, SourceProtAddress: net.ParseIP("fe80::1"),
+					DstHwAddress: zeroMAC, DstProtAddress: net.ParseIP("fe80::2"),
+				})
+			},
+		},
+		{
+			name: "IPv4 packet",
+			data: func(t *testing.T) []byte {
+				return serialize(t, ethernet(layers.EthernetTypeIPv4), ipv4("192.168.1.10", "192.168.1.1", layers.IPProtocolUDP),
+					&layers.UDP{SrcPort: 5000, DstPort: 5001})
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pkt, err := ParsePacket(tt.data(t), time.Unix(1700000000, 0), int(layers.LinkTypeEthernet))
+			if err != nil {
+				t.Fatalf("ParsePacket: %v", err)
+			}
+			msg, err := ParseARP(pkt)
+			if tt.want == nil {
+				if !errors.Is(err, ErrNotARP) {
+					t.Errorf("err = %v, want %v", err, ErrNotARP)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseARP: %v", err)
+			}
+			if !reflect.DeepEqual(msg, tt.want) {
+				t.Errorf("got  %+v\nwant %+v", msg, tt.want)
+			}
+		})
+	}
+}
+
+func TestARPMonitor(t *testing.T) {
+	const (
+		macA = "00:11:22:33:44:55"
+		macB = "66:77:88:99:aa:bb"
+		macC = "de:ad:be:ef:00:01"
+	)
+	type step struct {
+		at       time.Duration // 相对第一个数据包的时间
+		vlan     uint16
+		mac, ip  string
+		gratuit  bool
+		want     []string // 期望的事件类型
+		previous string   // 冲突或变更事件的原 MAC
+	}
+	opts := ARPMonitorOptions{
+		Gateways:       []string{"192.168.1.1"},
+		ConflictWindow: time.Minute,
+		FloodThreshold: 3,
+		FloodWindow:    10 * time.Second,
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "repeated announcements of the same binding",
+			steps: []step{
+				{mac: macA, ip: "192.168.1.10"},
+				{at: time.Second, mac: macA, ip: "192.168.1.10"},
+			},
+		},
+		{
+			name: "second MAC within the conflict window",
+			steps: []step{
+				{mac: macA, ip: "192.168.1.10"},
+				{at: 30 * time.Second, mac: macB, ip: "192.168.1.10", want: []string{ARPEventConflict}, previous: macA},
+			},
+		},
+		{
+			name: "address reassigned after the conflict window",
+			steps: []step{
+				{mac: macA, ip: "192.168.1.10"},
+				{at: 2 * time.Minute, mac: macB, ip: "192.168.1.10"},
+			},
+		},
+		{
+			name: "same address in another VLAN",
+			steps: []step{
+				{mac: macA, ip: "192.168.1.10"},
+				{at: time.Second, vlan: 100, mac: macB, ip: "192.168.1.10"},
+			},
+		},
+		{
+			name: "gateway MAC change regardless of the window",
+			steps: []step{
+				{mac: macA, ip: "192.168.1.1"},
+				{at: time.Hour, mac: macC, ip: "192.168.1.1", want: []string{ARPEventGatewayChange}, previous: macA},
+				{at: time.Hour + time.Second, mac: macA, ip: "192.168.1.1", want: []string{ARPEventGatewayChange}, previous: macC},
+			},
+		},
+		{
+			name: "gratuitous flood reported once per window",
+			steps: []step{
+				{mac: macC, ip: "192.168.1.20", gratuit: true},
+				{at: time.Second, mac: macC, ip: "192.168.1.21", gratuit: true},
+				{at: 2 * time.Second, mac: macC, ip: "192.168.1.22", gratuit: true, want: []string{ARPEventFlood}},
+				{at: 3 * time.Second, mac: macC, ip: "192.168.1.23", gratuit: true},
+				{at: 20 * time.Second, mac: macC, ip: "192.168.1.24", gratuit: true},
+				{at: 21 * time.Second, mac: macC, ip: "192.168.1.25", gratuit: true},
+				{at: 22 * time.Second, mac: macC, ip: "192.168.1.26", gratuit: true, want: []string{ARPEventFlood}},
+			},
+		},
+		{
+			name: "spoofed gratuitous ARP floods and conflicts",
+			steps: []step{
+				{mac: macA, ip: "192.168.1.10"},
+				{at: time.Second, mac: macC, ip: "192.168.1.10", gratuit: true, want: []string{ARPEventConflict}, previous: macA},
+				{at: 2 * time.Second, mac: macC, ip: "192.168.1.10", gratuit: true},
+				{at: 3 * time.Second, mac: macC, ip: "192.168.1.10", gratuit: true, want: []string{ARPEventFlood}},
+			},
+		},
+		{
+			name: "probes are ignored",
+			steps: []step{
+				{mac: macA, ip: "192.168.1.10"},
+				{at: time.Second, mac: macB, ip: "0.0.0.0"},
+			},
+		},
+	}
+
+	start := time.Unix(1700000000, 0)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewARPMonitor(opts)
+			for i, s := range tt.steps {
+				pkt := &model.Packet{Timestamp: start.Add(s.at), Protocol: "ARP", VLANID: s.vlan, Interface: "eth0"}
+				msg := &ARPMessage{Operation: 1, SenderMAC: s.mac, SenderIP: s.ip, TargetIP: s.ip, Gratuitous: s.gratuit}
+				if !s.gratuit {
+					msg.TargetIP = "192.168.1.254"
+				}
+				events := m.Observe(pkt, msg)
+
+				var kinds []string
+				for _, ev := range events {
+					kinds = append(kinds, ev.Kind)
+					if ev.IP != s.ip || ev.MAC != s.mac || ev.VLANID != s.vlan || ev.Interface != "eth0" {
+						t.Errorf("step %d: event %+v", i, ev)
+					}
+					if ev.Kind != ARPEventFlood && ev.PreviousMAC != s.previous {
+						t.Errorf("step %d: PreviousMAC = %s, want %s", i, ev.PreviousMAC, s.previous)
+					}
+				}
+				if !reflect.DeepEqual(kinds, s.want) {
+					t.Errorf("step %d: events = %v, want %v", i, kinds, s.want)
+				}
+			}
+		})
+	}
+}
+
+func TestARPMonitorEntries(t *testing.T) {
+	m := NewARPMonitor(ARPMonitorOptions{Gateways: []string{"192.168.1.1"}, ConflictWindow: time.Minute, MaxEntries: 3})
+	start := time.Unix(1700000000, 0)
+	observe := func(at time.Duration, mac, ip string) {
+		m.Observe(&model.Packet{Timestamp: start.Add(at), Protocol: "ARP"}, &ARPMessage{Operation: 2, SenderMAC: mac, SenderIP: ip})
+	}
+
+	observe(0, "00:00:00:00:00:01", "192.168.1.100")
+	observe(time.Second, "00:00:00:00:00:02", "192.168.1.1")
+	observe(2*time.Second, "00:00:00:00:00:03", "192.168.1.1")
+	observe(3*time.Second, "00:00:00:00:00:02", "192.168.1.1")
+	// 超出上限时淘汰最久未出现的 192.168.1.100
+	observe(4*time.Second, "00:00:00:00:00:04", "192.168.1.9")
+
+	type entry struct {
+		IP, MAC          string
+		Gateway, Current bool
+		Packets          int
+	}
+	var got []entry
+	for _, e := range m.Entries() {
+		got = append(got, entry{e.IP, e.MAC, e.Gateway, e.Current, int(e.Packets)})
+	}
+	want := []entry{
+		{"192.168.1.1", "00:00:00:00:00:02", true, true, 2},
+		{"192.168.1.1", "00:00:00:00:00:03", true, false, 1},
+		{"192.168.1.9", "00:00:00:00:00:04", false, true, 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("entries = %+v\nwant %+v", got, want)
+	}
+}
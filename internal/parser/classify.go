@@ -0,0 +1,479 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"sniffer/pkg/model"
+)
+
+// Classifier limits
+const (
+	classifyMaxPackets = 4               // 每个方向最多检查的载荷包数
+	classifyConfident  = 0.9             // 达到该置信度后不再检查后续载荷
+	classifyMaxFlows   = 65536           // 缓存的流数上限
+	classifyFlowIdle   = 5 * time.Minute // 空闲超过该时间的流在缓存满时淘汰
+	classifyMaxPayload = 512             // 每个载荷最多检查的字节数（需要完整载荷的特征除外）
+)
+
+// Classification is the application protocol of a flow detected from its payload
+type Classification struct {
+	Protocol   string  // 应用层协议，空表示尚未识别
+	Confidence float64 // 置信度 0-1
+}
+
+// payloadSignature identifies an application protocol from the first payload bytes of one direction
+type payloadSignature struct {
+	name      string
+	transport string // TCP / UDP，空表示两者皆可
+	// match returns the confidence that payload belongs to the protocol, 0 if it does not match
+	match func(payload []byte) float64
+	// whole 表示 match 校验消息长度字段或完整解码消息，需要未截断的载荷
+	whole bool
+}
+
+// payloadSignatures lists the protocols detected from payload, 同一载荷取置信度最高的结果
+var payloadSignatures = []payloadSignature{
+	{name: "HTTP", transport: "TCP", match: matchHTTP},
+	{name: "TLS", transport: "TCP", match: matchTLS},
+	{name: "SSH", transport: "TCP", match: matchSSH},
+	{name: "DNS", transport: "UDP", match: matchDNS, whole: true},
+	{name: "DNS", transport: "TCP", match: matchDNSOverTCP, whole: true},
+	{name: "QUIC", transport: "UDP", match: matchQUIC},
+	{name: "SMTP", transport: "TCP", match: matchSMTP},
+	{name: "FTP", transport: "TCP", match: matchFTP},
+	{name: "POP3", transport: "TCP", match: matchPOP3},
+	{name: "IMAP", transport: "TCP", match: matchIMAP},
+	{name: "Redis", transport: "TCP", match: matchRedis},
+	{name: "MySQL", transport: "TCP", match: matchMySQL, whole: true},
+	{name: "PostgreSQL", transport: "TCP", match: matchPostgreSQL, whole: true},
+	{name: "MongoDB", transport: "TCP", match: matchMongoDB, whole: true},
+	{name: "RDP", transport: "TCP", match: matchRDP, whole: true},
+	{name: "SMB", transport: "TCP", match: matchSMB},
+	{name: "Telnet", transport: "TCP", match: matchTelnet},
+	{name: "MQTT", transport: "TCP", match: matchMQTT},
+	{name: "BitTorrent", transport: "TCP", match: matchBitTorrent},
+	{name: "SIP", match: matchSIP},
+	{name: "DHCP", transport: "UDP", match: matchDHCP},
+	{name: "STUN", transport: "UDP", match: matchSTUN, whole: true},
+	{name: "SNMP", transport: "UDP", match: matchSNMP},
+	{name: "NTP", transport: "UDP", match: matchNTP},
+}
+
+// classifyKey identifies a flow regardless of direction: a 端为较小的 IP:端口
+type classifyKey struct {
+	protocol     string
+	aIP, bIP     string
+	aPort, bPort uint16
+}
+
+// classifyFlow is the cached classification state of a flow
+type classifyFlow struct {
+	result   Classification
+	packets  [2]int // 各方向已检查的载荷包数，0: a -> b, 1: b -> a
+	done     bool   // 识别结束，后续数据包直接使用缓存结果
+	lastSeen time.Time
+}
+
+// Classifier detects the application protocol of TCP/UDP flows from the first payload bytes
+// of each direction and caches the result per flow; 端口只在载荷无法识别时由调用方兜底
+type Classifier struct {
+	mu    sync.Mutex
+	flows map[classifyKey]*classifyFlow
+}
+
+// NewClassifier creates a payload classifier
+func NewClassifier() *Classifier {
+	return &Classifier{flows: make(map[classifyKey]*classifyFlow)}
+}
+
+// Classify returns the application protocol of the packet's flow
+// 每个方向检查前几个载荷包，置信度足够或检查数达到上限后结果固定
+func (c *Classifier) Classify(pkt *model.Packet) Classification {
+	if pkt.Protocol != "TCP" && pkt.Protocol != "UDP" {
+		return Classification{}
+	}
+
+	key, dir := newClassifyKey(pkt)
+	c.mu.Lock()
+	flow := c.flows[key]
+	if flow != nil {
+		flow.lastSeen = pkt.Timestamp
+		if flow.done {
+			result := flow.result
+			c.mu.Unlock()
+			return result
+		}
+	}
+	c.mu.Unlock()
+
+	payload := pkt.Payload
+	if len(payload) == 0 {
+		if flow == nil {
+			return Classification{}
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return flow.result
+	}
+	match := classifyPayload(pkt.Protocol, payload)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	flow = c.flows[key]
+	if flow == nil {
+		if len(c.flows) >= classifyMaxFlows {
+			c.evictLocked(pkt.Timestamp)
+		}
+		flow = &classifyFlow{}
+		c.flows[key] = flow
+	}
+	flow.lastSeen = pkt.Timestamp
+	if flow.done {
+		return flow.result
+	}
+
+	flow.packets[dir]++
+	if match.Confidence > flow.result.Confidence {
+		flow.result = match
+	}
+	if flow.result.Confidence >= classifyConfident ||
+		(flow.packets[0] >= classifyMaxPackets && flow.packets[1] >= classifyMaxPackets) {
+		flow.done = true
+	}
+	return flow.result
+}
+
+// Reset drops all cached flows (capture stopped)
+func (c *Classifier) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.flows = make(map[classifyKey]*classifyFlow)
+}
+
+// evictLocked removes the idle flows; 仍然超出上限时随机淘汰十分之一
+func (c *Classifier) evictLocked(now time.Time) {
+	cutoff := now.Add(-classifyFlowIdle)
+	for key, flow := range c.flows {
+		if flow.lastSeen.Before(cutoff) {
+			delete(c.flows, key)
+		}
+	}
+	for key := range c.flows {
+		if len(c.flows) < classifyMaxFlows*9/10 {
+			break
+		}
+		delete(c.flows, key)
+	}
+}
+
+// newClassifyKey returns the direction independent key of the packet's flow and the packet's direction
+func newClassifyKey(pkt *model.Packet) (classifyKey, int) {
+	key := classifyKey{
+		protocol: pkt.Protocol,
+		aIP:      pkt.SrcIP,
+		bIP:      pkt.DstIP,
+		aPort:    pkt.SrcPort,
+		bPort:    pkt.DstPort,
+	}
+	if key.aIP > key.bIP || (key.aIP == key.bIP && key.aPort > key.bPort) {
+		key.aIP, key.bIP = key.bIP, key.aIP
+		key.aPort, key.bPort = key.bPort, key.aPort
+		return key, 1
+	}
+	return key, 0
+}
+
+// classifyPayload matches the payload against all signatures of the transport
+// 只检查前缀的特征使用截断后的载荷，避免大载荷上的全量扫描
+func classifyPayload(transport string, payload []byte) Classification {
+	head := payload
+	if len(head) > classifyMaxPayload {
+		head = head[:classifyMaxPayload]
+	}
+
+	var best Classification
+	for _, sig := range payloadSignatures {
+		if sig.transport != "" && sig.transport != transport {
+			continue
+		}
+		p := head
+		if sig.whole {
+			p = payload
+		}
+		if confidence := sig.match(p); confidence > best.Confidence {
+			best = Classification{Protocol: sig.name, Confidence: confidence}
+		}
+	}
+	return best
+}
+
+func matchHTTP(p []byte) float64 {
+	if bytes.HasPrefix(p, []byte("PRI * HTTP/2.0\r\n")) {
+		return 1
+	}
+	if isHTTPData(p) || bytes.HasPrefix(p, []byte("CONNECT ")) {
+		return 0.95
+	}
+	return 0
+}
+
+func matchTLS(p []byte) float64 {
+	// 记录头：类型、版本 3.x、长度
+	if len(p) < 6 || p[1] != 3 || p[2] > 4 {
+		return 0
+	}
+	switch p[0] {
+	case 0x16: // handshake: ClientHello / ServerHello
+		if p[5] == 1 || p[5] == 2 {
+			return 0.95
+		}
+		return 0.7
+	case 0x14, 0x15, 0x17: // change_cipher_spec / alert / application_data（抓包开始时连接已建立）
+		return 0.6
+	}
+	return 0
+}
+
+func matchSSH(p []byte) float64 {
+	if bytes.HasPrefix(p, []byte("SSH-2.0-")) || bytes.HasPrefix(p, []byte("SSH-1.")) {
+		return 1
+	}
+	return 0
+}
+
+// matchDNSOverTCP matches a DNS message with its 2-byte length prefix
+func matchDNSOverTCP(p []byte) float64 {
+	if len(p) < 2 || int(binary.BigEndian.Uint16(p)) != len(p)-2 {
+		return 0
+	}
+	return matchDNS(p[2:]) * 0.95
+}
+
+// matchDNS checks the header and decodes the message
+func matchDNS(p []byte) float64 {
+	// 标准查询：单个问题，opcode 为 QUERY，Z 位为 0
+	if len(p) < 12 || binary.BigEndian.Uint16(p[4:]) != 1 || p[2]&0x78 != 0 || p[3]&0x40 != 0 {
+		return 0
+	}
+	var msg dns.Msg
+	if err := msg.Unpack(p); err != nil || len(msg.Question) != 1 {
+		return 0
+	}
+	return 0.9
+}
+
+func matchQUIC(p []byte) float64 {
+	if len(p) < 7 || p[0]&0xc0 != 0xc0 {
+		return 0
+	}
+	if _, ok := quicVersions[binary.BigEndian.Uint32(p[1:])]; ok {
+		return 0.9
+	}
+	return 0
+}
+
+func matchSMTP(p []byte) float64 {
+	switch {
+	case hasPrefixFold(p, "EHLO ") || hasPrefixFold(p, "HELO "):
+		return 0.9
+	case bytes.HasPrefix(p, []byte("220")) && bytes.Contains(p, []byte("SMTP")):
+		return 0.9
+	case bytes.HasPrefix(p, []byte("220 ")) || bytes.HasPrefix(p, []byte("220-")):
+		// 没有产品标识的欢迎语，也可能是 FTP
+		return 0.5
+	}
+	return 0
+}
+
+func matchFTP(p []byte) float64 {
+	if bytes.HasPrefix(p, []byte("220")) && bytes.Contains(bytes.ToUpper(p), []byte("FTP")) {
+		return 0.9
+	}
+	return 0
+}
+
+func matchPOP3(p []byte) float64 {
+	if bytes.HasPrefix(p, []byte("+OK")) {
+		return 0.8
+	}
+	return 0
+}
+
+func matchIMAP(p []byte) float64 {
+	if bytes.HasPrefix(p, []byte("* OK")) || bytes.HasPrefix(p, []byte("* PREAUTH")) {
+		return 0.85
+	}
+	return 0
+}
+
+// matchRedis matches a RESP command array such as "*2\r\n$3\r\nGET"
+func matchRedis(p []byte) float64 {
+	if len(p) < 4 || p[0] != '*' || p[1] < '0' || p[1] > '9' {
+		return 0
+	}
+	if i := bytes.Index(p, []byte("\r\n")); i > 0 && i+2 < len(p) && p[i+2] == '$' {
+		return 0.85
+	}
+	return 0
+}
+
+// matchMySQL matches the server greeting: 3 字节长度、序号 0、协议版本 10、版本字符串
+func matchMySQL(p []byte) float64 {
+	if len(p) < 6 || p[3] != 0 || p[4] != 0x0a || p[5] < '0' || p[5] > '9' {
+		return 0
+	}
+	if int(p[0])|int(p[1])<<8|int(p[2])<<16 != len(p)-4 {
+		return 0
+	}
+	return 0.85
+}
+
+// matchPostgreSQL matches the startup message and the SSL/GSSAPI encryption requests
+func matchPostgreSQL(p []byte) float64 {
+	if len(p) < 8 || int(binary.BigEndian.Uint32(p)) != len(p) {
+		return 0
+	}
+	switch binary.BigEndian.Uint32(p[4:]) {
+	case 196608: // 协议 3.0
+		return 0.9
+	case 80877103, 80877104: // SSLRequest / GSSENCRequest
+		if len(p) == 8 {
+			return 0.9
+		}
+	}
+	return 0
+}
+
+// matchMongoDB matches the wire protocol header: 消息长度与操作码（小端）
+func matchMongoDB(p []byte) float64 {
+	if len(p) < 16 || int(binary.LittleEndian.Uint32(p)) != len(p) {
+		return 0
+	}
+	switch binary.LittleEndian.Uint32(p[12:]) {
+	case 2013, 2004, 1: // OP_MSG / OP_QUERY / OP_REPLY
+		return 0.8
+	}
+	return 0
+}
+
+// matchRDP matches a TPKT header carrying an X.224 Connection Request/Confirm
+func matchRDP(p []byte) float64 {
+	if len(p) < 7 || p[0] != 3 || p[1] != 0 || int(binary.BigEndian.Uint16(p[2:])) != len(p) {
+		return 0
+	}
+	if p[5] == 0xe0 || p[5] == 0xd0 {
+		return 0.85
+	}
+	return 0
+}
+
+// matchSMB matches SMB1/SMB2 messages in a NetBIOS session message
+func matchSMB(p []byte) float64 {
+	if len(p) < 8 || p[0] != 0 {
+		return 0
+	}
+	if bytes.Equal(p[4:8], []byte("\xffSMB")) || bytes.Equal(p[4:8], []byte("\xfeSMB")) {
+		return 0.95
+	}
+	return 0
+}
+
+// matchTelnet matches an option negotiation: IAC WILL/WONT/DO/DONT
+func matchTelnet(p []byte) float64 {
+	if len(p) >= 3 && p[0] == 0xff && p[1] >= 0xfb && p[1] <= 0xfe {
+		return 0.7
+	}
+	return 0
+}
+
+// matchMQTT matches a CONNECT packet carrying the protocol name
+func matchMQTT(p []byte) float64 {
+	if len(p) < 10 || p[0] != 0x10 {
+		return 0
+	}
+	head := p[:min(len(p), 16)]
+	if bytes.Contains(head, []byte("\x00\x04MQTT")) || bytes.Contains(head, []byte("\x00\x06MQIsdp")) {
+		return 0.9
+	}
+	return 0
+}
+
+func matchBitTorrent(p []byte) float64 {
+	if bytes.HasPrefix(p, []byte("\x13BitTorrent protocol")) {
+		return 1
+	}
+	return 0
+}
+
+func matchSIP(p []byte) float64 {
+	if bytes.HasPrefix(p, []byte("SIP/2.0 ")) {
+		return 0.9
+	}
+	line := p
+	if i := bytes.IndexByte(p, '\n'); i >= 0 {
+		line = p[:i]
+	}
+	if bytes.Contains(line, []byte(" sip:")) && bytes.Contains(line, []byte("SIP/2.0")) {
+		return 0.9
+	}
+	return 0
+}
+
+// matchDHCP matches a BOOTP message carrying the DHCP magic cookie
+func matchDHCP(p []byte) float64 {
+	if len(p) < 240 || (p[0] != 1 && p[0] != 2) || binary.BigEndian.Uint32(p[236:]) != 0x63825363 {
+		return 0
+	}
+	return 0.95
+}
+
+// matchSTUN matches a STUN message carrying the magic cookie (RFC 5389)
+func matchSTUN(p []byte) float64 {
+	if len(p) < 20 || p[0]&0xc0 != 0 || binary.BigEndian.Uint32(p[4:]) != 0x2112a442 {
+		return 0
+	}
+	if int(binary.BigEndian.Uint16(p[2:])) != len(p)-20 {
+		return 0
+	}
+	return 0.95
+}
+
+// matchSNMP matches a BER SEQUENCE starting with the version (v1, v2c, v3)
+func matchSNMP(p []byte) float64 {
+	if len(p) < 8 || p[0] != 0x30 {
+		return 0
+	}
+	i := 2
+	if p[1]&0x80 != 0 {
+		i += int(p[1] & 0x7f)
+	}
+	if i+3 > len(p) || p[i] != 0x02 || p[i+1] != 0x01 {
+		return 0
+	}
+	if v := p[i+2]; v == 0 || v == 1 || v == 3 {
+		return 0.8
+	}
+	return 0
+}
+
+// matchNTP matches a 48-byte NTPv3/v4 message; 特征较弱，仅作为低置信度结果
+func matchNTP(p []byte) float64 {
+	if len(p) != 48 {
+		return 0
+	}
+	version, mode := (p[0]>>3)&0x07, p[0]&0x07
+	if (version == 3 || version == 4) && mode >= 1 && mode <= 5 {
+		return 0.5
+	}
+	return 0
+}
+
+// hasPrefixFold reports whether p begins with prefix, ignoring ASCII case
+func hasPrefixFold(p []byte, prefix string) bool {
+	return len(p) >= len(prefix) && bytes.EqualFold(p[:len(prefix)], []byte(prefix))
+}
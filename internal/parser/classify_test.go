@@ -0,0 +1,130 @@
+package parser
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"sniffer/pkg/model"
+)
+
+func TestClassifyPayload(t *testing.T) {
+	query := new(dns.Msg)
+	query.SetQuestion("example.com.", dns.TypeA)
+	dnsQuery, err := query.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dnsOverTCP := append([]byte{byte(len(dnsQuery) >> 8), byte(len(dnsQuery))}, dnsQuery...)
+	quic := protectInitial(t, quicVersion1, unhex(t, "8394c8f03e515708"), 0, make([]byte, 1162))
+
+	// 超过 classifyMaxPayload 的消息：长度字段和完整解码按原始载荷校验
+	response := new(dns.Msg)
+	response.SetQuestion("example.com.", dns.TypeA)
+	response.Response = true
+	for i := 0; i < 40; i++ {
+		rr, err := dns.NewRR(fmt.Sprintf("example.com. 300 IN A 192.0.2.%d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Answer = append(response.Answer, rr)
+	}
+	dnsResponse, err := response.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dnsResponseOverTCP := append(binary.BigEndian.AppendUint16(nil, uint16(len(dnsResponse))), dnsResponse...)
+	// message 返回总长为 size 的消息：header 之后以 0 填充
+	message := func(size int, header ...byte) []byte {
+		return append(header, make([]byte, size-len(header))...)
+	}
+	mysqlGreeting := message(600, 0x54, 0x02, 0x00, 0x00, 0x0a, '8', '.', '0')
+	postgresStartup := message(600, 0x00, 0x00, 0x02, 0x58, 0x00, 0x03, 0x00, 0x00)
+	mongoMsg := message(600, 0x58, 0x02, 0x00, 0x00, 1, 0, 0, 0, 0, 0, 0, 0, 0xdd, 0x07, 0x00, 0x00)
+	rdpRequest := message(600, 0x03, 0x00, 0x02, 0x58, 0x02, 0xe0)
+	stunRequest := message(600, 0x00, 0x01, 0x02, 0x44, 0x21, 0x12, 0xa4, 0x42)
+
+	tests := []struct {
+		name      string
+		transport string
+		payload   []byte
+		want      string
+	}{
+		{"HTTP request", "TCP", []byte("GET /index.html HTTP/1.1\r\nHost: example.com\r\n\r\n"), "HTTP"},
+		{"HTTP response", "TCP", []byte("HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"), "HTTP"},
+		{"TLS ClientHello", "TCP", tlsRecord(tlsClientHello, ja4ClientHello()), "TLS"},
+		{"SSH banner", "TCP", []byte("SSH-2.0-OpenSSH_9.6\r\n"), "SSH"},
+		{"DNS", "UDP", dnsQuery, "DNS"},
+		{"DNS over TCP", "TCP", dnsOverTCP, "DNS"},
+		{"QUIC Initial", "UDP", quic, "QUIC"},
+		{"SMTP client", "TCP", []byte("EHLO client.example.com\r\n"), "SMTP"},
+		{"SMTP greeting", "TCP", []byte("220 mail.example.com ESMTP Postfix\r\n"), "SMTP"},
+		{"FTP greeting", "TCP", []byte("220 (vsFTPd 3.0.5)\r\n"), "FTP"},
+		{"IMAP greeting", "TCP", []byte("* OK [CAPABILITY IMAP4rev1] Dovecot ready.\r\n"), "IMAP"},
+		{"Redis", "TCP", []byte("*2\r\n$3\r\nGET\r\n$3\r\nkey\r\n"), "Redis"},
+		{"large DNS response", "UDP", dnsResponse, "DNS"},
+		{"large DNS response over TCP", "TCP", dnsResponseOverTCP, "DNS"},
+		{"large MySQL greeting", "TCP", mysqlGreeting, "MySQL"},
+		{"large PostgreSQL startup", "TCP", postgresStartup, "PostgreSQL"},
+		{"large MongoDB message", "TCP", mongoMsg, "MongoDB"},
+		{"large RDP connection request", "TCP", rdpRequest, "RDP"},
+		{"large STUN request", "UDP", stunRequest, "STUN"},
+		{"truncated MySQL greeting", "TCP", mysqlGreeting[:300], ""},
+		{"HTTP over UDP", "UDP", []byte("GET / HTTP/1.1\r\n\r\n"), ""},
+		{"unknown", "TCP", []byte{0xde, 0xad, 0xbe, 0xef, 0x00, 0x01}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := classifyPayload(tt.transport, tt.payload)
+			if got.Protocol != tt.want {
+				t.Errorf("classifyPayload = %q (%.2f), want %q", got.Protocol, got.Confidence, tt.want)
+			}
+		})
+	}
+}
+
+func TestClassifierFlow(t *testing.T) {
+	ts := time.Unix(1700000000, 0)
+	packet := func(fromClient bool, payload string) *model.Packet {
+		pkt := &model.Packet{
+			Timestamp: ts,
+			Protocol:  "TCP",
+			SrcIP:     "192.168.1.10", DstIP: "10.0.0.5",
+			SrcPort: 50123, DstPort: 9000,
+			Payload: []byte(payload),
+		}
+		if !fromClient {
+			pkt.SrcIP, pkt.DstIP = pkt.DstIP, pkt.SrcIP
+			pkt.SrcPort, pkt.DstPort = pkt.DstPort, pkt.SrcPort
+		}
+		return pkt
+	}
+
+	c := NewClassifier()
+	steps := []struct {
+		pkt  *model.Packet
+		want string
+	}{
+		// 没有载荷的握手包和无法识别的载荷不产生结果
+		{packet(true, ""), ""},
+		{packet(true, "\x00\x01\x02"), ""},
+		// 非标准端口上的 HTTP 响应
+		{packet(false, "HTTP/1.1 200 OK\r\n\r\n"), "HTTP"},
+		// 识别完成后不再检查载荷，反向的数据包使用缓存结果
+		{packet(true, "SSH-2.0-OpenSSH_9.6\r\n"), "HTTP"},
+		{packet(false, ""), "HTTP"},
+	}
+	for i, st := range steps {
+		if got := c.Classify(st.pkt); got.Protocol != st.want {
+			t.Fatalf("step %d: Classify = %q, want %q", i, got.Protocol, st.want)
+		}
+	}
+
+	c.Reset()
+	if got := c.Classify(packet(true, "SSH-2.0-OpenSSH_9.6\r\n")); got.Protocol != "SSH" {
+		t.Errorf("after Reset: Classify = %q, want SSH", got.Protocol)
+	}
+}
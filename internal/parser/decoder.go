@@ -0,0 +1,388 @@
+package parser
+
+import (
+	"encoding/binary"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"sniffer/pkg/model"
+)
+
+// maxSummaryLayers is the number of layers of the summaries cached by a decoder
+const maxSummaryLayers = 8
+
+// ipv6ExtensionClass is the IPv6 extension headers skipped by the decoder
+// 逐跳选项头由 IPv6 层自身处理；分片头不跳过，非首个分片没有传输层头部
+var ipv6ExtensionClass = gopacket.NewLayerClass([]gopacket.LayerType{
+	layers.LayerTypeIPv6Routing,
+	layers.LayerTypeIPv6Destination,
+})
+
+// dot1qStack decodes stacked 802.1Q tags (QinQ)
+// DecodingLayerParser 中每种层类型只有一个解码器，依次记录外层和内层标签
+type dot1qStack struct {
+	layers.Dot1Q
+	ids [2]uint16
+	n   int
+}
+
+func (s *dot1qStack) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if err := s.Dot1Q.DecodeFromBytes(data, df); err != nil {
+		return err
+	}
+	if s.n < len(s.ids) {
+		s.ids[s.n] = s.VLANIdentifier
+	}
+	s.n++
+	return nil
+}
+
+// ipv6Extensions skips the IPv6 routing and destination options headers
+type ipv6Extensions struct {
+	layers.IPv6ExtensionSkipper
+}
+
+func (e *ipv6Extensions) CanDecode() gopacket.LayerClass { return ipv6ExtensionClass }
+
+// layerKey identifies the layer sequence of a packet summary
+type layerKey [maxSummaryLayers]gopacket.LayerType
+
+// Decoder decodes packets with reusable layer structs
+// 每个解码协程持有一个 Decoder（不可并发使用），各层结构体在数据包之间复用，每个数据包只解码一次；
+// 地址、端口、传输层报文和应用层载荷保存在 model.Packet 中（指向原始数据），各协议解析器直接使用
+type Decoder struct {
+	eth   layers.Ethernet
+	sll   layers.LinuxSLL
+	sll2  LinuxSLL2
+	loop  layers.Loopback
+	vlan  dot1qStack
+	ip4   layers.IPv4
+	ip6   layers.IPv6
+	ext   ipv6Extensions
+	arp   layers.ARP
+	tcp   layers.TCP
+	udp   layers.UDP
+	icmp4 layers.ICMPv4
+	icmp6 layers.ICMPv6
+
+	parsers   map[gopacket.LayerType]*gopacket.DecodingLayerParser // 按首层类型
+	decoded   []gopacket.LayerType
+	inner     []gopacket.LayerType // 重组后数据报的各层
+	summaries map[layerKey]string  // 层摘要（LayerInfo）缓存，常见的层组合只有几十种
+
+	// Defrag reassembles IP fragments, nil 时不重组（分片只解码到 IP 层）
+	Defrag *Defragmenter
+	frag   ipFragment
+	events []DefragEvent
+}
+
+// NewDecoder creates a packet decoder
+func NewDecoder() *Decoder {
+	return &Decoder{
+		parsers:   make(map[gopacket.LayerType]*gopacket.DecodingLayerParser),
+		decoded:   make([]gopacket.LayerType, 0, maxSummaryLayers),
+		inner:     make([]gopacket.LayerType, 0, maxSummaryLayers),
+		summaries: make(map[layerKey]string),
+	}
+}
+
+// decoderPool holds the decoders used by ParsePacket
+var decoderPool = sync.Pool{New: func() any { return NewDecoder() }}
+
+// ParsePacket parses a raw packet and extracts basic information
+// linkType 为抓包句柄的链路层类型（LINKTYPE_* 值），决定首层解码器；
+// 频繁调用时应由每个协程持有自己的 Decoder
+func ParsePacket(data []byte, timestamp time.Time, linkType int) (*model.Packet, error) {
+	d := decoderPool.Get().(*Decoder)
+	defer decoderPool.Put(d)
+	return d.Decode(data, timestamp, linkType)
+}
+
+// parser returns the DecodingLayerParser starting at the given layer type
+func (d *Decoder) parser(first gopacket.LayerType) *gopacket.DecodingLayerParser {
+	p, ok := d.parsers[first]
+	if !ok {
+		p = gopacket.NewDecodingLayerParser(first,
+			&d.eth, &d.sll, &d.sll2, &d.loop, &d.vlan, &d.ip4, &d.ip6, &d.ext,
+			&d.arp, &d.tcp, &d.udp, &d.icmp4, &d.icmp6)
+		// 应用层由各协议解析器基于载荷解析，遇到不支持的层时停止
+		p.IgnoreUnsupported = true
+		d.parsers[first] = p
+	}
+	return p
+}
+
+// firstLayer returns the layer type the decoder starts at and the data from that layer
+// DecodingLayerParser 不支持的链路层由 gopacket 解码，从其中的网络层开始
+func firstLayer(data []byte, linkType int) (gopacket.LayerType, []byte) {
+	switch linkType {
+	case int(layers.LinkTypeEthernet):
+		return layers.LayerTypeEthernet, data
+	case int(layers.LinkTypeLinuxSLL):
+		return layers.LayerTypeLinuxSLL, data
+	case LinkTypeLinuxSLL2:
+		return LayerTypeLinuxSLL2, data
+	case int(layers.LinkTypeNull), int(layers.LinkTypeLoop):
+		return layers.LayerTypeLoopback, data
+	case LinkTypeIPv4:
+		return layers.LayerTypeIPv4, data
+	case LinkTypeIPv6:
+		return layers.LayerTypeIPv6, data
+	case int(layers.LinkTypeRaw):
+		if len(data) > 0 && data[0]>>4 == 6 {
+			return layers.LayerTypeIPv6, data
+		}
+		return layers.LayerTypeIPv4, data
+	}
+
+	decoder := firstLayerDecoder(linkType)
+	if decoder == gopacket.Decoder(layers.LayerTypeEthernet) {
+		return layers.LayerTypeEthernet, data
+	}
+	packet := gopacket.NewPacket(data, decoder, gopacket.NoCopy)
+	for _, layer := range packet.Layers() {
+		switch typ := layer.LayerType(); typ {
+		case layers.LayerTypeIPv4, layers.LayerTypeIPv6, layers.LayerTypeARP:
+			// NoCopy 时各层内容是原始数据的子切片，由容量之差得到偏移
+			return typ, data[cap(data)-cap(layer.LayerContents()):]
+		}
+	}
+	return gopacket.LayerTypeZero, nil
+}
+
+// Decode decodes a raw packet once and extracts the addresses, ports and payload
+func (d *Decoder) Decode(data []byte, timestamp time.Time, linkType int) (*model.Packet, error) {
+	pkt := &model.Packet{
+		Timestamp:  timestamp,
+		Length:     len(data),
+		CaptureLen: len(data),
+		Data:       data,
+		LinkType:   linkType,
+	}
+
+	first, start := firstLayer(data, linkType)
+	if first == gopacket.LayerTypeZero {
+		return pkt, nil
+	}
+
+	// 畸形或截断的报文保留已解码的层
+	d.vlan.n = 0
+	d.events = d.events[:0]
+	d.decoded = d.decoded[:0]
+	_ = d.parser(first).DecodeLayers(start, &d.decoded)
+	next := d.extract(pkt, d.decoded)
+
+	// IP 分片：收齐后从重组的数据报继续解码传输层，之前的分片只解码到 IP 层
+	if frag := d.fragment(); frag != nil {
+		pkt.Protocol = frag.proto.String()
+		next = gopacket.LayerTypeFragment
+		if d.Defrag != nil {
+			datagram, ev := d.Defrag.add(frag, timestamp)
+			if ev != nil {
+				d.events = append(d.events, *ev)
+			}
+			if datagram != nil {
+				next = d.decodeDatagram(pkt, datagram)
+			}
+		}
+	}
+
+	// 802.1Q / QinQ VLAN 标签（外层在前）
+	if d.vlan.n > 0 {
+		pkt.VLANID = d.vlan.ids[0]
+	}
+	if d.vlan.n > 1 {
+		pkt.InnerVLANID = d.vlan.ids[1]
+	}
+
+	pkt.LayerInfo = d.summary(next)
+	return pkt, nil
+}
+
+// DefragEvents returns the overlapping fragments found by the last Decode call
+// 返回的切片在下次调用 Decode 前有效
+func (d *Decoder) DefragEvents() []DefragEvent {
+	return d.events
+}
+
+// extract copies the addresses, ports and payload of the decoded layers into the packet
+// and returns the layer type above the transport layer (没有载荷时为 LayerTypeZero)
+func (d *Decoder) extract(pkt *model.Packet, decoded []gopacket.LayerType) gopacket.LayerType {
+	var next gopacket.LayerType
+	for _, typ := range decoded {
+		switch typ {
+		case layers.LayerTypeEthernet:
+			pkt.SrcMAC, pkt.DstMAC = d.eth.SrcMAC, d.eth.DstMAC
+
+		case layers.LayerTypeIPv4:
+			pkt.SrcAddr, pkt.DstAddr = d.ip4.SrcIP, d.ip4.DstIP
+			pkt.SrcIP = d.ip4.SrcIP.String()
+			pkt.DstIP = d.ip4.DstIP.String()
+			pkt.Protocol = d.ip4.Protocol.String()
+			pkt.IPTTL = d.ip4.TTL
+
+		case layers.LayerTypeIPv6:
+			pkt.SrcAddr, pkt.DstAddr = d.ip6.SrcIP, d.ip6.DstIP
+			pkt.SrcIP = d.ip6.SrcIP.String()
+			pkt.DstIP = d.ip6.DstIP.String()
+			pkt.Protocol = d.ip6.NextHeader.String()
+			pkt.IPTTL = d.ip6.HopLimit
+
+		case layers.LayerTypeARP:
+			// ARP 没有 IP 层，使用发送方和目标的协议地址
+			if d.arp.Protocol == layers.EthernetTypeIPv4 && len(d.arp.SourceProtAddress) == 4 && len(d.arp.DstProtAddress) == 4 {
+				pkt.SrcIP = net.IP(d.arp.SourceProtAddress).String()
+				pkt.DstIP = net.IP(d.arp.DstProtAddress).String()
+			}
+			pkt.Protocol = "ARP"
+			pkt.Transport = d.arp.Contents
+
+		case layers.LayerTypeTCP:
+			pkt.SrcPort = uint16(d.tcp.SrcPort)
+			pkt.DstPort = uint16(d.tcp.DstPort)
+			pkt.Protocol = "TCP"
+			pkt.Transport = layerBytes(&d.tcp.BaseLayer)
+			pkt.Payload = d.tcp.Payload
+			if len(d.tcp.Payload) > 0 {
+				next = d.tcp.NextLayerType()
+			}
+
+		case layers.LayerTypeUDP:
+			pkt.SrcPort = uint16(d.udp.SrcPort)
+			pkt.DstPort = uint16(d.udp.DstPort)
+			pkt.Protocol = "UDP"
+			pkt.Transport = layerBytes(&d.udp.BaseLayer)
+			pkt.Payload = d.udp.Payload
+			if len(d.udp.Payload) > 0 {
+				next = d.udp.NextLayerType()
+			}
+
+		case layers.LayerTypeICMPv4:
+			pkt.Protocol = "ICMP"
+			pkt.Transport = layerBytes(&d.icmp4.BaseLayer)
+			if len(d.icmp4.Payload) > 0 {
+				next = d.icmp4.NextLayerType()
+			}
+
+		case layers.LayerTypeICMPv6:
+			pkt.Protocol = "ICMPv6"
+			pkt.Transport = layerBytes(&d.icmp6.BaseLayer)
+			if len(d.icmp6.Payload) > 0 {
+				next = d.icmp6.NextLayerType()
+			}
+		}
+	}
+	return next
+}
+
+// fragment returns the IP fragment of the decoded packet, nil 表示不是分片
+// IPv4 分片和 IPv6 分片扩展头都在 IP 层（或其后的扩展头）之后停止解码
+func (d *Decoder) fragment() *ipFragment {
+	if len(d.decoded) == 0 {
+		return nil
+	}
+	switch d.decoded[len(d.decoded)-1] {
+	case layers.LayerTypeIPv4:
+		if d.ip4.Flags&layers.IPv4MoreFragments == 0 && d.ip4.FragOffset == 0 {
+			return nil
+		}
+		d.frag = ipFragment{
+			src:    d.ip4.SrcIP,
+			dst:    d.ip4.DstIP,
+			id:     uint32(d.ip4.Id),
+			proto:  d.ip4.Protocol,
+			offset: int(d.ip4.FragOffset) * 8,
+			more:   d.ip4.Flags&layers.IPv4MoreFragments != 0,
+			header: d.ip4.Contents,
+			data:   d.ip4.Payload,
+		}
+		return &d.frag
+
+	case layers.LayerTypeIPv6, layers.LayerTypeIPv6Routing, layers.LayerTypeIPv6Destination:
+		next, payload := d.ip6.NextLayerType(), d.ip6.Payload
+		if d.decoded[len(d.decoded)-1] != layers.LayerTypeIPv6 {
+			next, payload = d.ext.NextLayerType(), d.ext.Payload
+		}
+		if next != layers.LayerTypeIPv6Fragment || len(payload) < 8 || len(d.ip6.Contents) < ipv6HeaderLen {
+			return nil
+		}
+		// 分片头：下一个头部(1) 保留(1) 偏移和 M 标志(2) 标识(4)
+		offset := binary.BigEndian.Uint16(payload[2:4])
+		d.frag = ipFragment{
+			v6:     true,
+			src:    d.ip6.SrcIP,
+			dst:    d.ip6.DstIP,
+			id:     binary.BigEndian.Uint32(payload[4:8]),
+			proto:  layers.IPProtocol(payload[0]),
+			offset: int(offset &^ 7),
+			more:   offset&1 != 0,
+			header: d.ip6.Contents[:ipv6HeaderLen],
+			data:   payload[8:],
+		}
+		return &d.frag
+	}
+	return nil
+}
+
+// decodeDatagram decodes a reassembled datagram in place of the IP layer of the packet
+// 链路层（MAC、VLAN）保留原数据包的解码结果
+func (d *Decoder) decodeDatagram(pkt *model.Packet, datagram []byte) gopacket.LayerType {
+	first := layers.LayerTypeIPv4
+	if datagram[0]>>4 == 6 {
+		first = layers.LayerTypeIPv6
+	}
+	for i, typ := range d.decoded {
+		if typ == layers.LayerTypeIPv4 || typ == layers.LayerTypeIPv6 {
+			d.decoded = d.decoded[:i]
+			break
+		}
+	}
+	_ = d.parser(first).DecodeLayers(datagram, &d.inner)
+	d.decoded = append(d.decoded, d.inner...)
+	return d.extract(pkt, d.inner)
+}
+
+// layerBytes returns the header and the payload of a decoded layer as one slice
+// 两者是原始数据中相邻的子切片
+func layerBytes(l *layers.BaseLayer) []byte {
+	return l.Contents[:len(l.Contents)+len(l.Payload)]
+}
+
+// summary returns the layer summary of the decoded packet, 如 "Ethernet > IPv4 > UDP > DNS"
+// next 为传输层之上的层类型，没有载荷时为 LayerTypeZero
+func (d *Decoder) summary(next gopacket.LayerType) string {
+	n := len(d.decoded)
+	if next != gopacket.LayerTypeZero {
+		n++
+	}
+	if n > maxSummaryLayers {
+		return d.buildSummary(next)
+	}
+
+	var key layerKey
+	copy(key[:], d.decoded)
+	if next != gopacket.LayerTypeZero {
+		key[n-1] = next
+	}
+	s, ok := d.summaries[key]
+	if !ok {
+		s = d.buildSummary(next)
+		d.summaries[key] = s
+	}
+	return s
+}
+
+func (d *Decoder) buildSummary(next gopacket.LayerType) string {
+	names := make([]string, 0, len(d.decoded)+1)
+	for _, typ := range d.decoded {
+		names = append(names, typ.String())
+	}
+	if next != gopacket.LayerTypeZero {
+		names = append(names, next.String())
+	}
+	return strings.Join(names, " > ")
+}
@@ -0,0 +1,266 @@
+package parser
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"sniffer/pkg/model"
+)
+
+// samplePackets returns a mix of DNS, HTTP, TLS, QUIC, ICMP, QinQ, IPv6, ARP and DHCP frames
+func samplePackets(tb testing.TB) map[string][]byte {
+	tb.Helper()
+
+	dns := &layers.DNS{
+		ID: 0x1234,
+		RD: true,
+		Questions: []layers.DNSQuestion{
+			{Name: []byte("www.example.com"), Type: layers.DNSTypeA, Class: layers.DNSClassIN},
+		},
+	}
+	http := gopacket.Payload("GET /index.html HTTP/1.1\r\nHost: www.example.com\r\nAccept: */*\r\n\r\n")
+	// TLS 记录头 + ClientHello 开头
+	tls := gopacket.Payload(append([]byte{0x16, 0x03, 0x01, 0x00, 0x40, 0x01, 0x00, 0x00, 0x3c, 0x03, 0x03}, make([]byte, 60)...))
+	// QUIC v1 长包头 Initial
+	quic := gopacket.Payload(append([]byte{0xc3, 0x00, 0x00, 0x00, 0x01, 0x08}, make([]byte, 1200)...))
+
+	tcp := func(src, dst layers.TCPPort) *layers.TCP {
+		return &layers.TCP{SrcPort: src, DstPort: dst, Seq: 1000, Ack: 1, PSH: true, ACK: true, Window: 65535}
+	}
+
+	return map[string][]byte{
+		"dns": serialize(tb, ethernet(layers.EthernetTypeIPv4), ipv4("192.168.1.10", "192.168.1.1", layers.IPProtocolUDP),
+			&layers.UDP{SrcPort: 53124, DstPort: 53}, dns),
+		"http": serialize(tb, ethernet(layers.EthernetTypeIPv4), ipv4("192.168.1.10", "93.184.216.34", layers.IPProtocolTCP),
+			tcp(50123, 80), http),
+		"tls": serialize(tb, ethernet(layers.EthernetTypeIPv4), ipv4("192.168.1.10", "93.184.216.34", layers.IPProtocolTCP),
+			tcp(50124, 443), tls),
+		"quic": serialize(tb, ethernet(layers.EthernetTypeIPv4), ipv4("192.168.1.10", "93.184.216.34", layers.IPProtocolUDP),
+			&layers.UDP{SrcPort: 50125, DstPort: 443}, quic),
+		"icmp": serialize(tb, ethernet(layers.EthernetTypeIPv4), ipv4("192.168.1.10", "8.8.8.8", layers.IPProtocolICMPv4),
+			&layers.ICMPv4{TypeCode: layers.CreateICMPv4TypeCode(layers.ICMPv4TypeEchoRequest, 0), Id: 1, Seq: 1},
+			gopacket.Payload(make([]byte, 56))),
+		"qinq": serialize(tb, ethernet(layers.EthernetTypeQinQ),
+			&layers.Dot1Q{VLANIdentifier: 100, Type: layers.EthernetTypeDot1Q},
+			&layers.Dot1Q{VLANIdentifier: 200, Type: layers.EthernetTypeIPv4},
+			ipv4("10.0.0.1", "10.0.0.2", layers.IPProtocolUDP), &layers.UDP{SrcPort: 40000, DstPort: 5000},
+			gopacket.Payload(make([]byte, 100))),
+		"ipv6": serialize(tb, ethernet(layers.EthernetTypeIPv6), ipv6("2001:db8::10", "2001:db8::34", layers.IPProtocolTCP),
+			tcp(50126, 443), tls),
+		"arp": serialize(tb, ethernet(layers.EthernetTypeARP), &layers.ARP{
+			AddrType:          layers.LinkTypeEthernet,
+			Protocol:          layers.EthernetTypeIPv4,
+			HwAddressSize:     6,
+			ProtAddressSize:   4,
+			Operation:         layers.ARPRequest,
+			SourceHwAddress:   testSrcMAC,
+			SourceProtAddress: net.IP{192, 168, 1, 10},
+			DstHwAddress:      make([]byte, 6),
+			DstProtAddress:    net.IP{192, 168, 1, 1},
+		}),
+		"dhcp": serialize(tb, ethernet(layers.EthernetTypeIPv4), ipv4("0.0.0.0", "255.255.255.255", layers.IPProtocolUDP),
+			&layers.UDP{SrcPort: 68, DstPort: 67}, &layers.DHCPv4{
+				Operation:    layers.DHCPOpRequest,
+				HardwareType: layers.LinkTypeEthernet,
+				HardwareLen:  6,
+				Xid:          0x3903f326,
+				ClientHWAddr: testSrcMAC,
+				Options: layers.DHCPOptions{
+					layers.NewDHCPOption(layers.DHCPOptMessageType, []byte{byte(layers.DHCPMsgTypeDiscover)}),
+				},
+			}),
+	}
+}
+
+// legacyDecode is the gopacket.NewPacket call each parser made before the single-pass decoder
+func legacyDecode(pkt *model.Packet) gopacket.Packet {
+	return gopacket.NewPacket(pkt.Data, firstLayerDecoder(pkt.LinkType), gopacket.Default)
+}
+
+// legacyParsePacket is ParsePacket as it was before the single-pass decoder
+func legacyParsePacket(data []byte, timestamp time.Time, linkType int) *model.Packet {
+	pkt := &model.Packet{
+		Timestamp:  timestamp,
+		Length:     len(data),
+		CaptureLen: len(data),
+		Data:       data,
+		LinkType:   linkType,
+	}
+
+	packet := legacyDecode(pkt)
+
+	for _, layer := range packet.Layers() {
+		dot1q, ok := layer.(*layers.Dot1Q)
+		if !ok {
+			continue
+		}
+		if pkt.VLANID == 0 {
+			pkt.VLANID = dot1q.VLANIdentifier
+		} else if pkt.InnerVLANID == 0 {
+			pkt.InnerVLANID = dot1q.VLANIdentifier
+		}
+	}
+
+	if ip, ok := packet.Layer(layers.LayerTypeIPv4).(*layers.IPv4); ok {
+		pkt.SrcIP = ip.SrcIP.String()
+		pkt.DstIP = ip.DstIP.String()
+		pkt.Protocol = ip.Protocol.String()
+		pkt.IPTTL = ip.TTL
+	} else if ip, ok := packet.Layer(layers.LayerTypeIPv6).(*layers.IPv6); ok {
+		pkt.SrcIP = ip.SrcIP.String()
+		pkt.DstIP = ip.DstIP.String()
+		pkt.Protocol = ip.NextHeader.String()
+		pkt.IPTTL = ip.HopLimit
+	}
+
+	if arp, ok := packet.Layer(layers.LayerTypeARP).(*layers.ARP); ok {
+		if arp.Protocol == layers.EthernetTypeIPv4 && len(arp.SourceProtAddress) == 4 && len(arp.DstProtAddress) == 4 {
+			pkt.SrcIP = net.IP(arp.SourceProtAddress).String()
+			pkt.DstIP = net.IP(arp.DstProtAddress).String()
+		}
+		pkt.Protocol = "ARP"
+	}
+
+	if tcp, ok := packet.Layer(layers.LayerTypeTCP).(*layers.TCP); ok {
+		pkt.SrcPort = uint16(tcp.SrcPort)
+		pkt.DstPort = uint16(tcp.DstPort)
+		pkt.Protocol = "TCP"
+	} else if udp, ok := packet.Layer(layers.LayerTypeUDP).(*layers.UDP); ok {
+		pkt.SrcPort = uint16(udp.SrcPort)
+		pkt.DstPort = uint16(udp.DstPort)
+		pkt.Protocol = "UDP"
+	} else if packet.Layer(layers.LayerTypeICMPv4) != nil {
+		pkt.Protocol = "ICMP"
+	}
+
+	var names []string
+	for _, layer := range packet.Layers() {
+		names = append(names, layer.LayerType().String())
+	}
+	pkt.LayerInfo = strings.Join(names, " > ")
+	return pkt
+}
+
+// legacyParserDecodes repeats the decodes the parsers made on a packet before the single-pass decoder
+// (TCP 重组开启时)：载荷识别、协议解析器、TCP 重组器和 QUIC 各自重新解码一次，返回解码次数
+func legacyParserDecodes(pkt *model.Packet) int {
+	n := 0
+	layer := func(typ gopacket.LayerType) gopacket.Layer {
+		n++
+		return legacyDecode(pkt).Layer(typ)
+	}
+
+	switch pkt.Protocol {
+	case "TCP":
+		// 载荷识别（流识别完成前）
+		layer(layers.LayerTypeTCP)
+		// TCP 重组器（开启重组时 HTTP / TLS 不再逐包解析）
+		layer(layers.LayerTypeTCP)
+	case "UDP":
+		layer(layers.LayerTypeUDP)
+		if (dnsDissector{}).Claims(pkt) {
+			layer(layers.LayerTypeUDP)
+		}
+		if (dhcpDissector{}).Claims(pkt) {
+			layer(layers.LayerTypeUDP)
+		}
+		if isQUICPort(pkt.DstPort) {
+			layer(layers.LayerTypeUDP)
+		}
+	case "ICMP", "ICMPv6":
+		layer(layers.LayerTypeICMPv4)
+	case "ARP":
+		layer(layers.LayerTypeARP)
+	}
+	return n
+}
+
+func TestDecoderMatchesLegacyParsePacket(t *testing.T) {
+	ts := time.Unix(1700000000, 0)
+	d := NewDecoder()
+	for name, data := range samplePackets(t) {
+		t.Run(name, func(t *testing.T) {
+			want := legacyParsePacket(data, ts, int(layers.LinkTypeEthernet))
+			got, err := d.Decode(data, ts, int(layers.LinkTypeEthernet))
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			if got.SrcIP != want.SrcIP || got.DstIP != want.DstIP || got.SrcPort != want.SrcPort || got.DstPort != want.DstPort {
+				t.Errorf("addresses = %s:%d > %s:%d, want %s:%d > %s:%d",
+					got.SrcIP, got.SrcPort, got.DstIP, got.DstPort, want.SrcIP, want.SrcPort, want.DstIP, want.DstPort)
+			}
+			if got.Protocol != want.Protocol {
+				t.Errorf("Protocol = %q, want %q", got.Protocol, want.Protocol)
+			}
+			if got.VLANID != want.VLANID || got.InnerVLANID != want.InnerVLANID {
+				t.Errorf("VLAN = %d/%d, want %d/%d", got.VLANID, got.InnerVLANID, want.VLANID, want.InnerVLANID)
+			}
+			if got.IPTTL != want.IPTTL {
+				t.Errorf("IPTTL = %d, want %d", got.IPTTL, want.IPTTL)
+			}
+		})
+	}
+}
+
+// benchmarkPackets returns the sample packets in a fixed order
+func benchmarkPackets(b *testing.B) [][]byte {
+	samples := samplePackets(b)
+	names := []string{"dns", "http", "tls", "quic", "icmp", "qinq", "ipv6", "arp", "dhcp"}
+	packets := make([][]byte, 0, len(names))
+	for _, name := range names {
+		packets = append(packets, samples[name])
+	}
+	return packets
+}
+
+// BenchmarkDecodeLegacy runs the decoding of the previous pipeline:
+// ParsePacket 通过 gopacket.NewPacket 解码后，各解析器再各自解码同一数据包（decodes/op 为平均解码次数）
+func BenchmarkDecodeLegacy(b *testing.B) {
+	packets := benchmarkPackets(b)
+	ts := time.Now()
+	linkType := int(layers.LinkTypeEthernet)
+
+	decodes := 0
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pkt := legacyParsePacket(packets[i%len(packets)], ts, linkType)
+		decodes += 1 + legacyParserDecodes(pkt)
+	}
+	b.ReportMetric(float64(decodes)/float64(b.N), "decodes/op")
+}
+
+// BenchmarkDecoder decodes each packet once with a per-worker Decoder
+func BenchmarkDecoder(b *testing.B) {
+	packets := benchmarkPackets(b)
+	ts := time.Now()
+	linkType := int(layers.LinkTypeEthernet)
+
+	d := NewDecoder()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := d.Decode(packets[i%len(packets)], ts, linkType); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkParsePacket decodes each packet once with a pooled Decoder
+func BenchmarkParsePacket(b *testing.B) {
+	packets := benchmarkPackets(b)
+	ts := time.Now()
+	linkType := int(layers.LinkTypeEthernet)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ParsePacket(packets[i%len(packets)], ts, linkType); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
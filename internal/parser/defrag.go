@@ -0,0 +1,286 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"sniffer/pkg/model"
+)
+
+// maxDatagramLen is the largest IP datagram (IPv4 总长度、IPv6 载荷长度字段的上限)
+const maxDatagramLen = 65535
+
+// DefragOptions represents the limits of the IP fragment reassembler
+type DefragOptions struct {
+	MaxMemory    int           // 所有未完成数据报缓存的分片数据上限（字节），超出时丢弃最早的数据报
+	MaxFragments int           // 单个数据报的分片数上限，超出时丢弃该数据报
+	Timeout      time.Duration // 等待剩余分片的超时，超时后丢弃未完成的数据报
+}
+
+// DefragEvent is an overlapping fragment found while reassembling a datagram
+// 正常的分片互不重叠；重叠分片可用于绕过检测（目标主机与监测设备按不同的策略取舍重叠部分）
+type DefragEvent struct {
+	SrcIP     string
+	DstIP     string
+	Protocol  string // 上层协议
+	ID        uint32 // 分片标识
+	Offset    int    // 重叠分片的偏移
+	Length    int    // 重叠分片的长度
+	Conflict  bool   // 重叠部分的内容不一致
+	VLANID    uint16
+	Interface string
+}
+
+// ipFragment is a fragment decoded from a packet
+type ipFragment struct {
+	v6       bool
+	src, dst net.IP
+	id       uint32
+	proto    layers.IPProtocol
+	offset   int
+	more     bool
+	header   []byte // IPv4 头部（含选项）或 IPv6 固定头部
+	data     []byte
+}
+
+// fragKey identifies the datagram of a fragment: 源地址、目的地址、标识和协议（IPv4）
+type fragKey struct {
+	src, dst [net.IPv6len]byte
+	id       uint32
+	proto    layers.IPProtocol
+	v6       bool
+}
+
+// fragPart is a buffered fragment
+type fragPart struct {
+	offset int
+	data   []byte
+}
+
+// fragSet holds the fragments of a datagram waiting for the rest
+type fragSet struct {
+	key    fragKey
+	first  time.Time  // 首个分片的时间
+	header []byte     // 优先使用偏移为 0 的分片的头部
+	parts  []fragPart // 按偏移排序，互不重叠
+	size   int        // 已缓存的分片数据字节数
+	total  int        // 数据报长度，收到最后一个分片前为 -1
+	done   bool       // 已完成或已丢弃，等待从队列中移除
+}
+
+// Defragmenter reassembles IPv4 fragments and IPv6 fragment extension headers
+// 解码阶段的多个协程共用，所有调用由 mu 串行化；超时按数据包时间计算（离线回放同样适用）
+type Defragmenter struct {
+	mu       sync.Mutex
+	opts     DefragOptions
+	sets     map[fragKey]*fragSet
+	queue    []*fragSet // 按首个分片到达的顺序排列，用于超时和内存淘汰
+	memory   int        // 所有未完成数据报缓存的字节数
+	lastSeen time.Time
+	stats    model.DefragStats
+}
+
+// NewDefragmenter creates an IP fragment reassembler with the given limits
+func NewDefragmenter(opts DefragOptions) *Defragmenter {
+	f := &Defragmenter{
+		opts: opts,
+		sets: make(map[fragKey]*fragSet),
+	}
+	f.stats.Enabled = true
+	return f
+}
+
+// Stats returns the reassembler counters
+func (f *Defragmenter) Stats() model.DefragStats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	stats := f.stats
+	stats.Pending = int64(len(f.sets))
+	stats.PendingBytes = int64(f.memory)
+	return stats
+}
+
+// add buffers a fragment and returns the reassembled datagram (IP 头部 + 完整载荷) once all fragments have arrived
+// 重叠的分片返回事件并丢弃整个数据报（RFC 5722），内容完全相同的重复分片直接忽略
+func (f *Defragmenter) add(frag *ipFragment, timestamp time.Time) ([]byte, *DefragEvent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.stats.Fragments++
+	if timestamp.After(f.lastSeen) {
+		f.lastSeen = timestamp
+	}
+	cutoff := f.lastSeen.Add(-f.opts.Timeout)
+	f.expireLocked(func(s *fragSet) bool { return s.first.Before(cutoff) }, &f.stats.Timeouts)
+
+	// IPv6 按源地址、目的地址和标识区分数据报（RFC 8200）
+	key := fragKey{id: frag.id, v6: frag.v6}
+	if !frag.v6 {
+		key.proto = frag.proto
+	}
+	copy(key.src[:], frag.src)
+	copy(key.dst[:], frag.dst)
+
+	// IPv4 的总长度包含头部，IPv6 的载荷长度不含固定头部
+	end := frag.offset + len(frag.data)
+	limit := maxDatagramLen
+	if !frag.v6 {
+		limit -= len(frag.header)
+	}
+	if end > limit || (frag.more && len(frag.data)%8 != 0) {
+		// 超长的数据报（Ping of Death）或中间分片长度不是 8 的倍数
+		f.stats.Invalid++
+		f.dropLocked(f.sets[key])
+		return nil, nil
+	}
+
+	s, ok := f.sets[key]
+	if !ok {
+		s = &fragSet{key: key, first: timestamp, total: -1}
+		f.sets[key] = s
+		f.queue = append(f.queue, s)
+	}
+
+	// 与已缓存的分片比较：完全相同的重传忽略，其余重叠报告后丢弃整个数据报
+	for _, p := range s.parts {
+		pEnd := p.offset + len(p.data)
+		if end <= p.offset || frag.offset >= pEnd {
+			continue
+		}
+		if p.offset == frag.offset && bytes.Equal(p.data, frag.data) {
+			return nil, nil
+		}
+		lo, hi := max(p.offset, frag.offset), min(pEnd, end)
+		ev := &DefragEvent{
+			SrcIP:    frag.src.String(),
+			DstIP:    frag.dst.String(),
+			Protocol: frag.proto.String(),
+			ID:       frag.id,
+			Offset:   frag.offset,
+			Length:   len(frag.data),
+			Conflict: !bytes.Equal(p.data[lo-p.offset:hi-p.offset], frag.data[lo-frag.offset:hi-frag.offset]),
+		}
+		f.stats.Overlaps++
+		f.dropLocked(s)
+		return nil, ev
+	}
+
+	if !frag.more {
+		if n := len(s.parts); (s.total >= 0 && s.total != end) || (n > 0 && s.parts[n-1].offset+len(s.parts[n-1].data) > end) {
+			f.stats.Invalid++
+			f.dropLocked(s)
+			return nil, nil
+		}
+		s.total = end
+	}
+	if s.total >= 0 && end > s.total {
+		f.stats.Invalid++
+		f.dropLocked(s)
+		return nil, nil
+	}
+	if f.opts.MaxFragments > 0 && len(s.parts) >= f.opts.MaxFragments {
+		f.stats.Dropped++
+		f.dropLocked(s)
+		return nil, nil
+	}
+
+	// 内存上限：丢弃最早的未完成数据报，仍不足时丢弃当前数据报
+	if f.opts.MaxMemory > 0 && f.memory+len(frag.data) > f.opts.MaxMemory {
+		f.evictLocked(s, len(frag.data))
+		if f.memory+len(frag.data) > f.opts.MaxMemory {
+			f.stats.Evicted++
+			f.dropLocked(s)
+			return nil, nil
+		}
+	}
+
+	data := append([]byte(nil), frag.data...)
+	i := sort.Search(len(s.parts), func(i int) bool { return s.parts[i].offset > frag.offset })
+	s.parts = append(s.parts, fragPart{})
+	copy(s.parts[i+1:], s.parts[i:])
+	s.parts[i] = fragPart{offset: frag.offset, data: data}
+	s.size += len(data)
+	f.memory += len(data)
+	if s.header == nil || frag.offset == 0 {
+		s.header = append(s.header[:0], frag.header...)
+	}
+
+	// 分片互不重叠，总长度等于数据报长度即已完整
+	if s.total < 0 || s.size != s.total || s.parts[0].offset != 0 {
+		return nil, nil
+	}
+	f.stats.Reassembled++
+	datagram := s.datagram(frag.proto)
+	f.dropLocked(s)
+	return datagram, nil
+}
+
+// datagram joins the header and the fragments into an unfragmented IP packet
+// IPv4 清除分片标志和偏移；IPv6 只保留固定头部，下一个头部改为分片头中的上层协议
+func (s *fragSet) datagram(proto layers.IPProtocol) []byte {
+	buf := make([]byte, len(s.header), len(s.header)+s.total)
+	copy(buf, s.header)
+	for _, p := range s.parts {
+		buf = append(buf, p.data...)
+	}
+	if s.key.v6 {
+		binary.BigEndian.PutUint16(buf[4:6], uint16(s.total))
+		buf[6] = byte(proto)
+	} else {
+		binary.BigEndian.PutUint16(buf[2:4], uint16(len(buf)))
+		binary.BigEndian.PutUint16(buf[6:8], 0)
+	}
+	return buf
+}
+
+// dropLocked removes a fragment set; 队列中的条目在出队时跳过
+func (f *Defragmenter) dropLocked(s *fragSet) {
+	if s == nil || s.done {
+		return
+	}
+	s.done = true
+	delete(f.sets, s.key)
+	f.memory -= s.size
+}
+
+// evictLocked drops the oldest fragment sets other than keep until need more bytes fit in the memory limit
+// 当前数据报可能位于队列前部，跳过它继续淘汰其后的数据报
+func (f *Defragmenter) evictLocked(keep *fragSet, need int) {
+	n := 0
+	for _, s := range f.queue {
+		if !s.done && s != keep && f.memory+need > f.opts.MaxMemory {
+			f.dropLocked(s)
+			f.stats.Evicted++
+		}
+		if !s.done {
+			f.queue[n] = s
+			n++
+		}
+	}
+	clear(f.queue[n:])
+	f.queue = f.queue[:n]
+}
+
+// expireLocked drops the fragment sets at the front of the queue while expire returns true
+// and adds them to the given counter; 已完成的数据报直接出队
+func (f *Defragmenter) expireLocked(expire func(s *fragSet) bool, counter *int64) {
+	n := 0
+	for ; n < len(f.queue); n++ {
+		s := f.queue[n]
+		if s.done {
+			continue
+		}
+		if !expire(s) {
+			break
+		}
+		f.dropLocked(s)
+		*counter++
+	}
+	f.queue = f.queue[:copy(f.queue, f.queue[n:])]
+}
@@ -0,0 +1,306 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// testDatagram is a UDP datagram split into fragments by the tests
+type testDatagram struct {
+	id        uint32
+	transport []byte // UDP 头部和载荷
+	payload   []byte
+}
+
+func newTestDatagram(t *testing.T, v6 bool, id uint32, size int) *testDatagram {
+	payload := make([]byte, size)
+	for i := range payload {
+		payload[i] = byte(i * 7)
+	}
+	udp := &layers.UDP{SrcPort: 5000, DstPort: 5001}
+	// 由完整的 IP 数据包计算 UDP 校验和，再去掉 IP 头部
+	var data []byte
+	if v6 {
+		data = serialize(t, ipv6("2001:db8::1", "2001:db8::2", layers.IPProtocolUDP), udp, gopacket.Payload(payload))[40:]
+	} else {
+		data = serialize(t, ipv4("10.0.0.1", "10.0.0.2", layers.IPProtocolUDP), udp, gopacket.Payload(payload))[20:]
+	}
+	return &testDatagram{id: id, transport: data, payload: payload}
+}
+
+// testFragment is one fragment of a test datagram
+type testFragment struct {
+	dgram  *testDatagram
+	offset int
+	data   []byte
+	more   bool
+	at     time.Duration // 相对第一个分片的时间
+}
+
+// part returns the fragment carrying transport[from:to]; 最后一段不设置 MF 标志
+func (d *testDatagram) part(from, to int) testFragment {
+	return testFragment{dgram: d, offset: from, data: d.transport[from:to], more: to < len(d.transport)}
+}
+
+func (f testFragment) after(at time.Duration) testFragment {
+	f.at = at
+	return f
+}
+
+// corrupt flips the bytes of the fragment so that it conflicts with the original data
+func (f testFragment) corrupt() testFragment {
+	data := make([]byte, len(f.data))
+	for i, b := range f.data {
+		data[i] = ^b
+	}
+	f.data = data
+	return f
+}
+
+func (f testFragment) frame(t *testing.T, v6 bool) []byte {
+	if v6 {
+		// 分片头：下一个头部(1) 保留(1) 偏移和 M 标志(2) 标识(4)
+		hdr := []byte{byte(layers.IPProtocolUDP), 0}
+		flags := uint16(f.offset)
+		if f.more {
+			flags |= 1
+		}
+		hdr = binary.BigEndian.AppendUint16(hdr, flags)
+		hdr = binary.BigEndian.AppendUint32(hdr, f.dgram.id)
+		return serialize(t, ethernet(layers.EthernetTypeIPv6),
+			ipv6("2001:db8::1", "2001:db8::2", layers.IPProtocolIPv6Fragment),
+			gopacket.Payload(append(hdr, f.data...)))
+	}
+	ip := ipv4("10.0.0.1", "10.0.0.2", layers.IPProtocolUDP)
+	ip.Id = uint16(f.dgram.id)
+	ip.FragOffset = uint16(f.offset / 8)
+	if f.more {
+		ip.Flags = layers.IPv4MoreFragments
+	}
+	return serialize(t, ethernet(layers.EthernetTypeIPv4), ip, gopacket.Payload(f.data))
+}
+
+func TestDefragmenter(t *testing.T) {
+	// 数据报 A 的 UDP 部分共 1200 字节，B 共 800 字节
+	type counters struct {
+		Reassembled, Timeouts, Evicted, Dropped, Invalid, Overlaps, Pending int64
+	}
+	type event struct {
+		Offset, Length int
+		Conflict       bool
+	}
+	tests := []struct {
+		name   string
+		v6     bool
+		opts   DefragOptions
+		frags  func(a, b *testDatagram) []testFragment
+		want   []uint32 // 按完成顺序排列的重组数据报标识
+		events []event
+		stats  counters
+	}{
+		{
+			name: "IPv4 in order",
+			frags: func(a, b *testDatagram) []testFragment {
+				return []testFragment{a.part(0, 480), a.part(480, 960), a.part(960, 1200)}
+			},
+			want:  []uint32{0xa},
+			stats: counters{Reassembled: 1},
+		},
+		{
+			name: "IPv4 out of order and interleaved",
+			frags: func(a, b *testDatagram) []testFragment {
+				return []testFragment{a.part(960, 1200), b.part(400, 800), a.part(0, 480), b.part(0, 400), a.part(480, 960)}
+			},
+			want:  []uint32{0xb, 0xa},
+			stats: counters{Reassembled: 2},
+		},
+		{
+			name: "identical retransmission ignored",
+			frags: func(a, b *testDatagram) []testFragment {
+				return []testFragment{a.part(0, 480), a.part(0, 480), a.part(480, 960), a.part(960, 1200)}
+			},
+			want:  []uint32{0xa},
+			stats: counters{Reassembled: 1},
+		},
+		{
+			name: "overlap with the same content",
+			frags: func(a, b *testDatagram) []testFragment {
+				return []testFragment{a.part(0, 480), a.part(240, 720), a.part(480, 960), a.part(960, 1200)}
+			},
+			// 重叠后丢弃整个数据报，之后的分片缺少偏移 0 无法完成
+			events: []event{{Offset: 240, Length: 480}},
+			stats:  counters{Overlaps: 1, Pending: 1},
+		},
+		{
+			name: "overlap with conflicting content",
+			frags: func(a, b *testDatagram) []testFragment {
+				return []testFragment{a.part(480, 960), a.part(0, 480), a.part(480, 960).corrupt()}
+			},
+			events: []event{{Offset: 480, Length: 480, Conflict: true}},
+			stats:  counters{Overlaps: 1},
+		},
+		{
+			name: "middle fragment not a multiple of 8",
+			frags: func(a, b *testDatagram) []testFragment {
+				return []testFragment{a.part(0, 480), a.part(480, 964)}
+			},
+			stats: counters{Invalid: 1},
+		},
+		{
+			name: "datagram longer than 65535 bytes",
+			frags: func(a, b *testDatagram) []testFragment {
+				return []testFragment{a.part(0, 480), {dgram: a, offset: 65000, data: a.transport[:600]}}
+			},
+			stats: counters{Invalid: 1},
+		},
+		{
+			name: "two last fragments with different lengths",
+			frags: func(a, b *testDatagram) []testFragment {
+				return []testFragment{a.part(960, 1200), {dgram: a, offset: 480, data: a.transport[480:960]}}
+			},
+			stats: counters{Invalid: 1},
+		},
+		{
+			name: "too many fragments",
+			opts: DefragOptions{MaxFragments: 2, Timeout: time.Minute},
+			frags: func(a, b *testDatagram) []testFragment {
+				return []testFragment{a.part(0, 480), a.part(480, 960), a.part(960, 1200)}
+			},
+			stats: counters{Dropped: 1},
+		},
+		{
+			name: "timeout",
+			opts: DefragOptions{Timeout: time.Second},
+			frags: func(a, b *testDatagram) []testFragment {
+				return []testFragment{
+					a.part(0, 480),
+					b.part(0, 400).after(2 * time.Second),
+					a.part(480, 960).after(2 * time.Second),
+					a.part(960, 1200).after(2 * time.Second),
+				}
+			},
+			stats: counters{Timeouts: 1, Pending: 2},
+		},
+		{
+			name: "memory limit evicts the oldest datagram",
+			opts: DefragOptions{MaxMemory: 1300, Timeout: time.Minute},
+			frags: func(a, b *testDatagram) []testFragment {
+				return []testFragment{b.part(0, 400), a.part(0, 480), a.part(480, 960), a.part(960, 1200), b.part(400, 800)}
+			},
+			want:  []uint32{0xa},
+			stats: counters{Reassembled: 1, Evicted: 1, Pending: 1},
+		},
+		{
+			name: "memory limit skips the current datagram at the front of the queue",
+			opts: DefragOptions{MaxMemory: 1400, Timeout: time.Minute},
+			frags: func(a, b *testDatagram) []testFragment {
+				return []testFragment{a.part(0, 480), b.part(0, 400), a.part(480, 960), a.part(960, 1200)}
+			},
+			want:  []uint32{0xa},
+			stats: counters{Reassembled: 1, Evicted: 1},
+		},
+		{
+			name: "datagram larger than the memory limit",
+			opts: DefragOptions{MaxMemory: 1000, Timeout: time.Minute},
+			frags: func(a, b *testDatagram) []testFragment {
+				return []testFragment{a.part(0, 480), a.part(480, 960), a.part(960, 1200)}
+			},
+			stats: counters{Evicted: 1},
+		},
+		{
+			name: "IPv6 out of order",
+			v6:   true,
+			frags: func(a, b *testDatagram) []testFragment {
+				return []testFragment{a.part(480, 960), a.part(960, 1200), a.part(0, 480)}
+			},
+			want:  []uint32{0xa},
+			stats: counters{Reassembled: 1},
+		},
+		{
+			name: "IPv6 overlap with conflicting content",
+			v6:   true,
+			frags: func(a, b *testDatagram) []testFragment {
+				return []testFragment{a.part(0, 480), a.part(472, 960).corrupt(), a.part(960, 1200)}
+			},
+			events: []event{{Offset: 472, Length: 488, Conflict: true}},
+			stats:  counters{Overlaps: 1, Pending: 1},
+		},
+	}
+
+	start := time.Unix(1700000000, 0)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.opts == (DefragOptions{}) {
+				tt.opts = DefragOptions{MaxMemory: 1 << 20, MaxFragments: 64, Timeout: time.Minute}
+			}
+			a, b := newTestDatagram(t, tt.v6, 0xa, 1192), newTestDatagram(t, tt.v6, 0xb, 792)
+			d := NewDecoder()
+			d.Defrag = NewDefragmenter(tt.opts)
+
+			var done []uint32
+			var events []event
+			for i, f := range tt.frags(a, b) {
+				pkt, err := d.Decode(f.frame(t, tt.v6), start.Add(f.at), int(layers.LinkTypeEthernet))
+				if err != nil {
+					t.Fatalf("fragment %d: Decode: %v", i, err)
+				}
+				if pkt.Protocol != "UDP" {
+					t.Errorf("fragment %d: Protocol = %q", i, pkt.Protocol)
+				}
+				for _, ev := range d.DefragEvents() {
+					events = append(events, event{ev.Offset, ev.Length, ev.Conflict})
+					if ev.ID != f.dgram.id || ev.Protocol != "UDP" {
+						t.Errorf("fragment %d: event %+v", i, ev)
+					}
+				}
+				if pkt.SrcPort == 0 {
+					continue
+				}
+				// 重组完成的数据报继续解码 UDP 层
+				if pkt.SrcPort != 5000 || pkt.DstPort != 5001 || !bytes.Equal(pkt.Payload, f.dgram.payload) {
+					t.Errorf("fragment %d: reassembled %d -> %d with %d payload bytes", i, pkt.SrcPort, pkt.DstPort, len(pkt.Payload))
+				}
+				done = append(done, f.dgram.id)
+			}
+
+			if !reflect.DeepEqual(done, tt.want) {
+				t.Errorf("reassembled = %x, want %x", done, tt.want)
+			}
+			if !reflect.DeepEqual(events, tt.events) {
+				t.Errorf("events = %+v, want %+v", events, tt.events)
+			}
+			s := d.Defrag.Stats()
+			got := counters{s.Reassembled, s.Timeouts, s.Evicted, s.Dropped, s.Invalid, s.Overlaps, s.Pending}
+			if got != tt.stats {
+				t.Errorf("stats = %+v, want %+v", got, tt.stats)
+			}
+			if s.Fragments != int64(len(tt.frags(a, b))) {
+				t.Errorf("Fragments = %d, want %d", s.Fragments, len(tt.frags(a, b)))
+			}
+			if s.Pending == 0 && s.PendingBytes != 0 {
+				t.Errorf("PendingBytes = %d with no pending datagrams", s.PendingBytes)
+			}
+		})
+	}
+}
+
+func TestDefragDisabled(t *testing.T) {
+	// 未启用重组时分片只解码到 IP 层
+	a := newTestDatagram(t, false, 0xa, 1192)
+	d := NewDecoder()
+	for _, f := range []testFragment{a.part(0, 480), a.part(480, 1200)} {
+		pkt, err := d.Decode(f.frame(t, false), time.Unix(1700000000, 0), int(layers.LinkTypeEthernet))
+		if err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		if pkt.Protocol != "UDP" || pkt.SrcPort != 0 || len(pkt.Payload) != 0 || pkt.SrcIP != "10.0.0.1" {
+			t.Errorf("fragment decoded as %s %s:%d with %d payload bytes", pkt.Protocol, pkt.SrcIP, pkt.SrcPort, len(pkt.Payload))
+		}
+	}
+}
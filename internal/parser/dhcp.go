@@ -0,0 +1,288 @@
+package parser
+
+import (
+	"encoding/binary"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"sniffer/pkg/model"
+)
+
+// DHCPv4 message types (option 53), 使用 RFC 2131 中的名称
+var dhcpv4MsgTypes = map[layers.DHCPMsgType]string{
+	layers.DHCPMsgTypeDiscover: "DISCOVER",
+	layers.DHCPMsgTypeOffer:    "OFFER",
+	layers.DHCPMsgTypeRequest:  "REQUEST",
+	layers.DHCPMsgTypeDecline:  "DECLINE",
+	layers.DHCPMsgTypeAck:      "ACK",
+	layers.DHCPMsgTypeNak:      "NAK",
+	layers.DHCPMsgTypeRelease:  "RELEASE",
+	layers.DHCPMsgTypeInform:   "INFORM",
+}
+
+// DHCPv6 message types, 使用 RFC 8415 中的名称
+var dhcpv6MsgTypes = map[layers.DHCPv6MsgType]string{
+	layers.DHCPv6MsgTypeSolicit:            "SOLICIT",
+	layers.DHCPv6MsgTypeAdverstise:         "ADVERTISE",
+	layers.DHCPv6MsgTypeRequest:            "REQUEST",
+	layers.DHCPv6MsgTypeConfirm:            "CONFIRM",
+	layers.DHCPv6MsgTypeRenew:              "RENEW",
+	layers.DHCPv6MsgTypeRebind:             "REBIND",
+	layers.DHCPv6MsgTypeReply:              "REPLY",
+	layers.DHCPv6MsgTypeRelease:            "RELEASE",
+	layers.DHCPv6MsgTypeDecline:            "DECLINE",
+	layers.DHCPv6MsgTypeReconfigure:        "RECONFIGURE",
+	layers.DHCPv6MsgTypeInformationRequest: "INFORMATION-REQUEST",
+	layers.DHCPv6MsgTypeRelayForward:       "RELAY-FORW",
+	layers.DHCPv6MsgTypeRelayReply:         "RELAY-REPL",
+}
+
+// maxDHCPv6RelayDepth limits the nesting of relayed DHCPv6 messages
+const maxDHCPv6RelayDepth = 8
+
+// isDHCPPort reports whether port is a DHCPv4 (67/68) or DHCPv6 (546/547) port
+func isDHCPPort(port uint16) bool {
+	return port == 67 || port == 68 || port == 546 || port == 547
+}
+
+// IsDHCPServerReply reports whether the session is a lease offer or grant sent by a DHCP server
+// (DHCPv4 OFFER/ACK, DHCPv6 ADVERTISE/REPLY)
+func IsDHCPServerReply(session *model.Session) bool {
+	switch session.DHCPMessageType {
+	case "OFFER", "ACK", "ADVERTISE", "REPLY":
+		return true
+	}
+	return false
+}
+
+// ParseDHCP parses a DHCPv4 or DHCPv6 message
+// 提取客户端 MAC、分配的地址、主机名、厂商类别、服务器和租期
+func ParseDHCP(pkt *model.Packet) (*model.Session, error) {
+	if !(dhcpDissector{}).Claims(pkt) {
+		return nil, ErrNotDHCP
+	}
+
+	payload := pkt.Payload
+	if len(payload) == 0 {
+		return nil, ErrNotDHCP
+	}
+
+	session := &model.Session{
+		Timestamp: pkt.Timestamp,
+		FiveTuple: model.FiveTuple{
+			SrcIP:    pkt.SrcIP,
+			DstIP:    pkt.DstIP,
+			SrcPort:  pkt.SrcPort,
+			DstPort:  pkt.DstPort,
+			Protocol: "UDP",
+		},
+		Type:        "DHCP",
+		PayloadSize: len(payload),
+		TTL:         pkt.Timestamp.Add(7 * 24 * time.Hour),
+
+		// 继承进程信息
+		ProcessPID:  pkt.ProcessPID,
+		ProcessName: pkt.ProcessName,
+		ProcessExe:  pkt.ProcessExe,
+	}
+
+	ethSrc, ethDst := pkt.SrcMAC, pkt.DstMAC
+
+	var err error
+	if pkt.SrcPort == 546 || pkt.SrcPort == 547 || pkt.DstPort == 546 || pkt.DstPort == 547 {
+		err = parseDHCPv6(session, payload, 0)
+	} else {
+		err = parseDHCPv4(session, payload)
+	}
+	if err != nil {
+		return nil, ErrNotDHCP
+	}
+
+	// 服务器消息的源 MAC 为服务器地址；报文中没有客户端 MAC 时（如 DHCPv6 DUID-EN）使用以太网地址
+	if IsDHCPServerReply(session) {
+		session.DHCPServerMAC = ethSrc.String()
+		if session.DHCPServer == "" {
+			session.DHCPServer = pkt.SrcIP
+		}
+		if session.ClientMAC == "" && len(ethDst) == 6 && ethDst[0]&0x01 == 0 {
+			session.ClientMAC = ethDst.String()
+		}
+	} else if session.ClientMAC == "" && len(ethSrc) == 6 {
+		session.ClientMAC = ethSrc.String()
+	}
+	return session, nil
+}
+
+// parseDHCPv4 fills the session from a DHCPv4/BOOTP message
+func parseDHCPv4(session *model.Session, payload []byte) error {
+	var msg layers.DHCPv4
+	if err := msg.DecodeFromBytes(payload, gopacket.NilDecodeFeedback); err != nil {
+		return err
+	}
+
+	session.DHCPTransactionID = msg.Xid
+	if msg.HardwareType == layers.LinkTypeEthernet && len(msg.ClientHWAddr) == 6 {
+		session.ClientMAC = msg.ClientHWAddr.String()
+	}
+	if ip := msg.YourClientIP; ip != nil && !ip.IsUnspecified() {
+		session.AssignedIP = ip.String()
+	} else if ip := msg.ClientIP; ip != nil && !ip.IsUnspecified() {
+		session.AssignedIP = ip.String()
+	}
+
+	// 没有消息类型选项的为 BOOTP 报文
+	session.DHCPMessageType = "BOOTREQUEST"
+	if msg.Operation == layers.DHCPOpReply {
+		session.DHCPMessageType = "BOOTREPLY"
+	}
+
+	for _, opt := range msg.Options {
+		data := opt.Data
+		switch opt.Type {
+		case layers.DHCPOptMessageType:
+			if len(data) == 1 {
+				if name, ok := dhcpv4MsgTypes[layers.DHCPMsgType(data[0])]; ok {
+					session.DHCPMessageType = name
+				}
+			}
+		case layers.DHCPOptHostname:
+			session.Hostname = printableString(data)
+		case layers.DHCPOptClassID:
+			session.VendorClass = printableString(data)
+		case layers.DHCPOptServerID:
+			if len(data) == 4 {
+				session.DHCPServer = net.IP(data).String()
+			}
+		case layers.DHCPOptLeaseTime:
+			if len(data) == 4 {
+				session.LeaseTime = binary.BigEndian.Uint32(data)
+			}
+		case 81: // Client FQDN (RFC 4702): flags, rcode1, rcode2, 名称
+			if session.Hostname == "" && len(data) > 3 {
+				if data[0]&0x04 != 0 {
+					session.Hostname = readWireName(data[3:])
+				} else {
+					session.Hostname = printableString(data[3:])
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// parseDHCPv6 fills the session from a DHCPv6 message; 中继消息解析其中封装的消息
+func parseDHCPv6(session *model.Session, payload []byte, depth int) error {
+	var msg layers.DHCPv6
+	if err := msg.DecodeFromBytes(payload, gopacket.NilDecodeFeedback); err != nil {
+		return err
+	}
+
+	if msg.MsgType == layers.DHCPv6MsgTypeRelayForward || msg.MsgType == layers.DHCPv6MsgTypeRelayReply {
+		for _, opt := range msg.Options {
+			if opt.Code == layers.DHCPv6OptRelayMessage && depth < maxDHCPv6RelayDepth {
+				return parseDHCPv6(session, opt.Data, depth+1)
+			}
+		}
+		session.DHCPMessageType = dhcpv6MsgTypes[msg.MsgType]
+		return nil
+	}
+
+	session.DHCPMessageType = dhcpv6MsgTypes[msg.MsgType]
+	if session.DHCPMessageType == "" {
+		return ErrNotDHCP
+	}
+	if len(msg.TransactionID) == 3 {
+		id := msg.TransactionID
+		session.DHCPTransactionID = uint32(id[0])<<16 | uint32(id[1])<<8 | uint32(id[2])
+	}
+
+	for _, opt := range msg.Options {
+		data := opt.Data
+		switch opt.Code {
+		case layers.DHCPv6OptClientID:
+			if mac := duidMAC(data); mac != "" {
+				session.ClientMAC = mac
+			}
+		case layers.DHCPv6OptIANA:
+			// IAID(4) T1(4) T2(4) 后为子选项，IAADDR: 地址(16) preferred(4) valid(4)
+			if len(data) < 12 {
+				continue
+			}
+			for sub := data[12:]; len(sub) >= 4; {
+				code, length := binary.BigEndian.Uint16(sub), int(binary.BigEndian.Uint16(sub[2:]))
+				if len(sub) < 4+length {
+					break
+				}
+				if body := sub[4 : 4+length]; layers.DHCPv6Opt(code) == layers.DHCPv6OptIAAddr && len(body) >= 24 {
+					session.AssignedIP = net.IP(body[:16]).String()
+					session.LeaseTime = binary.BigEndian.Uint32(body[20:])
+				}
+				sub = sub[4+length:]
+			}
+		case layers.DHCPv6OptClientFQDN:
+			if len(data) > 1 {
+				session.Hostname = readWireName(data[1:])
+			}
+		case layers.DHCPv6OptVendorClass:
+			// enterprise-number(4) 后为多个 2 字节长度前缀的字符串
+			var parts []string
+			for rest := data[min(4, len(data)):]; len(rest) >= 2; {
+				n := int(binary.BigEndian.Uint16(rest))
+				if len(rest) < 2+n {
+					break
+				}
+				parts = append(parts, printableString(rest[2:2+n]))
+				rest = rest[2+n:]
+			}
+			session.VendorClass = strings.Join(parts, ",")
+		}
+	}
+	return nil
+}
+
+// duidMAC returns the link-layer address of a DUID-LLT or DUID-LL with an Ethernet hardware type
+func duidMAC(duid []byte) string {
+	if len(duid) < 4 || binary.BigEndian.Uint16(duid[2:]) != 1 {
+		return ""
+	}
+	var addr []byte
+	switch binary.BigEndian.Uint16(duid) {
+	case 1: // DUID-LLT: type, hardware type, time, 链路层地址
+		if len(duid) >= 8 {
+			addr = duid[8:]
+		}
+	case 3: // DUID-LL: type, hardware type, 链路层地址
+		addr = duid[4:]
+	}
+	if len(addr) != 6 {
+		return ""
+	}
+	return net.HardwareAddr(addr).String()
+}
+
+// readWireName decodes a domain name in DNS wire format without compression
+func readWireName(data []byte) string {
+	var labels []string
+	for len(data) > 0 {
+		n := int(data[0])
+		if n == 0 || n > 63 || len(data) < 1+n {
+			break
+		}
+		labels = append(labels, printableString(data[1:1+n]))
+		data = data[1+n:]
+	}
+	return strings.Join(labels, ".")
+}
+
+// printableString returns data as a string with control characters removed
+func printableString(data []byte) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, strings.TrimRight(string(data), "\x00"))
+}
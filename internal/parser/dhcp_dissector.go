@@ -0,0 +1,96 @@
+package parser
+
+import (
+	"fmt"
+
+	"sniffer/pkg/model"
+)
+
+func init() {
+	Register(dhcpDissector{})
+}
+
+// dhcpDissector parses DHCPv4 and DHCPv6 messages, 每个数据包一条会话
+type dhcpDissector struct{}
+
+func (dhcpDissector) Name() string { return "DHCP" }
+
+func (dhcpDissector) Table() model.TableType { return model.TableDHCP }
+
+func (dhcpDissector) Claims(pkt *model.Packet) bool {
+	// 67/68、546/547 端口之外依据载荷识别结果（magic cookie）
+	return pkt.Protocol == "UDP" && (isDHCPPort(pkt.SrcPort) || isDHCPPort(pkt.DstPort) || pkt.AppProtocol == "DHCP")
+}
+
+func (dhcpDissector) Dissect(pkt *model.Packet, ctx *DissectContext) ([]*model.Session, error) {
+	session, err := ParseDHCP(pkt)
+	if err != nil {
+		return nil, err
+	}
+	return []*model.Session{session}, nil
+}
+
+func (dhcpDissector) StreamProtocol() *StreamProtocol { return nil }
+
+func (dhcpDissector) AlertField(session *model.Session, field string) (string, bool) {
+	switch field {
+	case "hostname":
+		return session.Hostname, true
+	case "client_mac":
+		return session.ClientMAC, true
+	case "assigned_ip":
+		return session.AssignedIP, true
+	case "vendor_class":
+		return session.VendorClass, true
+	case "dhcp_server":
+		return session.DHCPServer, true
+	case "message_type":
+		return session.DHCPMessageType, true
+	case "lease_time":
+		return fmt.Sprintf("%d", session.LeaseTime), true
+	}
+	return "", false
+}
+
+// dhcpSchema is the storage of DHCP messages; 由消息学习到的主机保存在 hosts 表
+var dhcpSchema = &Schema{
+	Table: "dhcp_sessions",
+	Columns: concatColumns(
+		[]Column{timestampColumn},
+		tupleColumns(true),
+		[]Column{
+			column("message_type", "TEXT", func(s *model.Session) *string { return &s.DHCPMessageType }),
+			column("transaction_id", "INTEGER", func(s *model.Session) *uint32 { return &s.DHCPTransactionID }),
+			column("client_mac", "TEXT", func(s *model.Session) *string { return &s.ClientMAC }),
+			column("assigned_ip", "TEXT", func(s *model.Session) *string { return &s.AssignedIP }),
+			column("hostname", "TEXT", func(s *model.Session) *string { return &s.Hostname }),
+			column("vendor_class", "TEXT", func(s *model.Session) *string { return &s.VendorClass }),
+			column("dhcp_server", "TEXT", func(s *model.Session) *string { return &s.DHCPServer }),
+			column("dhcp_server_mac", "TEXT", func(s *model.Session) *string { return &s.DHCPServerMAC }),
+			column("lease_time", "INTEGER", func(s *model.Session) *uint32 { return &s.LeaseTime }),
+			payloadColumn,
+			ttlColumn,
+		},
+		processColumns(),
+	),
+	Indexes:       []string{"timestamp", "ttl", "client_mac", "hostname"},
+	DomainColumn:  "hostname",
+	SearchColumns: []string{"src_ip", "dst_ip", "client_mac", "assigned_ip", "hostname", "vendor_class", "dhcp_server"},
+	Extra: `
+	-- 由 DHCP 消息学习到的主机清单，以客户端 MAC 为主键
+	CREATE TABLE IF NOT EXISTS hosts (
+		mac TEXT PRIMARY KEY,
+		ip TEXT,
+		hostname TEXT,
+		vendor_class TEXT,
+		dhcp_server TEXT,
+		lease_time INTEGER,
+		first_seen DATETIME NOT NULL,
+		last_seen DATETIME NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_hosts_ip ON hosts(ip);
+	CREATE INDEX IF NOT EXISTS idx_hosts_last_seen ON hosts(last_seen);
+	`,
+}
+
+func (dhcpDissector) Schema() *Schema { return dhcpSchema }
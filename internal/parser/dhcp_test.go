@@ -0,0 +1,249 @@
+package parser
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"sniffer/pkg/model"
+)
+
+var testServerMAC = net.HardwareAddr{0x00, 0x50, 0x56, 0xc0, 0x00, 0x08}
+
+// dhcpv4 builds a DHCPv4 message from the client testSrcMAC with the given options
+func dhcpv4(op layers.DHCPOp, msgType layers.DHCPMsgType, opts ...layers.DHCPOption) *layers.DHCPv4 {
+	msg := &layers.DHCPv4{
+		Operation:    op,
+		HardwareType: layers.LinkTypeEthernet,
+		HardwareLen:  6,
+		Xid:          0x3903f326,
+		ClientHWAddr: testSrcMAC,
+	}
+	if msgType != 0 {
+		msg.Options = append(msg.Options, layers.NewDHCPOption(layers.DHCPOptMessageType, []byte{byte(msgType)}))
+	}
+	msg.Options = append(msg.Options, opts...)
+	return msg
+}
+
+// dhcpv6 builds a DHCPv6 message with transaction ID 0x0a0b0c
+func dhcpv6(msgType layers.DHCPv6MsgType, opts ...layers.DHCPv6Option) *layers.DHCPv6 {
+	return &layers.DHCPv6{MsgType: msgType, TransactionID: []byte{0x0a, 0x0b, 0x0c}, Options: opts}
+}
+
+// duidLL returns a DUID-LL (RFC 8415 11.4) with an Ethernet address
+func duidLL(mac net.HardwareAddr) []byte {
+	return append([]byte{0x00, 0x03, 0x00, 0x01}, mac...)
+}
+
+// dhcpPacket wraps a serialized DHCP message; 服务器消息从服务器 MAC 发往客户端
+func dhcpPacket(src, dst string, sport, dport uint16, fromServer bool, msg []byte) *model.Packet {
+	pkt := &model.Packet{
+		Timestamp: time.Unix(1700000000, 0),
+		Protocol:  "UDP",
+		SrcIP:     src, DstIP: dst,
+		SrcPort: sport, DstPort: dport,
+		SrcMAC: testSrcMAC, DstMAC: net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		Payload: msg,
+	}
+	if fromServer {
+		pkt.SrcMAC, pkt.DstMAC = testServerMAC, testSrcMAC
+	}
+	return pkt
+}
+
+func TestParseDHCP(t *testing.T) {
+	type fields struct {
+		MessageType, ClientMAC, AssignedIP, Hostname, VendorClass, Server, ServerMAC string
+		XID, LeaseTime                                                               uint32
+	}
+	iaNA := append(make([]byte, 12), // IAID, T1, T2
+		0x00, 0x05, 0x00, 0x18, // IAADDR
+		0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x01, 0x00, // 2001:db8::100
+		0x00, 0x00, 0x0e, 0x10, // preferred 3600
+		0x00, 0x00, 0x1c, 0x20, // valid 7200
+	)
+	solicit := func(t *testing.T) []byte {
+		return serialize(t, dhcpv6(layers.DHCPv6MsgTypeSolicit,
+			layers.NewDHCPv6Option(layers.DHCPv6OptClientID, duidLL(testSrcMAC)),
+			layers.NewDHCPv6Option(layers.DHCPv6OptVendorClass, []byte{0, 0, 0x01, 0x37, 0, 8, 'M', 'S', 'F', 'T', ' ', '5', '.', '0'}),
+			layers.NewDHCPv6Option(layers.DHCPv6OptClientFQDN, []byte{0x01, 6, 'l', 'a', 'p', 't', 'o', 'p', 4, 'c', 'o', 'r', 'p', 0}),
+		))
+	}
+
+	tests := []struct {
+		name string
+		pkt  func(t *testing.T) *model.Packet
+		want fields
+	}{
+		{
+			name: "DISCOVER with hostname and vendor class",
+			pkt: func(t *testing.T) *model.Packet {
+				return dhcpPacket("0.0.0.0", "255.255.255.255", 68, 67, false, serialize(t, dhcpv4(layers.DHCPOpRequest, layers.DHCPMsgTypeDiscover,
+					layers.NewDHCPOption(layers.DHCPOptHostname, []byte("laptop")),
+					layers.NewDHCPOption(layers.DHCPOptClassID, []byte("MSFT 5.0")),
+				)))
+			},
+			want: fields{MessageType: "DISCOVER", ClientMAC: "00:11:22:33:44:55", Hostname: "laptop", VendorClass: "MSFT 5.0", XID: 0x3903f326},
+		},
+		{
+			name: "ACK with server identifier and lease",
+			pkt: func(t *testing.T) *model.Packet {
+				msg := dhcpv4(layers.DHCPOpReply, layers.DHCPMsgTypeAck,
+					layers.NewDHCPOption(layers.DHCPOptServerID, []byte{192, 168, 1, 1}),
+					layers.NewDHCPOption(layers.DHCPOptLeaseTime, []byte{0x00, 0x01, 0x51, 0x80}),
+				)
+				msg.YourClientIP = net.IP{192, 168, 1, 100}
+				return dhcpPacket("192.168.1.1", "192.168.1.100", 67, 68, true, serialize(t, msg))
+			},
+			want: fields{
+				MessageType: "ACK", ClientMAC: "00:11:22:33:44:55", AssignedIP: "192.168.1.100",
+				Server: "192.168.1.1", ServerMAC: "00:50:56:c0:00:08", XID: 0x3903f326, LeaseTime: 86400,
+			},
+		},
+		{
+			name: "OFFER without server identifier",
+			pkt: func(t *testing.T) *model.Packet {
+				msg := dhcpv4(layers.DHCPOpReply, layers.DHCPMsgTypeOffer)
+				msg.YourClientIP = net.IP{10, 0, 0, 23}
+				return dhcpPacket("10.0.0.254", "255.255.255.255", 67, 68, true, serialize(t, msg))
+			},
+			want: fields{
+				MessageType: "OFFER", ClientMAC: "00:11:22:33:44:55", AssignedIP: "10.0.0.23",
+				Server: "10.0.0.254", ServerMAC: "00:50:56:c0:00:08", XID: 0x3903f326,
+			},
+		},
+		{
+			name: "renewing REQUEST with client FQDN in wire format",
+			pkt: func(t *testing.T) *model.Packet {
+				msg := dhcpv4(layers.DHCPOpRequest, layers.DHCPMsgTypeRequest,
+					layers.NewDHCPOption(81, []byte{0x05, 0, 0, 6, 'l', 'a', 'p', 't', 'o', 'p', 4, 'c', 'o', 'r', 'p', 0}),
+				)
+				msg.ClientIP = net.IP{192, 168, 1, 100}
+				return dhcpPacket("192.168.1.100", "192.168.1.1", 68, 67, false, serialize(t, msg))
+			},
+			want: fields{MessageType: "REQUEST", ClientMAC: "00:11:22:33:44:55", AssignedIP: "192.168.1.100", Hostname: "laptop.corp", XID: 0x3903f326},
+		},
+		{
+			name: "client FQDN in ASCII does not replace the hostname option",
+			pkt: func(t *testing.T) *model.Packet {
+				return dhcpPacket("0.0.0.0", "255.255.255.255", 68, 67, false, serialize(t, dhcpv4(layers.DHCPOpRequest, layers.DHCPMsgTypeRequest,
+					layers.NewDHCPOption(layers.DHCPOptHostname, []byte("laptop")),
+					layers.NewDHCPOption(81, []byte{0x01, 0, 0, 'l', 'a', 'p', 't', 'o', 'p', '.', 'c', 'o', 'r', 'p'}),
+				)))
+			},
+			want: fields{MessageType: "REQUEST", ClientMAC: "00:11:22:33:44:55", Hostname: "laptop", XID: 0x3903f326},
+		},
+		{
+			name: "BOOTP reply strips control characters",
+			pkt: func(t *testing.T) *model.Packet {
+				msg := dhcpv4(layers.DHCPOpReply, 0, layers.NewDHCPOption(layers.DHCPOptHostname, []byte("pxe\x01host\x00\x00")))
+				msg.YourClientIP = net.IP{10, 0, 0, 5}
+				return dhcpPacket("10.0.0.1", "10.0.0.5", 67, 68, true, serialize(t, msg))
+			},
+			want: fields{MessageType: "BOOTREPLY", ClientMAC: "00:11:22:33:44:55", AssignedIP: "10.0.0.5", Hostname: "pxehost", XID: 0x3903f326},
+		},
+		{
+			name: "DHCPv6 SOLICIT",
+			pkt: func(t *testing.T) *model.Packet {
+				return dhcpPacket("fe80::211:22ff:fe33:4455", "ff02::1:2", 546, 547, false, solicit(t))
+			},
+			want: fields{MessageType: "SOLICIT", ClientMAC: "00:11:22:33:44:55", Hostname: "laptop.corp", VendorClass: "MSFT 5.0", XID: 0x0a0b0c},
+		},
+		{
+			name: "DHCPv6 REPLY with IA_NA and DUID-LLT",
+			pkt: func(t *testing.T) *model.Packet {
+				duid := append([]byte{0x00, 0x01, 0x00, 0x01, 0x2c, 0x8f, 0x3a, 0x10}, testSrcMAC...)
+				return dhcpPacket("fe80::250:56ff:fec0:8", "fe80::211:22ff:fe33:4455", 547, 546, true, serialize(t, dhcpv6(layers.DHCPv6MsgTypeReply,
+					layers.NewDHCPv6Option(layers.DHCPv6OptClientID, duid),
+					layers.NewDHCPv6Option(layers.DHCPv6OptIANA, iaNA),
+				)))
+			},
+			want: fields{
+				MessageType: "REPLY", ClientMAC: "00:11:22:33:44:55", AssignedIP: "2001:db8::100",
+				Server: "fe80::250:56ff:fec0:8", ServerMAC: "00:50:56:c0:00:08", XID: 0x0a0b0c, LeaseTime: 7200,
+			},
+		},
+		{
+			name: "DHCPv6 ADVERTISE to a DUID-EN client uses the Ethernet destination",
+			pkt: func(t *testing.T) *model.Packet {
+				return dhcpPacket("fe80::250:56ff:fec0:8", "fe80::211:22ff:fe33:4455", 547, 546, true, serialize(t, dhcpv6(layers.DHCPv6MsgTypeAdverstise,
+					layers.NewDHCPv6Option(layers.DHCPv6OptClientID, []byte{0x00, 0x02, 0x00, 0x00, 0x01, 0x37, 0xde, 0xad}),
+				)))
+			},
+			want: fields{
+				MessageType: "ADVERTISE", ClientMAC: "00:11:22:33:44:55",
+				Server: "fe80::250:56ff:fec0:8", ServerMAC: "00:50:56:c0:00:08", XID: 0x0a0b0c,
+			},
+		},
+		{
+			name: "DHCPv6 relayed SOLICIT",
+			pkt: func(t *testing.T) *model.Packet {
+				relay := &layers.DHCPv6{
+					MsgType:  layers.DHCPv6MsgTypeRelayForward,
+					LinkAddr: net.ParseIP("2001:db8:1::1"),
+					PeerAddr: net.ParseIP("fe80::211:22ff:fe33:4455"),
+					Options:  layers.DHCPv6Options{layers.NewDHCPv6Option(layers.DHCPv6OptRelayMessage, solicit(t))},
+				}
+				pkt := dhcpPacket("2001:db8:1::1", "2001:db8::547", 547, 547, false, serialize(t, relay))
+				pkt.SrcMAC = testServerMAC
+				return pkt
+			},
+			want: fields{MessageType: "SOLICIT", ClientMAC: "00:11:22:33:44:55", Hostname: "laptop.corp", VendorClass: "MSFT 5.0", XID: 0x0a0b0c},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := ParseDHCP(tt.pkt(t))
+			if err != nil {
+				t.Fatalf("ParseDHCP: %v", err)
+			}
+			got := fields{
+				MessageType: s.DHCPMessageType, ClientMAC: s.ClientMAC, AssignedIP: s.AssignedIP,
+				Hostname: s.Hostname, VendorClass: s.VendorClass, Server: s.DHCPServer, ServerMAC: s.DHCPServerMAC,
+				XID: s.DHCPTransactionID, LeaseTime: s.LeaseTime,
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got  %+v\nwant %+v", got, tt.want)
+			}
+			if s.Type != "DHCP" {
+				t.Errorf("Type = %q", s.Type)
+			}
+		})
+	}
+}
+
+func TestParseDHCPInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		pkt  *model.Packet
+	}{
+		{"not a DHCP port", &model.Packet{Protocol: "UDP", SrcPort: 40000, DstPort: 53, Payload: []byte{1}}},
+		{"TCP", &model.Packet{Protocol: "TCP", SrcPort: 68, DstPort: 67, Payload: []byte{1}}},
+		{"empty payload", &model.Packet{Protocol: "UDP", SrcPort: 68, DstPort: 67}},
+		{"truncated DHCPv4", &model.Packet{Protocol: "UDP", SrcPort: 68, DstPort: 67, Payload: make([]byte, 100)}},
+		{"unknown DHCPv6 message type", &model.Packet{Protocol: "UDP", SrcPort: 546, DstPort: 547, Payload: []byte{0, 1, 2, 3}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseDHCP(tt.pkt); !errors.Is(err, ErrNotDHCP) {
+				t.Errorf("err = %v, want %v", err, ErrNotDHCP)
+			}
+		})
+	}
+}
+
+func TestIsDHCPServerReply(t *testing.T) {
+	for typ, want := range map[string]bool{
+		"OFFER": true, "ACK": true, "ADVERTISE": true, "REPLY": true,
+		"DISCOVER": false, "REQUEST": false, "NAK": false, "SOLICIT": false, "BOOTREPLY": false,
+	} {
+		if got := IsDHCPServerReply(&model.Session{DHCPMessageType: typ}); got != want {
+			t.Errorf("IsDHCPServerReply(%s) = %v, want %v", typ, got, want)
+		}
+	}
+}
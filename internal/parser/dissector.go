@@ -0,0 +1,199 @@
+package parser
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"sniffer/pkg/model"
+)
+
+// Dissector parses one application protocol and describes how its sessions are stored,
+// searched and matched by alert rules; 新协议实现该接口并在 init 中调用 Register 注册
+type Dissector interface {
+	// Name returns the protocol name, 与其会话的 Session.Type 相同
+	Name() string
+
+	// Table returns the session table type, 同时作为告警规则类型
+	Table() model.TableType
+
+	// Schema describes the storage table of the protocol's sessions
+	Schema() *Schema
+
+	// Claims reports whether the packet belongs to the protocol (按传输层、端口或载荷识别结果快速判断)
+	Claims(pkt *model.Packet) bool
+
+	// Dissect parses a claimed packet and returns the sessions it completed
+	// 从重组的字节流解析的协议在开启 TCP 重组时由 StreamProtocol 的解析器产生会话
+	Dissect(pkt *model.Packet, ctx *DissectContext) ([]*model.Session, error)
+
+	// StreamProtocol describes how the protocol is parsed from reassembled TCP streams,
+	// nil if the protocol is not carried in TCP streams
+	StreamProtocol() *StreamProtocol
+
+	// AlertField returns the value of an alert rule condition field of the session,
+	// false if the field is not supported
+	AlertField(session *model.Session, field string) (string, bool)
+}
+
+// sessionTypes is implemented by dissectors whose table also stores sessions of other types
+// 如 TLS 表同时保存 QUIC 连接（Session.Type 为 QUIC）
+type sessionTypes interface {
+	SessionTypes() []string
+}
+
+// DissectContext is the per-capture state shared by the dissectors
+type DissectContext struct {
+	DNSTracker  *DNSTracker  // DNS 查询与响应配对，nil 表示关闭
+	ICMPTracker *ICMPTracker // ICMP 回显配对与路由跳发现，nil 表示关闭
+	QUICTracker *QUICTracker // QUIC Initial 包解密，nil 表示不解析 QUIC
+	Reassembler *Reassembler // TCP 流重组，非 nil 时流协议由重组后的字节流解析
+}
+
+// Schema describes the table storing the sessions of a dissector
+type Schema struct {
+	Table   string   // 表名
+	Columns []Column // 除自增主键 id 外的全部列，按建表顺序
+	Indexes []string // 建立索引的列
+
+	DomainColumn  string   // 按域名搜索时匹配的列，空表示不支持
+	SearchColumns []string // 全文搜索时匹配的列
+
+	Extra string // 附属表等其它建表语句
+}
+
+// Column is a column of a session table mapped to a session field
+type Column struct {
+	Name string
+	Type string // SQL 类型及约束
+
+	// Value returns the value written for the session
+	Value func(session *model.Session) any
+	// Dest returns the scan destination filling the session field, NULL 读为零值
+	Dest func(session *model.Session) any
+}
+
+// column maps a column to the session field returned by field
+func column[T any](name, typ string, field func(s *model.Session) *T) Column {
+	return Column{
+		Name:  name,
+		Type:  typ,
+		Value: func(s *model.Session) any { return *field(s) },
+		Dest:  func(s *model.Session) any { return nullable[T]{field(s)} },
+	}
+}
+
+// nullable scans a possibly NULL column into a session field
+type nullable[T any] struct {
+	field *T
+}
+
+func (n nullable[T]) Scan(src any) error {
+	var v sql.Null[T]
+	if err := v.Scan(src); err != nil {
+		return err
+	}
+	*n.field = v.V
+	return nil
+}
+
+// Columns shared by the session tables
+var (
+	timestampColumn = column("timestamp", "DATETIME NOT NULL", func(s *model.Session) *time.Time { return &s.Timestamp })
+	ttlColumn       = column("ttl", "DATETIME NOT NULL", func(s *model.Session) *time.Time { return &s.TTL })
+	payloadColumn   = column("payload_size", "INTEGER", func(s *model.Session) *int { return &s.PayloadSize })
+)
+
+// tupleColumns returns the 5-tuple columns; ports 为 false 时没有端口列（如 ICMP）
+func tupleColumns(ports bool) []Column {
+	cols := []Column{
+		column("src_ip", "TEXT NOT NULL", func(s *model.Session) *string { return &s.FiveTuple.SrcIP }),
+		column("dst_ip", "TEXT NOT NULL", func(s *model.Session) *string { return &s.FiveTuple.DstIP }),
+	}
+	if ports {
+		cols = append(cols,
+			column("src_port", "INTEGER", func(s *model.Session) *uint16 { return &s.FiveTuple.SrcPort }),
+			column("dst_port", "INTEGER", func(s *model.Session) *uint16 { return &s.FiveTuple.DstPort }),
+		)
+	}
+	return append(cols, column("protocol", "TEXT", func(s *model.Session) *string { return &s.FiveTuple.Protocol }))
+}
+
+// processColumns returns the process association columns
+func processColumns() []Column {
+	return []Column{
+		column("process_pid", "INTEGER", func(s *model.Session) *int32 { return &s.ProcessPID }),
+		column("process_name", "TEXT", func(s *model.Session) *string { return &s.ProcessName }),
+		column("process_exe", "TEXT", func(s *model.Session) *string { return &s.ProcessExe }),
+	}
+}
+
+// concatColumns joins column groups in order
+func concatColumns(groups ...[]Column) []Column {
+	var cols []Column
+	for _, g := range groups {
+		cols = append(cols, g...)
+	}
+	return cols
+}
+
+// registry holds the registered dissectors
+var registry struct {
+	mu         sync.RWMutex
+	dissectors []Dissector
+	byTable    map[model.TableType]Dissector
+	byName     map[string]Dissector
+}
+
+// Register adds a dissector to the registry; 表或协议名（含 SessionTypes）重复时 panic
+func Register(d Dissector) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	if registry.byTable == nil {
+		registry.byTable = make(map[model.TableType]Dissector)
+		registry.byName = make(map[string]Dissector)
+	}
+	if _, dup := registry.byTable[d.Table()]; dup {
+		panic(fmt.Sprintf("parser: dissector for table %s registered twice", d.Table()))
+	}
+	names := []string{d.Name()}
+	if st, ok := d.(sessionTypes); ok {
+		names = append(names, st.SessionTypes()...)
+	}
+	for _, name := range names {
+		if _, dup := registry.byName[name]; dup {
+			panic(fmt.Sprintf("parser: dissector %s registered twice", name))
+		}
+	}
+	registry.dissectors = append(registry.dissectors, d)
+	registry.byTable[d.Table()] = d
+	for _, name := range names {
+		registry.byName[name] = d
+	}
+}
+
+// Dissectors returns the registered dissectors in registration order
+// 每个数据包都会调用，返回的切片不复制，调用方不得修改
+func Dissectors() []Dissector {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	return registry.dissectors
+}
+
+// DissectorForTable returns the dissector storing sessions in the given table
+func DissectorForTable(table model.TableType) (Dissector, bool) {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	d, ok := registry.byTable[table]
+	return d, ok
+}
+
+// DissectorForSession returns the dissector that produced the session (按 Session.Type 及 SessionTypes 查找)
+func DissectorForSession(session *model.Session) (Dissector, bool) {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	d, ok := registry.byName[session.Type]
+	return d, ok
+}
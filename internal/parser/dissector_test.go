@@ -0,0 +1,85 @@
+package parser
+
+import (
+	"testing"
+
+	"sniffer/pkg/model"
+)
+
+func TestDissectorSchemas(t *testing.T) {
+	tables := make(map[string]string)
+	for _, d := range Dissectors() {
+		t.Run(d.Name(), func(t *testing.T) {
+			if got, ok := DissectorForTable(d.Table()); !ok || got.Name() != d.Name() {
+				t.Errorf("DissectorForTable(%s) = %v, %v", d.Table(), got, ok)
+			}
+			if got, ok := DissectorForSession(&model.Session{Type: d.Name()}); !ok || got.Name() != d.Name() {
+				t.Errorf("DissectorForSession(%s) = %v, %v", d.Name(), got, ok)
+			}
+
+			schema := d.Schema()
+			if other, dup := tables[schema.Table]; dup {
+				t.Errorf("table %s also used by %s", schema.Table, other)
+			}
+			tables[schema.Table] = d.Name()
+
+			// 索引和搜索列必须是表中的列
+			columns := make(map[string]bool)
+			for _, c := range schema.Columns {
+				if columns[c.Name] {
+					t.Errorf("column %s defined twice", c.Name)
+				}
+				columns[c.Name] = true
+				if c.Type == "" || c.Value == nil || c.Dest == nil {
+					t.Errorf("column %s is incomplete", c.Name)
+				}
+			}
+			refs := append(append([]string(nil), schema.Indexes...), schema.SearchColumns...)
+			if schema.DomainColumn != "" {
+				refs = append(refs, schema.DomainColumn)
+			}
+			for _, name := range refs {
+				if !columns[name] {
+					t.Errorf("schema refers to unknown column %s", name)
+				}
+			}
+			for _, name := range []string{"timestamp", "ttl", "src_ip", "dst_ip"} {
+				if !columns[name] {
+					t.Errorf("missing column %s", name)
+				}
+			}
+
+			if p := d.StreamProtocol(); p != nil && (p.IsServerPort == nil || p.NewParsers == nil) {
+				t.Error("incomplete stream protocol")
+			}
+
+			if _, ok := d.AlertField(&model.Session{}, "no_such_field"); ok {
+				t.Error("AlertField accepted an unknown field")
+			}
+		})
+	}
+}
+
+// duplicateDissector reuses the table of a registered dissector
+type duplicateDissector struct {
+	Dissector
+}
+
+func (duplicateDissector) Name() string { return "duplicate" }
+
+func TestRegisterDuplicate(t *testing.T) {
+	before := len(Dissectors())
+	d, ok := DissectorForTable(model.TableICMP)
+	if !ok {
+		t.Fatal("ICMP dissector not registered")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("Register did not panic")
+		}
+		if n := len(Dissectors()); n != before {
+			t.Errorf("%d dissectors after the failed registration, want %d", n, before)
+		}
+	}()
+	Register(duplicateDissector{d})
+}
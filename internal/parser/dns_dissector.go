@@ -0,0 +1,90 @@
+package parser
+
+import (
+	"sniffer/pkg/model"
+)
+
+func init() {
+	Register(dnsDissector{})
+}
+
+// dnsDissector parses DNS over UDP; 开启配对时查询与响应合并为一条事务
+type dnsDissector struct{}
+
+func (dnsDissector) Name() string { return "DNS" }
+
+func (dnsDissector) Table() model.TableType { return model.TableDNS }
+
+func (dnsDissector) Claims(pkt *model.Packet) bool {
+	// 53 端口之外依据载荷识别结果
+	return pkt.Protocol == "UDP" && (pkt.SrcPort == 53 || pkt.DstPort == 53 || pkt.AppProtocol == "DNS")
+}
+
+func (d dnsDissector) Dissect(pkt *model.Packet, ctx *DissectContext) ([]*model.Session, error) {
+	session, err := ParseDNS(pkt)
+	if err != nil {
+		return nil, err
+	}
+	if ctx != nil && ctx.DNSTracker != nil {
+		// 查询等待响应，配对后作为一条事务输出
+		return ctx.DNSTracker.Track(session), nil
+	}
+	return []*model.Session{session}, nil
+}
+
+func (dnsDissector) StreamProtocol() *StreamProtocol { return nil }
+
+func (dnsDissector) AlertField(session *model.Session, field string) (string, bool) {
+	switch field {
+	case "domain":
+		return session.Domain, true
+	}
+	return "", false
+}
+
+// dnsSchema is the storage of DNS sessions; 资源记录存放在 dns_records 子表
+var dnsSchema = &Schema{
+	Table: "dns_sessions",
+	Columns: concatColumns(
+		[]Column{timestampColumn},
+		tupleColumns(true),
+		[]Column{
+			column("domain", "TEXT", func(s *model.Session) *string { return &s.Domain }),
+			column("query_type", "TEXT", func(s *model.Session) *string { return &s.QueryType }),
+			column("response_ip", "TEXT", func(s *model.Session) *string { return &s.ResponseIP }),
+			payloadColumn,
+			ttlColumn,
+		},
+		processColumns(),
+		[]Column{
+			column("dns_id", "INTEGER", func(s *model.Session) *uint16 { return &s.DNSID }),
+			column("rcode", "TEXT", func(s *model.Session) *string { return &s.RCode }),
+			column("dns_flags", "TEXT", func(s *model.Session) *string { return &s.DNSFlags }),
+			column("cname_chain", "TEXT", func(s *model.Session) *string { return &s.CNAMEChain }),
+			column("latency_ms", "REAL", func(s *model.Session) *float64 { return &s.LatencyMs }),
+			column("unanswered", "INTEGER DEFAULT 0", func(s *model.Session) *bool { return &s.Unanswered }),
+			column("paired", "INTEGER DEFAULT 0", func(s *model.Session) *bool { return &s.Paired }),
+		},
+	),
+	Indexes:       []string{"timestamp", "ttl", "domain"},
+	DomainColumn:  "domain",
+	SearchColumns: []string{"src_ip", "dst_ip", "domain", "response_ip"},
+	Extra: `
+	-- DNS 报文中的全部资源记录（问题、回答、授权、附加），可按名称和数据检索
+	CREATE TABLE IF NOT EXISTS dns_records (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		session_id INTEGER NOT NULL,
+		section TEXT NOT NULL,
+		name TEXT,
+		type TEXT,
+		ttl INTEGER,
+		data TEXT
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_dns_records_session ON dns_records(session_id);
+	CREATE INDEX IF NOT EXISTS idx_dns_records_name ON dns_records(name);
+	CREATE INDEX IF NOT EXISTS idx_dns_records_data ON dns_records(data);
+	`,
+}
+
+func (dnsDissector) Schema() *Schema { return dnsSchema }
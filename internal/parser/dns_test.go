@@ -0,0 +1,212 @@
+package parser
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"sniffer/pkg/model"
+)
+
+// dnsPacket packs msg into a UDP packet from the client to the resolver (or back for responses)
+func dnsPacket(t *testing.T, msg *dns.Msg) *model.Packet {
+	t.Helper()
+	payload, err := msg.Pack()
+	if err != nil {
+		t.Fatalf("pack DNS message: %v", err)
+	}
+	pkt := &model.Packet{
+		Timestamp: time.Unix(1700000000, 0),
+		Protocol:  "UDP",
+		SrcIP:     "192.168.1.10", DstIP: "192.168.1.1",
+		SrcPort: 53124, DstPort: 53,
+		Payload: payload,
+	}
+	if msg.Response {
+		pkt.SrcIP, pkt.DstIP = pkt.DstIP, pkt.SrcIP
+		pkt.SrcPort, pkt.DstPort = pkt.DstPort, pkt.SrcPort
+	}
+	return pkt
+}
+
+func rrs(t *testing.T, records ...string) []dns.RR {
+	t.Helper()
+	var out []dns.RR
+	for _, s := range records {
+		rr, err := dns.NewRR(s)
+		if err != nil {
+			t.Fatalf("parse RR %q: %v", s, err)
+		}
+		out = append(out, rr)
+	}
+	return out
+}
+
+func TestParseDNS(t *testing.T) {
+	tests := []struct {
+		name  string
+		msg   func(t *testing.T) *dns.Msg
+		want  model.Session // 只比较 DNS 相关字段
+		wantR []model.DNSRecord
+	}{
+		{
+			name: "query",
+			msg: func(t *testing.T) *dns.Msg {
+				m := new(dns.Msg)
+				m.SetQuestion("www.example.com.", dns.TypeA)
+				m.Id = 0xbeef
+				return m
+			},
+			want: model.Session{Domain: "www.example.com", QueryType: "A", DNSID: 0xbeef, DNSFlags: "rd"},
+		},
+		{
+			name: "answers with CNAME chain, authority and additional records",
+			msg: func(t *testing.T) *dns.Msg {
+				m := new(dns.Msg)
+				m.SetQuestion("www.example.com.", dns.TypeA)
+				m.Id = 1
+				m.Response, m.RecursionAvailable = true, true
+				m.Answer = rrs(t,
+					"www.example.com. 300 IN CNAME example.cdn.net.",
+					"example.cdn.net. 60 IN CNAME edge.cdn.net.",
+					"edge.cdn.net. 20 IN A 93.184.216.34",
+					"edge.cdn.net. 20 IN A 93.184.216.35",
+				)
+				m.Ns = rrs(t, "cdn.net. 3600 IN NS ns1.cdn.net.")
+				m.Extra = rrs(t, "ns1.cdn.net. 3600 IN AAAA 2001:db8::53")
+				m.SetEdns0(1232, false) // OPT 伪记录不保存
+				return m
+			},
+			want: model.Session{
+				Domain: "www.example.com", QueryType: "A", ResponseIP: "93.184.216.34",
+				DNSID: 1, RCode: "NOERROR", DNSFlags: "qr rd ra",
+				CNAMEChain: "www.example.com -> example.cdn.net -> edge.cdn.net",
+			},
+			wantR: []model.DNSRecord{
+				{Section: model.DNSSectionAnswer, Name: "www.example.com", Type: "CNAME", TTL: 300, Data: "example.cdn.net."},
+				{Section: model.DNSSectionAnswer, Name: "example.cdn.net", Type: "CNAME", TTL: 60, Data: "edge.cdn.net."},
+				{Section: model.DNSSectionAnswer, Name: "edge.cdn.net", Type: "A", TTL: 20, Data: "93.184.216.34"},
+				{Section: model.DNSSectionAnswer, Name: "edge.cdn.net", Type: "A", TTL: 20, Data: "93.184.216.35"},
+				{Section: model.DNSSectionAuthority, Name: "cdn.net", Type: "NS", TTL: 3600, Data: "ns1.cdn.net."},
+				{Section: model.DNSSectionAdditional, Name: "ns1.cdn.net", Type: "AAAA", TTL: 3600, Data: "2001:db8::53"},
+			},
+		},
+		{
+			name: "NXDOMAIN with SOA",
+			msg: func(t *testing.T) *dns.Msg {
+				m := new(dns.Msg)
+				m.SetQuestion("missing.example.com.", dns.TypeAAAA)
+				m.Id = 2
+				m.Response, m.Authoritative = true, true
+				m.Rcode = dns.RcodeNameError
+				m.Ns = rrs(t, "example.com. 900 IN SOA ns.example.com. admin.example.com. 2024010101 7200 3600 1209600 900")
+				return m
+			},
+			want: model.Session{
+				Domain: "missing.example.com", QueryType: "AAAA", DNSID: 2, RCode: "NXDOMAIN", DNSFlags: "qr aa rd",
+			},
+			wantR: []model.DNSRecord{
+				{Section: model.DNSSectionAuthority, Name: "example.com", Type: "SOA", TTL: 900,
+					Data: "ns.example.com. admin.example.com. 2024010101 7200 3600 1209600 900"},
+			},
+		},
+		{
+			name: "MX, TXT and unknown types",
+			msg: func(t *testing.T) *dns.Msg {
+				m := new(dns.Msg)
+				m.SetQuestion("example.com.", dns.TypeMX)
+				m.Id = 3
+				m.Response = true
+				m.Answer = rrs(t,
+					"example.com. 300 IN MX 10 mail.example.com.",
+					`example.com. 300 IN TXT "v=spf1 -all"`,
+					`example.com. 300 IN TYPE65534 \# 2 abcd`,
+				)
+				return m
+			},
+			want: model.Session{Domain: "example.com", QueryType: "MX", DNSID: 3, RCode: "NOERROR", DNSFlags: "qr rd"},
+			wantR: []model.DNSRecord{
+				{Section: model.DNSSectionAnswer, Name: "example.com", Type: "MX", TTL: 300, Data: "10 mail.example.com."},
+				{Section: model.DNSSectionAnswer, Name: "example.com", Type: "TXT", TTL: 300, Data: `"v=spf1 -all"`},
+				{Section: model.DNSSectionAnswer, Name: "example.com", Type: "TYPE65534", TTL: 300, Data: `\# 2 abcd`},
+			},
+		},
+		{
+			name: "CNAME loop",
+			msg: func(t *testing.T) *dns.Msg {
+				m := new(dns.Msg)
+				m.SetQuestion("a.example.com.", dns.TypeA)
+				m.Id = 4
+				m.Response = true
+				m.Answer = rrs(t,
+					"a.example.com. 60 IN CNAME b.example.com.",
+					"B.example.com. 60 IN CNAME a.example.com.",
+				)
+				return m
+			},
+			want: model.Session{
+				Domain: "a.example.com", QueryType: "A", DNSID: 4, RCode: "NOERROR", DNSFlags: "qr rd",
+				CNAMEChain: "a.example.com -> b.example.com",
+			},
+			wantR: []model.DNSRecord{
+				{Section: model.DNSSectionAnswer, Name: "a.example.com", Type: "CNAME", TTL: 60, Data: "b.example.com."},
+				{Section: model.DNSSectionAnswer, Name: "B.example.com", Type: "CNAME", TTL: 60, Data: "a.example.com."},
+			},
+		},
+		{
+			name: "several questions",
+			msg: func(t *testing.T) *dns.Msg {
+				m := new(dns.Msg)
+				m.SetQuestion("example.com.", dns.TypeA)
+				m.Id = 5
+				m.Question = append(m.Question, dns.Question{Name: "example.com.", Qtype: dns.TypeHTTPS, Qclass: dns.ClassINET})
+				return m
+			},
+			want: model.Session{Domain: "example.com", QueryType: "A", DNSID: 5, DNSFlags: "rd"},
+			wantR: []model.DNSRecord{
+				{Section: model.DNSSectionQuestion, Name: "example.com", Type: "HTTPS"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := ParseDNS(dnsPacket(t, tt.msg(t)))
+			if err != nil {
+				t.Fatalf("ParseDNS: %v", err)
+			}
+			got := model.Session{
+				Domain: s.Domain, QueryType: s.QueryType, ResponseIP: s.ResponseIP,
+				DNSID: s.DNSID, RCode: s.RCode, DNSFlags: s.DNSFlags, CNAMEChain: s.CNAMEChain,
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("session = %+v, want %+v", got, tt.want)
+			}
+			if !reflect.DeepEqual(s.DNSRecords, tt.wantR) {
+				t.Errorf("records = %+v, want %+v", s.DNSRecords, tt.wantR)
+			}
+		})
+	}
+}
+
+func TestParseDNSInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		pkt  *model.Packet
+		want error
+	}{
+		{"not port 53", &model.Packet{Protocol: "UDP", SrcPort: 40000, DstPort: 5000, Payload: []byte{0, 1}}, ErrNotDNS},
+		{"TCP", &model.Packet{Protocol: "TCP", SrcPort: 40000, DstPort: 53, Payload: []byte{0, 1}}, ErrNotDNS},
+		{"empty payload", &model.Packet{Protocol: "UDP", SrcPort: 40000, DstPort: 53}, ErrNotDNS},
+		{"truncated header", &model.Packet{Protocol: "UDP", SrcPort: 40000, DstPort: 53, Payload: []byte{0, 1, 2}}, ErrParseErr},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseDNS(tt.pkt); !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package parser
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"sniffer/pkg/model"
+)
+
+// DNSTrackerOptions represents the limits of the DNS transaction tracker
+type DNSTrackerOptions struct {
+	Timeout    time.Duration // 查询等待响应的超时，超时后记为未响应
+	MaxPending int           // 等待响应的查询数上限，超出时最早的查询记为未响应
+}
+
+// dnsKey identifies a DNS transaction: 客户端与服务端的地址、端口和事务 ID
+type dnsKey struct {
+	client, server         string
+	clientPort, serverPort uint16
+	id                     uint16
+}
+
+// dnsPending is a query waiting for its response
+type dnsPending struct {
+	key     dnsKey
+	session *model.Session
+	done    bool // 已配对或已超时，等待从队列中移除
+}
+
+// DNSTracker pairs DNS queries with their responses by transaction ID and 5-tuple
+// 查询在响应到达前暂存，配对后合并为一条事务（延迟、响应码、应答记录）；
+// 超时按数据包时间计算（离线回放同样适用）
+type DNSTracker struct {
+	mu       sync.Mutex
+	opts     DNSTrackerOptions
+	pending  map[dnsKey]*dnsPending
+	queue    []*dnsPending // 按到达顺序排列，用于超时检查
+	lastSeen time.Time
+	stats    model.DNSTrackerStats
+}
+
+// NewDNSTracker creates a DNS transaction tracker with the given limits
+func NewDNSTracker(opts DNSTrackerOptions) *DNSTracker {
+	t := &DNSTracker{
+		opts:    opts,
+		pending: make(map[dnsKey]*dnsPending),
+	}
+	t.stats.Enabled = true
+	return t
+}
+
+// Track feeds a DNS session parsed from a single packet and returns the sessions it completed
+// 查询返回空；响应返回与查询合并后的事务，没有对应查询的响应原样返回
+func (t *DNSTracker) Track(session *model.Session) []*model.Session {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if session.Timestamp.After(t.lastSeen) {
+		t.lastSeen = session.Timestamp
+	}
+
+	// 响应报文的 RCode 总是非空
+	if session.RCode == "" {
+		return t.addQueryLocked(session)
+	}
+
+	key := dnsKey{
+		client:     session.FiveTuple.DstIP,
+		server:     session.FiveTuple.SrcIP,
+		clientPort: session.FiveTuple.DstPort,
+		serverPort: session.FiveTuple.SrcPort,
+		id:         session.DNSID,
+	}
+	p, ok := t.pending[key]
+	// 事务 ID 可能重复使用，问题不同时不配对
+	if !ok || !strings.EqualFold(p.session.Domain, session.Domain) {
+		t.stats.Unmatched++
+		return []*model.Session{session}
+	}
+
+	delete(t.pending, key)
+	p.done = true
+	mergeDNSResponse(p.session, session)
+	t.stats.Answered++
+	return []*model.Session{p.session}
+}
+
+// addQueryLocked queues a query until its response arrives
+func (t *DNSTracker) addQueryLocked(session *model.Session) []*model.Session {
+	key := dnsKey{
+		client:     session.FiveTuple.SrcIP,
+		server:     session.FiveTuple.DstIP,
+		clientPort: session.FiveTuple.SrcPort,
+		serverPort: session.FiveTuple.DstPort,
+		id:         session.DNSID,
+	}
+	// 重传的查询：保留首个查询，延迟从首次发送开始计算
+	if _, ok := t.pending[key]; ok {
+		t.stats.Duplicates++
+		return nil
+	}
+
+	var out []*model.Session
+	if t.opts.MaxPending > 0 && len(t.pending) >= t.opts.MaxPending {
+		out = t.expireLocked(func(*dnsPending) bool { return len(t.pending) >= t.opts.MaxPending })
+	}
+
+	p := &dnsPending{key: key, session: session}
+	t.pending[key] = p
+	t.queue = append(t.queue, p)
+	return out
+}
+
+// Flush returns the queries that have waited longer than the timeout, marked as unanswered
+func (t *DNSTracker) Flush() []*model.Session {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.lastSeen.IsZero() {
+		return nil
+	}
+	cutoff := t.lastSeen.Add(-t.opts.Timeout)
+	return t.expireLocked(func(p *dnsPending) bool { return p.session.Timestamp.Before(cutoff) })
+}
+
+// FlushAll returns all pending queries (capture stopped), marked as unanswered
+func (t *DNSTracker) FlushAll() []*model.Session {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	out := t.expireLocked(func(*dnsPending) bool { return true })
+	t.lastSeen = time.Time{}
+	return out
+}
+
+// Stats returns the tracker counters
+func (t *DNSTracker) Stats() model.DNSTrackerStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats := t.stats
+	stats.Pending = int64(len(t.pending))
+	return stats
+}
+
+// expireLocked removes queries from the front of the queue while expire returns true
+// and returns them marked as unanswered; 已配对的查询直接出队
+func (t *DNSTracker) expireLocked(expire func(p *dnsPending) bool) []*model.Session {
+	var out []*model.Session
+	n := 0
+	for ; n < len(t.queue); n++ {
+		p := t.queue[n]
+		if p.done {
+			continue
+		}
+		if !expire(p) {
+			break
+		}
+		delete(t.pending, p.key)
+		p.done = true
+		p.session.Unanswered = true
+		t.stats.Unanswered++
+		out = append(out, p.session)
+	}
+	t.queue = t.queue[:copy(t.queue, t.queue[n:])]
+	return out
+}
+
+// mergeDNSResponse merges a response into its query: 查询名、类型、方向和发送时间以查询为准
+func mergeDNSResponse(query, resp *model.Session) {
+	query.Paired = true
+	query.RCode = resp.RCode
+	query.DNSFlags = resp.DNSFlags
+	query.ResponseIP = resp.ResponseIP
+	query.CNAMEChain = resp.CNAMEChain
+	query.DNSRecords = resp.DNSRecords
+	query.PayloadSize += resp.PayloadSize
+	if latency := resp.Timestamp.Sub(query.Timestamp); latency > 0 {
+		query.LatencyMs = float64(latency) / float64(time.Millisecond)
+	}
+	if query.ProcessPID == 0 {
+		query.ProcessPID = resp.ProcessPID
+		query.ProcessName = resp.ProcessName
+		query.ProcessExe = resp.ProcessExe
+	}
+}
@@ -0,0 +1,146 @@
+package parser
+
+import (
+	"testing"
+	"time"
+
+	"sniffer/pkg/model"
+)
+
+// dnsQuery returns a parsed DNS query session sent at ms milliseconds
+func dnsQuery(id uint16, domain string, ms int) *model.Session {
+	return &model.Session{
+		Timestamp: time.Unix(1700000000, 0).Add(time.Duration(ms) * time.Millisecond),
+		FiveTuple: model.FiveTuple{SrcIP: "192.168.1.10", DstIP: "192.168.1.1", SrcPort: 53124, DstPort: 53, Protocol: "UDP"},
+		Type:      "DNS",
+		Domain:    domain,
+		DNSID:     id,
+	}
+}
+
+// dnsResponse returns the response to dnsQuery(id, domain) received at ms milliseconds
+func dnsResponse(id uint16, domain, rcode string, ms int) *model.Session {
+	s := dnsQuery(id, domain, ms)
+	s.FiveTuple = model.FiveTuple{SrcIP: "192.168.1.1", DstIP: "192.168.1.10", SrcPort: 53, DstPort: 53124, Protocol: "UDP"}
+	s.RCode = rcode
+	s.ResponseIP = "93.184.216.34"
+	return s
+}
+
+func TestDNSTracker(t *testing.T) {
+	type step struct {
+		session *model.Session
+		flush   bool // 调用 Flush 而不是 Track
+		want    []string
+	}
+	// 输出的会话记为 "域名 RCode 延迟ms"，未响应记为 "域名 unanswered"
+	describe := func(s *model.Session) string {
+		if s.Unanswered {
+			return s.Domain + " unanswered"
+		}
+		return s.Domain + " " + s.RCode + " " + time.Duration(s.LatencyMs*float64(time.Millisecond)).String()
+	}
+
+	tests := []struct {
+		name       string
+		maxPending int
+		steps      []step
+		want       model.DNSTrackerStats
+	}{
+		{
+			name: "query and response",
+			steps: []step{
+				{session: dnsQuery(1, "example.com", 0)},
+				{session: dnsResponse(1, "example.com", "NOERROR", 25), want: []string{"example.com NOERROR 25ms"}},
+			},
+			want: model.DNSTrackerStats{Answered: 1},
+		},
+		{
+			name: "NXDOMAIN",
+			steps: []step{
+				{session: dnsQuery(2, "missing.example.com", 0)},
+				{session: dnsResponse(2, "missing.example.com", "NXDOMAIN", 10), want: []string{"missing.example.com NXDOMAIN 10ms"}},
+			},
+			want: model.DNSTrackerStats{Answered: 1},
+		},
+		{
+			name: "retransmitted query keeps the first send time",
+			steps: []step{
+				{session: dnsQuery(3, "example.com", 0)},
+				{session: dnsQuery(3, "example.com", 1000)},
+				{session: dnsResponse(3, "example.com", "NOERROR", 1020), want: []string{"example.com NOERROR 1.02s"}},
+			},
+			want: model.DNSTrackerStats{Answered: 1, Duplicates: 1},
+		},
+		{
+			name: "response without query",
+			steps: []step{
+				{session: dnsResponse(4, "example.com", "NOERROR", 0), want: []string{"example.com NOERROR 0s"}},
+			},
+			want: model.DNSTrackerStats{Unmatched: 1},
+		},
+		{
+			name: "reused ID for another name",
+			steps: []step{
+				{session: dnsQuery(5, "a.example.com", 0)},
+				{session: dnsResponse(5, "b.example.com", "NOERROR", 5), want: []string{"b.example.com NOERROR 0s"}},
+				{session: dnsResponse(5, "A.EXAMPLE.COM", "NOERROR", 8), want: []string{"a.example.com NOERROR 8ms"}},
+			},
+			want: model.DNSTrackerStats{Answered: 1, Unmatched: 1},
+		},
+		{
+			name: "timeout",
+			steps: []step{
+				{session: dnsQuery(6, "slow.example.com", 0)},
+				{session: dnsQuery(7, "fast.example.com", 4000)},
+				{flush: true, want: []string{"slow.example.com unanswered"}},
+				{session: dnsResponse(6, "slow.example.com", "NOERROR", 4100), want: []string{"slow.example.com NOERROR 0s"}},
+				{session: dnsResponse(7, "fast.example.com", "NOERROR", 4100), want: []string{"fast.example.com NOERROR 100ms"}},
+			},
+			want: model.DNSTrackerStats{Answered: 1, Unanswered: 1, Unmatched: 1},
+		},
+		{
+			name:       "pending limit",
+			maxPending: 2,
+			steps: []step{
+				{session: dnsQuery(8, "a.example.com", 0)},
+				{session: dnsQuery(9, "b.example.com", 1)},
+				{session: dnsResponse(8, "a.example.com", "NOERROR", 2), want: []string{"a.example.com NOERROR 2ms"}},
+				{session: dnsQuery(10, "c.example.com", 3)},
+				{session: dnsQuery(11, "d.example.com", 4), want: []string{"b.example.com unanswered"}},
+			},
+			want: model.DNSTrackerStats{Answered: 1, Unanswered: 1, Pending: 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewDNSTracker(DNSTrackerOptions{Timeout: 2 * time.Second, MaxPending: tt.maxPending})
+			for i, st := range tt.steps {
+				var out []*model.Session
+				if st.flush {
+					out = tracker.Flush()
+				} else {
+					out = tracker.Track(st.session)
+				}
+				var got []string
+				for _, s := range out {
+					got = append(got, describe(s))
+				}
+				if len(got) != len(st.want) {
+					t.Fatalf("step %d: got %q, want %q", i, got, st.want)
+				}
+				for j := range got {
+					if got[j] != st.want[j] {
+						t.Fatalf("step %d: got %q, want %q", i, got, st.want)
+					}
+				}
+			}
+
+			tt.want.Enabled = true
+			if stats := tracker.Stats(); stats != tt.want {
+				t.Errorf("stats = %+v, want %+v", stats, tt.want)
+			}
+		})
+	}
+}
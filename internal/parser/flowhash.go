@@ -0,0 +1,91 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/google/gopacket/layers"
+)
+
+// FlowHash returns a direction independent hash of the IP addresses of a raw packet
+// 在解码前按原始字节计算，流水线据此把同一连接的数据包分给同一个工作协程以保持顺序；
+// 只使用地址对（不含端口），IP 分片与重组后的数据报落在同一协程。无 IP 层的数据包返回 0
+func FlowHash(data []byte, linkType int) uint32 {
+	ip := networkLayer(data, linkType)
+	if len(ip) == 0 {
+		return 0
+	}
+
+	var src, dst []byte
+	switch ip[0] >> 4 {
+	case 4:
+		if len(ip) < 20 {
+			return 0
+		}
+		src, dst = ip[12:16], ip[16:20]
+	case 6:
+		if len(ip) < 40 {
+			return 0
+		}
+		src, dst = ip[8:24], ip[24:40]
+	default:
+		return 0
+	}
+	if bytes.Compare(src, dst) > 0 {
+		src, dst = dst, src
+	}
+
+	// FNV-1a
+	h := uint32(2166136261)
+	for _, b := range src {
+		h = (h ^ uint32(b)) * 16777619
+	}
+	for _, b := range dst {
+		h = (h ^ uint32(b)) * 16777619
+	}
+	return h
+}
+
+// networkLayer returns the data from the IP header of a raw packet, nil if it is not IP
+func networkLayer(data []byte, linkType int) []byte {
+	var etherType layers.EthernetType
+	switch linkType {
+	case int(layers.LinkTypeEthernet):
+		if len(data) < 14 {
+			return nil
+		}
+		etherType, data = layers.EthernetType(binary.BigEndian.Uint16(data[12:14])), data[14:]
+		// 802.1Q / QinQ 标签
+		for etherType == layers.EthernetTypeDot1Q || etherType == layers.EthernetTypeQinQ || etherType == 0x9100 {
+			if len(data) < 4 {
+				return nil
+			}
+			etherType, data = layers.EthernetType(binary.BigEndian.Uint16(data[2:4])), data[4:]
+		}
+	case int(layers.LinkTypeLinuxSLL):
+		if len(data) < 16 {
+			return nil
+		}
+		etherType, data = layers.EthernetType(binary.BigEndian.Uint16(data[14:16])), data[16:]
+	case LinkTypeLinuxSLL2:
+		if len(data) < linuxSLL2HeaderLen {
+			return nil
+		}
+		etherType, data = layers.EthernetType(binary.BigEndian.Uint16(data[0:2])), data[linuxSLL2HeaderLen:]
+	case int(layers.LinkTypeNull), int(layers.LinkTypeLoop):
+		// 协议族为主机字节序，按 IP 版本号判断
+		if len(data) < 4 {
+			return nil
+		}
+		return data[4:]
+	case LinkTypeIPv4, LinkTypeIPv6, int(layers.LinkTypeRaw):
+		return data
+	default:
+		return nil
+	}
+
+	if etherType != layers.EthernetTypeIPv4 && etherType != layers.EthernetTypeIPv6 {
+		return nil
+	}
+	return data
+}
@@ -0,0 +1,67 @@
+package parser
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/google/gopacket/layers"
+)
+
+func TestFlowHashSymmetric(t *testing.T) {
+	udp := func(src, dst uint16) *layers.UDP {
+		return &layers.UDP{SrcPort: layers.UDPPort(src), DstPort: layers.UDPPort(dst)}
+	}
+
+	v4 := serialize(t, ethernet(layers.EthernetTypeIPv4), ipv4("10.0.0.1", "10.0.0.2", layers.IPProtocolUDP), udp(1234, 53))
+	v4Reply := serialize(t, ethernet(layers.EthernetTypeIPv4), ipv4("10.0.0.2", "10.0.0.1", layers.IPProtocolUDP), udp(53, 1234))
+	v4Other := serialize(t, ethernet(layers.EthernetTypeIPv4), ipv4("10.0.0.1", "10.0.0.3", layers.IPProtocolUDP), udp(1234, 53))
+	qinq := serialize(t, ethernet(layers.EthernetTypeQinQ),
+		&layers.Dot1Q{VLANIdentifier: 100, Type: layers.EthernetTypeDot1Q},
+		&layers.Dot1Q{VLANIdentifier: 200, Type: layers.EthernetTypeIPv4},
+		ipv4("10.0.0.2", "10.0.0.1", layers.IPProtocolUDP), udp(53, 1234))
+	v6 := serialize(t, ethernet(layers.EthernetTypeIPv6), ipv6("2001:db8::1", "2001:db8::2", layers.IPProtocolUDP), udp(1234, 53))
+	v6Reply := serialize(t, ethernet(layers.EthernetTypeIPv6), ipv6("2001:db8::2", "2001:db8::1", layers.IPProtocolUDP), udp(53, 1234))
+
+	// SLL2：20 字节头部，协议类型在开头
+	sll2 := make([]byte, linuxSLL2HeaderLen, linuxSLL2HeaderLen+len(v4)-14)
+	binary.BigEndian.PutUint16(sll2[0:2], uint16(layers.EthernetTypeIPv4))
+	sll2 = append(sll2, v4Reply[14:]...)
+
+	arp := serialize(t, ethernet(layers.EthernetTypeARP), &layers.ARP{
+		AddrType: layers.LinkTypeEthernet, Protocol: layers.EthernetTypeIPv4, HwAddressSize: 6, ProtAddressSize: 4,
+		Operation: layers.ARPRequest, SourceHwAddress: testSrcMAC, SourceProtAddress: []byte{10, 0, 0, 1},
+		DstHwAddress: make([]byte, 6), DstProtAddress: []byte{10, 0, 0, 2},
+	})
+
+	base := FlowHash(v4, int(layers.LinkTypeEthernet))
+	if base == 0 {
+		t.Fatal("FlowHash of an IPv4 packet = 0")
+	}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		linkType int
+		same     bool
+	}{
+		{"reply", v4Reply, int(layers.LinkTypeEthernet), true},
+		{"qinq reply", qinq, int(layers.LinkTypeEthernet), true},
+		{"raw ip", v4[14:], int(layers.LinkTypeRaw), true},
+		{"sll2 reply", sll2, LinkTypeLinuxSLL2, true},
+		{"other host", v4Other, int(layers.LinkTypeEthernet), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FlowHash(tt.data, tt.linkType); (got == base) != tt.same {
+				t.Errorf("FlowHash = %#x, base %#x, want same=%v", got, base, tt.same)
+			}
+		})
+	}
+
+	if a, b := FlowHash(v6, int(layers.LinkTypeEthernet)), FlowHash(v6Reply, int(layers.LinkTypeEthernet)); a != b || a == 0 {
+		t.Errorf("IPv6 FlowHash = %#x / %#x, want equal and non-zero", a, b)
+	}
+	if got := FlowHash(arp, int(layers.LinkTypeEthernet)); got != 0 {
+		t.Errorf("FlowHash of ARP = %#x, want 0", got)
+	}
+}
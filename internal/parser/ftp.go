@@ -0,0 +1,133 @@
+package parser
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"sniffer/pkg/model"
+)
+
+// maxFTPSizes limits the file sizes remembered from SIZE replies per connection
+const maxFTPSizes = 256
+
+// ftpBytesRe matches the transfer size reported in 150/226 replies, 如 "(1234 bytes)"
+var ftpBytesRe = regexp.MustCompile(`\(?(\d+) [Bb]ytes`)
+
+// isFTPPort reports whether port is the FTP control port
+func isFTPPort(port uint16) bool {
+	return port == 21
+}
+
+// ftpConn parses an FTP control connection, 每个命令及其最终应答一条记录
+// 文件传输命令（RETR/STOR/STOU/APPE）记录文件名，文件大小来自 SIZE 应答或传输应答中的字节数
+type ftpConn struct {
+	lineSession
+	user      string           // USER 命令的用户名，供随后的 PASS 使用
+	multiCode string           // 正在读取的多行应答的应答码
+	sizes     map[string]int64 // SIZE 命令得到的文件大小
+}
+
+// newFTPParsers creates the FTP parsers of both directions of a control connection
+func newFTPParsers(client model.FiveTuple, maxBuffer int) (StreamParser, StreamParser) {
+	return newLineParsers(&ftpConn{lineSession: lineSession{proto: "FTP", client: client}}, maxBuffer)
+}
+
+func (c *ftpConn) clientLine(line string, ts time.Time) []*model.Session {
+	verb, arg := splitCommand(line)
+	session := c.record(verb, arg, ts, len(line)+2)
+	switch verb {
+	case "USER":
+		c.user = arg
+		session.Username = arg
+	case "PASS", "ACCT":
+		// 匿名登录的密码通常是邮箱地址，不视为凭据泄露
+		session.Argument = maskedPassword
+		session.Username = c.user
+		session.CleartextAuth = verb == "PASS" && !isAnonymousFTPUser(c.user)
+	case "RETR", "STOR", "STOU", "APPE", "SIZE":
+		session.FileName = truncateText(printableString([]byte(arg)), maxLineArgument)
+		session.FileSize = c.sizes[arg]
+	}
+	return c.push(&lineCommand{verb: verb, session: session}, nil)
+}
+
+func (c *ftpConn) serverLine(line string, ts time.Time) []*model.Session {
+	// 多行应答以 "nnn-" 开始，以同一应答码的 "nnn " 行结束，中间行可为任意文本
+	if c.multiCode != "" {
+		if !strings.HasPrefix(line, c.multiCode+" ") && line != c.multiCode {
+			return nil
+		}
+		c.multiCode = ""
+	}
+	code, text, final := parseReplyLine(line)
+	if code == "" {
+		return nil
+	}
+	if !final {
+		c.multiCode = code
+		return nil
+	}
+
+	// 1yz 为初步应答，命令的最终应答随后到达
+	if code[0] == '1' {
+		if cmd := c.peek(); cmd != nil {
+			c.transferReply(cmd.session, code, text)
+		}
+		return nil
+	}
+
+	cmd := c.pop()
+	if cmd == nil {
+		return nil // 问候语或没有对应命令的应答
+	}
+	session := cmd.session
+	setReply(session, code, text, ts, len(line)+2)
+
+	switch cmd.verb {
+	case "SIZE":
+		if code == "213" {
+			if size, err := strconv.ParseInt(strings.TrimSpace(text), 10, 64); err == nil && size >= 0 {
+				session.FileSize = size
+				if c.sizes == nil {
+					c.sizes = make(map[string]int64)
+				}
+				if len(c.sizes) < maxFTPSizes {
+					c.sizes[session.Argument] = size
+				}
+			}
+		}
+	case "AUTH":
+		// AUTH TLS/SSL 成功后控制连接加密
+		c.tls = code == "234"
+	case "RETR", "STOR", "STOU", "APPE":
+		c.transferReply(session, code, text)
+	}
+	return []*model.Session{session}
+}
+
+func (c *ftpConn) close(ts time.Time) []*model.Session {
+	return c.flush(nil)
+}
+
+// transferReply takes the file name and size reported by a transfer reply
+func (c *ftpConn) transferReply(session *model.Session, code, text string) {
+	if session.FileSize == 0 {
+		if m := ftpBytesRe.FindStringSubmatch(text); m != nil {
+			session.FileSize, _ = strconv.ParseInt(m[1], 10, 64)
+		}
+	}
+	// STOU 的 150 应答给出服务器生成的文件名，如 "FILE: name"
+	if session.Command == "STOU" && session.FileName == "" {
+		if i := strings.Index(text, "FILE:"); i >= 0 {
+			name, _, _ := strings.Cut(strings.TrimSpace(text[i+5:]), " ")
+			session.FileName = printableString([]byte(name))
+		}
+	}
+}
+
+// isAnonymousFTPUser reports whether user is an anonymous FTP login
+func isAnonymousFTPUser(user string) bool {
+	return strings.EqualFold(user, "anonymous") || strings.EqualFold(user, "ftp")
+}
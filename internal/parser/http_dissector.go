@@ -0,0 +1,78 @@
+package parser
+
+import (
+	"sniffer/pkg/model"
+)
+
+func init() {
+	Register(httpDissector{})
+}
+
+// httpDissector parses HTTP/1.x; 开启 TCP 重组时由重组器解析字节流，这里不再逐包解析
+type httpDissector struct{}
+
+func (httpDissector) Name() string { return "HTTP" }
+
+func (httpDissector) Table() model.TableType { return model.TableHTTP }
+
+func (httpDissector) Claims(pkt *model.Packet) bool {
+	return pkt.Protocol == "TCP" && (isHTTPPort(pkt.SrcPort) || isHTTPPort(pkt.DstPort) || pkt.AppProtocol == "HTTP")
+}
+
+func (httpDissector) Dissect(pkt *model.Packet, ctx *DissectContext) ([]*model.Session, error) {
+	if ctx != nil && ctx.Reassembler != nil {
+		return nil, nil
+	}
+	session, err := ParseHTTP(pkt)
+	if err != nil {
+		return nil, err
+	}
+	return []*model.Session{session}, nil
+}
+
+// httpStreamProtocol parses HTTP/1.x from reassembled TCP streams
+var httpStreamProtocol = &StreamProtocol{IsServerPort: isHTTPPort, NewParsers: newHTTPParsers}
+
+func (httpDissector) StreamProtocol() *StreamProtocol { return httpStreamProtocol }
+
+func (httpDissector) AlertField(session *model.Session, field string) (string, bool) {
+	switch field {
+	case "domain":
+		return session.Domain, true
+	case "url":
+		// HTTP的URL由Host和Path组成
+		return session.Host + session.Path, true
+	}
+	return "", false
+}
+
+// httpSchema is the storage of HTTP transactions (请求与配对的响应)
+var httpSchema = &Schema{
+	Table: "http_sessions",
+	Columns: concatColumns(
+		[]Column{timestampColumn},
+		tupleColumns(true),
+		[]Column{
+			column("method", "TEXT", func(s *model.Session) *string { return &s.Method }),
+			column("host", "TEXT", func(s *model.Session) *string { return &s.Host }),
+			column("path", "TEXT", func(s *model.Session) *string { return &s.Path }),
+			column("status_code", "INTEGER", func(s *model.Session) *int { return &s.StatusCode }),
+			column("user_agent", "TEXT", func(s *model.Session) *string { return &s.UserAgent }),
+			column("content_type", "TEXT", func(s *model.Session) *string { return &s.ContentType }),
+			column("post_data", "TEXT", func(s *model.Session) *string { return &s.PostData }),
+			payloadColumn,
+			ttlColumn,
+		},
+		processColumns(),
+		[]Column{
+			column("response_content_type", "TEXT", func(s *model.Session) *string { return &s.ResponseContentType }),
+			column("response_size", "INTEGER", func(s *model.Session) *int { return &s.ResponseSize }),
+			column("latency_ms", "REAL", func(s *model.Session) *float64 { return &s.LatencyMs }),
+		},
+	),
+	Indexes:       []string{"timestamp", "ttl", "host"},
+	DomainColumn:  "host",
+	SearchColumns: []string{"src_ip", "dst_ip", "host", "path", "user_agent"},
+}
+
+func (httpDissector) Schema() *Schema { return httpSchema }
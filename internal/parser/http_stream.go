@@ -0,0 +1,389 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+
+	"sniffer/pkg/model"
+)
+
+// HTTP stream parser states
+const (
+	httpStateHeader     = iota // 等待完整的起始行和头部
+	httpStateBody              // Content-Length 消息体
+	httpStateChunkSize         // 分块大小行
+	httpStateChunkData         // 分块数据
+	httpStateChunkEnd          // 分块数据后的 CRLF
+	httpStateTrailer           // 最后一个分块后的尾部字段
+	httpStateUntilClose        // 无长度的响应体，读到连接关闭
+	httpStateSync              // 数据丢失后查找下一个消息的起始位置
+)
+
+// maxPendingRequests is the number of requests kept waiting for their responses per connection
+const maxPendingRequests = 64
+
+// httpConn is the state shared by both directions of an HTTP connection
+// 请求按顺序排队，响应按 FIFO 与请求配对（支持流水线请求）
+type httpConn struct {
+	requests []*httpRequest
+	closed   int // 已关闭的方向数
+}
+
+// httpRequest is a request waiting for its response
+type httpRequest struct {
+	session *model.Session
+	done    time.Time // 请求最后一个字节的时间，为零表示请求尚未结束
+}
+
+// httpStream parses the HTTP/1.x messages of one direction of a reassembled connection
+// 支持跨报文段的头部、流水线请求、Content-Length 和 chunked 消息体
+type httpStream struct {
+	conn      *httpConn
+	tuple     model.FiveTuple // 发送方 -> 接收方
+	maxBuffer int
+
+	state  int
+	buf    []byte    // 未解析的数据（头部、分块大小行）
+	bufTS  time.Time // buf 中首字节的时间戳
+	remain int64     // 当前消息体/分块剩余字节数
+
+	msg      *model.Session // 正在读取消息体的消息
+	req      *httpRequest   // msg 为请求时为其排队记录，为响应时为配对的请求
+	head     httpHead
+	body     []byte // 已捕获的消息体前缀（最多 maxPostData）
+	bodySize int64  // 消息体字节数（分块编码为解码后的长度）
+	size     int    // 消息总字节数
+}
+
+// newHTTPParsers creates the HTTP parsers of both directions of a connection
+func newHTTPParsers(client model.FiveTuple, maxBuffer int) (StreamParser, StreamParser) {
+	conn := &httpConn{}
+	return &httpStream{conn: conn, tuple: client, maxBuffer: maxBuffer},
+		&httpStream{conn: conn, tuple: reverseTuple(client), maxBuffer: maxBuffer}
+}
+
+// Feed parses the next in-order bytes of the stream
+func (h *httpStream) Feed(data []byte, skip int, ts time.Time) ([]*model.Session, error) {
+	var out []*model.Session
+	if skip > 0 {
+		out = h.lost(int64(skip), out)
+	}
+
+	if len(h.buf) == 0 {
+		h.bufTS = ts
+	}
+	h.buf = append(h.buf, data...)
+	out = h.parse(ts, out)
+
+	// 头部或分块大小行超过缓存上限：丢弃并重新同步
+	if len(h.buf) > h.maxBuffer {
+		out = h.finish(out)
+		h.buf = h.buf[:0]
+		h.state = httpStateSync
+		return out, ErrStreamOverflow
+	}
+	return out, nil
+}
+
+// Close returns the messages still pending when the connection ends
+// 读到连接关闭的响应体在此结束；两个方向都关闭后输出没有响应的请求
+func (h *httpStream) Close(ts time.Time) []*model.Session {
+	out := h.finish(nil)
+	h.buf = nil
+	h.state = httpStateHeader
+
+	h.conn.closed++
+	if h.conn.closed == 2 {
+		for _, req := range h.conn.requests {
+			out = append(out, req.session)
+		}
+		h.conn.requests = nil
+	}
+	return out
+}
+
+// parse consumes the buffered data and appends the completed messages to out
+func (h *httpStream) parse(ts time.Time, out []*model.Session) []*model.Session {
+	for len(h.buf) > 0 {
+		switch h.state {
+		case httpStateSync:
+			i := findHTTPStart(h.buf)
+			if i < 0 {
+				// 保留末尾的几个字节，起始标记可能被分在两段数据中
+				if keep := 8; len(h.buf) > keep {
+					h.buf = append(h.buf[:0], h.buf[len(h.buf)-keep:]...)
+				}
+				return out
+			}
+			h.consume(i, ts)
+			h.state = httpStateHeader
+
+		case httpStateHeader:
+			if !isHTTPData(h.buf) {
+				if len(h.buf) < 8 && bytes.IndexByte(h.buf, '\n') < 0 {
+					return out // 起始行尚不完整
+				}
+				h.state = httpStateSync
+				h.consume(1, ts)
+				continue
+			}
+			end := bytes.Index(h.buf, []byte("\r\n\r\n"))
+			if end < 0 {
+				return out
+			}
+			complete := h.startMessage(h.buf[:end+4])
+			h.consume(end+4, ts)
+			if complete {
+				out = h.finish(out)
+			}
+
+		case httpStateBody, httpStateChunkData:
+			n := int(min(h.remain, int64(len(h.buf))))
+			h.readBody(h.buf[:n])
+			h.consume(n, ts)
+			h.remain -= int64(n)
+			if h.remain > 0 {
+				continue
+			}
+			if h.state == httpStateChunkData {
+				h.state = httpStateChunkEnd
+			} else {
+				out = h.finish(out)
+			}
+
+		case httpStateChunkEnd:
+			if len(h.buf) < 2 {
+				return out
+			}
+			h.size += 2
+			h.consume(2, ts)
+			h.state = httpStateChunkSize
+
+		case httpStateChunkSize:
+			line, ok := h.readLine(ts)
+			if !ok {
+				return out
+			}
+			if i := strings.IndexByte(line, ';'); i >= 0 {
+				line = line[:i]
+			}
+			size, err := strconv.ParseInt(strings.TrimSpace(line), 16, 64)
+			if err != nil || size < 0 {
+				// 分块编码损坏：结束当前消息并重新同步
+				out = h.finish(out)
+				h.state = httpStateSync
+				continue
+			}
+			if size == 0 {
+				h.state = httpStateTrailer
+			} else {
+				h.remain = size
+				h.state = httpStateChunkData
+			}
+
+		case httpStateTrailer:
+			line, ok := h.readLine(ts)
+			if !ok {
+				return out
+			}
+			if strings.TrimSpace(line) == "" {
+				out = h.finish(out)
+			}
+
+		case httpStateUntilClose:
+			h.readBody(h.buf)
+			h.consume(len(h.buf), ts)
+		}
+	}
+	return out
+}
+
+// startMessage parses the header of a new message and selects how its body is framed.
+// Returns true if the message has no body.
+func (h *httpStream) startMessage(header []byte) bool {
+	session := &model.Session{
+		Timestamp: h.bufTS,
+		FiveTuple: h.tuple,
+		Type:      "HTTP",
+		TTL:       h.bufTS.Add(7 * 24 * time.Hour),
+	}
+	h.head = parseHTTPHead(session, bufio.NewReader(bytes.NewReader(header)))
+	h.msg = session
+	h.req = nil
+	h.body = nil
+	h.bodySize = 0
+	h.size = len(header)
+
+	response := session.StatusCode != 0
+	if response {
+		// 1xx 为中间响应，不消耗请求
+		if session.StatusCode >= 200 && len(h.conn.requests) > 0 {
+			h.req = h.conn.requests[0]
+			h.conn.requests = h.conn.requests[1:]
+		}
+	} else {
+		h.req = &httpRequest{session: session}
+		h.conn.requests = append(h.conn.requests, h.req)
+	}
+
+	switch {
+	case response && !h.responseHasBody(session.StatusCode):
+		return true
+	case h.head.chunked:
+		h.state = httpStateChunkSize
+	case h.head.hasLength && h.head.contentLength > 0:
+		h.state = httpStateBody
+		h.remain = h.head.contentLength
+	case response && !h.head.hasLength:
+		h.state = httpStateUntilClose
+	default:
+		return true
+	}
+	return false
+}
+
+// responseHasBody reports whether the current response may carry a body (RFC 9112 6.3)
+func (h *httpStream) responseHasBody(status int) bool {
+	method := ""
+	if h.req != nil {
+		method = h.req.session.Method
+	}
+	if method == "HEAD" || (method == "CONNECT" && status < 300) {
+		return false
+	}
+	return status >= 200 && status != 204 && status != 304
+}
+
+// readBody records body bytes and keeps a prefix of request bodies for PostData
+func (h *httpStream) readBody(data []byte) {
+	h.bodySize += int64(len(data))
+	h.size += len(data)
+	if h.msg == nil || (h.msg.Method != "POST" && h.msg.Method != "PUT") {
+		return
+	}
+	if room := maxPostData - len(h.body); room > 0 {
+		h.body = append(h.body, data[:min(room, len(data))]...)
+	}
+}
+
+// finish completes the current message
+// 请求等待配对的响应；响应与其请求合并为一条事务追加到 out
+func (h *httpStream) finish(out []*model.Session) []*model.Session {
+	if h.msg == nil {
+		return out
+	}
+	session, req := h.msg, h.req
+	h.msg, h.req = nil, nil
+	if h.state != httpStateSync {
+		h.state = httpStateHeader
+	}
+
+	if session.StatusCode == 0 {
+		length := h.head.contentLength
+		if !h.head.hasLength {
+			length = h.bodySize
+		}
+		setPostData(session, h.body, length)
+		session.PayloadSize = h.size
+		req.done = h.bufTS
+		h.body = nil
+
+		// 没有响应的请求过多时（如只抓到单向流量）输出最早的请求
+		if len(h.conn.requests) > maxPendingRequests {
+			out = append(out, h.conn.requests[0].session)
+			h.conn.requests = h.conn.requests[1:]
+		}
+		return out
+	}
+	h.body = nil
+
+	// 1xx 中间响应不单独记录
+	if session.StatusCode < 200 {
+		return out
+	}
+
+	// 没有对应请求的响应（抓包开始前发出的请求）单独记录
+	if req == nil {
+		session.ResponseContentType, session.ContentType = session.ContentType, ""
+		session.ResponseSize = h.size
+		session.PayloadSize = h.size
+		return append(out, session)
+	}
+
+	tx := req.session
+	tx.StatusCode = session.StatusCode
+	tx.ResponseContentType = session.ContentType
+	tx.ResponseSize = h.size
+	tx.PayloadSize += h.size
+
+	// 服务端延迟：请求结束到响应首字节；服务端提前响应时从请求开始计算
+	start := req.done
+	if start.IsZero() {
+		start = tx.Timestamp
+	}
+	if latency := session.Timestamp.Sub(start); latency > 0 {
+		tx.LatencyMs = float64(latency) / float64(time.Millisecond)
+	}
+	return append(out, tx)
+}
+
+// lost handles bytes lost before the next data
+// Content-Length 消息体中的缺失只跳过对应字节，其它情况结束当前消息并重新同步
+func (h *httpStream) lost(skip int64, out []*model.Session) []*model.Session {
+	switch h.state {
+	case httpStateBody, httpStateChunkData:
+		if len(h.buf) == 0 && skip <= h.remain {
+			h.remain -= skip
+			h.bodySize += skip
+			h.size += int(skip)
+			if h.remain == 0 {
+				if h.state == httpStateChunkData {
+					h.state = httpStateChunkEnd
+				} else {
+					out = h.finish(out)
+				}
+			}
+			return out
+		}
+	case httpStateUntilClose:
+		h.bodySize += skip
+		h.size += int(skip)
+		return out
+	}
+
+	out = h.finish(out)
+	h.buf = h.buf[:0]
+	h.state = httpStateSync
+	return out
+}
+
+// readLine removes a CRLF terminated line from the buffer
+func (h *httpStream) readLine(ts time.Time) (string, bool) {
+	i := bytes.IndexByte(h.buf, '\n')
+	if i < 0 {
+		return "", false
+	}
+	line := strings.TrimRight(string(h.buf[:i]), "\r")
+	h.size += i + 1
+	h.consume(i+1, ts)
+	return line, true
+}
+
+// consume removes n bytes from the front of the buffer
+func (h *httpStream) consume(n int, ts time.Time) {
+	h.buf = h.buf[:copy(h.buf, h.buf[n:])]
+	h.bufTS = ts
+}
+
+// findHTTPStart returns the offset of the first HTTP start line in data, or -1
+func findHTTPStart(data []byte) int {
+	for i := 0; i < len(data); i++ {
+		if (i == 0 || data[i-1] == '\n') && isHTTPData(data[i:]) {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,174 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"sniffer/pkg/model"
+)
+
+func TestHTTPStream(t *testing.T) {
+	const (
+		getA    = "GET /a HTTP/1.1\r\nHost: example.com\r\n\r\n"
+		getB    = "GET /b HTTP/1.1\r\nHost: example.com\r\n\r\n"
+		head    = "HEAD /a HTTP/1.1\r\nHost: example.com\r\n\r\n"
+		ok      = "HTTP/1.1 200 OK\r\nContent-Type: text/html\r\nContent-Length: 10\r\n\r\n"
+		notMod  = "HTTP/1.1 304 Not Modified\r\nContent-Length: 1000\r\n\r\n"
+		missing = "HTTP/1.1 404 Not Found\r\nContent-Length: 0\r\n\r\n"
+		chunked = "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n"
+		chunks  = "4\r\nabcd\r\n6;ext=1\r\nefghij\r\n0\r\nX-Trailer: 1\r\n\r\n"
+	)
+
+	// feed 为一方在 at 毫秒时发送的一段数据，skip 为之前丢失的字节数
+	type feed struct {
+		client bool
+		data   string
+		skip   int
+		at     int
+	}
+	type transaction struct {
+		Method, Path        string
+		Status              int
+		LatencyMs           float64
+		ResponseSize        int
+		ResponseContentType string
+		PostData            string
+	}
+
+	tests := []struct {
+		name  string
+		feeds []feed
+		want  []transaction
+	}{
+		{
+			name: "response body split across segments",
+			feeds: []feed{
+				{client: true, data: getA},
+				{data: ok + "01234", at: 25},
+				{data: "56789", at: 30},
+			},
+			want: []transaction{{"GET", "/a", 200, 25, len(ok) + 10, "text/html", ""}},
+		},
+		{
+			name: "pipelined requests",
+			feeds: []feed{
+				{client: true, data: getA + getB},
+				{data: ok + "0123456789" + missing, at: 30},
+			},
+			want: []transaction{
+				{"GET", "/a", 200, 30, len(ok) + 10, "text/html", ""},
+				{"GET", "/b", 404, 30, len(missing), "", ""},
+			},
+		},
+		{
+			name: "HEAD and 304 responses have no body",
+			feeds: []feed{
+				{client: true, data: head + getA},
+				{data: ok, at: 10},
+				{data: notMod, at: 20},
+			},
+			want: []transaction{
+				{"HEAD", "/a", 200, 10, len(ok), "text/html", ""},
+				{"GET", "/a", 304, 20, len(notMod), "", ""},
+			},
+		},
+		{
+			name: "chunked response with trailer",
+			feeds: []feed{
+				{client: true, data: getA},
+				{data: chunked + chunks[:9], at: 15},
+				{data: chunks[9:], at: 16},
+			},
+			want: []transaction{{"GET", "/a", 200, 15, len(chunked + chunks), "", ""}},
+		},
+		{
+			name: "POST body and 100 Continue",
+			feeds: []feed{
+				{client: true, data: "POST /api HTTP/1.1\r\nHost: example.com\r\nContent-Type: application/json\r\nContent-Length: 13\r\n\r\n"},
+				{data: "HTTP/1.1 100 Continue\r\n\r\n", at: 5},
+				{client: true, data: `{"user":"a"}` + "\n", at: 10},
+				{data: missing, at: 50},
+			},
+			want: []transaction{{"POST", "/api", 404, 40, len(missing), "", `{"user":"a"}` + "\n"}},
+		},
+		{
+			name: "response body read until the connection closes",
+			feeds: []feed{
+				{client: true, data: getA},
+				{data: "HTTP/1.0 200 OK\r\n\r\nbody", at: 20},
+				{data: "more", at: 21},
+			},
+			want: []transaction{{"GET", "/a", 200, 20, len("HTTP/1.0 200 OK\r\n\r\nbodymore"), "", ""}},
+		},
+		{
+			name: "request without response",
+			feeds: []feed{
+				{client: true, data: getA},
+			},
+			want: []transaction{{Method: "GET", Path: "/a"}},
+		},
+		{
+			name: "response without request",
+			feeds: []feed{
+				{data: missing},
+			},
+			want: []transaction{{Status: 404, ResponseSize: len(missing)}},
+		},
+		{
+			name: "bytes lost inside a response body",
+			feeds: []feed{
+				{client: true, data: getA + getB},
+				{data: ok + "0123", at: 10},
+				{data: missing, skip: 6, at: 20},
+			},
+			want: []transaction{
+				{"GET", "/a", 200, 10, len(ok) + 10, "text/html", ""},
+				{"GET", "/b", 404, 20, len(missing), "", ""},
+			},
+		},
+		{
+			name: "bytes lost inside a request header",
+			feeds: []feed{
+				{client: true, data: getA[:20]},
+				{client: true, data: "Host: example.com\r\n\r\n" + getB, skip: 10},
+				{data: missing, at: 20},
+			},
+			want: []transaction{{"GET", "/b", 404, 20, len(missing), "", ""}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := model.FiveTuple{SrcIP: "10.0.0.1", DstIP: "10.0.0.2", SrcPort: 40000, DstPort: 80, Protocol: "TCP"}
+			toServer, toClient := newHTTPParsers(client, 64<<10)
+			start := time.Unix(1700000000, 0)
+
+			var sessions []*model.Session
+			for _, f := range tt.feeds {
+				p := toClient
+				if f.client {
+					p = toServer
+				}
+				out, err := p.Feed([]byte(f.data), f.skip, start.Add(time.Duration(f.at)*time.Millisecond))
+				if err != nil {
+					t.Fatalf("Feed(%q): %v", f.data, err)
+				}
+				sessions = append(sessions, out...)
+			}
+			sessions = append(sessions, toServer.Close(start)...)
+			sessions = append(sessions, toClient.Close(start)...)
+
+			var got []transaction
+			for _, s := range sessions {
+				got = append(got, transaction{s.Method, s.Path, s.StatusCode, s.LatencyMs, s.ResponseSize, s.ResponseContentType, s.PostData})
+				if s.Type != "HTTP" {
+					t.Errorf("Type = %q", s.Type)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("transactions:\n got  %+v\n want %+v", got, tt.want)
+			}
+		})
+	}
+}
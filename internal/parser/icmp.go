@@ -0,0 +1,158 @@
+package parser
+
+import (
+	"encoding/binary"
+	"net"
+
+	"github.com/google/gopacket/layers"
+	"sniffer/pkg/model"
+)
+
+// ICMP message types used by the echo pairing and error decoding
+const (
+	icmpv4EchoReply      = 0
+	icmpv4Unreachable    = 3
+	icmpv4SourceQuench   = 4
+	icmpv4Redirect       = 5
+	icmpv4EchoRequest    = 8
+	icmpv4TimeExceeded   = 11
+	icmpv4ParamProblem   = 12
+	icmpv6Unreachable    = 1
+	icmpv6PacketTooBig   = 2
+	icmpv6TimeExceeded   = 3
+	icmpv6ParamProblem   = 4
+	icmpv6EchoRequest    = 128
+	icmpv6EchoReply      = 129
+	ipv6HeaderLen        = 40
+	ipv6ExtensionMaxHops = 8 // 原始报文中最多跳过的 IPv6 扩展头数
+)
+
+// isICMPEcho reports whether an ICMP type is an echo request or reply
+func isICMPEcho(v6 bool, typ uint8) bool {
+	return isICMPEchoRequest(v6, typ) || isICMPEchoReply(v6, typ)
+}
+
+func isICMPEchoRequest(v6 bool, typ uint8) bool {
+	if v6 {
+		return typ == icmpv6EchoRequest
+	}
+	return typ == icmpv4EchoRequest
+}
+
+func isICMPEchoReply(v6 bool, typ uint8) bool {
+	if v6 {
+		return typ == icmpv6EchoReply
+	}
+	return typ == icmpv4EchoReply
+}
+
+// isICMPError reports whether an ICMP type is an error message carrying the original packet header
+func isICMPError(v6 bool, typ uint8) bool {
+	if v6 {
+		return typ == icmpv6Unreachable || typ == icmpv6PacketTooBig || typ == icmpv6TimeExceeded || typ == icmpv6ParamProblem
+	}
+	switch typ {
+	case icmpv4Unreachable, icmpv4SourceQuench, icmpv4Redirect, icmpv4TimeExceeded, icmpv4ParamProblem:
+		return true
+	}
+	return false
+}
+
+// isICMPTimeExceeded reports whether an ICMP type is a time exceeded error (TTL 在途中耗尽)
+func isICMPTimeExceeded(v6 bool, typ uint8) bool {
+	if v6 {
+		return typ == icmpv6TimeExceeded
+	}
+	return typ == icmpv4TimeExceeded
+}
+
+// isICMPUnreachable reports whether an ICMP type is a destination unreachable error
+func isICMPUnreachable(v6 bool, typ uint8) bool {
+	if v6 {
+		return typ == icmpv6Unreachable
+	}
+	return typ == icmpv4Unreachable
+}
+
+// parseEmbeddedHeader decodes the original IP and transport header carried by an ICMP error
+// 路由器至少附带原始报文的 IP 头和 8 字节载荷（RFC 792），足以取得端口或回显的标识符和序号
+func parseEmbeddedHeader(session *model.Session, data []byte) {
+	if len(data) < 1 {
+		return
+	}
+
+	var proto layers.IPProtocol
+	var transport []byte
+	switch data[0] >> 4 {
+	case 4:
+		ihl := int(data[0]&0x0f) * 4
+		if ihl < 20 || len(data) < ihl {
+			return
+		}
+		proto = layers.IPProtocol(data[9])
+		session.OrigSrcIP = net.IP(data[12:16]).String()
+		session.OrigDstIP = net.IP(data[16:20]).String()
+		// 非首个分片没有传输层头部
+		if binary.BigEndian.Uint16(data[6:8])&0x1fff == 0 {
+			transport = data[ihl:]
+		}
+	case 6:
+		if len(data) < ipv6HeaderLen {
+			return
+		}
+		proto = layers.IPProtocol(data[6])
+		session.OrigSrcIP = net.IP(data[8:24]).String()
+		session.OrigDstIP = net.IP(data[24:40]).String()
+		proto, transport = skipIPv6Extensions(proto, data[ipv6HeaderLen:])
+	default:
+		return
+	}
+
+	switch proto {
+	case layers.IPProtocolICMPv4, layers.IPProtocolICMPv6:
+		// 与会话的协议名一致，ICMPv4 和 ICMPv6 都记为 ICMP
+		session.OrigProtocol = "ICMP"
+		if len(transport) >= 8 {
+			session.OrigSrcPort = binary.BigEndian.Uint16(transport[4:6])
+			session.OrigDstPort = binary.BigEndian.Uint16(transport[6:8])
+		}
+	case layers.IPProtocolTCP, layers.IPProtocolUDP, layers.IPProtocolSCTP:
+		session.OrigProtocol = proto.String()
+		if len(transport) >= 4 {
+			session.OrigSrcPort = binary.BigEndian.Uint16(transport[0:2])
+			session.OrigDstPort = binary.BigEndian.Uint16(transport[2:4])
+		}
+	default:
+		session.OrigProtocol = proto.String()
+	}
+}
+
+// skipIPv6Extensions skips the extension headers in front of the transport header of an embedded IPv6 packet
+// 被截断或非首个分片时返回空的传输层数据
+func skipIPv6Extensions(proto layers.IPProtocol, data []byte) (layers.IPProtocol, []byte) {
+	for i := 0; i < ipv6ExtensionMaxHops; i++ {
+		switch proto {
+		case layers.IPProtocolIPv6HopByHop, layers.IPProtocolIPv6Routing, layers.IPProtocolIPv6Destination:
+			if len(data) < 2 {
+				return proto, nil
+			}
+			n := (int(data[1]) + 1) * 8
+			if len(data) < n {
+				return layers.IPProtocol(data[0]), nil
+			}
+			proto, data = layers.IPProtocol(data[0]), data[n:]
+		case layers.IPProtocolIPv6Fragment:
+			if len(data) < 8 {
+				return proto, nil
+			}
+			next := layers.IPProtocol(data[0])
+			if binary.BigEndian.Uint16(data[2:4])&0xfff8 != 0 {
+				return next, nil
+			}
+			proto, data = next, data[8:]
+		default:
+			return proto, data
+		}
+	}
+	return proto, nil
+}
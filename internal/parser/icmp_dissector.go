@@ -0,0 +1,87 @@
+package parser
+
+import (
+	"fmt"
+
+	"sniffer/pkg/model"
+)
+
+func init() {
+	Register(icmpDissector{})
+}
+
+// icmpDissector records ICMP and ICMPv6 messages, 每个数据包一条会话
+// 开启配对时回显应答带有 RTT，超时差错带有探测包的跳数
+type icmpDissector struct{}
+
+func (icmpDissector) Name() string { return "ICMP" }
+
+func (icmpDissector) Table() model.TableType { return model.TableICMP }
+
+func (icmpDissector) Claims(pkt *model.Packet) bool {
+	return pkt.Protocol == "ICMP" || pkt.Protocol == "ICMPv6"
+}
+
+func (icmpDissector) Dissect(pkt *model.Packet, ctx *DissectContext) ([]*model.Session, error) {
+	session, err := ParseICMP(pkt)
+	if err != nil {
+		return nil, err
+	}
+	if ctx != nil && ctx.ICMPTracker != nil {
+		ctx.ICMPTracker.Track(pkt, session)
+	}
+	return []*model.Session{session}, nil
+}
+
+func (icmpDissector) StreamProtocol() *StreamProtocol { return nil }
+
+func (icmpDissector) AlertField(session *model.Session, field string) (string, bool) {
+	switch field {
+	case "src_ip":
+		return session.FiveTuple.SrcIP, true
+	case "dst_ip":
+		return session.FiveTuple.DstIP, true
+	case "icmp_type":
+		return fmt.Sprintf("%d", session.ICMPType), true
+	case "icmp_code":
+		return fmt.Sprintf("%d", session.ICMPCode), true
+	case "orig_src_ip":
+		return session.OrigSrcIP, true
+	case "orig_dst_ip":
+		return session.OrigDstIP, true
+	case "orig_protocol":
+		return session.OrigProtocol, true
+	case "orig_dst_port":
+		return fmt.Sprintf("%d", session.OrigDstPort), true
+	}
+	return "", false
+}
+
+// icmpSchema is the storage of ICMP messages (没有端口列)
+var icmpSchema = &Schema{
+	Table: "icmp_sessions",
+	Columns: concatColumns(
+		[]Column{timestampColumn},
+		tupleColumns(false),
+		[]Column{
+			column("icmp_type", "INTEGER", func(s *model.Session) *uint8 { return &s.ICMPType }),
+			column("icmp_code", "INTEGER", func(s *model.Session) *uint8 { return &s.ICMPCode }),
+			column("icmp_seq", "INTEGER", func(s *model.Session) *uint16 { return &s.ICMPSeq }),
+			column("icmp_id", "INTEGER", func(s *model.Session) *uint16 { return &s.ICMPID }),
+			column("latency_ms", "REAL", func(s *model.Session) *float64 { return &s.LatencyMs }),
+			column("orig_src_ip", "TEXT", func(s *model.Session) *string { return &s.OrigSrcIP }),
+			column("orig_dst_ip", "TEXT", func(s *model.Session) *string { return &s.OrigDstIP }),
+			column("orig_protocol", "TEXT", func(s *model.Session) *string { return &s.OrigProtocol }),
+			column("orig_src_port", "INTEGER", func(s *model.Session) *uint16 { return &s.OrigSrcPort }),
+			column("orig_dst_port", "INTEGER", func(s *model.Session) *uint16 { return &s.OrigDstPort }),
+			column("hop", "INTEGER", func(s *model.Session) *uint8 { return &s.Hop }),
+			payloadColumn,
+			ttlColumn,
+		},
+		processColumns(),
+	),
+	Indexes:       []string{"timestamp", "ttl"},
+	SearchColumns: []string{"src_ip", "dst_ip", "orig_src_ip", "orig_dst_ip"},
+}
+
+func (icmpDissector) Schema() *Schema { return icmpSchema }
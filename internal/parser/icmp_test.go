@@ -0,0 +1,412 @@
+package parser
+
+import (
+	"encoding/binary"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"sniffer/pkg/model"
+)
+
+// quoted returns the first n bytes of a serialized IP packet, 即 ICMP 差错报文中引用的原始报文
+func quoted(t *testing.T, n int, l ...gopacket.SerializableLayer) []byte {
+	t.Helper()
+	data := serialize(t, l...)
+	return data[:min(n, len(data))]
+}
+
+// ipv6Quote builds the IPv6 header of a quoted packet followed by ext (扩展头和传输层头部)
+func ipv6Quote(src, dst string, next layers.IPProtocol, ext ...byte) []byte {
+	hdr := make([]byte, ipv6HeaderLen)
+	hdr[0] = 0x60
+	binary.BigEndian.PutUint16(hdr[4:6], uint16(len(ext)))
+	hdr[6] = byte(next)
+	hdr[7] = 1
+	copy(hdr[8:24], net.ParseIP(src))
+	copy(hdr[24:40], net.ParseIP(dst))
+	return append(hdr, ext...)
+}
+
+func TestParseICMP(t *testing.T) {
+	type fields struct {
+		Type, Code                  uint8
+		ID, Seq                     uint16
+		OrigSrc, OrigDst, OrigProto string
+		OrigSrcPort, OrigDstPort    uint16
+	}
+	icmpv4 := func(typ, code uint8, id, seq uint16) *layers.ICMPv4 {
+		return &layers.ICMPv4{TypeCode: layers.CreateICMPv4TypeCode(typ, code), Id: id, Seq: seq}
+	}
+	icmpv6 := func(typ, code uint8) *layers.ICMPv6 {
+		return &layers.ICMPv6{TypeCode: layers.CreateICMPv6TypeCode(typ, code)}
+	}
+	udpProbe := func(t *testing.T) []byte {
+		return quoted(t, 28, ipv4("192.168.1.10", "8.8.8.8", layers.IPProtocolUDP), &layers.UDP{SrcPort: 45000, DstPort: 33435})
+	}
+
+	tests := []struct {
+		name string
+		data func(t *testing.T) []byte
+		want fields
+	}{
+		{
+			name: "echo request",
+			data: func(t *testing.T) []byte {
+				return serialize(t, ethernet(layers.EthernetTypeIPv4), ipv4("192.168.1.10", "8.8.8.8", layers.IPProtocolICMPv4),
+					icmpv4(icmpv4EchoRequest, 0, 0x1234, 7), gopacket.Payload(make([]byte, 56)))
+			},
+			want: fields{Type: 8, ID: 0x1234, Seq: 7},
+		},
+		{
+			name: "echo reply",
+			data: func(t *testing.T) []byte {
+				return serialize(t, ethernet(layers.EthernetTypeIPv4), ipv4("8.8.8.8", "192.168.1.10", layers.IPProtocolICMPv4),
+					icmpv4(icmpv4EchoReply, 0, 0x1234, 7), gopacket.Payload(make([]byte, 56)))
+			},
+			want: fields{Type: 0, ID: 0x1234, Seq: 7},
+		},
+		{
+			name: "port unreachable quoting a UDP probe",
+			data: func(t *testing.T) []byte {
+				return serialize(t, ethernet(layers.EthernetTypeIPv4), ipv4("8.8.8.8", "192.168.1.10", layers.IPProtocolICMPv4),
+					icmpv4(icmpv4Unreachable, 3, 0, 0), gopacket.Payload(udpProbe(t)))
+			},
+			want: fields{Type: 3, Code: 3, OrigSrc: "192.168.1.10", OrigDst: "8.8.8.8", OrigProto: "UDP", OrigSrcPort: 45000, OrigDstPort: 33435},
+		},
+		{
+			name: "time exceeded quoting an echo request",
+			data: func(t *testing.T) []byte {
+				probe := quoted(t, 28, ipv4("192.168.1.10", "8.8.8.8", layers.IPProtocolICMPv4), icmpv4(icmpv4EchoRequest, 0, 0x0001, 0x002a))
+				return serialize(t, ethernet(layers.EthernetTypeIPv4), ipv4("10.0.0.1", "192.168.1.10", layers.IPProtocolICMPv4),
+					icmpv4(icmpv4TimeExceeded, 0, 0, 0), gopacket.Payload(probe))
+			},
+			// 标识符和序号取自被引用的回显请求
+			want: fields{Type: 11, ID: 1, Seq: 42, OrigSrc: "192.168.1.10", OrigDst: "8.8.8.8", OrigProto: "ICMP", OrigSrcPort: 1, OrigDstPort: 42},
+		},
+		{
+			name: "redirect gateway is not an identifier",
+			data: func(t *testing.T) []byte {
+				orig := quoted(t, 28, ipv4("192.168.1.10", "203.0.113.5", layers.IPProtocolTCP), &layers.TCP{SrcPort: 50000, DstPort: 443})
+				return serialize(t, ethernet(layers.EthernetTypeIPv4), ipv4("192.168.1.1", "192.168.1.10", layers.IPProtocolICMPv4),
+					icmpv4(icmpv4Redirect, 1, 0xc0a8, 0x01fe), gopacket.Payload(orig)) // 网关 192.168.1.254
+			},
+			want: fields{Type: 5, Code: 1, OrigSrc: "192.168.1.10", OrigDst: "203.0.113.5", OrigProto: "TCP", OrigSrcPort: 50000, OrigDstPort: 443},
+		},
+		{
+			name: "time exceeded quoting a non-first fragment",
+			data: func(t *testing.T) []byte {
+				ip := ipv4("192.168.1.10", "8.8.8.8", layers.IPProtocolUDP)
+				ip.FragOffset = 185
+				orig := quoted(t, 28, ip, gopacket.Payload(make([]byte, 8)))
+				return serialize(t, ethernet(layers.EthernetTypeIPv4), ipv4("10.0.0.1", "192.168.1.10", layers.IPProtocolICMPv4),
+					icmpv4(icmpv4TimeExceeded, 1, 0, 0), gopacket.Payload(orig))
+			},
+			want: fields{Type: 11, Code: 1, OrigSrc: "192.168.1.10", OrigDst: "8.8.8.8", OrigProto: "UDP"},
+		},
+		{
+			name: "ICMPv6 echo request",
+			data: func(t *testing.T) []byte {
+				return serialize(t, ethernet(layers.EthernetTypeIPv6), ipv6("2001:db8::10", "2001:db8::1", layers.IPProtocolICMPv6),
+					icmpv6(icmpv6EchoRequest, 0), &layers.ICMPv6Echo{Identifier: 0x0bad, SeqNumber: 3})
+			},
+			want: fields{Type: 128, ID: 0x0bad, Seq: 3},
+		},
+		{
+			name: "ICMPv6 time exceeded quoting UDP behind a hop-by-hop header",
+			data: func(t *testing.T) []byte {
+				orig := ipv6Quote("2001:db8::10", "2001:db8:ffff::1", layers.IPProtocolIPv6HopByHop,
+					byte(layers.IPProtocolUDP), 0, 1, 4, 0, 0, 0, 0, // Hop-by-Hop: PadN
+					0xaf, 0xc8, 0x82, 0x9b, 0, 8, 0, 0) // UDP 45000 -> 33435
+				return serialize(t, ethernet(layers.EthernetTypeIPv6), ipv6("2001:db8:1::1", "2001:db8::10", layers.IPProtocolICMPv6),
+					icmpv6(icmpv6TimeExceeded, 0), gopacket.Payload(append(make([]byte, 4), orig...)))
+			},
+			want: fields{Type: 3, OrigSrc: "2001:db8::10", OrigDst: "2001:db8:ffff::1", OrigProto: "UDP", OrigSrcPort: 45000, OrigDstPort: 33435},
+		},
+		{
+			name: "ICMPv6 packet too big quoting TCP",
+			data: func(t *testing.T) []byte {
+				orig := ipv6Quote("2001:db8::10", "2001:db8:ffff::1", layers.IPProtocolTCP, 0xc3, 0x50, 0x01, 0xbb, 0, 0, 0, 1)
+				return serialize(t, ethernet(layers.EthernetTypeIPv6), ipv6("2001:db8:1::1", "2001:db8::10", layers.IPProtocolICMPv6),
+					icmpv6(icmpv6PacketTooBig, 0), gopacket.Payload(append([]byte{0, 0, 0x05, 0x00}, orig...))) // MTU 1280
+			},
+			want: fields{Type: 2, OrigSrc: "2001:db8::10", OrigDst: "2001:db8:ffff::1", OrigProto: "TCP", OrigSrcPort: 50000, OrigDstPort: 443},
+		},
+		{
+			name: "ICMPv6 unreachable quoting a non-first fragment",
+			data: func(t *testing.T) []byte {
+				orig := ipv6Quote("2001:db8::10", "2001:db8:ffff::1", layers.IPProtocolIPv6Fragment,
+					byte(layers.IPProtocolUDP), 0, 0x05, 0xa8, 0, 0, 0, 1, // offset 181
+					0xaf, 0xc8, 0x82, 0x9b)
+				return serialize(t, ethernet(layers.EthernetTypeIPv6), ipv6("2001:db8:ffff::1", "2001:db8::10", layers.IPProtocolICMPv6),
+					icmpv6(icmpv6Unreachable, 4), gopacket.Payload(append(make([]byte, 4), orig...)))
+			},
+			want: fields{Type: 1, Code: 4, OrigSrc: "2001:db8::10", OrigDst: "2001:db8:ffff::1", OrigProto: "UDP"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pkt, err := ParsePacket(tt.data(t), time.Unix(1700000000, 0), int(layers.LinkTypeEthernet))
+			if err != nil {
+				t.Fatalf("ParsePacket: %v", err)
+			}
+			s, err := ParseICMP(pkt)
+			if err != nil {
+				t.Fatalf("ParseICMP: %v", err)
+			}
+			got := fields{s.ICMPType, s.ICMPCode, s.ICMPID, s.ICMPSeq, s.OrigSrcIP, s.OrigDstIP, s.OrigProtocol, s.OrigSrcPort, s.OrigDstPort}
+			if got != tt.want {
+				t.Errorf("got  %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// icmpEvent is an ICMP message or probe fed to the tracker
+type icmpEvent struct {
+	at       time.Duration // 相对第一个报文的时间
+	src, dst string
+	typ      uint8
+	id, seq  uint16
+	ttl      uint8
+	probe    *model.Packet  // 非 nil 时为 TCP/UDP 探测包
+	orig     *model.Session // 差错报文引用的原始报文，只使用 Orig 开头的字段
+}
+
+// track feeds the events to the tracker and returns the ICMP sessions
+func track(tr *ICMPTracker, events []icmpEvent) []*model.Session {
+	start := time.Unix(1700000000, 0)
+	var sessions []*model.Session
+	for _, ev := range events {
+		ts := start.Add(ev.at)
+		if ev.probe != nil {
+			ev.probe.Timestamp = ts
+			tr.Probe(ev.probe)
+			continue
+		}
+		pkt := &model.Packet{Timestamp: ts, Protocol: "ICMP", SrcIP: ev.src, DstIP: ev.dst, IPTTL: ev.ttl}
+		session := &model.Session{
+			Timestamp: ts,
+			FiveTuple: model.FiveTuple{SrcIP: ev.src, DstIP: ev.dst, Protocol: "ICMP"},
+			Type:      "ICMP",
+			ICMPType:  ev.typ,
+			ICMPID:    ev.id,
+			ICMPSeq:   ev.seq,
+		}
+		if ev.orig != nil {
+			session.OrigSrcIP, session.OrigDstIP, session.OrigProtocol = ev.orig.OrigSrcIP, ev.orig.OrigDstIP, ev.orig.OrigProtocol
+			session.OrigSrcPort, session.OrigDstPort = ev.orig.OrigSrcPort, ev.orig.OrigDstPort
+		}
+		tr.Track(pkt, session)
+		sessions = append(sessions, session)
+	}
+	return sessions
+}
+
+func TestICMPTrackerEcho(t *testing.T) {
+	const host, dst = "192.168.1.10", "8.8.8.8"
+	ms := time.Millisecond
+	request := func(at time.Duration, seq uint16) icmpEvent {
+		return icmpEvent{at: at, src: host, dst: dst, typ: icmpv4EchoRequest, id: 1, seq: seq, ttl: 64}
+	}
+	reply := func(at time.Duration, seq uint16) icmpEvent {
+		return icmpEvent{at: at, src: dst, dst: host, typ: icmpv4EchoReply, id: 1, seq: seq, ttl: 118}
+	}
+	unreachable := func(at time.Duration, seq uint16) icmpEvent {
+		return icmpEvent{at: at, src: "192.168.1.1", dst: host, typ: icmpv4Unreachable, id: 1, seq: seq, ttl: 64,
+			orig: &model.Session{OrigSrcIP: host, OrigDstIP: dst, OrigProtocol: "ICMP", OrigSrcPort: 1, OrigDstPort: seq}}
+	}
+
+	type stat struct {
+		Sent, Received, Lost int64
+		Min, Avg, Max, Last  float64
+	}
+	tests := []struct {
+		name   string
+		opts   ICMPTrackerOptions
+		events []icmpEvent
+		rtts   []float64 // 每个 ICMP 会话的 LatencyMs
+		want   stat
+	}{
+		{
+			name:   "replies paired by sequence",
+			opts:   ICMPTrackerOptions{Timeout: 5 * time.Second},
+			events: []icmpEvent{request(0, 1), request(ms, 2), reply(30*ms, 2), reply(40*ms, 1)},
+			rtts:   []float64{0, 0, 29, 40},
+			want:   stat{Sent: 2, Received: 2, Min: 29, Avg: 34.5, Max: 40, Last: 40},
+		},
+		{
+			name:   "duplicate request counted once",
+			opts:   ICMPTrackerOptions{Timeout: 5 * time.Second},
+			events: []icmpEvent{request(0, 1), request(10*ms, 1), reply(20*ms, 1), reply(25*ms, 1)},
+			rtts:   []float64{0, 0, 20, 0},
+			want:   stat{Sent: 1, Received: 1, Min: 20, Avg: 20, Max: 20, Last: 20},
+		},
+		{
+			name:   "request times out",
+			opts:   ICMPTrackerOptions{Timeout: time.Second},
+			events: []icmpEvent{request(0, 1), request(time.Second, 2), reply(1010*ms, 2), reply(2*time.Second, 1)},
+			rtts:   []float64{0, 0, 10, 0},
+			want:   stat{Sent: 2, Received: 1, Lost: 1, Min: 10, Avg: 10, Max: 10, Last: 10},
+		},
+		{
+			name:   "request rejected by an unreachable error",
+			opts:   ICMPTrackerOptions{Timeout: 5 * time.Second},
+			events: []icmpEvent{request(0, 1), unreachable(5*ms, 1), reply(10*ms, 1)},
+			rtts:   []float64{0, 0, 0},
+			want:   stat{Sent: 1, Lost: 1},
+		},
+		{
+			name:   "oldest request dropped over the pending limit",
+			opts:   ICMPTrackerOptions{Timeout: 5 * time.Second, MaxPending: 2},
+			events: []icmpEvent{request(0, 1), request(ms, 2), request(2*ms, 3), reply(10*ms, 1), reply(12*ms, 3)},
+			rtts:   []float64{0, 0, 0, 0, 10},
+			want:   stat{Sent: 3, Received: 1, Lost: 1, Min: 10, Avg: 10, Max: 10, Last: 10},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := NewICMPTracker(tt.opts)
+			sessions := track(tr, tt.events)
+			var rtts []float64
+			for _, s := range sessions {
+				rtts = append(rtts, s.LatencyMs)
+			}
+			if !reflect.DeepEqual(rtts, tt.rtts) {
+				t.Errorf("RTTs = %v, want %v", rtts, tt.rtts)
+			}
+
+			stats := tr.PingStats()
+			if len(stats) != 1 || stats[0].Destination != dst {
+				t.Fatalf("stats = %+v", stats)
+			}
+			s := stats[0]
+			got := stat{s.Sent, s.Received, s.Lost, s.MinRTT, s.AvgRTT, s.MaxRTT, s.LastRTT}
+			if got != tt.want {
+				t.Errorf("stat = %+v, want %+v", got, tt.want)
+			}
+			if answered := s.Received + s.Lost; answered > 0 && s.LossRate != float64(s.Lost)*100/float64(answered) {
+				t.Errorf("LossRate = %v", s.LossRate)
+			}
+		})
+	}
+}
+
+func TestICMPTrackerMaxDestinations(t *testing.T) {
+	tr := NewICMPTracker(ICMPTrackerOptions{Timeout: time.Second, MaxDestinations: 2})
+	track(tr, []icmpEvent{
+		{at: 0, src: "192.168.1.10", dst: "10.0.0.1", typ: icmpv4EchoRequest, id: 1, seq: 1, ttl: 64},
+		{at: time.Millisecond, src: "192.168.1.10", dst: "10.0.0.2", typ: icmpv4EchoRequest, id: 1, seq: 1, ttl: 64},
+		{at: 2 * time.Millisecond, src: "192.168.1.10", dst: "10.0.0.3", typ: icmpv4EchoRequest, id: 1, seq: 1, ttl: 64},
+	})
+	var dsts []string
+	for _, s := range tr.PingStats() {
+		dsts = append(dsts, s.Destination)
+	}
+	if want := []string{"10.0.0.3", "10.0.0.2"}; !reflect.DeepEqual(dsts, want) {
+		t.Errorf("destinations = %v, want %v", dsts, want)
+	}
+}
+
+func TestICMPTrackerTraceRoute(t *testing.T) {
+	const host, dst = "192.168.1.10", "8.8.8.8"
+	ms := time.Millisecond
+	udpProbe := func(at time.Duration, ttl uint8, port uint16) icmpEvent {
+		return icmpEvent{at: at, probe: &model.Packet{Protocol: "UDP", SrcIP: host, DstIP: dst, SrcPort: 45000, DstPort: port, IPTTL: ttl}}
+	}
+	udpError := func(at time.Duration, router string, typ uint8, port uint16) icmpEvent {
+		return icmpEvent{at: at, src: router, dst: host, typ: typ, ttl: 250,
+			orig: &model.Session{OrigSrcIP: host, OrigDstIP: dst, OrigProtocol: "UDP", OrigSrcPort: 45000, OrigDstPort: port}}
+	}
+	echoProbe := func(at time.Duration, ttl uint8, seq uint16) icmpEvent {
+		return icmpEvent{at: at, src: host, dst: dst, typ: icmpv4EchoRequest, id: 1, seq: seq, ttl: ttl}
+	}
+
+	tests := []struct {
+		name     string
+		events   []icmpEvent
+		protocol string
+		reached  bool
+		hops     []model.RouteHop // 只比较 Hop、Router、RTT 和 Replies
+	}{
+		{
+			name: "UDP traceroute",
+			events: []icmpEvent{
+				udpProbe(0, 1, 33434), udpProbe(0, 2, 33435), udpProbe(0, 3, 33436),
+				udpError(2*ms, "192.168.1.1", icmpv4TimeExceeded, 33434),
+				udpError(9*ms, "100.64.0.1", icmpv4TimeExceeded, 33435),
+				udpError(20*ms, dst, icmpv4Unreachable, 33436),
+				udpProbe(30*ms, 2, 33437),
+				udpError(37*ms, "100.64.0.2", icmpv4TimeExceeded, 33437), // 等价多路径
+			},
+			protocol: "UDP",
+			reached:  true,
+			hops: []model.RouteHop{
+				{Hop: 1, Router: "192.168.1.1", RTT: 2, Replies: 1},
+				{Hop: 2, Router: "100.64.0.1", RTT: 9, Replies: 1},
+				{Hop: 2, Router: "100.64.0.2", RTT: 7, Replies: 1},
+				{Hop: 3, Router: dst, RTT: 20, Replies: 1},
+			},
+		},
+		{
+			name: "ICMP tracert",
+			events: []icmpEvent{
+				echoProbe(0, 1, 10), echoProbe(ms, 2, 11),
+				{at: 3 * ms, src: "192.168.1.1", dst: host, typ: icmpv4TimeExceeded, id: 1, seq: 10, ttl: 64,
+					orig: &model.Session{OrigSrcIP: host, OrigDstIP: dst, OrigProtocol: "ICMP", OrigSrcPort: 1, OrigDstPort: 10}},
+				{at: 13 * ms, src: dst, dst: host, typ: icmpv4EchoReply, id: 1, seq: 11, ttl: 118},
+			},
+			protocol: "ICMP",
+			reached:  true,
+			hops: []model.RouteHop{
+				{Hop: 1, Router: "192.168.1.1", RTT: 3, Replies: 1},
+				{Hop: 2, Router: dst, RTT: 12, Replies: 1},
+			},
+		},
+		{
+			name: "probe rejected by a firewall on the way",
+			events: []icmpEvent{
+				udpProbe(0, 1, 33434), udpProbe(0, 2, 33435),
+				udpError(2*ms, "192.168.1.1", icmpv4TimeExceeded, 33434),
+				udpError(5*ms, "100.64.0.1", icmpv4Unreachable, 33435),
+			},
+			protocol: "UDP",
+			hops: []model.RouteHop{
+				{Hop: 1, Router: "192.168.1.1", RTT: 2, Replies: 1},
+				{Hop: 2, Router: "100.64.0.1", RTT: 5, Replies: 1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := NewICMPTracker(ICMPTrackerOptions{Timeout: 5 * time.Second})
+			track(tr, tt.events)
+
+			routes := tr.TraceRoutes()
+			if len(routes) != 1 {
+				t.Fatalf("got %d routes, want 1", len(routes))
+			}
+			r := routes[0]
+			if r.Source != host || r.Destination != dst || r.Protocol != tt.protocol || r.Reached != tt.reached {
+				t.Errorf("route %s -> %s protocol %s reached %v", r.Source, r.Destination, r.Protocol, r.Reached)
+			}
+			var hops []model.RouteHop
+			for _, h := range r.Hops {
+				hops = append(hops, model.RouteHop{Hop: h.Hop, Router: h.Router, RTT: h.RTT, Replies: h.Replies})
+			}
+			if !reflect.DeepEqual(hops, tt.hops) {
+				t.Errorf("hops:\n got  %+v\n want %+v", hops, tt.hops)
+			}
+			// 低 TTL 的回显请求只作为探测包，不计入回显统计
+			if stats := tr.PingStats(); len(stats) != 0 {
+				t.Errorf("ping stats = %+v, want none", stats)
+			}
+		})
+	}
+}
@@ -0,0 +1,421 @@
+package parser
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"sniffer/pkg/model"
+)
+
+// Limits of the traceroute hop discovery
+const (
+	maxProbeTTL      = 30 // TTL 不超过此值的报文视为 traceroute 探测包（traceroute/tracert 默认最多 30 跳）
+	maxRoutersPerHop = 8  // 同一跳记录的路由器数上限（等价多路径）
+)
+
+// ICMPTrackerOptions represents the limits of the ICMP echo and probe tracker
+type ICMPTrackerOptions struct {
+	Timeout         time.Duration // 回显请求等待应答的超时，超时后记为丢包
+	MaxPending      int           // 等待应答的回显请求数（以及探测包数）上限，超出时最早的请求记为丢包
+	MaxDestinations int           // 回显统计和路由的目的地址数上限，超出时淘汰最久未出现的地址
+}
+
+// echoKey identifies an echo request: 发送方、目的地址、标识符和序号
+type echoKey struct {
+	client, server string
+	id, seq        uint16
+}
+
+// echoPending is an echo request waiting for its reply
+type echoPending struct {
+	key  echoKey
+	ts   time.Time
+	done bool // 已应答或已超时，等待从队列中移除
+}
+
+// probeKey identifies a traceroute probe by the header an ICMP error quotes back
+// TCP/UDP 为端口，ICMP 回显为标识符和序号
+type probeKey struct {
+	src, dst, proto string
+	srcPort         uint16
+	dstPort         uint16
+}
+
+// probePending is a low-TTL probe waiting for a router to answer
+type probePending struct {
+	key  probeKey
+	ttl  uint8
+	ts   time.Time
+	done bool
+}
+
+// pingStat accumulates the echo statistics of one destination
+type pingStat struct {
+	model.PingStat
+	rttSum float64
+}
+
+// routeKey identifies a traceroute: 探测的发送方和目的地址
+type routeKey struct {
+	src, dst string
+}
+
+// routeHopKey identifies a router at one hop of a traceroute
+type routeHopKey struct {
+	hop    uint8
+	router string
+}
+
+// traceRoute accumulates the hops of one traceroute
+type traceRoute struct {
+	model.TraceRoute
+	hops map[routeHopKey]*model.RouteHop
+}
+
+// ICMPTracker pairs ICMP echo requests with replies and low-TTL probes with the ICMP errors they caused
+// 回显按目的地址统计 RTT 和丢包；探测包（TTL <= 30 的 TCP/UDP 报文或 ICMP 回显请求）与
+// 路由器返回的超时差错配对得到每一跳，目的地址的端口不可达或回显应答表示到达。
+// 超时按数据包时间计算（离线回放同样适用）
+type ICMPTracker struct {
+	mu         sync.Mutex
+	opts       ICMPTrackerOptions
+	echoes     map[echoKey]*echoPending
+	echoQueue  []*echoPending // 按到达顺序排列，用于超时检查
+	probes     map[probeKey]*probePending
+	probeQueue []*probePending
+	pings      map[string]*pingStat
+	routes     map[routeKey]*traceRoute
+	lastSeen   time.Time
+}
+
+// NewICMPTracker creates an ICMP tracker with the given limits
+func NewICMPTracker(opts ICMPTrackerOptions) *ICMPTracker {
+	return &ICMPTracker{
+		opts:   opts,
+		echoes: make(map[echoKey]*echoPending),
+		probes: make(map[probeKey]*probePending),
+		pings:  make(map[string]*pingStat),
+		routes: make(map[routeKey]*traceRoute),
+	}
+}
+
+// isProbeTTL reports whether a packet TTL marks a traceroute probe
+func isProbeTTL(ttl uint8) bool {
+	return ttl > 0 && ttl <= maxProbeTTL
+}
+
+// Probe records a low-TTL TCP or UDP packet as a traceroute probe
+// ICMP 回显探测包在 Track 中记录
+func (t *ICMPTracker) Probe(pkt *model.Packet) {
+	if !isProbeTTL(pkt.IPTTL) || (pkt.Protocol != "TCP" && pkt.Protocol != "UDP") {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.advanceLocked(pkt.Timestamp)
+	t.addProbeLocked(probeKey{
+		src:     pkt.SrcIP,
+		dst:     pkt.DstIP,
+		proto:   pkt.Protocol,
+		srcPort: pkt.SrcPort,
+		dstPort: pkt.DstPort,
+	}, pkt.IPTTL, pkt.Timestamp)
+}
+
+// Track feeds an ICMP session parsed from pkt
+// 回显应答填入 RTT（LatencyMs），超时差错填入探测包的跳数（Hop）和 RTT
+func (t *ICMPTracker) Track(pkt *model.Packet, session *model.Session) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.advanceLocked(session.Timestamp)
+
+	v6 := pkt.Protocol == "ICMPv6"
+	src, dst := session.FiveTuple.SrcIP, session.FiveTuple.DstIP
+	switch {
+	case isICMPEchoRequest(v6, session.ICMPType):
+		if isProbeTTL(pkt.IPTTL) {
+			t.addProbeLocked(probeKey{src: src, dst: dst, proto: "ICMP", srcPort: session.ICMPID, dstPort: session.ICMPSeq},
+				pkt.IPTTL, session.Timestamp)
+			return
+		}
+		t.addEchoLocked(echoKey{client: src, server: dst, id: session.ICMPID, seq: session.ICMPSeq}, session.Timestamp)
+
+	case isICMPEchoReply(v6, session.ICMPType):
+		key := echoKey{client: dst, server: src, id: session.ICMPID, seq: session.ICMPSeq}
+		if p, ok := t.echoes[key]; ok {
+			delete(t.echoes, key)
+			p.done = true
+			rtt := float64(session.Timestamp.Sub(p.ts)) / float64(time.Millisecond)
+			session.LatencyMs = rtt
+			t.replyLocked(src, rtt, session.Timestamp)
+			return
+		}
+		// tracert 的探测包到达目的地址
+		probe := probeKey{src: dst, dst: src, proto: "ICMP", srcPort: session.ICMPID, dstPort: session.ICMPSeq}
+		t.answerProbeLocked(probe, session, true)
+
+	case isICMPError(v6, session.ICMPType) && session.OrigSrcIP != "":
+		// 回显请求被拒绝（目的不可达等），不再等待应答
+		if session.OrigProtocol == "ICMP" {
+			key := echoKey{client: session.OrigSrcIP, server: session.OrigDstIP, id: session.OrigSrcPort, seq: session.OrigDstPort}
+			if p, ok := t.echoes[key]; ok {
+				delete(t.echoes, key)
+				p.done = true
+				t.lostLocked(key.server)
+			}
+		}
+		// 超时差错来自中途的路由器；不可达差错来自目的地址（如 UDP 探测的端口不可达）时表示到达，
+		// 来自中途路由器时（如被防火墙拒绝）同样占据该跳
+		if !isICMPTimeExceeded(v6, session.ICMPType) && !isICMPUnreachable(v6, session.ICMPType) {
+			return
+		}
+		probe := probeKey{
+			src:     session.OrigSrcIP,
+			dst:     session.OrigDstIP,
+			proto:   session.OrigProtocol,
+			srcPort: session.OrigSrcPort,
+			dstPort: session.OrigDstPort,
+		}
+		t.answerProbeLocked(probe, session, src == session.OrigDstIP)
+	}
+}
+
+// advanceLocked moves the packet clock forward and expires the requests that waited longer than the timeout
+func (t *ICMPTracker) advanceLocked(ts time.Time) {
+	if ts.After(t.lastSeen) {
+		t.lastSeen = ts
+	}
+	t.expireLocked(t.lastSeen.Add(-t.opts.Timeout))
+}
+
+// addEchoLocked queues an echo request until its reply arrives
+func (t *ICMPTracker) addEchoLocked(key echoKey, ts time.Time) {
+	// 重复的请求只计一次
+	if _, ok := t.echoes[key]; ok {
+		return
+	}
+	for t.opts.MaxPending > 0 && len(t.echoes) >= t.opts.MaxPending && len(t.echoQueue) > 0 {
+		p := t.echoQueue[0]
+		t.echoQueue = t.echoQueue[1:]
+		if !p.done {
+			delete(t.echoes, p.key)
+			t.lostLocked(p.key.server)
+		}
+	}
+
+	p := &echoPending{key: key, ts: ts}
+	t.echoes[key] = p
+	t.echoQueue = append(t.echoQueue, p)
+
+	stat := t.pingLocked(key.server, ts)
+	stat.Sent++
+}
+
+// addProbeLocked remembers the TTL and send time of a probe
+// 同一探测包头部再次出现时（如 TCP 重传）以最近一次为准
+func (t *ICMPTracker) addProbeLocked(key probeKey, ttl uint8, ts time.Time) {
+	if p, ok := t.probes[key]; ok {
+		p.done = true
+	}
+	for t.opts.MaxPending > 0 && len(t.probes) >= t.opts.MaxPending && len(t.probeQueue) > 0 {
+		p := t.probeQueue[0]
+		t.probeQueue = t.probeQueue[1:]
+		if !p.done {
+			delete(t.probes, p.key)
+		}
+	}
+
+	p := &probePending{key: key, ttl: ttl, ts: ts}
+	t.probes[key] = p
+	t.probeQueue = append(t.probeQueue, p)
+}
+
+// answerProbeLocked records the router that answered a probe as a hop of the route
+func (t *ICMPTracker) answerProbeLocked(key probeKey, session *model.Session, reached bool) {
+	p, ok := t.probes[key]
+	if !ok {
+		return
+	}
+	delete(t.probes, key)
+	p.done = true
+
+	rtt := float64(session.Timestamp.Sub(p.ts)) / float64(time.Millisecond)
+	session.Hop = p.ttl
+	session.LatencyMs = rtt
+
+	route := t.routeLocked(routeKey{src: key.src, dst: key.dst}, session.Timestamp)
+	route.Protocol = key.proto
+	route.Reached = route.Reached || reached
+
+	hk := routeHopKey{hop: p.ttl, router: session.FiveTuple.SrcIP}
+	hop, ok := route.hops[hk]
+	if !ok {
+		if t.routersAtLocked(route, p.ttl) >= maxRoutersPerHop {
+			return
+		}
+		hop = &model.RouteHop{Hop: p.ttl, Router: hk.router}
+		route.hops[hk] = hop
+	}
+	hop.RTT = rtt
+	hop.Replies++
+	hop.LastSeen = session.Timestamp
+}
+
+// routersAtLocked returns the number of routers recorded at one hop of a route
+func (t *ICMPTracker) routersAtLocked(route *traceRoute, hop uint8) int {
+	n := 0
+	for k := range route.hops {
+		if k.hop == hop {
+			n++
+		}
+	}
+	return n
+}
+
+// replyLocked adds an answered echo to the statistics of a destination
+func (t *ICMPTracker) replyLocked(dst string, rtt float64, ts time.Time) {
+	stat := t.pingLocked(dst, ts)
+	if stat.Received == 0 || rtt < stat.MinRTT {
+		stat.MinRTT = rtt
+	}
+	if rtt > stat.MaxRTT {
+		stat.MaxRTT = rtt
+	}
+	stat.Received++
+	stat.rttSum += rtt
+	stat.AvgRTT = stat.rttSum / float64(stat.Received)
+	stat.LastRTT = rtt
+}
+
+// lostLocked counts an unanswered echo; 统计已被淘汰的目的地址不再记录
+func (t *ICMPTracker) lostLocked(dst string) {
+	if stat, ok := t.pings[dst]; ok {
+		stat.Lost++
+	}
+}
+
+// pingLocked returns the statistics of a destination, creating them at ts
+func (t *ICMPTracker) pingLocked(dst string, ts time.Time) *pingStat {
+	stat, ok := t.pings[dst]
+	if !ok {
+		if t.opts.MaxDestinations > 0 && len(t.pings) >= t.opts.MaxDestinations {
+			var oldest *pingStat
+			for _, s := range t.pings {
+				if oldest == nil || s.LastSeen.Before(oldest.LastSeen) {
+					oldest = s
+				}
+			}
+			delete(t.pings, oldest.Destination)
+		}
+		stat = &pingStat{PingStat: model.PingStat{Destination: dst, FirstSeen: ts}}
+		t.pings[dst] = stat
+	}
+	stat.LastSeen = ts
+	return stat
+}
+
+// routeLocked returns the route from src to dst, creating it if needed
+func (t *ICMPTracker) routeLocked(key routeKey, ts time.Time) *traceRoute {
+	route, ok := t.routes[key]
+	if !ok {
+		if t.opts.MaxDestinations > 0 && len(t.routes) >= t.opts.MaxDestinations {
+			var oldest *traceRoute
+			var oldestKey routeKey
+			for k, r := range t.routes {
+				if oldest == nil || r.LastSeen.Before(oldest.LastSeen) {
+					oldest, oldestKey = r, k
+				}
+			}
+			delete(t.routes, oldestKey)
+		}
+		route = &traceRoute{
+			TraceRoute: model.TraceRoute{Source: key.src, Destination: key.dst},
+			hops:       make(map[routeHopKey]*model.RouteHop),
+		}
+		t.routes[key] = route
+	}
+	route.LastSeen = ts
+	return route
+}
+
+// expireLocked drops the requests and probes sent before cutoff; 未应答的回显请求记为丢包
+func (t *ICMPTracker) expireLocked(cutoff time.Time) {
+	for len(t.echoQueue) > 0 {
+		p := t.echoQueue[0]
+		if !p.done && !p.ts.Before(cutoff) {
+			break
+		}
+		t.echoQueue = t.echoQueue[1:]
+		if !p.done {
+			delete(t.echoes, p.key)
+			t.lostLocked(p.key.server)
+		}
+	}
+	for len(t.probeQueue) > 0 {
+		p := t.probeQueue[0]
+		if !p.done && !p.ts.Before(cutoff) {
+			break
+		}
+		t.probeQueue = t.probeQueue[1:]
+		if !p.done {
+			delete(t.probes, p.key)
+		}
+	}
+}
+
+// PingStats returns the echo statistics per destination, 最近出现的目的地址在前
+func (t *ICMPTracker) PingStats() []model.PingStat {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.lastSeen.IsZero() {
+		t.expireLocked(t.lastSeen.Add(-t.opts.Timeout))
+	}
+	stats := make([]model.PingStat, 0, len(t.pings))
+	for _, s := range t.pings {
+		stat := s.PingStat
+		if answered := stat.Received + stat.Lost; answered > 0 {
+			stat.LossRate = float64(stat.Lost) * 100 / float64(answered)
+		}
+		stats = append(stats, stat)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if !stats[i].LastSeen.Equal(stats[j].LastSeen) {
+			return stats[i].LastSeen.After(stats[j].LastSeen)
+		}
+		return stats[i].Destination < stats[j].Destination
+	})
+	return stats
+}
+
+// TraceRoutes returns the discovered routes, 最近更新的路由在前，每条路由的跳按跳数排序
+func (t *ICMPTracker) TraceRoutes() []model.TraceRoute {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	routes := make([]model.TraceRoute, 0, len(t.routes))
+	for _, r := range t.routes {
+		route := r.TraceRoute
+		route.Hops = make([]model.RouteHop, 0, len(r.hops))
+		for _, hop := range r.hops {
+			route.Hops = append(route.Hops, *hop)
+		}
+		sort.Slice(route.Hops, func(i, j int) bool {
+			if route.Hops[i].Hop != route.Hops[j].Hop {
+				return route.Hops[i].Hop < route.Hops[j].Hop
+			}
+			return route.Hops[i].Router < route.Hops[j].Router
+		})
+		routes = append(routes, route)
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if !routes[i].LastSeen.Equal(routes[j].LastSeen) {
+			return routes[i].LastSeen.After(routes[j].LastSeen)
+		}
+		return routes[i].Destination < routes[j].Destination
+	})
+	return routes
+}
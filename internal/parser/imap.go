@@ -0,0 +1,161 @@
+package parser
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"sniffer/pkg/model"
+)
+
+// isIMAPPort reports whether port is the IMAP port
+func isIMAPPort(port uint16) bool {
+	return port == 143
+}
+
+// imapConn parses an IMAP connection
+// 带标签的命令与同标签的 OK/NO/BAD 应答配对，每个命令一条记录；未标记的应答（"*"）不记录
+type imapConn struct {
+	lineSession
+	auth     *saslAuth
+	authWait bool // 服务器发出 "+" 后，下一行为客户端的 SASL 响应
+}
+
+// newIMAPParsers creates the IMAP parsers of both directions of a connection
+func newIMAPParsers(client model.FiveTuple, maxBuffer int) (StreamParser, StreamParser) {
+	return newLineParsers(&imapConn{lineSession: lineSession{proto: "IMAP", client: client}}, maxBuffer)
+}
+
+// literal reads the literal announced by a trailing {n} or {n+} (RFC 7888)
+// 字面量并入逻辑行，超过 maxLiteralKeep 的部分（如 APPEND、FETCH 的邮件内容）被丢弃
+func (c *imapConn) literal(line string, client bool) (int, bool) {
+	if !strings.HasSuffix(line, "}") {
+		return 0, false
+	}
+	start := strings.LastIndexByte(line, '{')
+	if start < 0 {
+		return 0, false
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(line[start+1:len(line)-1], "+"))
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+func (c *imapConn) clientLine(line string, ts time.Time) []*model.Session {
+	size := len(line) + 2
+	if c.authWait {
+		c.authWait = false
+		if c.auth != nil {
+			c.auth.response(line)
+			c.auth.session.PayloadSize += size
+		}
+		return nil
+	}
+
+	// tag SP command [SP arguments]；IDLE 以 DONE 结束
+	tag, rest, ok := strings.Cut(line, " ")
+	if !ok || strings.EqualFold(line, "DONE") {
+		return nil
+	}
+	verb, arg := splitCommand(rest)
+	if verb == "UID" {
+		sub, subArg := splitCommand(arg)
+		verb, arg = verb+" "+sub, subArg
+	}
+
+	session := c.record(verb, arg, ts, size)
+	switch verb {
+	case "LOGIN":
+		user, _ := imapString(arg)
+		session.Argument = user + " " + maskedPassword
+		session.Username = user
+		session.CleartextAuth = true
+	case "AUTHENTICATE":
+		mech, initial, _ := strings.Cut(arg, " ")
+		c.auth = newSASLAuth(session, mech, strings.TrimSpace(initial))
+	}
+	return c.push(&lineCommand{verb: verb, tag: tag, session: session}, nil)
+}
+
+func (c *imapConn) serverLine(line string, ts time.Time) []*model.Session {
+	if line == "+" || strings.HasPrefix(line, "+ ") {
+		c.authWait = c.auth != nil
+		return nil
+	}
+
+	tag, rest, ok := strings.Cut(line, " ")
+	if !ok || tag == "*" {
+		return nil
+	}
+	status, text, _ := strings.Cut(rest, " ")
+	status = strings.ToUpper(status)
+	if status != "OK" && status != "NO" && status != "BAD" {
+		return nil
+	}
+
+	cmd := c.popTag(tag)
+	if cmd == nil {
+		return nil
+	}
+	switch cmd.verb {
+	case "AUTHENTICATE":
+		c.auth, c.authWait = nil, false
+	case "STARTTLS":
+		c.tls = status == "OK"
+	}
+	setReply(cmd.session, status, text, ts, len(line)+2)
+	return []*model.Session{cmd.session}
+}
+
+func (c *imapConn) close(ts time.Time) []*model.Session {
+	return c.flush(nil)
+}
+
+// popTag removes the command with the given tag, nil if none
+func (c *imapConn) popTag(tag string) *lineCommand {
+	for i, cmd := range c.pending {
+		if cmd.tag == tag {
+			c.pending = append(c.pending[:i], c.pending[i+1:]...)
+			return cmd
+		}
+	}
+	return nil
+}
+
+// imapString reads an IMAP astring (atom, quoted string or literal) from the front of s
+// 字面量 {n} 的内容已由 lineStream 并入其后
+func imapString(s string) (string, string) {
+	s = strings.TrimLeft(s, " ")
+	switch {
+	case strings.HasPrefix(s, "\""):
+		var b strings.Builder
+		for i := 1; i < len(s); i++ {
+			switch s[i] {
+			case '\\':
+				if i+1 < len(s) {
+					i++
+					b.WriteByte(s[i])
+				}
+			case '"':
+				return printableString([]byte(b.String())), s[i+1:]
+			default:
+				b.WriteByte(s[i])
+			}
+		}
+		return printableString([]byte(b.String())), ""
+
+	case strings.HasPrefix(s, "{"):
+		end := strings.IndexByte(s, '}')
+		if end > 0 {
+			if n, err := strconv.Atoi(strings.TrimSuffix(s[1:end], "+")); err == nil && n >= 0 {
+				s = s[end+1:]
+				n = min(n, len(s))
+				return printableString([]byte(s[:n])), s[n:]
+			}
+		}
+	}
+	atom, rest, _ := strings.Cut(s, " ")
+	return printableString([]byte(atom)), rest
+}
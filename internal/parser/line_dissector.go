@@ -0,0 +1,171 @@
+package parser
+
+import (
+	"fmt"
+
+	"sniffer/pkg/model"
+)
+
+func init() {
+	Register(&lineDissector{name: "SMTP", table: model.TableSMTP,
+		stream: StreamProtocol{IsServerPort: isSMTPPort, NewParsers: newSMTPParsers}, schema: smtpSchema,
+		fields: map[string]func(*model.Session) string{
+			"mail_from":   func(s *model.Session) string { return s.MailFrom },
+			"rcpt_to":     func(s *model.Session) string { return s.RcptTo },
+			"subject":     func(s *model.Session) string { return s.Subject },
+			"attachments": func(s *model.Session) string { return s.Attachments },
+		}})
+	Register(&lineDissector{name: "POP3", table: model.TablePOP3,
+		stream: StreamProtocol{IsServerPort: isPOP3Port, NewParsers: newPOP3Parsers}, schema: pop3Schema,
+		fields: map[string]func(*model.Session) string{
+			"subject":     func(s *model.Session) string { return s.Subject },
+			"attachments": func(s *model.Session) string { return s.Attachments },
+		}})
+	Register(&lineDissector{name: "IMAP", table: model.TableIMAP,
+		stream: StreamProtocol{IsServerPort: isIMAPPort, NewParsers: newIMAPParsers}, schema: imapSchema})
+	Register(&lineDissector{name: "FTP", table: model.TableFTP,
+		stream: StreamProtocol{IsServerPort: isFTPPort, NewParsers: newFTPParsers}, schema: ftpSchema,
+		fields: map[string]func(*model.Session) string{
+			"file_name": func(s *model.Session) string { return s.FileName },
+			"file_size": func(s *model.Session) string { return fmt.Sprintf("%d", s.FileSize) },
+		}})
+}
+
+// lineDissector describes a line based cleartext protocol (SMTP/POP3/IMAP/FTP)
+// 只能从重组的 TCP 字节流中解析，未开启 TCP 重组时不产生记录
+type lineDissector struct {
+	name   string
+	table  model.TableType
+	stream StreamProtocol
+	schema *Schema
+	fields map[string]func(*model.Session) string // 协议特有的告警字段
+}
+
+func (d *lineDissector) Name() string { return d.name }
+
+func (d *lineDissector) Table() model.TableType { return d.table }
+
+func (d *lineDissector) Claims(pkt *model.Packet) bool {
+	return pkt.Protocol == "TCP" && (d.stream.IsServerPort(pkt.SrcPort) || d.stream.IsServerPort(pkt.DstPort) || pkt.AppProtocol == d.name)
+}
+
+// Dissect returns nothing: 会话只由 StreamProtocol 的解析器从重组的字节流产生
+func (d *lineDissector) Dissect(pkt *model.Packet, ctx *DissectContext) ([]*model.Session, error) {
+	return nil, nil
+}
+
+func (d *lineDissector) StreamProtocol() *StreamProtocol { return &d.stream }
+
+func (d *lineDissector) AlertField(session *model.Session, field string) (string, bool) {
+	switch field {
+	case "command":
+		return session.Command, true
+	case "argument":
+		return session.Argument, true
+	case "reply_code":
+		return session.ReplyCode, true
+	case "username":
+		return session.Username, true
+	case "cleartext_auth":
+		return fmt.Sprintf("%t", session.CleartextAuth), true
+	case "src_ip":
+		return session.FiveTuple.SrcIP, true
+	case "dst_ip":
+		return session.FiveTuple.DstIP, true
+	}
+	if value, ok := d.fields[field]; ok {
+		return value(session), true
+	}
+	return "", false
+}
+
+func (d *lineDissector) Schema() *Schema { return d.schema }
+
+// lineColumns are the columns shared by the tables of the line based protocols
+func lineColumns() []Column {
+	return []Column{
+		column("command", "TEXT", func(s *model.Session) *string { return &s.Command }),
+		column("argument", "TEXT", func(s *model.Session) *string { return &s.Argument }),
+		column("reply_code", "TEXT", func(s *model.Session) *string { return &s.ReplyCode }),
+		column("reply_text", "TEXT", func(s *model.Session) *string { return &s.ReplyText }),
+		column("username", "TEXT", func(s *model.Session) *string { return &s.Username }),
+		column("cleartext_auth", "INTEGER", func(s *model.Session) *bool { return &s.CleartextAuth }),
+		column("latency_ms", "REAL", func(s *model.Session) *float64 { return &s.LatencyMs }),
+	}
+}
+
+// smtpSchema is the storage of SMTP commands and mail transactions
+var smtpSchema = &Schema{
+	Table: "smtp_sessions",
+	Columns: concatColumns(
+		[]Column{timestampColumn},
+		tupleColumns(true),
+		lineColumns(),
+		[]Column{
+			column("mail_from", "TEXT", func(s *model.Session) *string { return &s.MailFrom }),
+			column("rcpt_to", "TEXT", func(s *model.Session) *string { return &s.RcptTo }),
+			column("subject", "TEXT", func(s *model.Session) *string { return &s.Subject }),
+			column("attachments", "TEXT", func(s *model.Session) *string { return &s.Attachments }),
+			payloadColumn,
+			ttlColumn,
+		},
+		processColumns(),
+	),
+	Indexes:       []string{"timestamp", "ttl", "username", "mail_from"},
+	SearchColumns: []string{"src_ip", "dst_ip", "command", "username", "mail_from", "rcpt_to", "subject", "attachments"},
+}
+
+// pop3Schema is the storage of POP3 commands; RETR/TOP 记录邮件主题和附件
+var pop3Schema = &Schema{
+	Table: "pop3_sessions",
+	Columns: concatColumns(
+		[]Column{timestampColumn},
+		tupleColumns(true),
+		lineColumns(),
+		[]Column{
+			column("subject", "TEXT", func(s *model.Session) *string { return &s.Subject }),
+			column("attachments", "TEXT", func(s *model.Session) *string { return &s.Attachments }),
+			payloadColumn,
+			ttlColumn,
+		},
+		processColumns(),
+	),
+	Indexes:       []string{"timestamp", "ttl", "username"},
+	SearchColumns: []string{"src_ip", "dst_ip", "command", "username", "subject", "attachments"},
+}
+
+// imapSchema is the storage of tagged IMAP commands
+var imapSchema = &Schema{
+	Table: "imap_sessions",
+	Columns: concatColumns(
+		[]Column{timestampColumn},
+		tupleColumns(true),
+		lineColumns(),
+		[]Column{
+			payloadColumn,
+			ttlColumn,
+		},
+		processColumns(),
+	),
+	Indexes:       []string{"timestamp", "ttl", "username"},
+	SearchColumns: []string{"src_ip", "dst_ip", "command", "argument", "username"},
+}
+
+// ftpSchema is the storage of FTP control commands
+var ftpSchema = &Schema{
+	Table: "ftp_sessions",
+	Columns: concatColumns(
+		[]Column{timestampColumn},
+		tupleColumns(true),
+		lineColumns(),
+		[]Column{
+			column("file_name", "TEXT", func(s *model.Session) *string { return &s.FileName }),
+			column("file_size", "INTEGER", func(s *model.Session) *int64 { return &s.FileSize }),
+			payloadColumn,
+			ttlColumn,
+		},
+		processColumns(),
+	),
+	Indexes:       []string{"timestamp", "ttl", "username", "file_name"},
+	SearchColumns: []string{"src_ip", "dst_ip", "command", "argument", "username", "file_name"},
+}
@@ -0,0 +1,306 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"sniffer/pkg/model"
+)
+
+// Limits of line based protocol parsing
+const (
+	maxPendingCommands = 64   // 每个连接等待应答的命令数
+	maxLineArgument    = 512  // 记录的命令参数和应答文本长度
+	maxLiteralKeep     = 1024 // 并入逻辑行的 IMAP 字面量长度
+)
+
+// lineHandler handles the lines of a connection of a line based protocol (SMTP/POP3/IMAP/FTP)
+// 两个方向的行按到达顺序交给同一个 handler，由其完成命令与应答的配对
+type lineHandler interface {
+	clientLine(line string, ts time.Time) []*model.Session
+	serverLine(line string, ts time.Time) []*model.Session
+	// literal returns the length of the literal announced by a line (IMAP {n}, SMTP BDAT n),
+	// keep 为 true 时字面量并入逻辑行，否则跳过
+	literal(line string, client bool) (n int, keep bool)
+	// close returns the records still waiting for their replies
+	close(ts time.Time) []*model.Session
+	// encrypted reports whether the connection was upgraded to TLS, 之后的数据不再解析
+	encrypted() bool
+}
+
+// lineConn is the state shared by both directions of a line based connection
+type lineConn struct {
+	handler lineHandler
+	closed  int // 已关闭的方向数
+}
+
+// lineStream splits one direction of a reassembled connection into CRLF terminated lines
+type lineStream struct {
+	conn      *lineConn
+	client    bool
+	maxBuffer int
+
+	buf     []byte // 不完整的行
+	pending []byte // 含字面量的逻辑行已读取的部分
+	literal int    // 剩余的字面量字节数
+	keep    bool   // 字面量是否并入逻辑行
+	resync  bool   // 数据丢失后丢弃到下一个换行
+}
+
+// newLineParsers creates the parsers of both directions of a line based connection
+func newLineParsers(handler lineHandler, maxBuffer int) (StreamParser, StreamParser) {
+	conn := &lineConn{handler: handler}
+	return &lineStream{conn: conn, client: true, maxBuffer: maxBuffer},
+		&lineStream{conn: conn, maxBuffer: maxBuffer}
+}
+
+// Feed parses the next in-order bytes of the stream
+func (s *lineStream) Feed(data []byte, skip int, ts time.Time) ([]*model.Session, error) {
+	handler := s.conn.handler
+	if handler.encrypted() {
+		return nil, nil
+	}
+	if skip > 0 {
+		// 跳过的字面量之内的缺失不影响行边界
+		if s.literal > 0 && !s.keep && len(s.buf) == 0 && skip <= s.literal {
+			s.literal -= skip
+		} else {
+			s.buf, s.pending = s.buf[:0], nil
+			s.literal = 0
+			s.resync = true
+		}
+	}
+
+	var out []*model.Session
+	for len(data) > 0 && !handler.encrypted() {
+		if s.literal > 0 {
+			n := min(s.literal, len(data))
+			if s.keep {
+				if room := maxLiteralKeep - len(s.pending); room > 0 {
+					s.pending = append(s.pending, data[:min(room, n)]...)
+				}
+			}
+			s.literal -= n
+			data = data[n:]
+			continue
+		}
+
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			s.buf = append(s.buf, data...)
+			if len(s.buf)+len(s.pending) > s.maxBuffer {
+				s.buf, s.pending = s.buf[:0], nil
+				s.resync = true
+				return out, ErrStreamOverflow
+			}
+			return out, nil
+		}
+		line := data[:i]
+		if len(s.buf) > 0 {
+			s.buf = append(s.buf, line...)
+			line = s.buf
+		}
+		data = data[i+1:]
+		out = s.line(bytes.TrimSuffix(line, []byte("\r")), ts, out)
+		s.buf = s.buf[:0]
+	}
+	return out, nil
+}
+
+// line handles a complete line
+func (s *lineStream) line(line []byte, ts time.Time, out []*model.Session) []*model.Session {
+	if s.resync {
+		s.resync = false
+		return out
+	}
+
+	handler := s.conn.handler
+	if n, keep := handler.literal(string(line), s.client); n > 0 {
+		if keep {
+			s.pending = append(s.pending, line...)
+			s.literal, s.keep = n, true
+			return out
+		}
+		s.literal, s.keep = n, false
+	}
+	text := string(line)
+	if s.pending != nil {
+		text = string(append(s.pending, line...))
+		s.pending = nil
+	}
+
+	if s.client {
+		return append(out, handler.clientLine(text, ts)...)
+	}
+	return append(out, handler.serverLine(text, ts)...)
+}
+
+// Close returns the records still pending when the connection ends
+func (s *lineStream) Close(ts time.Time) []*model.Session {
+	s.buf, s.pending = nil, nil
+	s.conn.closed++
+	if s.conn.closed == 2 {
+		return s.conn.handler.close(ts)
+	}
+	return nil
+}
+
+// lineCommand is a command waiting for its final reply
+type lineCommand struct {
+	verb    string
+	tag     string         // IMAP 命令标签
+	session *model.Session // 等待应答的记录，为 nil 时只用于配对应答（SMTP 事务中的 MAIL/RCPT/DATA）
+	mail    *model.Session // SMTP 命令所属的邮件事务
+}
+
+// lineSession holds what the handlers of all line based protocols share
+// 命令按顺序排队，应答按 FIFO 配对（支持 SMTP PIPELINING）
+type lineSession struct {
+	proto   string
+	client  model.FiveTuple
+	pending []*lineCommand
+	tls     bool
+}
+
+// record creates the record of a client command
+func (b *lineSession) record(verb, arg string, ts time.Time, size int) *model.Session {
+	return &model.Session{
+		Timestamp:   ts,
+		FiveTuple:   b.client,
+		Type:        b.proto,
+		Command:     verb,
+		Argument:    truncateText(arg, maxLineArgument),
+		PayloadSize: size,
+		TTL:         ts.Add(7 * 24 * time.Hour),
+	}
+}
+
+// push queues a command waiting for its reply
+func (b *lineSession) push(cmd *lineCommand, out []*model.Session) []*model.Session {
+	b.pending = append(b.pending, cmd)
+
+	// 没有应答的命令过多时（如只抓到单向流量）输出最早的命令
+	if len(b.pending) > maxPendingCommands {
+		if old := b.pending[0]; old.session != nil {
+			out = append(out, old.session)
+		}
+		b.pending = b.pending[1:]
+	}
+	return out
+}
+
+// pop removes the oldest command waiting for a reply, nil if none
+func (b *lineSession) pop() *lineCommand {
+	if len(b.pending) == 0 {
+		return nil
+	}
+	cmd := b.pending[0]
+	b.pending = b.pending[1:]
+	return cmd
+}
+
+// peek returns the oldest command waiting for a reply, nil if none
+func (b *lineSession) peek() *lineCommand {
+	if len(b.pending) == 0 {
+		return nil
+	}
+	return b.pending[0]
+}
+
+// flush returns the records of all commands still waiting for their replies
+func (b *lineSession) flush(out []*model.Session) []*model.Session {
+	for _, cmd := range b.pending {
+		if cmd.session != nil {
+			out = append(out, cmd.session)
+		}
+	}
+	b.pending = nil
+	return out
+}
+
+func (b *lineSession) encrypted() bool { return b.tls }
+
+func (b *lineSession) literal(line string, client bool) (int, bool) { return 0, false }
+
+// setReply records the final reply of a command
+func setReply(session *model.Session, code, text string, ts time.Time, size int) {
+	session.ReplyCode = code
+	session.ReplyText = truncateText(text, maxLineArgument)
+	session.PayloadSize += size
+	if latency := ts.Sub(session.Timestamp); latency > 0 {
+		session.LatencyMs = float64(latency) / float64(time.Millisecond)
+	}
+}
+
+// splitCommand splits a command line into its upper-cased verb and its argument
+func splitCommand(line string) (string, string) {
+	verb, arg, _ := strings.Cut(line, " ")
+	return strings.ToUpper(verb), strings.TrimSpace(arg)
+}
+
+// truncateText limits s to n bytes without splitting a UTF-8 sequence
+func truncateText(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && s[n]&0xc0 == 0x80 {
+		n--
+	}
+	return s[:n]
+}
+
+// maskedPassword replaces passwords in recorded command arguments
+const maskedPassword = "****"
+
+// saslAuth follows a SASL exchange (SMTP/POP3 AUTH, IMAP AUTHENTICATE) to extract the user name
+// PLAIN 和 LOGIN 的凭据只经过 base64 编码，视为明文认证
+type saslAuth struct {
+	session *model.Session
+	mech    string
+	step    int // 已处理的客户端响应数
+}
+
+// newSASLAuth starts a SASL exchange; initial 为命令中携带的初始响应（SASL-IR）
+func newSASLAuth(session *model.Session, mech, initial string) *saslAuth {
+	a := &saslAuth{session: session, mech: strings.ToUpper(mech)}
+	session.Argument = a.mech
+	session.CleartextAuth = a.mech == "PLAIN" || a.mech == "LOGIN"
+	if initial != "" && initial != "=" {
+		a.response(initial)
+	}
+	return a
+}
+
+// response handles a client response of the exchange
+func (a *saslAuth) response(line string) {
+	a.step++
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(line))
+	if err != nil {
+		return
+	}
+	switch a.mech {
+	case "PLAIN":
+		// authzid NUL authcid NUL passwd
+		if parts := strings.Split(string(data), "\x00"); len(parts) == 3 {
+			a.session.Username = printableString([]byte(parts[1]))
+		}
+	case "LOGIN":
+		// 第一个响应为用户名，第二个为密码
+		if a.step == 1 {
+			a.session.Username = printableString(data)
+		}
+	case "CRAM-MD5":
+		if user, _, ok := strings.Cut(string(data), " "); ok {
+			a.session.Username = printableString([]byte(user))
+		}
+	case "XOAUTH2":
+		// user=...^Aauth=Bearer ...^A^A
+		for _, field := range strings.Split(string(data), "\x01") {
+			if user, ok := strings.CutPrefix(field, "user="); ok {
+				a.session.Username = printableString([]byte(user))
+			}
+		}
+	}
+}
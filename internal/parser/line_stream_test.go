@@ -0,0 +1,388 @@
+package parser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"sniffer/pkg/model"
+)
+
+// converse feeds a dialogue to the parsers of a connection and returns the records, 包括结束时输出的记录
+// 每行以 "C: " 或 "S: " 开头表示客户端或服务器发送，行尾自动加 CRLF
+func converse(t *testing.T, newParsers func(model.FiveTuple, int) (StreamParser, StreamParser), dialogue ...string) []*model.Session {
+	t.Helper()
+	client := model.FiveTuple{SrcIP: "10.0.0.1", DstIP: "10.0.0.2", SrcPort: 40000, DstPort: 25, Protocol: "TCP"}
+	toServer, toClient := newParsers(client, 64<<10)
+	ts := time.Unix(1700000000, 0)
+
+	var sessions []*model.Session
+	for _, line := range dialogue {
+		ts = ts.Add(10 * time.Millisecond)
+		p := toServer
+		if strings.HasPrefix(line, "S: ") {
+			p = toClient
+		} else if !strings.HasPrefix(line, "C: ") {
+			t.Fatalf("dialogue line %q has no direction", line)
+		}
+		out, err := p.Feed([]byte(line[3:]+"\r\n"), 0, ts)
+		if err != nil {
+			t.Fatalf("Feed(%q): %v", line, err)
+		}
+		sessions = append(sessions, out...)
+	}
+	sessions = append(sessions, toServer.Close(ts)...)
+	return append(sessions, toClient.Close(ts)...)
+}
+
+// lineRecord is what the credential tests compare of each record
+type lineRecord struct {
+	Command, Argument, Username string
+	Cleartext                   bool
+	Reply                       string
+}
+
+func lineRecords(sessions []*model.Session) []lineRecord {
+	var out []lineRecord
+	for _, s := range sessions {
+		out = append(out, lineRecord{s.Command, s.Argument, s.Username, s.CleartextAuth, s.ReplyCode})
+	}
+	return out
+}
+
+func TestLineProtocolCredentials(t *testing.T) {
+	tests := []struct {
+		name       string
+		newParsers func(model.FiveTuple, int) (StreamParser, StreamParser)
+		dialogue   []string
+		want       []lineRecord
+	}{
+		{
+			name:       "SMTP AUTH PLAIN with initial response",
+			newParsers: newSMTPParsers,
+			dialogue: []string{
+				"S: 220 mail.example.com ESMTP",
+				"C: EHLO client.example.com",
+				"S: 250-mail.example.com",
+				"S: 250-PIPELINING",
+				"S: 250 AUTH PLAIN LOGIN",
+				"C: AUTH PLAIN AGFsaWNlAHNlY3JldA==",
+				"S: 235 2.7.0 Authentication successful",
+			},
+			want: []lineRecord{
+				{"EHLO", "client.example.com", "", false, "250"},
+				{"AUTH", "PLAIN", "alice", true, "235"},
+			},
+		},
+		{
+			name:       "SMTP AUTH LOGIN",
+			newParsers: newSMTPParsers,
+			dialogue: []string{
+				"C: AUTH LOGIN",
+				"S: 334 VXNlcm5hbWU6",
+				"C: Ym9i",
+				"S: 334 UGFzc3dvcmQ6",
+				"C: cHc=",
+				"S: 535 5.7.8 Authentication credentials invalid",
+			},
+			want: []lineRecord{{"AUTH", "LOGIN", "bob", true, "535"}},
+		},
+		{
+			name:       "SMTP AUTH CRAM-MD5 (RFC 2195)",
+			newParsers: newSMTPParsers,
+			dialogue: []string{
+				"C: AUTH CRAM-MD5",
+				"S: 334 PDE4OTYuNjk3MTcwOTUyQHBvc3RvZmZpY2UucmVzdG9uLm1jaS5uZXQ+",
+				"C: dGltIGI5MTNhNjAyYzdlZGE3YTQ5NWI0ZTZlNzMzNGQzODkw",
+				"S: 235 Authentication successful",
+			},
+			want: []lineRecord{{"AUTH", "CRAM-MD5", "tim", false, "235"}},
+		},
+		{
+			name:       "SMTP AUTH without a reply",
+			newParsers: newSMTPParsers,
+			dialogue:   []string{"C: AUTH PLAIN AGFsaWNlAHNlY3JldA=="},
+			want:       []lineRecord{{"AUTH", "PLAIN", "alice", true, ""}},
+		},
+		{
+			name:       "SMTP STARTTLS",
+			newParsers: newSMTPParsers,
+			dialogue: []string{
+				"C: STARTTLS",
+				"S: 220 2.0.0 Ready to start TLS",
+				"C: \x16\x03\x01\x02\x00\x01\x00\x01\xfc\x03\x03",
+				"C: AUTH PLAIN AGFsaWNlAHNlY3JldA==",
+			},
+			want: []lineRecord{{"STARTTLS", "", "", false, "220"}},
+		},
+		{
+			name:       "POP3 USER and PASS",
+			newParsers: newPOP3Parsers,
+			dialogue: []string{
+				"S: +OK POP3 server ready",
+				"C: USER alice",
+				"S: +OK",
+				"C: PASS secret",
+				"S: +OK maildrop has 2 messages",
+			},
+			want: []lineRecord{
+				{"USER", "alice", "alice", false, "+OK"},
+				{"PASS", "****", "alice", true, "+OK"},
+			},
+		},
+		{
+			name:       "POP3 APOP (RFC 1939)",
+			newParsers: newPOP3Parsers,
+			dialogue: []string{
+				"C: APOP mrose c4c9334bac560ecc979e58001b3e22fb",
+				"S: +OK maildrop has 1 message (369 octets)",
+			},
+			want: []lineRecord{{"APOP", "mrose", "mrose", false, "+OK"}},
+		},
+		{
+			name:       "POP3 AUTH PLAIN",
+			newParsers: newPOP3Parsers,
+			dialogue: []string{
+				"C: AUTH PLAIN",
+				"S: + ",
+				"C: AGFsaWNlAHNlY3JldA==",
+				"S: +OK Logged in.",
+			},
+			want: []lineRecord{{"AUTH", "PLAIN", "alice", true, "+OK"}},
+		},
+		{
+			name:       "IMAP LOGIN with quoted password",
+			newParsers: newIMAPParsers,
+			dialogue: []string{
+				"S: * OK IMAP4rev1 Service Ready",
+				`C: a001 LOGIN alice "p@ss word"`,
+				"S: a001 OK LOGIN completed",
+			},
+			want: []lineRecord{{"LOGIN", "alice ****", "alice", true, "OK"}},
+		},
+		{
+			name:       "IMAP LOGIN with literals",
+			newParsers: newIMAPParsers,
+			dialogue: []string{
+				"C: a002 LOGIN {5}",
+				"S: + Ready for literal data",
+				"C: alice {6}",
+				"S: + Ready for literal data",
+				"C: secret",
+				"S: a002 NO [AUTHENTICATIONFAILED] Authentication failed.",
+			},
+			want: []lineRecord{{"LOGIN", "alice ****", "alice", true, "NO"}},
+		},
+		{
+			name:       "IMAP AUTHENTICATE XOAUTH2",
+			newParsers: newIMAPParsers,
+			dialogue: []string{
+				"C: a003 AUTHENTICATE XOAUTH2",
+				"S: +",
+				"C: dXNlcj1jYXJvbEBleGFtcGxlLmNvbQFhdXRoPUJlYXJlciB5YTI5LnRva2VuAQE=",
+				"S: a003 OK Success",
+			},
+			want: []lineRecord{{"AUTHENTICATE", "XOAUTH2", "carol@example.com", false, "OK"}},
+		},
+		{
+			name:       "IMAP replies matched by tag",
+			newParsers: newIMAPParsers,
+			dialogue: []string{
+				"C: a004 SELECT INBOX",
+				"C: a005 NOOP",
+				"S: * 18 EXISTS",
+				"S: a005 OK NOOP completed",
+				"S: a004 OK [READ-WRITE] SELECT completed",
+			},
+			want: []lineRecord{
+				{"NOOP", "", "", false, "OK"},
+				{"SELECT", "INBOX", "", false, "OK"},
+			},
+		},
+		{
+			name:       "FTP USER and PASS",
+			newParsers: newFTPParsers,
+			dialogue: []string{
+				"S: 220 (vsFTPd 3.0.3)",
+				"C: USER alice",
+				"S: 331 Please specify the password.",
+				"C: PASS secret",
+				"S: 230 Login successful.",
+			},
+			want: []lineRecord{
+				{"USER", "alice", "alice", false, "331"},
+				{"PASS", "****", "alice", true, "230"},
+			},
+		},
+		{
+			name:       "FTP anonymous login",
+			newParsers: newFTPParsers,
+			dialogue: []string{
+				"C: USER anonymous",
+				"S: 331 Please specify the password.",
+				"C: PASS guest@example.com",
+				"S: 230 Login successful.",
+			},
+			want: []lineRecord{
+				{"USER", "anonymous", "anonymous", false, "331"},
+				{"PASS", "****", "anonymous", false, "230"},
+			},
+		},
+		{
+			name:       "FTP AUTH TLS",
+			newParsers: newFTPParsers,
+			dialogue: []string{
+				"C: AUTH TLS",
+				"S: 234 Proceed with negotiation.",
+				"C: USER alice",
+				"C: PASS secret",
+			},
+			want: []lineRecord{{"AUTH", "TLS", "", false, "234"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := lineRecords(converse(t, tt.newParsers, tt.dialogue...))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("records:\n got  %+v\n want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSMTPMailTransaction(t *testing.T) {
+	sessions := converse(t, newSMTPParsers,
+		"C: MAIL FROM:<alice@example.com> SIZE=2048",
+		"C: RCPT TO:<bob@example.com>",
+		"C: RCPT TO:<carol@example.com> NOTIFY=NEVER",
+		"C: DATA",
+		"S: 250 2.1.0 Ok",
+		"S: 250 2.1.5 Ok",
+		"S: 250 2.1.5 Ok",
+		"S: 354 End data with <CR><LF>.<CR><LF>",
+		"C: Subject: =?UTF-8?B?5oql5ZGK?=",
+		`C: Content-Type: multipart/mixed; boundary="b1"`,
+		"C: ",
+		"C: --b1",
+		"C: Content-Type: text/plain",
+		"C: ",
+		"C: ..hello",
+		"C: --b1",
+		`C: Content-Type: application/pdf; name="q3.pdf"`,
+		`C: Content-Disposition: attachment;`,
+		`C:  filename="report, q3.pdf"`,
+		"C: ",
+		"C: JVBERi0=",
+		"C: --b1--",
+		"C: .",
+		"S: 250 2.0.0 Ok: queued as 4F2A1",
+		"C: QUIT",
+		"S: 221 2.0.0 Bye",
+	)
+
+	if len(sessions) != 2 {
+		t.Fatalf("got %d records, want 2: %+v", len(sessions), lineRecords(sessions))
+	}
+	mail := sessions[0]
+	if mail.Command != "MAIL" || mail.MailFrom != "alice@example.com" || mail.RcptTo != "bob@example.com,carol@example.com" {
+		t.Errorf("mail = %s from %q to %q", mail.Command, mail.MailFrom, mail.RcptTo)
+	}
+	if mail.Subject != "报告" || mail.Attachments != "report_ q3.pdf" {
+		t.Errorf("subject = %q, attachments = %q", mail.Subject, mail.Attachments)
+	}
+	if mail.ReplyCode != "250" || mail.ReplyText != "2.0.0 Ok: queued as 4F2A1" {
+		t.Errorf("reply = %s %s", mail.ReplyCode, mail.ReplyText)
+	}
+	if sessions[1].Command != "QUIT" || sessions[1].ReplyCode != "221" {
+		t.Errorf("second record = %s %s", sessions[1].Command, sessions[1].ReplyCode)
+	}
+}
+
+func TestPOP3Retrieve(t *testing.T) {
+	sessions := converse(t, newPOP3Parsers,
+		"C: RETR 1",
+		"S: +OK 120 octets",
+		"S: Subject: quarterly report",
+		`S: Content-Type: application/pdf; name="q3.pdf"`,
+		"S: ",
+		"S: ..body",
+		"S: .",
+		"C: QUIT",
+		"S: +OK bye",
+	)
+	got := lineRecords(sessions)
+	want := []lineRecord{{"RETR", "1", "", false, "+OK"}, {"QUIT", "", "", false, "+OK"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("records = %+v, want %+v", got, want)
+	}
+	if sessions[0].Subject != "quarterly report" || sessions[0].Attachments != "q3.pdf" {
+		t.Errorf("subject = %q, attachments = %q", sessions[0].Subject, sessions[0].Attachments)
+	}
+}
+
+func TestFTPTransfer(t *testing.T) {
+	sessions := converse(t, newFTPParsers,
+		"C: FEAT",
+		"S: 211-Features:",
+		"S:  SIZE",
+		"S: 211 End",
+		"C: SIZE report.pdf",
+		"S: 213 2048",
+		"C: RETR report.pdf",
+		"S: 150 Opening BINARY mode data connection for report.pdf.",
+		"S: 226 Transfer complete.",
+		"C: STOU",
+		"S: 150 FILE: upload.1 (512 bytes)",
+		"S: 226 Transfer complete.",
+	)
+
+	type transfer struct {
+		Command, Reply, FileName string
+		FileSize                 int64
+	}
+	var got []transfer
+	for _, s := range sessions {
+		got = append(got, transfer{s.Command, s.ReplyCode, s.FileName, s.FileSize})
+	}
+	want := []transfer{
+		{"FEAT", "211", "", 0},
+		{"SIZE", "213", "report.pdf", 2048},
+		{"RETR", "226", "report.pdf", 2048},
+		{"STOU", "226", "upload.1", 512},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("records:\n got  %+v\n want %+v", got, want)
+	}
+}
+
+func TestLineStreamGap(t *testing.T) {
+	client := model.FiveTuple{SrcIP: "10.0.0.1", DstIP: "10.0.0.2", SrcPort: 40000, DstPort: 21, Protocol: "TCP"}
+	toServer, toClient := newFTPParsers(client, 64<<10)
+	ts := time.Unix(1700000000, 0)
+
+	// PASS 命令的一部分丢失：丢弃到下一个换行后继续解析
+	var sessions []*model.Session
+	for _, feed := range []struct {
+		data string
+		skip int
+	}{
+		{"USER alice\r\nPA", 0},
+		{"cret\r\nQUIT\r\n", 3},
+	} {
+		out, err := toServer.Feed([]byte(feed.data), feed.skip, ts)
+		if err != nil {
+			t.Fatalf("Feed: %v", err)
+		}
+		sessions = append(sessions, out...)
+	}
+	sessions = append(sessions, toServer.Close(ts)...)
+	sessions = append(sessions, toClient.Close(ts)...)
+
+	got := lineRecords(sessions)
+	want := []lineRecord{{"USER", "alice", "alice", false, ""}, {"QUIT", "", "", false, ""}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("records = %+v, want %+v", got, want)
+	}
+}
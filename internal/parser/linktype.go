@@ -0,0 +1,98 @@
+package parser
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// Link types (LINKTYPE_* values) not registered by gopacket.
+// gopacket 的 layers.LinkType 为 uint8，无法表示大于 255 的链路类型，因此这里使用 int
+const (
+	LinkTypeIPv4      = 228
+	LinkTypeIPv6      = 229
+	LinkTypeLinuxSLL2 = 276
+
+	linuxSLL2HeaderLen = 20
+)
+
+// LayerTypeLinuxSLL2 is the Linux "cooked" capture v2 header used by the "any" interface
+var LayerTypeLinuxSLL2 = gopacket.RegisterLayerType(1276, gopacket.LayerTypeMetadata{
+	Name:    "LinuxSLL2",
+	Decoder: gopacket.DecodeFunc(decodeLinuxSLL2),
+})
+
+// LinuxSLL2 represents a Linux cooked capture v2 header
+// Linux "any" 网卡的伪链路层头（SLL2）
+type LinuxSLL2 struct {
+	layers.BaseLayer
+	ProtocolType   layers.EthernetType
+	InterfaceIndex uint32
+	ARPHRDType     uint16
+	PacketType     layers.LinuxSLLPacketType
+	AddrLen        uint8
+	Addr           net.HardwareAddr
+}
+
+func (sll *LinuxSLL2) LayerType() gopacket.LayerType { return LayerTypeLinuxSLL2 }
+
+func (sll *LinuxSLL2) CanDecode() gopacket.LayerClass { return LayerTypeLinuxSLL2 }
+
+func (sll *LinuxSLL2) NextLayerType() gopacket.LayerType { return sll.ProtocolType.LayerType() }
+
+func (sll *LinuxSLL2) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < linuxSLL2HeaderLen {
+		return errors.New("Linux SLL2 packet too small")
+	}
+
+	sll.ProtocolType = layers.EthernetType(binary.BigEndian.Uint16(data[0:2]))
+	sll.InterfaceIndex = binary.BigEndian.Uint32(data[4:8])
+	sll.ARPHRDType = binary.BigEndian.Uint16(data[8:10])
+	sll.PacketType = layers.LinuxSLLPacketType(data[10])
+	sll.AddrLen = data[11]
+	addrLen := int(sll.AddrLen)
+	if addrLen > 8 {
+		addrLen = 8
+	}
+	sll.Addr = net.HardwareAddr(data[12 : 12+addrLen])
+	sll.BaseLayer = layers.BaseLayer{Contents: data[:linuxSLL2HeaderLen], Payload: data[linuxSLL2HeaderLen:]}
+	return nil
+}
+
+func decodeLinuxSLL2(data []byte, p gopacket.PacketBuilder) error {
+	sll := &LinuxSLL2{}
+	if err := sll.DecodeFromBytes(data, p); err != nil {
+		return err
+	}
+	p.AddLayer(sll)
+	p.SetLinkLayer(sll)
+	return p.NextDecoder(sll.ProtocolType)
+}
+
+// LinkFlow implements gopacket.LinkLayer
+func (sll *LinuxSLL2) LinkFlow() gopacket.Flow {
+	return gopacket.NewFlow(layers.EndpointMAC, sll.Addr, nil)
+}
+
+// firstLayerDecoder returns the decoder for the first layer of a packet with the given link type
+// 根据链路层类型选择首层解码器，未知类型按以太网处理
+func firstLayerDecoder(linkType int) gopacket.Decoder {
+	switch linkType {
+	case LinkTypeLinuxSLL2:
+		return LayerTypeLinuxSLL2
+	case LinkTypeIPv4:
+		return layers.LayerTypeIPv4
+	case LinkTypeIPv6:
+		return layers.LayerTypeIPv6
+	}
+
+	if linkType >= 0 && linkType <= 0xff {
+		if meta := layers.LinkTypeMetadata[linkType]; meta.DecodeWith != nil {
+			return layers.LinkType(linkType)
+		}
+	}
+	return layers.LayerTypeEthernet
+}
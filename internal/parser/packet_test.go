@@ -0,0 +1,55 @@
+package parser
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+var (
+	testSrcMAC = net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}
+	testDstMAC = net.HardwareAddr{0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb}
+)
+
+// serialize builds a packet from the given layers, fixing lengths and checksums
+func serialize(t testing.TB, l ...gopacket.SerializableLayer) []byte {
+	t.Helper()
+	for _, layer := range l {
+		switch v := layer.(type) {
+		case *layers.TCP:
+			v.SetNetworkLayerForChecksum(networkFor(l))
+		case *layers.UDP:
+			v.SetNetworkLayerForChecksum(networkFor(l))
+		case *layers.ICMPv6:
+			v.SetNetworkLayerForChecksum(networkFor(l))
+		}
+	}
+	buf := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}, l...); err != nil {
+		t.Fatalf("serialize packet: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func networkFor(l []gopacket.SerializableLayer) gopacket.NetworkLayer {
+	for _, layer := range l {
+		if n, ok := layer.(gopacket.NetworkLayer); ok {
+			return n
+		}
+	}
+	return nil
+}
+
+func ethernet(typ layers.EthernetType) *layers.Ethernet {
+	return &layers.Ethernet{SrcMAC: testSrcMAC, DstMAC: testDstMAC, EthernetType: typ}
+}
+
+func ipv4(src, dst string, proto layers.IPProtocol) *layers.IPv4 {
+	return &layers.IPv4{Version: 4, TTL: 64, Protocol: proto, SrcIP: net.ParseIP(src).To4(), DstIP: net.ParseIP(dst).To4()}
+}
+
+func ipv6(src, dst string, next layers.IPProtocol) *layers.IPv6 {
+	return &layers.IPv6{Version: 6, HopLimit: 64, NextHeader: next, SrcIP: net.ParseIP(src), DstIP: net.ParseIP(dst)}
+}
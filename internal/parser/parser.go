@@ -3,13 +3,12 @@ package parser
 import (
 	"bufio"
 	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"strings"
 	"time"
 
-	"github.com/google/gopacket"
-	"github.com/google/gopacket/layers"
 	"github.com/miekg/dns"
 	"sniffer/pkg/model"
 )
@@ -18,77 +17,25 @@ var (
 	ErrNotDNS   = errors.New("not a DNS packet")
 	ErrNotHTTP  = errors.New("not an HTTP packet")
 	ErrNotICMP  = errors.New("not an ICMP packet")
+	ErrNotTLS   = errors.New("not a TLS handshake packet")
+	ErrNotQUIC  = errors.New("not a QUIC Initial packet")
+	ErrNotDHCP  = errors.New("not a DHCP packet")
+	ErrNotARP   = errors.New("not an ARP packet")
 	ErrParseErr = errors.New("parse error")
 )
 
-// ParsePacket parses a raw packet and extracts basic information
-func ParsePacket(data []byte, timestamp time.Time) (*model.Packet, error) {
-	packet := gopacket.NewPacket(data, layers.LayerTypeEthernet, gopacket.Default)
-
-	pkt := &model.Packet{
-		Timestamp:  timestamp,
-		Length:     len(data),
-		CaptureLen: len(data),
-		Data:       data,
-		LayerInfo:  "",
-	}
-
-	// Extract IP layer
-	if ipLayer := packet.Layer(layers.LayerTypeIPv4); ipLayer != nil {
-		ip, _ := ipLayer.(*layers.IPv4)
-		pkt.SrcIP = ip.SrcIP.String()
-		pkt.DstIP = ip.DstIP.String()
-		pkt.Protocol = ip.Protocol.String()
-	} else if ipLayer := packet.Layer(layers.LayerTypeIPv6); ipLayer != nil {
-		ip, _ := ipLayer.(*layers.IPv6)
-		pkt.SrcIP = ip.SrcIP.String()
-		pkt.DstIP = ip.DstIP.String()
-		pkt.Protocol = ip.NextHeader.String()
-	}
-
-	// Extract transport layer ports
-	if tcpLayer := packet.Layer(layers.LayerTypeTCP); tcpLayer != nil {
-		tcp, _ := tcpLayer.(*layers.TCP)
-		pkt.SrcPort = uint16(tcp.SrcPort)
-		pkt.DstPort = uint16(tcp.DstPort)
-		pkt.Protocol = "TCP"
-	} else if udpLayer := packet.Layer(layers.LayerTypeUDP); udpLayer != nil {
-		udp, _ := udpLayer.(*layers.UDP)
-		pkt.SrcPort = uint16(udp.SrcPort)
-		pkt.DstPort = uint16(udp.DstPort)
-		pkt.Protocol = "UDP"
-	} else if icmpLayer := packet.Layer(layers.LayerTypeICMPv4); icmpLayer != nil {
-		pkt.Protocol = "ICMP"
-	}
-
-	// Build layer summary
-	var layers []string
-	for _, layer := range packet.Layers() {
-		layers = append(layers, layer.LayerType().String())
-	}
-	pkt.LayerInfo = strings.Join(layers, " > ")
-
-	return pkt, nil
-}
-
 // ParseDNS parses a DNS packet
 func ParseDNS(pkt *model.Packet) (*model.Session, error) {
-	// DNS typically uses UDP port 53
-	if pkt.Protocol != "UDP" || (pkt.SrcPort != 53 && pkt.DstPort != 53) {
+	if !(dnsDissector{}).Claims(pkt) {
 		return nil, ErrNotDNS
 	}
 
-	packet := gopacket.NewPacket(pkt.Data, layers.LayerTypeEthernet, gopacket.Default)
-	
-	// Get UDP payload
-	udpLayer := packet.Layer(layers.LayerTypeUDP)
-	if udpLayer == nil {
+	// UDP payload (解码阶段已取得)
+	payload := pkt.Payload
+	if len(payload) == 0 {
 		return nil, ErrNotDNS
 	}
 
-	udp, _ := udpLayer.(*layers.UDP)
-	payload := udp.Payload
-
 	// Parse DNS
 	msg := new(dns.Msg)
 	if err := msg.Unpack(payload); err != nil {
@@ -118,7 +65,7 @@ func ParseDNS(pkt *model.Packet) (*model.Session, error) {
 	if len(msg.Question) > 0 {
 		q := msg.Question[0]
 		session.Domain = strings.TrimSuffix(q.Name, ".")
-		session.QueryType = dns.TypeToString[q.Qtype]
+		session.QueryType = dnsTypeString(q.Qtype)
 	}
 
 	// Extract answer information (for responses)
@@ -134,36 +81,129 @@ func ParseDNS(pkt *model.Packet) (*model.Session, error) {
 		}
 	}
 
+	// 报文头与所有记录（第一个问题保存在 Domain / QueryType 中）
+	session.DNSID = msg.Id
+	session.DNSFlags = dnsFlags(msg)
+	if msg.Response {
+		session.RCode = dns.RcodeToString[msg.Rcode]
+		if session.RCode == "" {
+			session.RCode = fmt.Sprintf("RCODE%d", msg.Rcode)
+		}
+	}
+	for i := 1; i < len(msg.Question); i++ {
+		q := msg.Question[i]
+		session.DNSRecords = append(session.DNSRecords, model.DNSRecord{
+			Section: model.DNSSectionQuestion,
+			Name:    strings.TrimSuffix(q.Name, "."),
+			Type:    dnsTypeString(q.Qtype),
+		})
+	}
+	session.DNSRecords = appendDNSRecords(session.DNSRecords, model.DNSSectionAnswer, msg.Answer)
+	session.DNSRecords = appendDNSRecords(session.DNSRecords, model.DNSSectionAuthority, msg.Ns)
+	session.DNSRecords = appendDNSRecords(session.DNSRecords, model.DNSSectionAdditional, msg.Extra)
+	session.CNAMEChain = cnameChain(session.Domain, msg.Answer)
+
 	return session, nil
 }
 
-// ParseHTTP parses an HTTP packet (HTTP/1.x only, not HTTPS)
-func ParseHTTP(pkt *model.Packet) (*model.Session, error) {
-	// HTTP typically uses TCP
-	if pkt.Protocol != "TCP" {
-		return nil, ErrNotHTTP
+// dnsFlags returns the header flags that are set, e.g. "qr rd ra"
+func dnsFlags(msg *dns.Msg) string {
+	var flags []string
+	for _, f := range []struct {
+		name string
+		set  bool
+	}{
+		{"qr", msg.Response},
+		{"aa", msg.Authoritative},
+		{"tc", msg.Truncated},
+		{"rd", msg.RecursionDesired},
+		{"ra", msg.RecursionAvailable},
+		{"ad", msg.AuthenticatedData},
+		{"cd", msg.CheckingDisabled},
+	} {
+		if f.set {
+			flags = append(flags, f.name)
+		}
 	}
+	return strings.Join(flags, " ")
+}
 
-	// Common HTTP ports
-	isHTTPPort := pkt.SrcPort == 80 || pkt.DstPort == 80 ||
-		pkt.SrcPort == 8080 || pkt.DstPort == 8080 ||
-		pkt.SrcPort == 8000 || pkt.DstPort == 8000
+// appendDNSRecords converts the resource records of a message section
+// EDNS 的 OPT 伪记录不是资源记录，不保存
+func appendDNSRecords(records []model.DNSRecord, section string, rrs []dns.RR) []model.DNSRecord {
+	for _, rr := range rrs {
+		hdr := rr.Header()
+		if hdr.Rrtype == dns.TypeOPT {
+			continue
+		}
+		// 记录数据为区域文件格式中头部之后的部分（如 MX 的 "10 mail.example.com."）
+		// 未知类型（RFC 3597）的头部写作 "CLASS1 TYPE65534"，与 hdr.String() 不同，按字段切分
+		text := rr.String()
+		data := strings.TrimPrefix(text, hdr.String())
+		if len(data) == len(text) {
+			if fields := strings.SplitN(text, "\t", 5); len(fields) == 5 {
+				data = fields[4]
+			}
+		}
+		records = append(records, model.DNSRecord{
+			Section: section,
+			Name:    strings.TrimSuffix(hdr.Name, "."),
+			Type:    dnsTypeString(hdr.Rrtype),
+			TTL:     hdr.Ttl,
+			Data:    data,
+		})
+	}
+	return records
+}
 
-	if !isHTTPPort {
-		return nil, ErrNotHTTP
+// cnameChain follows the CNAME records of the answer section from the queried name,
+// e.g. "www.example.com -> example.cdn.net -> edge.cdn.net"
+func cnameChain(name string, answers []dns.RR) string {
+	if name == "" {
+		return ""
+	}
+	targets := make(map[string]string)
+	for _, rr := range answers {
+		if cname, ok := rr.(*dns.CNAME); ok {
+			targets[strings.ToLower(strings.TrimSuffix(cname.Hdr.Name, "."))] = strings.TrimSuffix(cname.Target, ".")
+		}
+	}
+	if len(targets) == 0 {
+		return ""
 	}
 
-	packet := gopacket.NewPacket(pkt.Data, layers.LayerTypeEthernet, gopacket.Default)
+	chain := []string{name}
+	seen := map[string]bool{strings.ToLower(name): true}
+	for {
+		next, ok := targets[strings.ToLower(chain[len(chain)-1])]
+		if !ok || seen[strings.ToLower(next)] {
+			break
+		}
+		seen[strings.ToLower(next)] = true
+		chain = append(chain, next)
+	}
+	if len(chain) == 1 {
+		return ""
+	}
+	return strings.Join(chain, " -> ")
+}
 
-	// Get TCP payload
-	tcpLayer := packet.Layer(layers.LayerTypeTCP)
-	if tcpLayer == nil {
-		return nil, ErrNotHTTP
+// dnsTypeString returns the mnemonic of a DNS record type, e.g. "HTTPS" or "TYPE65534"
+func dnsTypeString(t uint16) string {
+	if s, ok := dns.TypeToString[t]; ok {
+		return s
 	}
+	return fmt.Sprintf("TYPE%d", t)
+}
 
-	tcp, _ := tcpLayer.(*layers.TCP)
-	payload := tcp.Payload
+// ParseHTTP parses an HTTP packet (HTTP/1.x only, not HTTPS)
+func ParseHTTP(pkt *model.Packet) (*model.Session, error) {
+	if !(httpDissector{}).Claims(pkt) {
+		return nil, ErrNotHTTP
+	}
 
+	// TCP payload (解码阶段已取得)
+	payload := pkt.Payload
 	if len(payload) == 0 {
 		return nil, ErrNotHTTP
 	}
@@ -194,33 +234,61 @@ func ParseHTTP(pkt *model.Packet) (*model.Session, error) {
 
 	// Parse HTTP headers
 	reader := bufio.NewReader(bytes.NewReader(payload))
-	
+	head := parseHTTPHead(session, reader)
+
+	// 如果是 POST/PUT 请求，尝试读取请求体
+	if (session.Method == "POST" || session.Method == "PUT") && head.contentLength > 0 {
+		// 限制最大读取 10KB 避免内存问题
+		bodyBuf := make([]byte, min(head.contentLength, maxPostData))
+		n, _ := reader.Read(bodyBuf)
+		setPostData(session, bodyBuf[:n], head.contentLength)
+	}
+
+	return session, nil
+}
+
+// maxPostData is the maximum number of request body bytes kept in PostData
+const maxPostData = 10240
+
+// isHTTPPort reports whether port is a common HTTP port
+func isHTTPPort(port uint16) bool {
+	return port == 80 || port == 8080 || port == 8000
+}
+
+// httpHead holds the message framing headers of an HTTP message
+type httpHead struct {
+	contentLength int64
+	hasLength     bool
+	chunked       bool
+}
+
+// parseHTTPHead parses the start line and headers of an HTTP message into session
+func parseHTTPHead(session *model.Session, reader *bufio.Reader) httpHead {
+	var head httpHead
+
 	// Read first line
 	firstLine, err := reader.ReadString('\n')
 	if err != nil {
-		return session, nil // Return partial session
+		return head // Partial message
 	}
 
 	firstLine = strings.TrimSpace(firstLine)
 	parts := strings.Fields(firstLine)
 
 	// Check if it's a request or response
-	if len(parts) >= 3 {
-		if strings.HasPrefix(parts[0], "HTTP/") {
-			// Response
-			var code int
-			if _, err := fmt.Sscanf(parts[1], "%d", &code); err == nil {
-				session.StatusCode = code
-			}
-		} else {
-			// Request
-			session.Method = parts[0]
-			session.Path = parts[1]
+	if len(parts) >= 2 && strings.HasPrefix(parts[0], "HTTP/") {
+		// Response
+		var code int
+		if _, err := fmt.Sscanf(parts[1], "%d", &code); err == nil {
+			session.StatusCode = code
 		}
+	} else if len(parts) >= 3 {
+		// Request
+		session.Method = parts[0]
+		session.Path = parts[1]
 	}
 
 	// Parse headers
-	contentLength := 0
 	for {
 		line, err := reader.ReadString('\n')
 		if err != nil || line == "\r\n" || line == "\n" {
@@ -237,54 +305,52 @@ func ParseHTTP(pkt *model.Packet) (*model.Session, error) {
 		} else if strings.HasPrefix(lineLower, "content-type:") {
 			session.ContentType = strings.TrimSpace(line[13:])
 		} else if strings.HasPrefix(lineLower, "content-length:") {
-			fmt.Sscanf(line[15:], "%d", &contentLength)
+			if _, err := fmt.Sscanf(line[15:], "%d", &head.contentLength); err == nil && head.contentLength >= 0 {
+				head.hasLength = true
+			}
+		} else if strings.HasPrefix(lineLower, "transfer-encoding:") {
+			head.chunked = strings.Contains(lineLower[18:], "chunked")
 		}
 	}
 
-	// 如果是 POST/PUT 请求，尝试读取请求体
-	if (session.Method == "POST" || session.Method == "PUT") && contentLength > 0 {
-		// 限制最大读取 10KB 避免内存问题
-		maxRead := contentLength
-		if maxRead > 10240 {
-			maxRead = 10240
-		}
-		
-		bodyBuf := make([]byte, maxRead)
-		n, _ := reader.Read(bodyBuf)
-		if n > 0 {
-			bodyStr := string(bodyBuf[:n])
-			contentTypeLower := strings.ToLower(session.ContentType)
-			
-			// 根据 Content-Type 判断
-			isTextContent := strings.Contains(contentTypeLower, "text/") ||
-				strings.Contains(contentTypeLower, "json") ||
-				strings.Contains(contentTypeLower, "xml") ||
-				strings.Contains(contentTypeLower, "urlencoded") ||
-				strings.Contains(contentTypeLower, "form-data")
-			
-			// 如果是明确的文本类型或通过启发式判断为文本
-			if isTextContent || isPrintableText(bodyStr) {
-				// URL编码解码（application/x-www-form-urlencoded）
-				if strings.Contains(contentTypeLower, "urlencoded") {
-					decoded, err := decodeURLEncoded(bodyStr)
-					if err == nil {
-						session.PostData = decoded
-					} else {
-						session.PostData = bodyStr
-					}
-				} else if strings.Contains(contentTypeLower, "json") {
-					// JSON格式化（简单处理）
-					session.PostData = bodyStr
-				} else {
-					session.PostData = bodyStr
-				}
+	return head
+}
+
+// setPostData stores the (possibly truncated) request body as readable text
+func setPostData(session *model.Session, body []byte, contentLength int64) {
+	if len(body) == 0 {
+		return
+	}
+
+	bodyStr := string(body)
+	contentTypeLower := strings.ToLower(session.ContentType)
+	
+	// 根据 Content-Type 判断
+	isTextContent := strings.Contains(contentTypeLower, "text/") ||
+		strings.Contains(contentTypeLower, "json") ||
+		strings.Contains(contentTypeLower, "xml") ||
+		strings.Contains(contentTypeLower, "urlencoded") ||
+		strings.Contains(contentTypeLower, "form-data")
+	
+	// 如果是明确的文本类型或通过启发式判断为文本
+	if isTextContent || isPrintableText(bodyStr) {
+		// URL编码解码（application/x-www-form-urlencoded）
+		if strings.Contains(contentTypeLower, "urlencoded") {
+			decoded, err := decodeURLEncoded(bodyStr)
+			if err == nil {
+				session.PostData = decoded
 			} else {
-				session.PostData = fmt.Sprintf("[二进制数据, %d 字节]", contentLength)
+				session.PostData = bodyStr
 			}
+		} else if strings.Contains(contentTypeLower, "json") {
+			// JSON格式化（简单处理）
+			session.PostData = bodyStr
+		} else {
+			session.PostData = bodyStr
 		}
+	} else {
+		session.PostData = fmt.Sprintf("[二进制数据, %d 字节]", contentLength)
 	}
-
-	return session, nil
 }
 
 // decodeURLEncoded 解码 URL 编码的表单数据
@@ -377,16 +443,11 @@ func ParseICMP(pkt *model.Packet) (*model.Session, error) {
 		return nil, ErrNotICMP
 	}
 
-	packet := gopacket.NewPacket(pkt.Data, layers.LayerTypeEthernet, gopacket.Default)
-
-	// Get ICMP layer
-	icmpLayer := packet.Layer(layers.LayerTypeICMPv4)
-	if icmpLayer == nil {
-		// Try ICMPv6
-		icmpLayer = packet.Layer(layers.LayerTypeICMPv6)
-		if icmpLayer == nil {
-			return nil, ErrNotICMP
-		}
+	// ICMP 报文（解码阶段已取得）：类型、代码和校验和之后，ICMPv4 为 4 字节的标识符和序号（或未用字段）
+	data := pkt.Transport
+	v6 := pkt.Protocol == "ICMPv6"
+	if len(data) < 4 || (!v6 && len(data) < 8) {
+		return nil, ErrNotICMP
 	}
 
 	session := &model.Session{
@@ -407,13 +468,32 @@ func ParseICMP(pkt *model.Packet) (*model.Session, error) {
 	}
 
 	// Extract ICMP details
-	if icmp4, ok := icmpLayer.(*layers.ICMPv4); ok {
-		session.ICMPType = uint8(icmp4.TypeCode.Type())
-		session.ICMPCode = uint8(icmp4.TypeCode.Code())
-		session.ICMPSeq = icmp4.Seq
-	} else if icmp6, ok := icmpLayer.(*layers.ICMPv6); ok {
-		session.ICMPType = uint8(icmp6.TypeCode.Type())
-		session.ICMPCode = uint8(icmp6.TypeCode.Code())
+	session.ICMPType = data[0]
+	session.ICMPCode = data[1]
+	if !v6 {
+		// 标识符和序号只存在于回显报文中，差错报文的这 4 字节为未用字段（或 MTU、网关地址）
+		if isICMPEcho(false, session.ICMPType) {
+			session.ICMPID = binary.BigEndian.Uint16(data[4:6])
+			session.ICMPSeq = binary.BigEndian.Uint16(data[6:8])
+		} else if isICMPError(false, session.ICMPType) {
+			// 差错报文的 8 字节头部之后是原始报文的 IP 头和传输层头部
+			parseEmbeddedHeader(session, data[8:])
+		}
+	} else {
+		// ICMPv6 的载荷从类型和校验和之后开始：回显为标识符和序号，差错报文为 4 字节的未用字段（或 MTU）
+		if payload := data[4:]; len(payload) >= 4 {
+			if isICMPEcho(true, session.ICMPType) {
+				session.ICMPID = binary.BigEndian.Uint16(payload[0:2])
+				session.ICMPSeq = binary.BigEndian.Uint16(payload[2:4])
+			} else if isICMPError(true, session.ICMPType) {
+				parseEmbeddedHeader(session, payload[4:])
+			}
+		}
+	}
+
+	// 原始报文为回显请求时，差错报文的标识符和序号取自被引用的回显请求
+	if session.OrigProtocol == "ICMP" {
+		session.ICMPID, session.ICMPSeq = session.OrigSrcPort, session.OrigDstPort
 	}
 
 	return session, nil
@@ -0,0 +1,143 @@
+package parser
+
+import (
+	"strings"
+	"time"
+
+	"sniffer/pkg/model"
+)
+
+// isPOP3Port reports whether port is the POP3 port
+func isPOP3Port(port uint16) bool {
+	return port == 110
+}
+
+// pop3Conn parses a POP3 connection, 每个命令及其 +OK/-ERR 应答一条记录
+type pop3Conn struct {
+	lineSession
+	user     string // USER 命令的用户名，供随后的 PASS 使用
+	auth     *saslAuth
+	authWait bool         // 服务器发出 "+ " 后，下一行为客户端的 SASL 响应
+	multi    *lineCommand // 正在接收多行应答的命令
+	msg      *mailMessage // RETR/TOP 返回的邮件内容
+}
+
+// newPOP3Parsers creates the POP3 parsers of both directions of a connection
+func newPOP3Parsers(client model.FiveTuple, maxBuffer int) (StreamParser, StreamParser) {
+	return newLineParsers(&pop3Conn{lineSession: lineSession{proto: "POP3", client: client}}, maxBuffer)
+}
+
+func (c *pop3Conn) clientLine(line string, ts time.Time) []*model.Session {
+	size := len(line) + 2
+	if c.authWait {
+		c.authWait = false
+		if c.auth != nil {
+			c.auth.response(line)
+			c.auth.session.PayloadSize += size
+		}
+		return nil
+	}
+
+	verb, arg := splitCommand(line)
+	session := c.record(verb, arg, ts, size)
+	switch verb {
+	case "USER":
+		c.user = arg
+		session.Username = arg
+	case "PASS":
+		session.Argument = maskedPassword
+		session.Username = c.user
+		session.CleartextAuth = true
+	case "APOP":
+		// APOP name digest：摘要不可重放为密码，不视为明文认证
+		name, _, _ := strings.Cut(arg, " ")
+		session.Argument = name
+		session.Username = name
+	case "AUTH":
+		// 无参数的 AUTH 列出支持的机制
+		if arg != "" {
+			mech, initial, _ := strings.Cut(arg, " ")
+			c.auth = newSASLAuth(session, mech, strings.TrimSpace(initial))
+		}
+	}
+	return c.push(&lineCommand{verb: verb, session: session}, nil)
+}
+
+func (c *pop3Conn) serverLine(line string, ts time.Time) []*model.Session {
+	size := len(line) + 2
+
+	// 多行应答以单独的 "." 行结束，行首的 "." 经过转义
+	if c.multi != nil {
+		session := c.multi.session
+		if line == "." {
+			if c.msg != nil {
+				c.msg.finish(session)
+			}
+			c.multi, c.msg = nil, nil
+			session.PayloadSize += size
+			return []*model.Session{session}
+		}
+		session.PayloadSize += size
+		if c.msg != nil {
+			c.msg.line(strings.TrimPrefix(line, "."))
+		}
+		return nil
+	}
+
+	if line == "+" || strings.HasPrefix(line, "+ ") {
+		c.authWait = c.auth != nil
+		return nil
+	}
+
+	code, text, _ := strings.Cut(line, " ")
+	if code != "+OK" && code != "-ERR" {
+		return nil
+	}
+	cmd := c.pop()
+	if cmd == nil {
+		return nil // 问候语或没有对应命令的应答
+	}
+	session := cmd.session
+	setReply(session, code, text, ts, size)
+
+	switch cmd.verb {
+	case "AUTH":
+		c.auth, c.authWait = nil, false
+	case "STLS":
+		c.tls = code == "+OK"
+	}
+
+	if code == "+OK" && pop3MultiLine(cmd.verb, session.Argument) {
+		c.multi = cmd
+		if cmd.verb == "RETR" || cmd.verb == "TOP" {
+			c.msg = newMailMessage()
+		}
+		return nil
+	}
+	return []*model.Session{session}
+}
+
+func (c *pop3Conn) close(ts time.Time) []*model.Session {
+	var out []*model.Session
+	if c.multi != nil {
+		if c.msg != nil {
+			c.msg.finish(c.multi.session)
+		}
+		out = append(out, c.multi.session)
+		c.multi, c.msg = nil, nil
+	}
+	return c.flush(out)
+}
+
+// pop3MultiLine reports whether a successful reply to the command is multi-line (RFC 1939)
+func pop3MultiLine(verb, arg string) bool {
+	switch verb {
+	case "RETR", "TOP", "CAPA":
+		return true
+	case "LIST", "UIDL":
+		return arg == ""
+	case "AUTH":
+		return arg == "" // 机制列表
+	}
+	return false
+}
@@ -0,0 +1,436 @@
+package parser
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/cryptobyte"
+	"golang.org/x/crypto/hkdf"
+	"sniffer/pkg/model"
+)
+
+// errQUICIncomplete is returned while the ClientHello is still spread over missing Initial packets
+var errQUICIncomplete = errors.New("incomplete QUIC ClientHello")
+
+// QUIC versions with known Initial keys
+const (
+	quicVersion1       = 0x00000001
+	quicVersion2       = 0x6b3343cf
+	quicVersionDraft29 = 0xff00001d
+)
+
+const (
+	quicMaxCIDLen     = 20
+	quicSampleLen     = 16
+	quicMaxCryptoData = 64 * 1024        // 单个连接缓存的 CRYPTO 数据上限
+	quicMaxConns      = 4096             // 同时跟踪的连接数上限
+	quicConnTimeout   = 10 * time.Second // 连接跟踪超时（按数据包时间）
+
+	quicFramePadding         = 0x00
+	quicFramePing            = 0x01
+	quicFrameAck             = 0x02
+	quicFrameAckECN          = 0x03
+	quicFrameCrypto          = 0x06
+	quicFrameConnectionClose = 0x1c
+)
+
+// quicVersionParams holds the version specific values used to protect Initial packets
+type quicVersionParams struct {
+	name        string
+	initialType byte // 长包头中 Initial 的包类型
+	salt        []byte
+	labelPrefix string // HKDF 标签前缀，QUIC v2 使用 "quicv2 "
+}
+
+// quicVersions lists the QUIC versions whose Initial packets can be decrypted (RFC 9001, RFC 9369)
+var quicVersions = map[uint32]*quicVersionParams{
+	quicVersion1: {
+		name:        "QUIC v1",
+		initialType: 0,
+		salt:        []byte{0x38, 0x76, 0x2c, 0xf7, 0xf5, 0x59, 0x34, 0xb3, 0x4d, 0x17, 0x9a, 0xe6, 0xa4, 0xc8, 0x0c, 0xad, 0xcc, 0xbb, 0x7f, 0x0a},
+		labelPrefix: "quic ",
+	},
+	quicVersion2: {
+		name:        "QUIC v2",
+		initialType: 1,
+		salt:        []byte{0x0d, 0xed, 0xe3, 0xde, 0xf7, 0x00, 0xa6, 0xdb, 0x81, 0x93, 0x81, 0xbe, 0x6e, 0x26, 0x9d, 0xcb, 0xf9, 0xbd, 0x2e, 0xd9},
+		labelPrefix: "quicv2 ",
+	},
+	quicVersionDraft29: {
+		name:        "draft-29",
+		initialType: 0,
+		salt:        []byte{0xaf, 0xbf, 0xec, 0x28, 0x99, 0x93, 0xd2, 0x4c, 0x9e, 0x97, 0x86, 0xf1, 0x9c, 0x61, 0x11, 0xe0, 0x43, 0x90, 0xa8, 0x99},
+		labelPrefix: "quic ",
+	},
+}
+
+// isQUICPort reports whether port is a common QUIC server port (HTTP/3, DNS over QUIC)
+func isQUICPort(port uint16) bool {
+	switch port {
+	case 443, 8443, 853:
+		return true
+	}
+	return false
+}
+
+// quicConn collects the CRYPTO stream of a client's Initial packets
+type quicConn struct {
+	version  *quicVersionParams
+	first    time.Time         // 首个 Initial 包的时间
+	lastSeen time.Time         // 最后一个 Initial 包的时间
+	crypto   []byte            // 从偏移 0 开始的连续数据
+	frags    map[uint64][]byte // 乱序到达的 CRYPTO 数据
+	buffered int
+	size     int  // Initial 包的字节数
+	done     bool // ClientHello 已输出，忽略之后的重传
+}
+
+// QUICTracker decrypts client Initial packets and extracts the ClientHello
+// Initial 包使用由目标连接 ID 派生的公开密钥加密（RFC 9001 5.2）；
+// ClientHello 可能跨多个 Initial 包（如包含后量子密钥交换），按连接收集 CRYPTO 帧
+type QUICTracker struct {
+	mu    sync.Mutex
+	conns map[string]*quicConn // 客户端地址 + 目标连接 ID
+}
+
+// NewQUICTracker creates a QUIC Initial packet tracker
+func NewQUICTracker() *QUICTracker {
+	return &QUICTracker{conns: make(map[string]*quicConn)}
+}
+
+// Parse decrypts the client Initial packets of a UDP datagram.
+// Returns a session once the ClientHello of the connection is complete.
+func (t *QUICTracker) Parse(pkt *model.Packet) (*model.Session, error) {
+	if pkt.Protocol != "UDP" || (!isQUICPort(pkt.DstPort) && pkt.AppProtocol != "QUIC") {
+		return nil, ErrNotQUIC
+	}
+	// 长包头，且固定位为 1
+	if len(pkt.Payload) < 7 || pkt.Payload[0]&0xc0 != 0xc0 {
+		return nil, ErrNotQUIC
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// 一个 UDP 数据报可能包含多个合并的 QUIC 包
+	data := pkt.Payload
+	var conn *quicConn
+	for len(data) > 0 {
+		initial, rest, err := parseQUICLongHeader(data)
+		if err != nil {
+			break
+		}
+		data = rest
+		if initial == nil {
+			continue
+		}
+
+		key := fmt.Sprintf("%s|%d|%x", pkt.SrcIP, pkt.SrcPort, initial.dcid)
+		c := t.conns[key]
+		if c == nil {
+			if !t.reserveLocked(pkt.Timestamp) {
+				return nil, errQUICIncomplete
+			}
+			c = &quicConn{version: initial.version, first: pkt.Timestamp}
+			t.conns[key] = c
+		}
+		c.lastSeen = pkt.Timestamp
+		if c.done {
+			return nil, errQUICIncomplete
+		}
+
+		payload, err := initial.decrypt()
+		if err != nil {
+			continue
+		}
+		c.size += len(initial.packet)
+		if err := c.readFrames(payload); err != nil {
+			continue
+		}
+		conn = c
+	}
+	if conn == nil {
+		return nil, ErrNotQUIC
+	}
+
+	hello, err := conn.clientHello()
+	if err != nil {
+		return nil, err
+	}
+	conn.done = true
+	conn.crypto, conn.frags = nil, nil
+
+	session := newTLSSession(GetFiveTuple(pkt), conn.first)
+	session.Type = "QUIC"
+	session.ProcessPID = pkt.ProcessPID
+	session.ProcessName = pkt.ProcessName
+	session.ProcessExe = pkt.ProcessExe
+	applyHello(session, hello, 0)
+	session.PayloadSize = conn.size
+	session.JA4 = ja4(hello, 'q')
+	session.QUICVersion = conn.version.name
+	// QUIC 只能使用 TLS 1.3（RFC 9001 4.2）
+	session.TLSVersion = "TLS 1.3"
+	return session, nil
+}
+
+// reserveLocked makes room for a new connection, removing the expired ones when the table is full
+func (t *QUICTracker) reserveLocked(now time.Time) bool {
+	if len(t.conns) < quicMaxConns {
+		return true
+	}
+	for key, c := range t.conns {
+		if now.Sub(c.lastSeen) > quicConnTimeout {
+			delete(t.conns, key)
+		}
+	}
+	return len(t.conns) < quicMaxConns
+}
+
+// quicInitial is a protected Initial packet
+type quicInitial struct {
+	version  *quicVersionParams
+	dcid     []byte
+	packet   []byte // 整个包（包头 + 受保护的载荷）
+	pnOffset int    // 包号在 packet 中的偏移
+}
+
+// parseQUICLongHeader parses the long header packet at the start of data and returns the rest of the datagram.
+// initial is nil for packets other than Initial packets of a supported version.
+func parseQUICLongHeader(data []byte) (initial *quicInitial, rest []byte, err error) {
+	if len(data) < 7 || data[0]&0x80 == 0 {
+		return nil, nil, ErrNotQUIC
+	}
+	version := binary.BigEndian.Uint32(data[1:5])
+	params := quicVersions[version]
+	// 版本协商包和未知版本的包长度无法解析
+	if params == nil {
+		return nil, nil, ErrNotQUIC
+	}
+
+	s := cryptobyte.String(data[5:])
+	var dcid, scid []byte
+	if !s.ReadUint8LengthPrefixed((*cryptobyte.String)(&dcid)) || len(dcid) > quicMaxCIDLen ||
+		!s.ReadUint8LengthPrefixed((*cryptobyte.String)(&scid)) || len(scid) > quicMaxCIDLen {
+		return nil, nil, ErrNotQUIC
+	}
+
+	isInitial := (data[0]>>4)&0x03 == params.initialType
+	if isInitial {
+		tokenLen, ok := readQUICVarint(&s)
+		if !ok || !s.Skip(int(tokenLen)) {
+			return nil, nil, ErrNotQUIC
+		}
+	}
+	length, ok := readQUICVarint(&s)
+	if !ok || length > uint64(len(s)) {
+		return nil, nil, ErrNotQUIC
+	}
+
+	pnOffset := len(data) - len(s)
+	end := pnOffset + int(length)
+	if !isInitial {
+		return nil, data[end:], nil
+	}
+	return &quicInitial{
+		version:  params,
+		dcid:     dcid,
+		packet:   data[:end],
+		pnOffset: pnOffset,
+	}, data[end:], nil
+}
+
+// decrypt removes the header protection and decrypts the payload with the client Initial keys
+func (p *quicInitial) decrypt() ([]byte, error) {
+	key, iv, hp := quicClientInitialKeys(p.version, p.dcid)
+
+	sampleOffset := p.pnOffset + 4
+	if len(p.packet) < sampleOffset+quicSampleLen {
+		return nil, fmt.Errorf("%w: QUIC packet too short", ErrParseErr)
+	}
+	hpCipher, err := aes.NewCipher(hp)
+	if err != nil {
+		return nil, err
+	}
+	mask := make([]byte, aes.BlockSize)
+	hpCipher.Encrypt(mask, p.packet[sampleOffset:sampleOffset+quicSampleLen])
+
+	// 去除包头保护：长包头保护首字节低 4 位和包号（不修改原始数据）
+	first := p.packet[0] ^ mask[0]&0x0f
+	pnLen := int(first&0x03) + 1
+	header := append([]byte(nil), p.packet[:p.pnOffset+pnLen]...)
+	header[0] = first
+	var pn uint64
+	for i := 0; i < pnLen; i++ {
+		header[p.pnOffset+i] ^= mask[1+i]
+		pn = pn<<8 | uint64(header[p.pnOffset+i])
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	// 客户端的前几个 Initial 包号很小，截断的包号即完整包号
+	nonce := append([]byte(nil), iv...)
+	for i := 0; i < 8; i++ {
+		nonce[len(nonce)-1-i] ^= byte(pn >> (8 * i))
+	}
+	payload, err := aead.Open(nil, nonce, p.packet[p.pnOffset+pnLen:], header)
+	if err != nil {
+		return nil, fmt.Errorf("%w: decrypt QUIC Initial: %v", ErrParseErr, err)
+	}
+	return payload, nil
+}
+
+// quicClientInitialKeys derives the client Initial packet protection keys from the destination connection ID
+func quicClientInitialKeys(version *quicVersionParams, dcid []byte) (key, iv, hp []byte) {
+	initialSecret := hkdf.Extract(sha256.New, dcid, version.salt)
+	clientSecret := hkdfExpandLabel(initialSecret, "client in", sha256.Size)
+	key = hkdfExpandLabel(clientSecret, version.labelPrefix+"key", 16)
+	iv = hkdfExpandLabel(clientSecret, version.labelPrefix+"iv", 12)
+	hp = hkdfExpandLabel(clientSecret, version.labelPrefix+"hp", 16)
+	return key, iv, hp
+}
+
+// hkdfExpandLabel implements HKDF-Expand-Label of TLS 1.3 with an empty context (RFC 8446 7.1)
+func hkdfExpandLabel(secret []byte, label string, length int) []byte {
+	var b cryptobyte.Builder
+	b.AddUint16(uint16(length))
+	b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes([]byte("tls13 " + label))
+	})
+	b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {})
+
+	out := make([]byte, length)
+	if _, err := io.ReadFull(hkdf.Expand(sha256.New, secret, b.BytesOrPanic()), out); err != nil {
+		panic(err) // 长度远小于 HKDF 上限，不会发生
+	}
+	return out
+}
+
+// readFrames collects the CRYPTO frames of a decrypted Initial payload
+// 客户端 Initial 包中只会出现 PADDING、PING、ACK、CRYPTO 和 CONNECTION_CLOSE 帧
+func (c *quicConn) readFrames(payload []byte) error {
+	s := cryptobyte.String(payload)
+	for !s.Empty() {
+		typ, ok := readQUICVarint(&s)
+		if !ok {
+			return ErrParseErr
+		}
+		switch typ {
+		case quicFramePadding, quicFramePing:
+		case quicFrameAck, quicFrameAckECN:
+			// largest acknowledged, ack delay, range count, first range
+			var fields [4]uint64
+			for i := range fields {
+				if fields[i], ok = readQUICVarint(&s); !ok {
+					return ErrParseErr
+				}
+			}
+			n := fields[2] * 2
+			if typ == quicFrameAckECN {
+				n += 3
+			}
+			for ; n > 0; n-- {
+				if _, ok := readQUICVarint(&s); !ok {
+					return ErrParseErr
+				}
+			}
+		case quicFrameCrypto:
+			offset, ok1 := readQUICVarint(&s)
+			length, ok2 := readQUICVarint(&s)
+			var data []byte
+			if !ok1 || !ok2 || !s.ReadBytes(&data, int(length)) {
+				return ErrParseErr
+			}
+			c.addCrypto(offset, data)
+		case quicFrameConnectionClose:
+			return nil
+		default:
+			return fmt.Errorf("%w: unexpected QUIC frame 0x%x in Initial packet", ErrParseErr, typ)
+		}
+	}
+	return nil
+}
+
+// addCrypto adds CRYPTO frame data at offset; 帧可能乱序或重复（如 Chrome 打乱帧顺序）
+func (c *quicConn) addCrypto(offset uint64, data []byte) {
+	end := offset + uint64(len(data))
+	if end <= uint64(len(c.crypto)) {
+		return
+	}
+	if offset > uint64(len(c.crypto)) {
+		if c.buffered+len(data) > quicMaxCryptoData {
+			return
+		}
+		if c.frags == nil {
+			c.frags = make(map[uint64][]byte)
+		}
+		c.frags[offset] = append([]byte(nil), data...)
+		c.buffered += len(data)
+		return
+	}
+	if end > quicMaxCryptoData {
+		return
+	}
+	c.crypto = append(c.crypto, data[uint64(len(c.crypto))-offset:]...)
+
+	// 合并已经连续的乱序数据
+	for merged := true; merged; {
+		merged = false
+		for off, frag := range c.frags {
+			if off > uint64(len(c.crypto)) {
+				continue
+			}
+			delete(c.frags, off)
+			c.buffered -= len(frag)
+			if fragEnd := off + uint64(len(frag)); fragEnd > uint64(len(c.crypto)) {
+				c.crypto = append(c.crypto, frag[uint64(len(c.crypto))-off:]...)
+			}
+			merged = true
+		}
+	}
+}
+
+// clientHello parses the ClientHello once the CRYPTO stream holds the whole message
+func (c *quicConn) clientHello() (*tlsHello, error) {
+	if len(c.crypto) < tlsHandshakeHeaderLen {
+		return nil, errQUICIncomplete
+	}
+	if c.crypto[0] != tlsClientHello {
+		return nil, ErrNotQUIC
+	}
+	size := int(c.crypto[1])<<16 | int(c.crypto[2])<<8 | int(c.crypto[3])
+	if len(c.crypto) < tlsHandshakeHeaderLen+size {
+		return nil, errQUICIncomplete
+	}
+	return parseHello(tlsClientHello, c.crypto[tlsHandshakeHeaderLen:tlsHandshakeHeaderLen+size])
+}
+
+// readQUICVarint reads a variable-length integer (RFC 9000 16)
+func readQUICVarint(s *cryptobyte.String) (uint64, bool) {
+	var first uint8
+	if !s.ReadUint8(&first) {
+		return 0, false
+	}
+	v := uint64(first & 0x3f)
+	for n := 1<<(first>>6) - 1; n > 0; n-- {
+		var b uint8
+		if !s.ReadUint8(&b) {
+			return 0, false
+		}
+		v = v<<8 | uint64(b)
+	}
+	return v, true
+}
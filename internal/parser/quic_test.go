@@ -0,0 +1,241 @@
+package parser
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/cryptobyte"
+	"sniffer/pkg/model"
+)
+
+func unhex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("decode hex %q: %v", s, err)
+	}
+	return b
+}
+
+func TestQUICClientInitialKeys(t *testing.T) {
+	tests := []struct {
+		name        string
+		version     uint32
+		key, iv, hp string
+		dcid        string
+	}{
+		// RFC 9001 Appendix A.1
+		{"v1", quicVersion1, "1f369613dd76d5467730efcbe3b1a22d", "fa044b2f42a3fd3b46fb255c", "9f50449e04a0e810283a1e9933adedd2", "8394c8f03e515708"},
+		// RFC 9369 Appendix A.1
+		{"v2", quicVersion2, "8b1a0bc121284290a29e0971b5cd045d", "91f73e2351d8fa91660e909f", "45b95e15235d6f45a6b19cbcb0294ba9", "8394c8f03e515708"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, iv, hp := quicClientInitialKeys(quicVersions[tt.version], unhex(t, tt.dcid))
+			if hex.EncodeToString(key) != tt.key || hex.EncodeToString(iv) != tt.iv || hex.EncodeToString(hp) != tt.hp {
+				t.Errorf("keys = %x / %x / %x, want %s / %s / %s", key, iv, hp, tt.key, tt.iv, tt.hp)
+			}
+		})
+	}
+}
+
+// protectInitial builds a client Initial packet carrying payload, protected as in RFC 9001 5
+// 包号固定用 4 字节编码，与 RFC 9001 附录 A.2 相同
+func protectInitial(t *testing.T, version uint32, dcid []byte, pn uint32, payload []byte) []byte {
+	t.Helper()
+	params := quicVersions[version]
+	key, iv, hp := quicClientInitialKeys(params, dcid)
+
+	var b cryptobyte.Builder
+	b.AddUint8(0xc0 | params.initialType<<4 | 0x03)
+	b.AddUint32(version)
+	b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes(dcid) })
+	b.AddUint8(0) // scid
+	b.AddUint8(0) // token
+	b.AddUint16(0x4000 | uint16(4+len(payload)+16))
+	b.AddUint32(pn)
+	header := b.BytesOrPanic()
+	pnOffset := len(header) - 4
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := append([]byte(nil), iv...)
+	for i := 0; i < 4; i++ {
+		nonce[len(nonce)-1-i] ^= byte(pn >> (8 * i))
+	}
+	packet := aead.Seal(append([]byte(nil), header...), nonce, payload, header)
+
+	hpBlock, err := aes.NewCipher(hp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mask := make([]byte, aes.BlockSize)
+	hpBlock.Encrypt(mask, packet[pnOffset+4:pnOffset+4+quicSampleLen])
+	packet[0] ^= mask[0] & 0x0f
+	for i := 0; i < 4; i++ {
+		packet[pnOffset+i] ^= mask[1+i]
+	}
+	return packet
+}
+
+// cryptoFrame returns a CRYPTO frame carrying data[from:to] at its offset, padded to size bytes
+func cryptoFrame(data []byte, from, to, size int) []byte {
+	var b cryptobyte.Builder
+	b.AddUint8(quicFrameCrypto)
+	addQUICVarint(&b, uint64(from))
+	addQUICVarint(&b, uint64(to-from))
+	b.AddBytes(data[from:to])
+	frame := b.BytesOrPanic()
+	if len(frame) < size {
+		frame = append(frame, make([]byte, size-len(frame))...) // PADDING
+	}
+	return frame
+}
+
+func addQUICVarint(b *cryptobyte.Builder, v uint64) {
+	switch {
+	case v < 1<<6:
+		b.AddUint8(uint8(v))
+	case v < 1<<14:
+		b.AddUint16(0x4000 | uint16(v))
+	default:
+		b.AddUint32(0x80000000 | uint32(v))
+	}
+}
+
+// TestQUICProtectionVector checks the test packet protection against the protected header of RFC 9001 A.2
+// 首个 CRYPTO 帧的前 16 字节与 RFC 相同时，采样和包头保护的结果与 RFC 一致
+func TestQUICProtectionVector(t *testing.T) {
+	payload := make([]byte, 1162)
+	copy(payload, unhex(t, "060040f1010000ed0303ebf8fa56f129"))
+	packet := protectInitial(t, quicVersion1, unhex(t, "8394c8f03e515708"), 2, payload)
+
+	want := unhex(t, "c000000001088394c8f03e5157080000449e7b9aec34d1b1c98dd7689fb8ec11d242b123dc9b")
+	if !bytes.HasPrefix(packet, want) {
+		t.Fatalf("protected packet starts with %x, want %x", packet[:len(want)], want)
+	}
+	if len(packet) != 1200 {
+		t.Errorf("packet length = %d, want 1200", len(packet))
+	}
+
+	initial, rest, err := parseQUICLongHeader(packet)
+	if err != nil || len(rest) != 0 {
+		t.Fatalf("parseQUICLongHeader: %v, %d bytes left", err, len(rest))
+	}
+	got, err := initial.decrypt()
+	if err != nil {
+		t.Fatalf("decrypt: %v", err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Error("decrypted payload differs")
+	}
+}
+
+func TestQUICTracker(t *testing.T) {
+	// ClientHello 握手消息（CRYPTO 流的内容）
+	hello := tlsRecord(tlsClientHello, ja4ClientHello())[tlsRecordHeaderLen:]
+	dcid := unhex(t, "8394c8f03e515708")
+	half := len(hello) / 2
+
+	udp := func(payload ...[]byte) *model.Packet {
+		return &model.Packet{
+			Timestamp: time.Unix(1700000000, 0),
+			Protocol:  "UDP",
+			SrcIP:     "192.168.1.10", DstIP: "93.184.216.34",
+			SrcPort: 50125, DstPort: 443,
+			Payload: bytes.Join(payload, nil),
+		}
+	}
+	tampered := protectInitial(t, quicVersion1, dcid, 0, cryptoFrame(hello, 0, len(hello), 1162))
+	tampered[len(tampered)-1] ^= 0xff
+
+	tests := []struct {
+		name    string
+		packets []*model.Packet
+		errs    []error // 每个数据包的期望错误，最后一个包输出会话时为 nil
+		version string
+	}{
+		{
+			name:    "single Initial",
+			packets: []*model.Packet{udp(protectInitial(t, quicVersion1, dcid, 0, cryptoFrame(hello, 0, len(hello), 1162)))},
+			errs:    []error{nil},
+			version: "QUIC v1",
+		},
+		{
+			name:    "QUIC v2",
+			packets: []*model.Packet{udp(protectInitial(t, quicVersion2, dcid, 0, cryptoFrame(hello, 0, len(hello), 1162)))},
+			errs:    []error{nil},
+			version: "QUIC v2",
+		},
+		{
+			name: "ClientHello over two Initials, second first",
+			packets: []*model.Packet{
+				udp(protectInitial(t, quicVersion1, dcid, 1, cryptoFrame(hello, half, len(hello), 1162))),
+				udp(protectInitial(t, quicVersion1, dcid, 0, cryptoFrame(hello, 0, half, 1162))),
+			},
+			errs:    []error{errQUICIncomplete, nil},
+			version: "QUIC v1",
+		},
+		{
+			name: "coalesced Initials",
+			packets: []*model.Packet{udp(
+				protectInitial(t, quicVersion1, dcid, 0, cryptoFrame(hello, 0, half, 100)),
+				protectInitial(t, quicVersion1, dcid, 1, cryptoFrame(hello, half, len(hello), 100)),
+			)},
+			errs:    []error{nil},
+			version: "QUIC v1",
+		},
+		{
+			name:    "tampered packet",
+			packets: []*model.Packet{udp(tampered)},
+			errs:    []error{ErrNotQUIC},
+		},
+		{
+			name:    "short header",
+			packets: []*model.Packet{udp(append([]byte{0x40}, make([]byte, 40)...))},
+			errs:    []error{ErrNotQUIC},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewQUICTracker()
+			var session *model.Session
+			for i, pkt := range tt.packets {
+				s, err := tracker.Parse(pkt)
+				if !errors.Is(err, tt.errs[i]) {
+					t.Fatalf("packet %d: err = %v, want %v", i, err, tt.errs[i])
+				}
+				session = s
+			}
+			if tt.errs[len(tt.errs)-1] != nil {
+				return
+			}
+			if session.Type != "QUIC" || session.QUICVersion != tt.version || session.TLSVersion != "TLS 1.3" {
+				t.Errorf("Type = %q, QUICVersion = %q, TLSVersion = %q", session.Type, session.QUICVersion, session.TLSVersion)
+			}
+			if session.SNI != "example.com" || session.ALPN != "h2,http/1.1" {
+				t.Errorf("SNI = %q, ALPN = %q", session.SNI, session.ALPN)
+			}
+			if session.JA4 != "q13d1516h2_8daaf6152771_e5627efa2ab1" {
+				t.Errorf("JA4 = %s", session.JA4)
+			}
+
+			// 输出后的重传不再产生会话
+			if _, err := tracker.Parse(tt.packets[len(tt.packets)-1]); !errors.Is(err, errQUICIncomplete) {
+				t.Errorf("retransmission: err = %v, want %v", err, errQUICIncomplete)
+			}
+		})
+	}
+}
@@ -0,0 +1,413 @@
+package parser
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/reassembly"
+	"sniffer/pkg/model"
+)
+
+// invalidSequence is the next sequence of a stream half that has not started (gopacket/reassembly 中未导出)
+const invalidSequence = reassembly.Sequence(-1)
+
+// reassemblyMaxHandshakes is the limit of the handshakes kept for flows not yet classified
+const reassemblyMaxHandshakes = 65536
+
+// ErrStreamOverflow is returned by a StreamParser when its buffer limit is exceeded
+var ErrStreamOverflow = errors.New("stream buffer limit exceeded")
+
+// StreamParser parses one direction of a reassembled TCP connection
+// 重组器按序交付字节流，乱序和重传已处理
+type StreamParser interface {
+	// Feed parses the next in-order bytes of the stream.
+	// skip > 0 means skip bytes before data were lost and will never arrive.
+	Feed(data []byte, skip int, ts time.Time) ([]*model.Session, error)
+
+	// Close is called when the connection ends (FIN/RST, timeout or capture stop)
+	// and returns the messages still pending.
+	Close(ts time.Time) []*model.Session
+}
+
+// StreamProtocol is an application protocol parsed from reassembled TCP streams
+// 由注册的 Dissector 提供，重组器按载荷识别结果或服务端端口选择
+type StreamProtocol struct {
+	// IsServerPort reports whether port is a server port of the protocol
+	// 未看到握手的连接据此确定客户端方向
+	IsServerPort func(port uint16) bool
+	// NewParsers creates the parsers of both directions of a new connection
+	// client 为客户端 -> 服务端方向的五元组
+	NewParsers func(client model.FiveTuple, maxBuffer int) (toServer, toClient StreamParser)
+}
+
+// ReassemblyOptions represents the limits of the TCP reassembler
+type ReassemblyOptions struct {
+	MaxPagesTotal   int           // 所有连接缓存的乱序报文页数上限，0 表示不限制
+	MaxPagesPerConn int           // 单个连接缓存的乱序报文页数上限，0 表示不限制
+	MaxBuffer       int           // 单个方向解析器缓存的未解析数据上限（字节）
+	Timeout         time.Duration // 连接空闲超时
+}
+
+// Reassembler reassembles TCP connections of the stream protocols and parses their byte streams
+// 基于 gopacket/reassembly；gopacket 的 Assembler 不支持并发，所有调用由 mu 串行化
+type Reassembler struct {
+	mu        sync.Mutex
+	opts      ReassemblyOptions
+	assembler *reassembly.Assembler
+	pending   []*model.Session // 当前调用中解析完成的会话
+	lastSeen  time.Time        // 最新的数据包时间戳，超时按数据包时间计算（离线回放同样适用）
+	stats     model.ReassemblyStats
+	tcp       layers.TCP // 复用的 TCP 层，受 mu 保护
+
+	// 尚未确定流协议的连接的握手报文：非标准端口上的连接在载荷识别后才交给重组器，
+	// 识别前的 SYN / SYN-ACK 在此保留，连接建立时先重放，以确定客户端方向和起始序号
+	handshakes map[classifyKey]*handshake
+}
+
+// handshake is the SYN and SYN-ACK of a connection not yet followed by the reassembler
+type handshake struct {
+	syn, synAck *model.Packet
+	lastSeen    time.Time
+}
+
+// NewReassembler creates a TCP reassembler with the given limits
+func NewReassembler(opts ReassemblyOptions) *Reassembler {
+	r := &Reassembler{opts: opts, handshakes: make(map[classifyKey]*handshake)}
+	r.stats.Enabled = true
+
+	pool := reassembly.NewStreamPool(&streamFactory{r: r})
+	r.assembler = reassembly.NewAssembler(pool)
+	r.assembler.MaxBufferedPagesTotal = opts.MaxPagesTotal
+	r.assembler.MaxBufferedPagesPerConnection = opts.MaxPagesPerConn
+	return r
+}
+
+// Assemble feeds a TCP packet to the reassembler and returns the sessions it completed
+// 既不是流协议端口、载荷也未识别为流协议的数据包只记录握手
+func (r *Reassembler) Assemble(pkt *model.Packet) []*model.Session {
+	if pkt.Protocol != "TCP" {
+		return nil
+	}
+
+	var endpoint gopacket.EndpointType
+	switch len(pkt.SrcAddr) {
+	case net.IPv4len:
+		endpoint = layers.EndpointIPv4
+	case net.IPv6len:
+		endpoint = layers.EndpointIPv6
+	default:
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// 解码结果只在本次调用中使用，TCP 层结构体在数据包之间复用
+	if err := r.tcp.DecodeFromBytes(pkt.Transport, gopacket.NilDecodeFeedback); err != nil {
+		return nil
+	}
+
+	if pkt.Timestamp.After(r.lastSeen) {
+		r.lastSeen = pkt.Timestamp
+	}
+
+	proto := findStreamProtocol(pkt)
+	if proto == nil {
+		r.trackHandshakeLocked(pkt)
+		return nil
+	}
+
+	// 载荷识别后首次交给重组器的连接：先重放识别前的握手
+	key, _ := newClassifyKey(pkt)
+	if hs := r.handshakes[key]; hs != nil {
+		delete(r.handshakes, key)
+		for _, p := range []*model.Packet{hs.syn, hs.synAck} {
+			if p != nil && r.tcp.DecodeFromBytes(p.Transport, gopacket.NilDecodeFeedback) == nil {
+				r.assembleLocked(endpoint, p, proto)
+			}
+		}
+		if err := r.tcp.DecodeFromBytes(pkt.Transport, gopacket.NilDecodeFeedback); err != nil {
+			return r.takePendingLocked()
+		}
+	}
+
+	r.assembleLocked(endpoint, pkt, proto)
+	return r.takePendingLocked()
+}
+
+// assembleLocked feeds a packet whose TCP layer is decoded in r.tcp to the assembler
+func (r *Reassembler) assembleLocked(endpoint gopacket.EndpointType, pkt *model.Packet, proto *StreamProtocol) {
+	ctx := &assemblerContext{
+		ci: gopacket.CaptureInfo{
+			Timestamp:     pkt.Timestamp,
+			CaptureLength: pkt.CaptureLen,
+			Length:        pkt.Length,
+		},
+		pkt:   pkt,
+		proto: proto,
+	}
+	r.assembler.AssembleWithContext(gopacket.NewFlow(endpoint, pkt.SrcAddr, pkt.DstAddr), &r.tcp, ctx)
+}
+
+// trackHandshakeLocked records the SYN / SYN-ACK of a connection without a stream protocol
+// RST / FIN 表示连接结束，删除记录
+func (r *Reassembler) trackHandshakeLocked(pkt *model.Packet) {
+	key, _ := newClassifyKey(pkt)
+	if r.tcp.RST || r.tcp.FIN {
+		delete(r.handshakes, key)
+		return
+	}
+	if !r.tcp.SYN {
+		return
+	}
+
+	hs := r.handshakes[key]
+	if hs == nil {
+		if len(r.handshakes) >= reassemblyMaxHandshakes {
+			r.pruneHandshakesLocked()
+			if len(r.handshakes) >= reassemblyMaxHandshakes {
+				return
+			}
+		}
+		hs = &handshake{}
+		r.handshakes[key] = hs
+	}
+	cp := *pkt
+	if r.tcp.ACK {
+		hs.synAck = &cp
+	} else {
+		// 新的 SYN（包括端口复用的新连接）重新开始记录
+		hs.syn, hs.synAck = &cp, nil
+	}
+	hs.lastSeen = pkt.Timestamp
+}
+
+// pruneHandshakesLocked drops the handshakes older than the connection timeout
+func (r *Reassembler) pruneHandshakesLocked() {
+	cutoff := r.lastSeen.Add(-r.opts.Timeout)
+	for key, hs := range r.handshakes {
+		if hs.lastSeen.Before(cutoff) {
+			delete(r.handshakes, key)
+		}
+	}
+}
+
+// Flush skips the missing data of connections waiting longer than the timeout,
+// closes the idle connections and returns the sessions completed by it
+func (r *Reassembler) Flush() []*model.Session {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.lastSeen.IsZero() {
+		return nil
+	}
+	r.assembler.FlushCloseOlderThan(r.lastSeen.Add(-r.opts.Timeout))
+	r.pruneHandshakesLocked()
+	return r.takePendingLocked()
+}
+
+// FlushAll closes all connections (capture stopped) and returns the sessions still pending
+func (r *Reassembler) FlushAll() []*model.Session {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.assembler.FlushAll()
+	r.handshakes = make(map[classifyKey]*handshake)
+	r.lastSeen = time.Time{}
+	return r.takePendingLocked()
+}
+
+// Stats returns the reassembly counters
+func (r *Reassembler) Stats() model.ReassemblyStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stats
+}
+
+func (r *Reassembler) takePendingLocked() []*model.Session {
+	sessions := r.pending
+	r.pending = nil
+	r.stats.Sessions += int64(len(sessions))
+	return sessions
+}
+
+// findStreamProtocol returns the stream protocol of a connection from the registered dissectors
+// 优先使用载荷识别结果，未识别时按端口判断
+func findStreamProtocol(pkt *model.Packet) *StreamProtocol {
+	dissectors := Dissectors()
+	if pkt.AppProtocol != "" {
+		for _, d := range dissectors {
+			if d.Name() != pkt.AppProtocol {
+				continue
+			}
+			if p := d.StreamProtocol(); p != nil {
+				return p
+			}
+		}
+	}
+	for _, d := range dissectors {
+		if p := d.StreamProtocol(); p != nil && (p.IsServerPort(pkt.DstPort) || p.IsServerPort(pkt.SrcPort)) {
+			return p
+		}
+	}
+	return nil
+}
+
+// reverseTuple returns the 5-tuple of the opposite direction
+func reverseTuple(t model.FiveTuple) model.FiveTuple {
+	return model.FiveTuple{
+		SrcIP:    t.DstIP,
+		DstIP:    t.SrcIP,
+		SrcPort:  t.DstPort,
+		DstPort:  t.SrcPort,
+		Protocol: t.Protocol,
+	}
+}
+
+// assemblerContext carries the capture info, the packet and its stream protocol through the assembler
+type assemblerContext struct {
+	ci    gopacket.CaptureInfo
+	pkt   *model.Packet
+	proto *StreamProtocol
+}
+
+func (ac *assemblerContext) GetCaptureInfo() gopacket.CaptureInfo {
+	return ac.ci
+}
+
+// streamFactory creates a tcpStream for each new connection (called with r.mu held)
+type streamFactory struct {
+	r *Reassembler
+}
+
+func (f *streamFactory) New(netFlow, tcpFlow gopacket.Flow, tcp *layers.TCP, ac reassembly.AssemblerContext) reassembly.Stream {
+	s := &tcpStream{r: f.r}
+
+	// 首个数据包不一定来自客户端（抓包开始时连接已建立或 SYN 乱序到达）：SYN 按握手标志确定方向，
+	// 其余按服务端端口确定；非标准端口上按载荷识别、又没有看到握手的连接，假定首个数据包由客户端发出
+	proto := ac.(*assemblerContext).proto
+	if tcp.SYN {
+		s.reversed = tcp.ACK
+	} else {
+		s.reversed = proto.IsServerPort(uint16(tcp.SrcPort)) && !proto.IsServerPort(uint16(tcp.DstPort))
+	}
+
+	client := model.FiveTuple{
+		SrcIP:    netFlow.Src().String(),
+		DstIP:    netFlow.Dst().String(),
+		SrcPort:  uint16(tcp.SrcPort),
+		DstPort:  uint16(tcp.DstPort),
+		Protocol: "TCP",
+	}
+	if s.reversed {
+		client = reverseTuple(client)
+	}
+	s.parsers[0], s.parsers[1] = proto.NewParsers(client, f.r.opts.MaxBuffer)
+
+	f.r.stats.Connections++
+	return s
+}
+
+// tcpStream is a TCP connection followed by the reassembler
+type tcpStream struct {
+	r        *Reassembler
+	parsers  [2]StreamParser // 0: 客户端 -> 服务端, 1: 服务端 -> 客户端
+	reversed bool            // 首个数据包由服务端发出
+
+	// 各方向最近确认的序号（按 assembler 方向索引），用于确定未看到 SYN 的方向从何处开始重组
+	ack    [2]reassembly.Sequence
+	hasAck [2]bool
+
+	// 连接关联的进程信息，填充到解析出的会话
+	processPID  int32
+	processName string
+	processExe  string
+}
+
+func (s *tcpStream) Accept(tcp *layers.TCP, ci gopacket.CaptureInfo, dir reassembly.TCPFlowDirection, nextSeq reassembly.Sequence, start *bool, ac reassembly.AssemblerContext) bool {
+	if ctx, ok := ac.(*assemblerContext); ok && ctx.pkt.ProcessPID != 0 {
+		s.processPID = ctx.pkt.ProcessPID
+		s.processName = ctx.pkt.ProcessName
+		s.processExe = ctx.pkt.ProcessExe
+	}
+
+	if tcp.ACK {
+		s.ack[dirIndex(dir)], s.hasAck[dirIndex(dir)] = reassembly.Sequence(tcp.Ack), true
+	}
+
+	// 没有看到 SYN 的方向（抓包前已建立）不从首个到达的报文开始，以免乱序时跳过前面的数据：
+	// 报文覆盖对端已确认的序号时从这里开始（之前的数据对端已收到）；
+	// 否则报文先缓存，超时刷新或缓存页数达到上限时从序号最小的报文开始交付
+	if rev := dirIndex(dir.Reverse()); !*start && nextSeq == invalidSequence && s.hasAck[rev] {
+		d := reassembly.Sequence(tcp.Seq).Difference(s.ack[rev])
+		*start = d == 0 || (d > 0 && d < len(tcp.Payload))
+	}
+	return true
+}
+
+func (s *tcpStream) ReassembledSG(sg reassembly.ScatterGather, ac reassembly.AssemblerContext) {
+	dir, _, _, skip := sg.Info()
+	length, _ := sg.Lengths()
+	stats := sg.Stats()
+
+	s.r.stats.Bytes += int64(length)
+	s.r.stats.OverlapBytes += int64(stats.OverlapBytes)
+	s.r.stats.OutOfOrder += int64(stats.QueuedPackets)
+	if skip > 0 {
+		s.r.stats.MissedBytes += int64(skip)
+	}
+	if length == 0 && skip <= 0 {
+		return
+	}
+
+	parser := s.parser(dir)
+	sessions, err := parser.Feed(sg.Fetch(length), skip, sg.CaptureInfo(0).Timestamp)
+	if errors.Is(err, ErrStreamOverflow) {
+		s.r.stats.BufferOverflows++
+	}
+	s.emit(sessions)
+}
+
+func (s *tcpStream) ReassemblyComplete(ac reassembly.AssemblerContext) bool {
+	ts := s.r.lastSeen
+	for _, parser := range s.parsers {
+		s.emit(parser.Close(ts))
+	}
+
+	s.r.stats.Connections--
+	s.r.stats.Closed++
+	// 连接结束后从连接池移除
+	return true
+}
+
+// dirIndex returns the index of an assembler direction
+func dirIndex(dir reassembly.TCPFlowDirection) int {
+	if dir == reassembly.TCPDirClientToServer {
+		return 0
+	}
+	return 1
+}
+
+// parser returns the parser of the given assembler direction
+func (s *tcpStream) parser(dir reassembly.TCPFlowDirection) StreamParser {
+	if (dir == reassembly.TCPDirClientToServer) != s.reversed {
+		return s.parsers[0]
+	}
+	return s.parsers[1]
+}
+
+// emit fills the process info and queues the parsed sessions
+func (s *tcpStream) emit(sessions []*model.Session) {
+	for _, session := range sessions {
+		if session.ProcessPID == 0 {
+			session.ProcessPID = s.processPID
+			session.ProcessName = s.processName
+			session.ProcessExe = s.processExe
+		}
+		s.r.pending = append(s.r.pending, session)
+	}
+}
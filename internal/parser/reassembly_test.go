@@ -0,0 +1,284 @@
+package parser
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"sniffer/pkg/model"
+)
+
+const (
+	testHTTPRequest  = "GET /index.html HTTP/1.1\r\nHost: www.example.com\r\nUser-Agent: test\r\n\r\n"
+	testHTTPResponse = "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nContent-Length: 5\r\n\r\nhello"
+)
+
+// tcpSegment is a TCP segment of the test connection 10.0.0.1:40000 <-> 10.0.0.2:port
+type tcpSegment struct {
+	toServer bool
+	flags    string // S: SYN, A: ACK, F: FIN
+	seq, ack uint32
+	payload  string
+	port     uint16 // 服务端端口，0 表示 80
+}
+
+func (s tcpSegment) packet(t *testing.T, d *Decoder, ts time.Time) *model.Packet {
+	t.Helper()
+	ip := ipv4("10.0.0.1", "10.0.0.2", layers.IPProtocolTCP)
+	tcp := &layers.TCP{SrcPort: 40000, DstPort: 80, Seq: s.seq, Ack: s.ack, Window: 65535}
+	if s.port != 0 {
+		tcp.DstPort = layers.TCPPort(s.port)
+	}
+	if !s.toServer {
+		ip.SrcIP, ip.DstIP = ip.DstIP, ip.SrcIP
+		tcp.SrcPort, tcp.DstPort = tcp.DstPort, tcp.SrcPort
+	}
+	for _, f := range s.flags {
+		switch f {
+		case 'S':
+			tcp.SYN = true
+		case 'A':
+			tcp.ACK = true
+		case 'F':
+			tcp.FIN = true
+		}
+	}
+	data := serialize(t, ethernet(layers.EthernetTypeIPv4), ip, tcp, gopacket.Payload(s.payload))
+	pkt, err := d.Decode(data, ts, int(layers.LinkTypeEthernet))
+	if err != nil {
+		t.Fatalf("decode segment: %v", err)
+	}
+	return pkt
+}
+
+// split cuts s into the given number of parts of about the same length
+func split(s string, n int) []string {
+	parts := make([]string, 0, n)
+	size := (len(s) + n - 1) / n
+	for len(s) > size {
+		parts = append(parts, s[:size])
+		s = s[size:]
+	}
+	return append(parts, s)
+}
+
+// dataSegments returns the segments carrying payload split into n parts starting at seq
+func dataSegments(toServer bool, seq, ack uint32, payload string, n int) []tcpSegment {
+	var segs []tcpSegment
+	for _, part := range split(payload, n) {
+		segs = append(segs, tcpSegment{toServer: toServer, flags: "A", seq: seq, ack: ack, payload: part})
+		seq += uint32(len(part))
+	}
+	return segs
+}
+
+func TestReassemblerHTTP(t *testing.T) {
+	const clientISN, serverISN = 1000, 5000
+	reqSeq, respSeq := uint32(clientISN+1), uint32(serverISN+1)
+	reqEnd, respEnd := reqSeq+uint32(len(testHTTPRequest)), respSeq+uint32(len(testHTTPResponse))
+
+	handshake := []tcpSegment{
+		{toServer: true, flags: "S", seq: clientISN},
+		{toServer: false, flags: "SA", seq: serverISN, ack: reqSeq},
+		{toServer: true, flags: "A", seq: reqSeq, ack: respSeq},
+	}
+	request := dataSegments(true, reqSeq, respSeq, testHTTPRequest, 3)
+	response := dataSegments(false, respSeq, reqEnd, testHTTPResponse, 2)
+	teardown := []tcpSegment{
+		{toServer: true, flags: "FA", seq: reqEnd, ack: respEnd},
+		{toServer: false, flags: "FA", seq: respEnd, ack: reqEnd + 1},
+	}
+	concat := func(parts ...[]tcpSegment) []tcpSegment {
+		var all []tcpSegment
+		for _, p := range parts {
+			all = append(all, p...)
+		}
+		return all
+	}
+
+	tests := []struct {
+		name     string
+		segments []tcpSegment
+		status   int // 期望的响应状态码，0 表示只有请求
+	}{
+		{
+			name:     "in order",
+			segments: concat(handshake, request, response, teardown),
+			status:   200,
+		},
+		{
+			name:     "one byte segments",
+			segments: concat(handshake, dataSegments(true, reqSeq, respSeq, testHTTPRequest, len(testHTTPRequest)), response, teardown),
+			status:   200,
+		},
+		{
+			name:     "out of order",
+			segments: concat(handshake, []tcpSegment{request[2], request[0], request[1]}, []tcpSegment{response[1], response[0]}, teardown),
+			status:   200,
+		},
+		{
+			name:     "retransmitted",
+			segments: concat(handshake, []tcpSegment{request[0], request[1], request[0], request[1], request[2]}, response, []tcpSegment{response[1]}, teardown),
+			status:   200,
+		},
+		{
+			name: "syn after data",
+			// SYN 晚于首个数据报文到达，不能从数据报文开始重组
+			segments: concat([]tcpSegment{request[1]}, handshake, []tcpSegment{request[0], request[2]}, response, teardown),
+			status:   200,
+		},
+		{
+			name: "established connection out of order",
+			// 抓包前已建立的连接：对端的确认序号之前的数据已收到，从确认处开始
+			segments: concat([]tcpSegment{{toServer: false, flags: "A", seq: respSeq, ack: reqSeq}},
+				[]tcpSegment{request[1], request[2], request[0]}, response, teardown),
+			status: 200,
+		},
+		{
+			name: "established connection without acknowledgement",
+			// 没有对端确认时缓存，结束时从序号最小的报文开始交付
+			segments: []tcpSegment{request[2], request[1], request[0]},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewReassembler(ReassemblyOptions{MaxBuffer: 64 << 10, Timeout: time.Minute})
+			d := NewDecoder()
+			ts := time.Unix(1700000000, 0)
+
+			var sessions []*model.Session
+			for _, seg := range tt.segments {
+				ts = ts.Add(time.Millisecond)
+				sessions = append(sessions, r.Assemble(seg.packet(t, d, ts))...)
+			}
+			sessions = append(sessions, r.FlushAll()...)
+
+			if len(sessions) != 1 {
+				t.Fatalf("got %d sessions, want 1: %+v", len(sessions), sessions)
+			}
+			s := sessions[0]
+			if s.Type != "HTTP" || s.Method != "GET" || s.Path != "/index.html" || s.Host != "www.example.com" || s.UserAgent != "test" {
+				t.Errorf("request = %s %s %s host=%q ua=%q", s.Type, s.Method, s.Path, s.Host, s.UserAgent)
+			}
+			if s.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", s.StatusCode, tt.status)
+			}
+			if s.FiveTuple.SrcIP != "10.0.0.1" || s.FiveTuple.DstPort != 80 {
+				t.Errorf("five tuple = %+v, want client 10.0.0.1 -> :80", s.FiveTuple)
+			}
+			if tt.status != 0 && s.ResponseSize != len(testHTTPResponse) {
+				t.Errorf("response size = %d, want %d", s.ResponseSize, len(testHTTPResponse))
+			}
+		})
+	}
+}
+
+// tcpConversation returns the segments of a connection to port exchanging msgs after the handshake
+// 每条消息由一个报文段承载，最后双方各发送 FIN
+func tcpConversation(port uint16, msgs []tcpSegment) []tcpSegment {
+	const clientISN, serverISN = 1000, 5000
+	next := [2]uint32{serverISN + 1, clientISN + 1} // 0: 服务端, 1: 客户端
+	segs := []tcpSegment{
+		{toServer: true, flags: "S", seq: clientISN},
+		{toServer: false, flags: "SA", seq: serverISN, ack: next[1]},
+		{toServer: true, flags: "A", seq: next[1], ack: next[0]},
+	}
+	side := func(toServer bool) int {
+		if toServer {
+			return 1
+		}
+		return 0
+	}
+	for _, m := range msgs {
+		from := side(m.toServer)
+		segs = append(segs, tcpSegment{toServer: m.toServer, flags: "A", seq: next[from], ack: next[1-from], payload: m.payload})
+		next[from] += uint32(len(m.payload))
+	}
+	segs = append(segs,
+		tcpSegment{toServer: true, flags: "FA", seq: next[1], ack: next[0]},
+		tcpSegment{toServer: false, flags: "FA", seq: next[0], ack: next[1] + 1},
+	)
+	for i := range segs {
+		segs[i].port = port
+	}
+	return segs
+}
+
+func TestReassemblerClassifiedFlows(t *testing.T) {
+	const (
+		clientBanner = "SSH-2.0-OpenSSH_9.6p1"
+		serverBanner = "SSH-2.0-OpenSSH_8.9p1"
+	)
+	type result struct {
+		Type, Method, Path         string
+		Status                     int
+		ClientBanner, ServerBanner string
+	}
+
+	tests := []struct {
+		name     string
+		segments []tcpSegment
+		want     result
+	}{
+		{
+			name: "HTTP on port 3000",
+			segments: tcpConversation(3000, []tcpSegment{
+				{toServer: true, payload: testHTTPRequest},
+				{toServer: false, payload: testHTTPResponse},
+			}),
+			want: result{Type: "HTTP", Method: "GET", Path: "/index.html", Status: 200},
+		},
+		{
+			name: "HTTP on port 3000 with the request in two segments",
+			segments: tcpConversation(3000, []tcpSegment{
+				{toServer: true, payload: testHTTPRequest[:20]},
+				{toServer: true, payload: testHTTPRequest[20:]},
+				{toServer: false, payload: testHTTPResponse},
+			}),
+			want: result{Type: "HTTP", Method: "GET", Path: "/index.html", Status: 200},
+		},
+		{
+			name: "SSH on port 2222 with the server banner first",
+			segments: tcpConversation(2222, []tcpSegment{
+				{toServer: false, payload: serverBanner + "\r\n"},
+				{toServer: true, payload: clientBanner + "\r\n"},
+				{toServer: true, payload: string(sshPacket(testSSHClientKex))},
+				{toServer: false, payload: string(sshPacket(testSSHServerKex))},
+			}),
+			want: result{Type: "SSH", ClientBanner: clientBanner, ServerBanner: serverBanner},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewReassembler(ReassemblyOptions{MaxBuffer: 64 << 10, Timeout: time.Minute})
+			c := NewClassifier()
+			d := NewDecoder()
+			ts := time.Unix(1700000000, 0)
+
+			var sessions []*model.Session
+			for _, seg := range tt.segments {
+				ts = ts.Add(time.Millisecond)
+				pkt := seg.packet(t, d, ts)
+				pkt.AppProtocol = c.Classify(pkt).Protocol
+				sessions = append(sessions, r.Assemble(pkt)...)
+			}
+			sessions = append(sessions, r.FlushAll()...)
+
+			if len(sessions) != 1 {
+				t.Fatalf("got %d sessions, want 1: %+v", len(sessions), sessions)
+			}
+			s := sessions[0]
+			got := result{s.Type, s.Method, s.Path, s.StatusCode, s.ClientBanner, s.ServerBanner}
+			if got != tt.want {
+				t.Errorf("session:\n got  %+v\n want %+v", got, tt.want)
+			}
+			port := tt.segments[0].port
+			if s.FiveTuple.SrcIP != "10.0.0.1" || s.FiveTuple.SrcPort != 40000 || s.FiveTuple.DstPort != port {
+				t.Errorf("five tuple = %+v, want client 10.0.0.1:40000 -> :%d", s.FiveTuple, port)
+			}
+		})
+	}
+}
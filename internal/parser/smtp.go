@@ -0,0 +1,347 @@
+package parser
+
+import (
+	"mime"
+	"strconv"
+	"strings"
+	"time"
+
+	"sniffer/pkg/model"
+)
+
+// Limits of mail message parsing
+const (
+	maxMailHeaderFields = 128  // 每个头部块记录的字段数
+	maxMailHeaderLine   = 2048 // 展开折行后的字段长度
+	maxMailAttachments  = 32
+	maxMailRecipients   = 64
+)
+
+// isSMTPPort reports whether port is an SMTP (25) or submission (587) port
+func isSMTPPort(port uint16) bool {
+	return port == 25 || port == 587
+}
+
+// smtpConn parses an SMTP connection
+// 每个邮件事务（MAIL FROM、RCPT TO、DATA 内容）合并为一条记录，其它命令（EHLO、AUTH、STARTTLS 等）各一条
+type smtpConn struct {
+	lineSession
+	mail     *model.Session // 当前邮件事务
+	msg      *mailMessage   // 正在接收的邮件内容（DATA 之后）
+	auth     *saslAuth
+	authWait bool // 服务器发出 334 后，下一行为客户端的 SASL 响应
+}
+
+// newSMTPParsers creates the SMTP parsers of both directions of a connection
+func newSMTPParsers(client model.FiveTuple, maxBuffer int) (StreamParser, StreamParser) {
+	return newLineParsers(&smtpConn{lineSession: lineSession{proto: "SMTP", client: client}}, maxBuffer)
+}
+
+// literal skips the message chunk following a BDAT command (RFC 3030)
+func (c *smtpConn) literal(line string, client bool) (int, bool) {
+	if !client || c.msg != nil || c.authWait {
+		return 0, false
+	}
+	verb, arg := splitCommand(line)
+	if verb != "BDAT" {
+		return 0, false
+	}
+	size, _, _ := strings.Cut(arg, " ")
+	n, err := strconv.Atoi(size)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, false
+}
+
+func (c *smtpConn) clientLine(line string, ts time.Time) []*model.Session {
+	size := len(line) + 2
+
+	// DATA 内容以单独的 "." 行结束，行首的 "." 经过转义
+	if c.msg != nil {
+		if line == "." {
+			mail := c.mail
+			c.msg.finish(mail)
+			c.msg, c.mail = nil, nil
+			return c.push(&lineCommand{verb: ".", mail: mail}, nil)
+		}
+		c.mail.PayloadSize += size
+		c.msg.line(strings.TrimPrefix(line, "."))
+		return nil
+	}
+
+	if c.authWait {
+		c.authWait = false
+		if c.auth != nil {
+			c.auth.response(line)
+			c.auth.session.PayloadSize += size
+		}
+		return nil
+	}
+
+	var out []*model.Session
+	verb, arg := splitCommand(line)
+	switch verb {
+	case "MAIL":
+		// 没有 DATA 的上一个事务（如被 RSET 取消）单独输出
+		if c.mail != nil {
+			out = append(out, c.mail)
+		}
+		c.mail = c.record("MAIL", arg, ts, size)
+		c.mail.MailFrom = mailAddress(arg, "FROM:")
+		return c.push(&lineCommand{verb: verb, mail: c.mail}, out)
+
+	case "RCPT":
+		if c.mail == nil {
+			return c.push(&lineCommand{verb: verb}, nil)
+		}
+		c.mail.PayloadSize += size
+		if rcpt := mailAddress(arg, "TO:"); rcpt != "" && strings.Count(c.mail.RcptTo, ",") < maxMailRecipients {
+			if c.mail.RcptTo != "" {
+				c.mail.RcptTo += ","
+			}
+			c.mail.RcptTo += rcpt
+		}
+		return c.push(&lineCommand{verb: verb, mail: c.mail}, nil)
+
+	case "DATA":
+		// 抓包开始于事务中途时没有 MAIL FROM
+		if c.mail == nil {
+			c.mail = c.record("MAIL", "", ts, 0)
+		}
+		c.mail.PayloadSize += size
+		return c.push(&lineCommand{verb: verb, mail: c.mail}, nil)
+
+	case "BDAT":
+		// 分块内容不解析，最后一块的应答结束事务
+		if c.mail != nil {
+			c.mail.PayloadSize += size
+		}
+		if strings.HasSuffix(strings.ToUpper(arg), " LAST") {
+			mail := c.mail
+			c.mail = nil
+			return c.push(&lineCommand{verb: ".", mail: mail}, nil)
+		}
+		return c.push(&lineCommand{verb: verb, mail: c.mail}, nil)
+
+	case "RSET", "QUIT":
+		if c.mail != nil {
+			out = append(out, c.mail)
+			c.mail = nil
+		}
+
+	case "AUTH":
+		mech, initial, _ := strings.Cut(arg, " ")
+		session := c.record(verb, "", ts, size)
+		c.auth = newSASLAuth(session, mech, strings.TrimSpace(initial))
+		return c.push(&lineCommand{verb: verb, session: session}, nil)
+	}
+
+	return c.push(&lineCommand{verb: verb, session: c.record(verb, arg, ts, size)}, out)
+}
+
+func (c *smtpConn) serverLine(line string, ts time.Time) []*model.Session {
+	// 多行应答以 "250-" 形式的行继续，以 "250 " 形式的行结束
+	code, text, final := parseReplyLine(line)
+	if code == "" {
+		return nil
+	}
+	if !final {
+		return nil
+	}
+
+	if code == "334" {
+		c.authWait = c.auth != nil
+		return nil
+	}
+
+	cmd := c.pop()
+	if cmd == nil {
+		return nil // 问候语或没有对应命令的应答
+	}
+	size := len(line) + 2
+
+	switch cmd.verb {
+	case "MAIL", "DATA":
+		mail := cmd.mail
+		if mail == nil {
+			return nil
+		}
+		if cmd.verb == "DATA" && code == "354" {
+			c.msg = newMailMessage()
+			return nil
+		}
+		if code[0] == '2' {
+			return nil
+		}
+		// 发件人或 DATA 被拒绝：事务结束
+		setReply(mail, code, text, ts, size)
+		if c.mail == mail {
+			c.mail = nil
+		}
+		return []*model.Session{mail}
+
+	case "RCPT", "BDAT":
+		return nil
+
+	case ".":
+		if cmd.mail == nil {
+			return nil
+		}
+		setReply(cmd.mail, code, text, ts, size)
+		return []*model.Session{cmd.mail}
+
+	case "AUTH":
+		c.auth, c.authWait = nil, false
+
+	case "STARTTLS":
+		c.tls = code == "220"
+	}
+
+	if cmd.session == nil {
+		return nil
+	}
+	setReply(cmd.session, code, text, ts, size)
+	return []*model.Session{cmd.session}
+}
+
+func (c *smtpConn) close(ts time.Time) []*model.Session {
+	var out []*model.Session
+	if c.mail != nil {
+		if c.msg != nil {
+			c.msg.finish(c.mail)
+		}
+		out = append(out, c.mail)
+		c.mail, c.msg = nil, nil
+	}
+	// 等待应答的事务结束标记也要输出其事务
+	for _, cmd := range c.pending {
+		if cmd.verb == "." && cmd.mail != nil {
+			out = append(out, cmd.mail)
+		}
+	}
+	return c.flush(out)
+}
+
+// parseReplyLine parses an SMTP/FTP reply line "250 text" or "250-text"
+// final 为 false 表示多行应答的中间行
+func parseReplyLine(line string) (code, text string, final bool) {
+	if len(line) < 3 || line[0] < '1' || line[0] > '5' || line[1] < '0' || line[1] > '9' || line[2] < '0' || line[2] > '9' {
+		return "", "", false
+	}
+	if len(line) == 3 {
+		return line, "", true
+	}
+	if line[3] != ' ' && line[3] != '-' {
+		return "", "", false
+	}
+	return line[:3], strings.TrimSpace(line[4:]), line[3] == ' '
+}
+
+// mailAddress extracts the address of a MAIL FROM:<a@b> or RCPT TO:<a@b> argument
+func mailAddress(arg, prefix string) string {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return ""
+	}
+	addr := strings.TrimSpace(arg[len(prefix):])
+	if strings.HasPrefix(addr, "<") {
+		if end := strings.IndexByte(addr, '>'); end > 0 {
+			return printableString([]byte(addr[1:end]))
+		}
+	}
+	// 没有尖括号时取到第一个空格（其后为 SIZE= 等参数）
+	addr, _, _ = strings.Cut(addr, " ")
+	return printableString([]byte(addr))
+}
+
+// mailMessage scans an RFC 5322 message for its subject and attachment names
+// 只检查邮件头和以 "--" 分隔行开始的 MIME 部分头，不解码正文
+type mailMessage struct {
+	inHeader    bool
+	top         bool     // 当前头部块是否为邮件头
+	header      []string // 当前头部块的字段（已展开折行）
+	subject     string
+	attachments []string
+}
+
+func newMailMessage() *mailMessage {
+	return &mailMessage{inHeader: true, top: true}
+}
+
+// line handles a line of the message (已去除 SMTP 的点转义)
+func (m *mailMessage) line(line string) {
+	if !m.inHeader {
+		if strings.HasPrefix(line, "--") && len(line) > 2 {
+			m.inHeader, m.top = true, false
+			m.header = m.header[:0]
+		}
+		return
+	}
+
+	switch {
+	case line == "":
+		m.endHeader()
+	case (line[0] == ' ' || line[0] == '\t') && len(m.header) > 0:
+		last := &m.header[len(m.header)-1]
+		if len(*last) < maxMailHeaderLine {
+			*last += " " + strings.TrimSpace(line)
+		}
+	case len(m.header) < maxMailHeaderFields:
+		m.header = append(m.header, line)
+	}
+}
+
+// endHeader extracts the subject and the attachment name of a header block
+func (m *mailMessage) endHeader() {
+	m.inHeader = false
+
+	var disposition, name string
+	for _, field := range m.header {
+		key, value, ok := strings.Cut(field, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "subject":
+			if m.top {
+				m.subject = truncateText(decodeMailHeader(value), maxLineArgument)
+			}
+		case "content-disposition":
+			if _, params, err := mime.ParseMediaType(value); err == nil {
+				disposition = params["filename"]
+			}
+		case "content-type":
+			if _, params, err := mime.ParseMediaType(value); err == nil {
+				name = params["name"]
+			}
+		}
+	}
+	m.header = m.header[:0]
+
+	// Content-Disposition 的 filename 优先，其次为 Content-Type 的 name
+	if disposition == "" {
+		disposition = name
+	}
+	if disposition != "" && len(m.attachments) < maxMailAttachments {
+		m.attachments = append(m.attachments, strings.ReplaceAll(decodeMailHeader(disposition), ",", "_"))
+	}
+}
+
+// finish stores the subject and attachments in the session
+func (m *mailMessage) finish(session *model.Session) {
+	if m.inHeader && m.top {
+		m.endHeader()
+	}
+	session.Subject = m.subject
+	session.Attachments = strings.Join(m.attachments, ",")
+}
+
+// decodeMailHeader decodes RFC 2047 encoded words, 无法解码的字符集保留原文
+func decodeMailHeader(value string) string {
+	dec := new(mime.WordDecoder)
+	if decoded, err := dec.DecodeHeader(value); err == nil {
+		value = decoded
+	}
+	return printableString([]byte(value))
+}
@@ -0,0 +1,328 @@
+package parser
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"sniffer/pkg/model"
+)
+
+// SSH message numbers (RFC 4253)
+const (
+	sshMsgKexInit = 20
+	sshMsgNewKeys = 21
+)
+
+// Limits and thresholds of SSH parsing
+const (
+	maxSSHPacket       = 256 * 1024 // 明文阶段的最大报文长度，超过时视为非 SSH 数据
+	maxSSHBanner       = 255        // 版本行最大长度（RFC 4253 4.2）
+	sshUsageSegments   = 200        // 加密阶段观察的报文段数，达到后输出会话
+	sshMinSegments     = 20         // 判断会话类型所需的最少报文段数
+	sshSmallSegment    = 128        // 单次按键等交互数据的报文段大小上限
+	sshLargeSegment    = 1000       // 批量传输的报文段大小下限
+	sshBulkBytes       = 64 * 1024  // 批量传输方向的最少字节数
+	sshKexInitNameList = 10         // KEXINIT 中的算法列表数
+)
+
+// SSH session usage
+const (
+	SSHUsageInteractive = "interactive" // 交互式 shell
+	SSHUsageBulk        = "bulk"        // 文件传输（scp/sftp）或端口转发
+)
+
+// SSH stream parser states
+const (
+	sshStateBanner    = iota // 等待版本行
+	sshStatePackets          // 明文的密钥交换报文
+	sshStateEncrypted        // NEWKEYS 之后只统计报文段大小
+	sshStateDone             // 数据丢失或不是 SSH
+)
+
+// isSSHPort reports whether port is the SSH port
+func isSSHPort(port uint16) bool {
+	return port == 22
+}
+
+// sshKexInit holds the name-lists of a KEXINIT message (RFC 4253 7.1)
+// kex, host key, 加密 c2s/s2c, MAC c2s/s2c, 压缩 c2s/s2c, 语言 c2s/s2c
+type sshKexInit [sshKexInitNameList]string
+
+// parseSSHKexInit parses the payload of a KEXINIT message
+func parseSSHKexInit(payload []byte) (*sshKexInit, bool) {
+	if len(payload) < 17 || payload[0] != sshMsgKexInit {
+		return nil, false
+	}
+	data := payload[17:] // 消息号和 16 字节 cookie
+	var kex sshKexInit
+	for i := range kex {
+		if len(data) < 4 {
+			return nil, false
+		}
+		n := binary.BigEndian.Uint32(data)
+		if uint32(len(data)-4) < n {
+			return nil, false
+		}
+		kex[i] = printableString(data[4 : 4+n])
+		data = data[4+n:]
+	}
+	return &kex, true
+}
+
+// hassh returns the HASSH fingerprint of a client KEXINIT or the HASSHServer fingerprint of a server KEXINIT
+// MD5(kex;encryption;mac;compression)，客户端取 c2s 方向的列表，服务端取 s2c 方向的列表
+func (k *sshKexInit) hassh(client bool) string {
+	dir := 1
+	if client {
+		dir = 0
+	}
+	sum := md5.Sum([]byte(strings.Join([]string{k[0], k[2+dir], k[4+dir], k[6+dir]}, ";")))
+	return hex.EncodeToString(sum[:])
+}
+
+// negotiateSSH returns the first client algorithm also supported by the server (RFC 4253 7.1)
+func negotiateSSH(client, server string) string {
+	supported := strings.Split(server, ",")
+	for _, alg := range strings.Split(client, ",") {
+		for _, s := range supported {
+			if alg != "" && alg == s {
+				return alg
+			}
+		}
+	}
+	return ""
+}
+
+// sshTraffic counts the encrypted segments of one direction
+type sshTraffic struct {
+	segments int
+	small    int
+	large    int
+	bytes    int64
+}
+
+func (t *sshTraffic) add(n int) {
+	t.segments++
+	t.bytes += int64(n)
+	switch {
+	case n <= sshSmallSegment:
+		t.small++
+	case n >= sshLargeSegment:
+		t.large++
+	}
+}
+
+// sshConn is the state shared by both directions of an SSH connection
+// 两个方向的版本行和 KEXINIT 合并为一条会话，加密阶段观察足够的报文段（或连接结束）后输出
+type sshConn struct {
+	tuple   model.FiveTuple // 客户端 -> 服务端
+	session *model.Session
+	kex     [2]*sshKexInit // 客户端、服务端的 KEXINIT
+	traffic [2]sshTraffic  // 客户端、服务端方向的加密报文段
+	emitted bool
+}
+
+// sessionAt returns the connection session, creating it at ts
+func (c *sshConn) sessionAt(ts time.Time) *model.Session {
+	if c.session == nil {
+		c.session = &model.Session{
+			Timestamp: ts,
+			FiveTuple: c.tuple,
+			Type:      "SSH",
+			TTL:       ts.Add(7 * 24 * time.Hour),
+		}
+	}
+	return c.session
+}
+
+// kexInit records the KEXINIT of one side and negotiates the algorithms once both are known
+func (c *sshConn) kexInit(client bool, kex *sshKexInit, ts time.Time) {
+	session := c.sessionAt(ts)
+	dir := 1
+	if client {
+		dir = 0
+		session.HASSH = kex.hassh(true)
+	} else {
+		session.HASSHServer = kex.hassh(false)
+	}
+	c.kex[dir] = kex
+
+	cli, srv := c.kex[0], c.kex[1]
+	if cli == nil || srv == nil {
+		return
+	}
+	session.KexAlgorithm = negotiateSSH(cli[0], srv[0])
+	session.HostKeyAlgorithm = negotiateSSH(cli[1], srv[1])
+	session.EncryptionAlgorithm = negotiateSSH(cli[2], srv[2])
+	// AEAD 加密算法自带完整性校验，不使用协商的 MAC
+	if !strings.Contains(session.EncryptionAlgorithm, "gcm") && !strings.Contains(session.EncryptionAlgorithm, "poly1305") {
+		session.MACAlgorithm = negotiateSSH(cli[4], srv[4])
+	}
+	session.CompressionAlgorithm = negotiateSSH(cli[6], srv[6])
+}
+
+// segment counts an encrypted segment; 观察到足够的报文段后输出会话
+func (c *sshConn) segment(client bool, n int) []*model.Session {
+	dir := 1
+	if client {
+		dir = 0
+	}
+	c.traffic[dir].add(n)
+	if c.traffic[0].segments+c.traffic[1].segments >= sshUsageSegments {
+		return c.emit()
+	}
+	return nil
+}
+
+func (c *sshConn) emit() []*model.Session {
+	if c.session == nil || c.emitted {
+		return nil
+	}
+	c.emitted = true
+	c.session.SSHUsage = sshUsage(c.traffic)
+	c.session.PayloadSize += int(c.traffic[0].bytes + c.traffic[1].bytes)
+	return []*model.Session{c.session}
+}
+
+// sshUsage classifies a session from the sizes of its encrypted segments
+// 交互式 shell 的客户端报文段多为按键产生的小包；文件传输和端口转发有一个方向以满载的大包为主
+func sshUsage(traffic [2]sshTraffic) string {
+	if traffic[0].segments+traffic[1].segments < sshMinSegments {
+		return ""
+	}
+	for _, t := range traffic {
+		if t.segments > 0 && t.large*2 >= t.segments && t.bytes >= sshBulkBytes {
+			return SSHUsageBulk
+		}
+	}
+	if client := traffic[0]; client.segments > 0 && client.small*10 >= client.segments*8 {
+		return SSHUsageInteractive
+	}
+	return ""
+}
+
+// sshStream parses one direction of a reassembled SSH connection
+// 解析版本行和明文的 KEXINIT，NEWKEYS 之后只统计报文段大小
+type sshStream struct {
+	conn      *sshConn
+	client    bool
+	maxBuffer int
+
+	state int
+	buf   []byte
+	bufTS time.Time
+}
+
+// newSSHParsers creates the SSH parsers of both directions of a connection
+func newSSHParsers(client model.FiveTuple, maxBuffer int) (StreamParser, StreamParser) {
+	conn := &sshConn{tuple: client}
+	return &sshStream{conn: conn, client: true, maxBuffer: maxBuffer},
+		&sshStream{conn: conn, maxBuffer: maxBuffer}
+}
+
+// Feed parses the next in-order bytes of the stream
+func (s *sshStream) Feed(data []byte, skip int, ts time.Time) ([]*model.Session, error) {
+	switch s.state {
+	case sshStateDone:
+		return nil, nil
+	case sshStateEncrypted:
+		return s.conn.segment(s.client, len(data)), nil
+	}
+	if skip > 0 {
+		// 明文阶段的数据丢失，无法继续解析报文边界
+		s.finish()
+		return nil, nil
+	}
+
+	if len(s.buf) == 0 {
+		s.bufTS = ts
+	}
+	s.buf = append(s.buf, data...)
+	s.parse()
+	if s.state == sshStateEncrypted && len(s.buf) > 0 {
+		// NEWKEYS 之后同一段中的数据已加密
+		n := len(s.buf)
+		s.buf = nil
+		return s.conn.segment(s.client, n), nil
+	}
+
+	if len(s.buf) > s.maxBuffer {
+		s.finish()
+		return nil, ErrStreamOverflow
+	}
+	return nil, nil
+}
+
+// parse consumes the banner and the cleartext packets in the buffer
+func (s *sshStream) parse() {
+	for s.state == sshStateBanner || s.state == sshStatePackets {
+		if s.state == sshStateBanner {
+			// 服务端可在版本行之前发送其它文本行
+			i := bytes.IndexByte(s.buf, '\n')
+			if i < 0 {
+				if len(s.buf) > maxSSHBanner && !bytes.HasPrefix(s.buf, []byte("SSH-")) {
+					s.finish()
+				}
+				return
+			}
+			line := strings.TrimRight(string(s.buf[:i]), "\r")
+			s.buf = s.buf[i+1:]
+			if !strings.HasPrefix(line, "SSH-") {
+				continue
+			}
+			session := s.conn.sessionAt(s.bufTS)
+			if s.client {
+				session.ClientBanner = printableString([]byte(truncateText(line, maxSSHBanner)))
+			} else {
+				session.ServerBanner = printableString([]byte(truncateText(line, maxSSHBanner)))
+			}
+			session.PayloadSize += i + 1
+			s.state = sshStatePackets
+			continue
+		}
+
+		// uint32 packet_length, byte padding_length, payload, padding
+		if len(s.buf) < 5 {
+			return
+		}
+		length := binary.BigEndian.Uint32(s.buf)
+		padding := uint32(s.buf[4])
+		if length < 5 || length > maxSSHPacket || padding+1 > length {
+			s.finish()
+			return
+		}
+		if uint32(len(s.buf)-4) < length {
+			return
+		}
+		payload := s.buf[5 : 4+length-padding]
+		s.buf = s.buf[4+length:]
+		s.conn.sessionAt(s.bufTS).PayloadSize += int(4 + length)
+
+		if len(payload) == 0 {
+			continue
+		}
+		switch payload[0] {
+		case sshMsgKexInit:
+			if kex, ok := parseSSHKexInit(payload); ok {
+				s.conn.kexInit(s.client, kex, s.bufTS)
+			}
+		case sshMsgNewKeys:
+			s.state = sshStateEncrypted
+		}
+	}
+}
+
+// Close returns the session of a connection that ended before enough encrypted traffic was seen
+func (s *sshStream) Close(ts time.Time) []*model.Session {
+	s.finish()
+	return s.conn.emit()
+}
+
+func (s *sshStream) finish() {
+	s.state = sshStateDone
+	s.buf = nil
+}
@@ -0,0 +1,84 @@
+package parser
+
+import (
+	"sniffer/pkg/model"
+)
+
+func init() {
+	Register(sshDissector{})
+}
+
+// sshDissector describes SSH connections; 版本行和 KEXINIT 只能从重组的 TCP 字节流中解析
+type sshDissector struct{}
+
+func (sshDissector) Name() string { return "SSH" }
+
+func (sshDissector) Table() model.TableType { return model.TableSSH }
+
+func (sshDissector) Claims(pkt *model.Packet) bool {
+	return pkt.Protocol == "TCP" && (isSSHPort(pkt.SrcPort) || isSSHPort(pkt.DstPort) || pkt.AppProtocol == "SSH")
+}
+
+// Dissect returns nothing: SSH 会话只由 StreamProtocol 的解析器从重组的字节流产生
+func (sshDissector) Dissect(pkt *model.Packet, ctx *DissectContext) ([]*model.Session, error) {
+	return nil, nil
+}
+
+// sshStreamProtocol parses SSH banners and KEXINIT from reassembled TCP streams
+var sshStreamProtocol = &StreamProtocol{IsServerPort: isSSHPort, NewParsers: newSSHParsers}
+
+func (sshDissector) StreamProtocol() *StreamProtocol { return sshStreamProtocol }
+
+func (sshDissector) AlertField(session *model.Session, field string) (string, bool) {
+	switch field {
+	case "client_banner":
+		return session.ClientBanner, true
+	case "server_banner":
+		return session.ServerBanner, true
+	case "hassh":
+		return session.HASSH, true
+	case "hassh_server":
+		return session.HASSHServer, true
+	case "kex_algorithm":
+		return session.KexAlgorithm, true
+	case "host_key_algorithm":
+		return session.HostKeyAlgorithm, true
+	case "encryption_algorithm":
+		return session.EncryptionAlgorithm, true
+	case "ssh_usage":
+		return session.SSHUsage, true
+	case "src_ip":
+		return session.FiveTuple.SrcIP, true
+	case "dst_ip":
+		return session.FiveTuple.DstIP, true
+	}
+	return "", false
+}
+
+// sshSchema is the storage of SSH connections
+var sshSchema = &Schema{
+	Table: "ssh_sessions",
+	Columns: concatColumns(
+		[]Column{timestampColumn},
+		tupleColumns(true),
+		[]Column{
+			column("client_banner", "TEXT", func(s *model.Session) *string { return &s.ClientBanner }),
+			column("server_banner", "TEXT", func(s *model.Session) *string { return &s.ServerBanner }),
+			column("hassh", "TEXT", func(s *model.Session) *string { return &s.HASSH }),
+			column("hassh_server", "TEXT", func(s *model.Session) *string { return &s.HASSHServer }),
+			column("kex_algorithm", "TEXT", func(s *model.Session) *string { return &s.KexAlgorithm }),
+			column("host_key_algorithm", "TEXT", func(s *model.Session) *string { return &s.HostKeyAlgorithm }),
+			column("encryption_algorithm", "TEXT", func(s *model.Session) *string { return &s.EncryptionAlgorithm }),
+			column("mac_algorithm", "TEXT", func(s *model.Session) *string { return &s.MACAlgorithm }),
+			column("compression_algorithm", "TEXT", func(s *model.Session) *string { return &s.CompressionAlgorithm }),
+			column("ssh_usage", "TEXT", func(s *model.Session) *string { return &s.SSHUsage }),
+			payloadColumn,
+			ttlColumn,
+		},
+		processColumns(),
+	),
+	Indexes:       []string{"timestamp", "ttl", "hassh", "hassh_server"},
+	SearchColumns: []string{"src_ip", "dst_ip", "client_banner", "server_banner", "hassh", "hassh_server"},
+}
+
+func (sshDissector) Schema() *Schema { return sshSchema }
@@ -0,0 +1,294 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"sniffer/pkg/model"
+)
+
+// sshPacket wraps payload in a cleartext SSH binary packet (RFC 4253 6), 填充到 8 字节的倍数
+func sshPacket(payload []byte) []byte {
+	padding := 8 - (5+len(payload))%8
+	if padding < 4 {
+		padding += 8
+	}
+	packet := binary.BigEndian.AppendUint32(nil, uint32(1+len(payload)+padding))
+	packet = append(packet, byte(padding))
+	packet = append(packet, payload...)
+	return append(packet, make([]byte, padding)...)
+}
+
+// sshKexInitPayload builds a KEXINIT message from kex, host key, encryption, MAC and compression lists
+// 同一算法列表用于两个方向，语言列表为空
+func sshKexInitPayload(lists ...string) []byte {
+	payload := append([]byte{sshMsgKexInit}, bytes.Repeat([]byte{0xa5}, 16)...)
+	var names [sshKexInitNameList]string
+	switch len(lists) {
+	case 5:
+		names = [sshKexInitNameList]string{lists[0], lists[1], lists[2], lists[2], lists[3], lists[3], lists[4], lists[4]}
+	case sshKexInitNameList:
+		copy(names[:], lists)
+	}
+	for _, name := range names {
+		payload = binary.BigEndian.AppendUint32(payload, uint32(len(name)))
+		payload = append(payload, name...)
+	}
+	return append(payload, 0, 0, 0, 0, 0) // first_kex_packet_follows, reserved
+}
+
+// OpenSSH style algorithm lists of the test client and server
+var (
+	testSSHClientKex = sshKexInitPayload(
+		"curve25519-sha256,ecdh-sha2-nistp256,ext-info-c",
+		"ssh-ed25519,rsa-sha2-512",
+		"chacha20-poly1305@openssh.com,aes128-ctr",
+		"hmac-sha2-256-etm@openssh.com,hmac-sha2-256",
+		"none,zlib@openssh.com",
+	)
+	testSSHServerKex = sshKexInitPayload(
+		"curve25519-sha256,diffie-hellman-group14-sha256,kex-strict-s-v00@openssh.com",
+		"rsa-sha2-512,ssh-ed25519",
+		"aes256-gcm@openssh.com,chacha20-poly1305@openssh.com,aes128-ctr",
+		"hmac-sha2-256-etm@openssh.com",
+		"none",
+	)
+)
+
+func TestSSHKexInitHASSH(t *testing.T) {
+	// 每个列表取不同的值，检查 HASSH 和 HASSHServer 分别使用 c2s 和 s2c 方向
+	kex, ok := parseSSHKexInit(sshKexInitPayload("k", "h", "e1", "e2", "m1", "m2", "c1", "c2", "", ""))
+	if !ok {
+		t.Fatal("parseSSHKexInit failed")
+	}
+	tests := []struct {
+		name   string
+		kex    *sshKexInit
+		client bool
+		want   string
+	}{
+		// MD5("k;e1;m1;c1") 与 MD5("k;e2;m2;c2")
+		{"client uses c2s lists", kex, true, "47d71892470729ad46c26350b8ac1031"},
+		{"server uses s2c lists", kex, false, "b99172f9a0714d060be6e3522e91f3cc"},
+		// MD5("curve25519-sha256,ecdh-sha2-nistp256,ext-info-c;chacha20-poly1305@openssh.com,aes128-ctr;hmac-sha2-256-etm@openssh.com,hmac-sha2-256;none,zlib@openssh.com")
+		{"OpenSSH client", mustKexInit(t, testSSHClientKex), true, "3ac5c89f8a8a6b695a0af0bad495dc90"},
+		// MD5("curve25519-sha256,diffie-hellman-group14-sha256,kex-strict-s-v00@openssh.com;aes256-gcm@openssh.com,chacha20-poly1305@openssh.com,aes128-ctr;hmac-sha2-256-etm@openssh.com;none")
+		{"OpenSSH server", mustKexInit(t, testSSHServerKex), false, "d6567f1261d20b13285015cd23e985ac"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.kex.hassh(tt.client); got != tt.want {
+				t.Errorf("hassh = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func mustKexInit(t *testing.T, payload []byte) *sshKexInit {
+	t.Helper()
+	kex, ok := parseSSHKexInit(payload)
+	if !ok {
+		t.Fatal("parseSSHKexInit failed")
+	}
+	return kex
+}
+
+func TestParseSSHKexInitInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+	}{
+		{"not KEXINIT", append([]byte{sshMsgNewKeys}, make([]byte, 60)...)},
+		{"short cookie", []byte{sshMsgKexInit, 1, 2, 3}},
+		{"missing lists", testSSHClientKex[:40]},
+		{"list longer than message", append(append([]byte{sshMsgKexInit}, make([]byte, 16)...), 0, 0, 1, 0, 'a')},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := parseSSHKexInit(tt.payload); ok {
+				t.Error("parseSSHKexInit succeeded")
+			}
+		})
+	}
+}
+
+func TestNegotiateSSH(t *testing.T) {
+	tests := []struct {
+		client, server, want string
+	}{
+		{"curve25519-sha256,ecdh-sha2-nistp256", "ecdh-sha2-nistp256,curve25519-sha256", "curve25519-sha256"},
+		{"aes128-ctr", "aes256-ctr", ""},
+		{"", "none", ""},
+	}
+	for _, tt := range tests {
+		if got := negotiateSSH(tt.client, tt.server); got != tt.want {
+			t.Errorf("negotiateSSH(%q, %q) = %q, want %q", tt.client, tt.server, got, tt.want)
+		}
+	}
+}
+
+func TestSSHStream(t *testing.T) {
+	const (
+		clientBanner = "SSH-2.0-OpenSSH_9.6p1 Ubuntu-3ubuntu13"
+		serverBanner = "SSH-2.0-OpenSSH_8.9p1"
+	)
+	newKeys := sshPacket([]byte{sshMsgNewKeys})
+
+	// feed 为一方发送的一段数据
+	type feed struct {
+		client bool
+		data   []byte
+		skip   int
+	}
+	handshake := func(serverKex []byte) []feed {
+		return []feed{
+			{client: false, data: []byte("Welcome\r\n" + serverBanner + "\r\n")},
+			{client: true, data: []byte(clientBanner + "\r\n")},
+			{client: true, data: sshPacket(testSSHClientKex)},
+			{client: false, data: sshPacket(serverKex)},
+			{client: true, data: newKeys},
+			{client: false, data: newKeys},
+		}
+	}
+	segments := func(client bool, n, size int) []feed {
+		var out []feed
+		for i := 0; i < n; i++ {
+			out = append(out, feed{client: client, data: make([]byte, size)})
+		}
+		return out
+	}
+	concat := func(parts ...[]feed) []feed {
+		var all []feed
+		for _, p := range parts {
+			all = append(all, p...)
+		}
+		return all
+	}
+
+	type result struct {
+		ClientBanner, ServerBanner, HASSH, HASSHServer string
+		Kex, HostKey, Encryption, MAC, Compression     string
+		Usage                                          string
+	}
+	negotiated := result{
+		ClientBanner: clientBanner, ServerBanner: serverBanner,
+		HASSH: "3ac5c89f8a8a6b695a0af0bad495dc90", HASSHServer: "d6567f1261d20b13285015cd23e985ac",
+		Kex: "curve25519-sha256", HostKey: "ssh-ed25519", Encryption: "chacha20-poly1305@openssh.com", Compression: "none",
+	}
+	with := func(r result, edit func(*result)) result {
+		edit(&r)
+		return r
+	}
+	ctrServer := sshKexInitPayload(
+		"curve25519-sha256",
+		"rsa-sha2-512",
+		"aes128-ctr",
+		"hmac-sha2-512,hmac-sha2-256",
+		"none",
+	)
+
+	tests := []struct {
+		name       string
+		feeds      []feed
+		beforeStop bool   // 观察到足够的加密报文段，会话在连接结束前输出
+		want       result // 零值表示不输出会话
+	}{
+		{
+			name:       "interactive shell",
+			feeds:      concat(handshake(testSSHServerKex), segments(true, 100, 36), segments(false, 100, 52)),
+			beforeStop: true,
+			want:       with(negotiated, func(r *result) { r.Usage = SSHUsageInteractive }),
+		},
+		{
+			name:  "bulk transfer",
+			feeds: concat(handshake(testSSHServerKex), segments(true, 10, 36), segments(false, 60, 1400)),
+			want:  with(negotiated, func(r *result) { r.Usage = SSHUsageBulk }),
+		},
+		{
+			name:  "too few segments to classify",
+			feeds: concat(handshake(testSSHServerKex), segments(true, 5, 36)),
+			want:  negotiated,
+		},
+		{
+			name:  "MAC negotiated for a non-AEAD cipher",
+			feeds: handshake(ctrServer),
+			// HASSHServer 为 MD5("curve25519-sha256;aes128-ctr;hmac-sha2-512,hmac-sha2-256;none")
+			want: with(negotiated, func(r *result) {
+				r.HASSHServer = "7689a68a1dcf6613e1eed36a0e6bf0f1"
+				r.HostKey, r.Encryption, r.MAC = "rsa-sha2-512", "aes128-ctr", "hmac-sha2-256"
+			}),
+		},
+		{
+			name: "banner and KEXINIT in one segment",
+			feeds: []feed{
+				{client: true, data: append([]byte(clientBanner+"\r\n"), sshPacket(testSSHClientKex)...)},
+			},
+			want: result{ClientBanner: clientBanner, HASSH: "3ac5c89f8a8a6b695a0af0bad495dc90"},
+		},
+		{
+			name: "cleartext data lost",
+			feeds: []feed{
+				{client: true, data: []byte(clientBanner + "\r\n")},
+				{client: true, data: sshPacket(testSSHClientKex)[100:], skip: 100},
+			},
+			want: result{ClientBanner: clientBanner},
+		},
+		{
+			name: "not SSH",
+			feeds: []feed{
+				{client: true, data: []byte("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n")},
+				{client: false, data: []byte("HTTP/1.1 400 Bad Request\r\n\r\n")},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := model.FiveTuple{SrcIP: "10.0.0.1", DstIP: "10.0.0.2", SrcPort: 40000, DstPort: 22, Protocol: "TCP"}
+			toServer, toClient := newSSHParsers(client, 64<<10)
+			ts := time.Unix(1700000000, 0)
+
+			var sessions []*model.Session
+			for _, f := range tt.feeds {
+				p := toClient
+				if f.client {
+					p = toServer
+				}
+				out, err := p.Feed(f.data, f.skip, ts)
+				if err != nil {
+					t.Fatalf("Feed: %v", err)
+				}
+				sessions = append(sessions, out...)
+			}
+			if tt.beforeStop && len(sessions) != 1 {
+				t.Errorf("got %d sessions before the connection ended, want 1", len(sessions))
+			}
+			sessions = append(sessions, toServer.Close(ts)...)
+			sessions = append(sessions, toClient.Close(ts)...)
+
+			if tt.want == (result{}) {
+				if len(sessions) != 0 {
+					t.Errorf("got %d sessions, want none", len(sessions))
+				}
+				return
+			}
+			if len(sessions) != 1 {
+				t.Fatalf("got %d sessions, want 1", len(sessions))
+			}
+			s := sessions[0]
+			got := result{
+				s.ClientBanner, s.ServerBanner, s.HASSH, s.HASSHServer,
+				s.KexAlgorithm, s.HostKeyAlgorithm, s.EncryptionAlgorithm, s.MACAlgorithm, s.CompressionAlgorithm,
+				s.SSHUsage,
+			}
+			if got != tt.want {
+				t.Errorf("session:\n got  %+v\n want %+v", got, tt.want)
+			}
+			if s.Type != "SSH" || s.FiveTuple != client {
+				t.Errorf("Type = %q, FiveTuple = %+v", s.Type, s.FiveTuple)
+			}
+		})
+	}
+}
@@ -0,0 +1,569 @@
+package parser
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/cryptobyte"
+	"sniffer/pkg/model"
+)
+
+// errTLSIncomplete is returned while the handshake message is still spread over missing records
+var errTLSIncomplete = errors.New("incomplete TLS handshake")
+
+// TLS record and handshake constants
+const (
+	tlsRecordHandshake    = 22
+	tlsRecordHeaderLen    = 5
+	tlsMaxRecordLen       = 16384 + 2048
+	tlsHandshakeHeaderLen = 4
+	tlsClientHello        = 1
+	tlsServerHello        = 2
+
+	tlsExtServerName    = 0x0000
+	tlsExtGroups        = 0x000a
+	tlsExtPointFormats  = 0x000b
+	tlsExtSignatureAlgs = 0x000d
+	tlsExtALPN          = 0x0010
+	tlsExtSupportedVers = 0x002b
+)
+
+// isTLSPort reports whether port is a common TLS port (HTTPS, SMTPS, LDAPS, DoT, IMAPS, POP3S)
+func isTLSPort(port uint16) bool {
+	switch port {
+	case 443, 8443, 465, 636, 853, 993, 995:
+		return true
+	}
+	return false
+}
+
+// tlsHello holds the fields of a ClientHello or ServerHello used for metadata and fingerprints
+type tlsHello struct {
+	client       bool
+	version      uint16   // legacy_version
+	ciphers      []uint16 // 客户端提供的密码套件；服务端为选择的一个
+	extensions   []uint16 // 扩展类型，按出现顺序
+	sni          string
+	alpn         []string
+	versions     []uint16 // supported_versions；服务端为选择的一个
+	groups       []uint16
+	pointFormats []uint8
+	sigAlgs      []uint16
+}
+
+// ParseTLS parses a TLS ClientHello or ServerHello contained in a single packet
+// 未开启流重组时使用；握手消息跨多个报文段时无法解析
+func ParseTLS(pkt *model.Packet) (*model.Session, error) {
+	if pkt.Protocol != "TCP" || (!isTLSPort(pkt.SrcPort) && !isTLSPort(pkt.DstPort) && pkt.AppProtocol != "TLS") {
+		return nil, ErrNotTLS
+	}
+
+	if len(pkt.Payload) == 0 {
+		return nil, ErrNotTLS
+	}
+
+	msgType, body, err := readHandshake(pkt.Payload)
+	if err != nil {
+		return nil, ErrNotTLS
+	}
+	hello, err := parseHello(msgType, body)
+	if err != nil {
+		return nil, err
+	}
+
+	tuple := GetFiveTuple(pkt)
+	if !hello.client {
+		tuple = reverseTuple(tuple)
+	}
+	session := newTLSSession(tuple, pkt.Timestamp)
+	session.ProcessPID = pkt.ProcessPID
+	session.ProcessName = pkt.ProcessName
+	session.ProcessExe = pkt.ProcessExe
+	applyHello(session, hello, len(body)+tlsHandshakeHeaderLen)
+	return session, nil
+}
+
+// readHandshake returns the first handshake message carried by the TLS records at the start of data
+// 握手消息可能跨多个记录；数据不完整时返回 errTLSIncomplete
+func readHandshake(data []byte) (uint8, []byte, error) {
+	var msg []byte
+	for {
+		if len(data) < tlsRecordHeaderLen {
+			return 0, nil, errTLSIncomplete
+		}
+		// 只接受 TLS 1.x 记录头（SSLv2 兼容的 ClientHello 不支持）
+		if data[0] != tlsRecordHandshake || data[1] != 3 {
+			return 0, nil, ErrNotTLS
+		}
+		length := int(data[3])<<8 | int(data[4])
+		if length == 0 || length > tlsMaxRecordLen {
+			return 0, nil, ErrNotTLS
+		}
+		if len(data) < tlsRecordHeaderLen+length {
+			return 0, nil, errTLSIncomplete
+		}
+		msg = append(msg, data[tlsRecordHeaderLen:tlsRecordHeaderLen+length]...)
+		data = data[tlsRecordHeaderLen+length:]
+
+		if len(msg) >= tlsHandshakeHeaderLen {
+			size := int(msg[1])<<16 | int(msg[2])<<8 | int(msg[3])
+			if len(msg) >= tlsHandshakeHeaderLen+size {
+				return msg[0], msg[tlsHandshakeHeaderLen : tlsHandshakeHeaderLen+size], nil
+			}
+		}
+	}
+}
+
+// parseHello parses the body of a ClientHello or ServerHello handshake message
+func parseHello(msgType uint8, body []byte) (*tlsHello, error) {
+	if msgType != tlsClientHello && msgType != tlsServerHello {
+		return nil, fmt.Errorf("%w: handshake type %d", ErrParseErr, msgType)
+	}
+	hello := &tlsHello{client: msgType == tlsClientHello}
+
+	s := cryptobyte.String(body)
+	var sessionID cryptobyte.String
+	if !s.ReadUint16(&hello.version) || !s.Skip(32) || !s.ReadUint8LengthPrefixed(&sessionID) {
+		return nil, fmt.Errorf("%w: truncated hello", ErrParseErr)
+	}
+
+	if hello.client {
+		var ciphers, compression cryptobyte.String
+		if !s.ReadUint16LengthPrefixed(&ciphers) || !s.ReadUint8LengthPrefixed(&compression) {
+			return nil, fmt.Errorf("%w: truncated client hello", ErrParseErr)
+		}
+		for !ciphers.Empty() {
+			var c uint16
+			if !ciphers.ReadUint16(&c) {
+				return nil, fmt.Errorf("%w: bad cipher suites", ErrParseErr)
+			}
+			hello.ciphers = append(hello.ciphers, c)
+		}
+	} else {
+		var cipher uint16
+		var compression uint8
+		if !s.ReadUint16(&cipher) || !s.ReadUint8(&compression) {
+			return nil, fmt.Errorf("%w: truncated server hello", ErrParseErr)
+		}
+		hello.ciphers = []uint16{cipher}
+	}
+
+	// 扩展是可选的（旧版本客户端可能不带扩展）
+	if s.Empty() {
+		return hello, nil
+	}
+	var extensions cryptobyte.String
+	if !s.ReadUint16LengthPrefixed(&extensions) {
+		return nil, fmt.Errorf("%w: bad extensions", ErrParseErr)
+	}
+	for !extensions.Empty() {
+		var typ uint16
+		var data cryptobyte.String
+		if !extensions.ReadUint16(&typ) || !extensions.ReadUint16LengthPrefixed(&data) {
+			return nil, fmt.Errorf("%w: bad extension", ErrParseErr)
+		}
+		hello.extensions = append(hello.extensions, typ)
+		hello.parseExtension(typ, data)
+	}
+	return hello, nil
+}
+
+// parseExtension extracts the fields of the extensions used by the metadata and fingerprints
+// 扩展内容格式错误时忽略该扩展
+func (h *tlsHello) parseExtension(typ uint16, data cryptobyte.String) {
+	switch typ {
+	case tlsExtServerName:
+		var names cryptobyte.String
+		if !data.ReadUint16LengthPrefixed(&names) {
+			return
+		}
+		for !names.Empty() {
+			var nameType uint8
+			var name cryptobyte.String
+			if !names.ReadUint8(&nameType) || !names.ReadUint16LengthPrefixed(&name) {
+				return
+			}
+			if nameType == 0 {
+				h.sni = string(name)
+				return
+			}
+		}
+
+	case tlsExtALPN:
+		var protos cryptobyte.String
+		if !data.ReadUint16LengthPrefixed(&protos) {
+			return
+		}
+		for !protos.Empty() {
+			var proto cryptobyte.String
+			if !protos.ReadUint8LengthPrefixed(&proto) {
+				return
+			}
+			h.alpn = append(h.alpn, string(proto))
+		}
+
+	case tlsExtSupportedVers:
+		if !h.client {
+			var v uint16
+			if data.ReadUint16(&v) {
+				h.versions = []uint16{v}
+			}
+			return
+		}
+		var versions cryptobyte.String
+		if data.ReadUint8LengthPrefixed(&versions) {
+			h.versions = readUint16List(versions)
+		}
+
+	case tlsExtGroups:
+		var groups cryptobyte.String
+		if data.ReadUint16LengthPrefixed(&groups) {
+			h.groups = readUint16List(groups)
+		}
+
+	case tlsExtPointFormats:
+		var formats cryptobyte.String
+		if data.ReadUint8LengthPrefixed(&formats) {
+			h.pointFormats = []uint8(formats)
+		}
+
+	case tlsExtSignatureAlgs:
+		var algs cryptobyte.String
+		if data.ReadUint16LengthPrefixed(&algs) {
+			h.sigAlgs = readUint16List(algs)
+		}
+	}
+}
+
+func readUint16List(s cryptobyte.String) []uint16 {
+	var list []uint16
+	for !s.Empty() {
+		var v uint16
+		if !s.ReadUint16(&v) {
+			break
+		}
+		list = append(list, v)
+	}
+	return list
+}
+
+// isGREASE reports whether v is a GREASE value (RFC 8701), which fingerprints ignore
+func isGREASE(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+// withoutGREASE returns the list without GREASE values
+func withoutGREASE(list []uint16) []uint16 {
+	out := make([]uint16, 0, len(list))
+	for _, v := range list {
+		if !isGREASE(v) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// newTLSSession creates the TLS session of a connection (tuple is client -> server)
+func newTLSSession(tuple model.FiveTuple, ts time.Time) *model.Session {
+	return &model.Session{
+		Timestamp: ts,
+		FiveTuple: tuple,
+		Type:      "TLS",
+		TTL:       ts.Add(7 * 24 * time.Hour),
+	}
+}
+
+// applyHello fills the session with the metadata and fingerprint of a hello message
+func applyHello(session *model.Session, hello *tlsHello, size int) {
+	session.PayloadSize += size
+
+	if hello.client {
+		session.SNI = hello.sni
+		session.Domain = hello.sni
+		session.ALPN = strings.Join(hello.alpn, ",")
+		session.CipherSuites = cipherSuiteNames(withoutGREASE(hello.ciphers))
+
+		versions := withoutGREASE(hello.versions)
+		if len(versions) == 0 {
+			versions = []uint16{hello.version}
+		}
+		names := make([]string, len(versions))
+		for i, v := range versions {
+			names[i] = tls.VersionName(v)
+		}
+		session.TLSOfferedVersions = strings.Join(names, ",")
+
+		session.JA3 = ja3(hello)
+		session.JA4 = ja4(hello, 't')
+		return
+	}
+
+	version := hello.version
+	if len(hello.versions) > 0 {
+		version = hello.versions[0]
+	}
+	session.TLSVersion = tls.VersionName(version)
+	session.CipherSuite = tls.CipherSuiteName(hello.ciphers[0])
+	if len(hello.alpn) > 0 {
+		session.NegotiatedALPN = hello.alpn[0]
+	}
+	session.JA3S = ja3s(hello)
+}
+
+func cipherSuiteNames(ciphers []uint16) string {
+	names := make([]string, len(ciphers))
+	for i, c := range ciphers {
+		names[i] = tls.CipherSuiteName(c)
+	}
+	return strings.Join(names, ",")
+}
+
+// ja3 returns the JA3 fingerprint of a ClientHello:
+// MD5(SSLVersion,Ciphers,Extensions,EllipticCurves,EllipticCurvePointFormats)
+func ja3(hello *tlsHello) string {
+	formats := make([]string, len(hello.pointFormats))
+	for i, f := range hello.pointFormats {
+		formats[i] = strconv.Itoa(int(f))
+	}
+	s := strings.Join([]string{
+		strconv.Itoa(int(hello.version)),
+		joinDecimal(withoutGREASE(hello.ciphers)),
+		joinDecimal(withoutGREASE(hello.extensions)),
+		joinDecimal(withoutGREASE(hello.groups)),
+		strings.Join(formats, "-"),
+	}, ",")
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// ja3s returns the JA3S fingerprint of a ServerHello: MD5(SSLVersion,Cipher,Extensions)
+func ja3s(hello *tlsHello) string {
+	s := strings.Join([]string{
+		strconv.Itoa(int(hello.version)),
+		strconv.Itoa(int(hello.ciphers[0])),
+		joinDecimal(hello.extensions),
+	}, ",")
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func joinDecimal(list []uint16) string {
+	parts := make([]string, len(list))
+	for i, v := range list {
+		parts[i] = strconv.Itoa(int(v))
+	}
+	return strings.Join(parts, "-")
+}
+
+// ja4 returns the JA4 fingerprint of a ClientHello
+// 格式: {t|q}{版本}{d|i}{密码套件数}{扩展数}{ALPN 首尾字符}_{排序后密码套件的哈希}_{排序后扩展+签名算法的哈希}
+// transport 为 't' (TCP) 或 'q' (QUIC)
+func ja4(hello *tlsHello, transport byte) string {
+	ciphers := withoutGREASE(hello.ciphers)
+	extensions := withoutGREASE(hello.extensions)
+
+	version := hello.version
+	for _, v := range withoutGREASE(hello.versions) {
+		if v > version {
+			version = v
+		}
+	}
+
+	sni := byte('i')
+	if hello.sni != "" {
+		sni = 'd'
+	}
+
+	alpn := "00"
+	if len(hello.alpn) > 0 && hello.alpn[0] != "" {
+		first := hello.alpn[0]
+		if isAlphanumeric(first[0]) && isAlphanumeric(first[len(first)-1]) {
+			alpn = string([]byte{first[0], first[len(first)-1]})
+		} else {
+			h := hex.EncodeToString([]byte(first))
+			alpn = string([]byte{h[0], h[len(h)-1]})
+		}
+	}
+
+	a := fmt.Sprintf("%c%s%c%02d%02d%s", transport, ja4Version(version), sni,
+		min(len(ciphers), 99), min(len(extensions), 99), alpn)
+
+	// 扩展哈希不包含 SNI 和 ALPN，签名算法保持原始顺序
+	var exts []uint16
+	for _, e := range extensions {
+		if e != tlsExtServerName && e != tlsExtALPN {
+			exts = append(exts, e)
+		}
+	}
+	extString := joinHex(sortedCopy(exts))
+	if algs := withoutGREASE(hello.sigAlgs); len(algs) > 0 {
+		extString += "_" + joinHex(algs)
+	}
+
+	return a + "_" + ja4Hash(joinHex(sortedCopy(ciphers)), len(ciphers) == 0) +
+		"_" + ja4Hash(extString, len(exts) == 0)
+}
+
+// ja4Version returns the two character JA4 code of a TLS version
+func ja4Version(v uint16) string {
+	switch v {
+	case tls.VersionTLS13:
+		return "13"
+	case tls.VersionTLS12:
+		return "12"
+	case tls.VersionTLS11:
+		return "11"
+	case tls.VersionTLS10:
+		return "10"
+	case 0x0300: // SSL 3.0
+		return "s3"
+	case 0x0002:
+		return "s2"
+	case 0xfeff:
+		return "d1"
+	case 0xfefd:
+		return "d2"
+	case 0xfefc:
+		return "d3"
+	}
+	return "00"
+}
+
+// ja4Hash returns the first 12 hex characters of the SHA-256 of s, or zeros for an empty list
+func ja4Hash(s string, empty bool) string {
+	if empty {
+		return "000000000000"
+	}
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+func joinHex(list []uint16) string {
+	parts := make([]string, len(list))
+	for i, v := range list {
+		parts[i] = fmt.Sprintf("%04x", v)
+	}
+	return strings.Join(parts, ",")
+}
+
+func sortedCopy(list []uint16) []uint16 {
+	out := append([]uint16(nil), list...)
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+func isAlphanumeric(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// tlsConn is the state shared by both directions of a TLS connection
+// 两个方向的 Hello 合并为一条会话，服务端 Hello 到达（或连接结束）时输出
+type tlsConn struct {
+	session *model.Session
+	emitted bool
+}
+
+// hello merges a parsed hello message into the connection session.
+// tuple is the sender -> receiver 5-tuple of the message.
+func (c *tlsConn) hello(hello *tlsHello, tuple model.FiveTuple, ts time.Time, size int) []*model.Session {
+	if c.emitted {
+		return nil
+	}
+	if c.session == nil {
+		if !hello.client {
+			tuple = reverseTuple(tuple)
+		}
+		c.session = newTLSSession(tuple, ts)
+	}
+	applyHello(c.session, hello, size)
+
+	// ClientHello 之后等待 ServerHello；只看到 ServerHello（抓包前已发出 ClientHello）时直接输出
+	if hello.client {
+		return nil
+	}
+	return c.emit()
+}
+
+func (c *tlsConn) emit() []*model.Session {
+	if c.session == nil || c.emitted {
+		return nil
+	}
+	c.emitted = true
+	return []*model.Session{c.session}
+}
+
+// tlsStream parses the handshake of one direction of a reassembled TLS connection
+// 只解析第一个握手消息（ClientHello / ServerHello），之后的加密数据直接忽略
+type tlsStream struct {
+	conn      *tlsConn
+	tuple     model.FiveTuple // 发送方 -> 接收方
+	maxBuffer int
+
+	buf   []byte
+	bufTS time.Time
+	done  bool
+}
+
+// newTLSParsers creates the TLS parsers of both directions of a connection
+func newTLSParsers(client model.FiveTuple, maxBuffer int) (StreamParser, StreamParser) {
+	conn := &tlsConn{}
+	return &tlsStream{conn: conn, tuple: client, maxBuffer: maxBuffer},
+		&tlsStream{conn: conn, tuple: reverseTuple(client), maxBuffer: maxBuffer}
+}
+
+// Feed parses the next in-order bytes of the stream
+func (s *tlsStream) Feed(data []byte, skip int, ts time.Time) ([]*model.Session, error) {
+	if s.done {
+		return nil, nil
+	}
+	if skip > 0 {
+		// 握手数据丢失，放弃该方向
+		s.finish()
+		return nil, nil
+	}
+
+	if len(s.buf) == 0 {
+		s.bufTS = ts
+	}
+	s.buf = append(s.buf, data...)
+
+	msgType, body, err := readHandshake(s.buf)
+	if errors.Is(err, errTLSIncomplete) {
+		if len(s.buf) > s.maxBuffer {
+			s.finish()
+			return nil, ErrStreamOverflow
+		}
+		return nil, nil
+	}
+	ts = s.bufTS
+	s.finish()
+	if err != nil {
+		// 不是 TLS 握手（如抓包开始时连接已在传输应用数据）
+		return nil, nil
+	}
+
+	hello, err := parseHello(msgType, body)
+	if err != nil {
+		return nil, nil
+	}
+	return s.conn.hello(hello, s.tuple, ts, len(body)+tlsHandshakeHeaderLen), nil
+}
+
+// Close returns the session of a connection that ended without a ServerHello
+func (s *tlsStream) Close(ts time.Time) []*model.Session {
+	s.finish()
+	return s.conn.emit()
+}
+
+func (s *tlsStream) finish() {
+	s.done = true
+	s.buf = nil
+}
@@ -0,0 +1,139 @@
+package parser
+
+import (
+	"database/sql"
+
+	"sniffer/pkg/model"
+)
+
+func init() {
+	Register(tlsDissector{})
+}
+
+// tlsDissector records TLS handshakes and QUIC connections, 每个连接一条会话
+// 开启 TCP 重组时 TLS 由重组器解析字节流；QUIC 的 ClientHello 从解密的 Initial 包中提取
+type tlsDissector struct{}
+
+func (tlsDissector) Name() string { return "TLS" }
+
+// SessionTypes returns the session types stored in the TLS table
+func (tlsDissector) SessionTypes() []string { return []string{"QUIC"} }
+
+func (tlsDissector) Table() model.TableType { return model.TableTLS }
+
+func (tlsDissector) Claims(pkt *model.Packet) bool {
+	switch pkt.Protocol {
+	case "TCP":
+		return isTLSPort(pkt.SrcPort) || isTLSPort(pkt.DstPort) || pkt.AppProtocol == "TLS"
+	case "UDP":
+		return isQUICPort(pkt.DstPort) || pkt.AppProtocol == "QUIC"
+	}
+	return false
+}
+
+func (tlsDissector) Dissect(pkt *model.Packet, ctx *DissectContext) ([]*model.Session, error) {
+	var session *model.Session
+	var err error
+	if pkt.Protocol == "UDP" {
+		if ctx == nil || ctx.QUICTracker == nil {
+			return nil, nil
+		}
+		session, err = ctx.QUICTracker.Parse(pkt)
+	} else {
+		if ctx != nil && ctx.Reassembler != nil {
+			return nil, nil
+		}
+		session, err = ParseTLS(pkt)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []*model.Session{session}, nil
+}
+
+// tlsStreamProtocol parses TLS handshakes from reassembled TCP streams (QUIC 按 UDP 包解析)
+var tlsStreamProtocol = &StreamProtocol{IsServerPort: isTLSPort, NewParsers: newTLSParsers}
+
+func (tlsDissector) StreamProtocol() *StreamProtocol { return tlsStreamProtocol }
+
+// AlertField returns the value of a TLS / QUIC alert field, 字段为空（如只看到 ClientHello）时不匹配
+func (tlsDissector) AlertField(session *model.Session, field string) (string, bool) {
+	var value string
+	switch field {
+	case "sni", "domain":
+		value = session.SNI
+	case "ja3":
+		value = session.JA3
+	case "ja3s":
+		value = session.JA3S
+	case "ja4":
+		value = session.JA4
+	case "alpn":
+		// 协商的 ALPN 优先，未完成握手时使用客户端提供的列表
+		value = session.NegotiatedALPN
+		if value == "" {
+			value = session.ALPN
+		}
+	case "tls_version":
+		value = session.TLSVersion
+	case "cipher_suite":
+		value = session.CipherSuite
+	case "quic_version":
+		value = session.QUICVersion
+	}
+	return value, value != ""
+}
+
+// sniColumn stores the SNI, 读取时同时填充 Domain
+var sniColumn = Column{
+	Name:  "sni",
+	Type:  "TEXT",
+	Value: func(s *model.Session) any { return s.SNI },
+	Dest:  func(s *model.Session) any { return sniDest{s} },
+}
+
+// sniDest scans the sni column into the SNI and Domain of a session
+type sniDest struct {
+	session *model.Session
+}
+
+func (d sniDest) Scan(src any) error {
+	var v sql.NullString
+	if err := v.Scan(src); err != nil {
+		return err
+	}
+	d.session.SNI, d.session.Domain = v.String, v.String
+	return nil
+}
+
+// tlsSchema is the storage of TLS handshake metadata and fingerprints
+var tlsSchema = &Schema{
+	Table: "tls_sessions",
+	Columns: concatColumns(
+		[]Column{timestampColumn},
+		tupleColumns(true),
+		[]Column{
+			sniColumn,
+			column("tls_version", "TEXT", func(s *model.Session) *string { return &s.TLSVersion }),
+			column("offered_versions", "TEXT", func(s *model.Session) *string { return &s.TLSOfferedVersions }),
+			column("cipher_suites", "TEXT", func(s *model.Session) *string { return &s.CipherSuites }),
+			column("cipher_suite", "TEXT", func(s *model.Session) *string { return &s.CipherSuite }),
+			column("alpn", "TEXT", func(s *model.Session) *string { return &s.ALPN }),
+			column("negotiated_alpn", "TEXT", func(s *model.Session) *string { return &s.NegotiatedALPN }),
+			column("ja3", "TEXT", func(s *model.Session) *string { return &s.JA3 }),
+			column("ja3s", "TEXT", func(s *model.Session) *string { return &s.JA3S }),
+			column("ja4", "TEXT", func(s *model.Session) *string { return &s.JA4 }),
+			payloadColumn,
+			ttlColumn,
+		},
+		processColumns(),
+		[]Column{
+			column("quic_version", "TEXT", func(s *model.Session) *string { return &s.QUICVersion }),
+		},
+	),
+	Indexes:       []string{"timestamp", "ttl", "sni", "ja3", "ja4"},
+	DomainColumn:  "sni",
+	SearchColumns: []string{"src_ip", "dst_ip", "sni", "ja3", "ja4"},
+}
+
+func (tlsDissector) Schema() *Schema { return tlsSchema }
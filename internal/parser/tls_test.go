@@ -0,0 +1,342 @@
+package parser
+
+import (
+	"testing"
+
+	"golang.org/x/crypto/cryptobyte"
+	"sniffer/pkg/model"
+)
+
+// testExtension is a TLS extension of a test hello message
+type testExtension struct {
+	typ  uint16
+	data []byte
+}
+
+// build returns the extension data built by f
+func build(f func(b *cryptobyte.Builder)) []byte {
+	var b cryptobyte.Builder
+	f(&b)
+	return b.BytesOrPanic()
+}
+
+func sniExtension(name string) testExtension {
+	return testExtension{tlsExtServerName, build(func(b *cryptobyte.Builder) {
+		b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddUint8(0)
+			b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes([]byte(name)) })
+		})
+	})}
+}
+
+func alpnExtension(protos ...string) testExtension {
+	return testExtension{tlsExtALPN, build(func(b *cryptobyte.Builder) {
+		b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+			for _, p := range protos {
+				b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes([]byte(p)) })
+			}
+		})
+	})}
+}
+
+// uint16ListExtension is an extension holding a 16-bit length prefixed list (groups, signature algorithms)
+func uint16ListExtension(typ uint16, list ...uint16) testExtension {
+	return testExtension{typ, build(func(b *cryptobyte.Builder) {
+		b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+			for _, v := range list {
+				b.AddUint16(v)
+			}
+		})
+	})}
+}
+
+func supportedVersionsExtension(versions ...uint16) testExtension {
+	return testExtension{tlsExtSupportedVers, build(func(b *cryptobyte.Builder) {
+		b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
+			for _, v := range versions {
+				b.AddUint16(v)
+			}
+		})
+	})}
+}
+
+func pointFormatsExtension(formats ...uint8) testExtension {
+	return testExtension{tlsExtPointFormats, build(func(b *cryptobyte.Builder) {
+		b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes(formats) })
+	})}
+}
+
+// emptyExtension is an extension whose content is not used by the parser
+func emptyExtension(typ uint16) testExtension {
+	return testExtension{typ, nil}
+}
+
+// tlsRecord wraps a handshake message in a TLS handshake record
+func tlsRecord(msgType uint8, body []byte) []byte {
+	return build(func(b *cryptobyte.Builder) {
+		b.AddUint8(tlsRecordHandshake)
+		b.AddUint16(0x0301)
+		b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddUint8(msgType)
+			b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes(body) })
+		})
+	})
+}
+
+func addExtensions(b *cryptobyte.Builder, exts []testExtension) {
+	if exts == nil {
+		return
+	}
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		for _, e := range exts {
+			b.AddUint16(e.typ)
+			b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes(e.data) })
+		}
+	})
+}
+
+// clientHelloBody builds a ClientHello, exts 为 nil 时不带扩展块
+func clientHelloBody(version uint16, ciphers []uint16, exts []testExtension) []byte {
+	return build(func(b *cryptobyte.Builder) {
+		b.AddUint16(version)
+		b.AddBytes(make([]byte, 32))
+		b.AddUint8(0) // session_id
+		b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+			for _, c := range ciphers {
+				b.AddUint16(c)
+			}
+		})
+		b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) { b.AddUint8(0) })
+		addExtensions(b, exts)
+	})
+}
+
+func serverHelloBody(version, cipher uint16, exts []testExtension) []byte {
+	return build(func(b *cryptobyte.Builder) {
+		b.AddUint16(version)
+		b.AddBytes(make([]byte, 32))
+		b.AddUint8(0) // session_id
+		b.AddUint16(cipher)
+		b.AddUint8(0)
+		addExtensions(b, exts)
+	})
+}
+
+// ja4ClientHello is the ClientHello of the JA4 specification example (t13d1516h2_8daaf6152771_e5627efa2ab1)
+// 密码套件和扩展打乱顺序并加入 GREASE，指纹不受影响
+func ja4ClientHello() []byte {
+	ciphers := []uint16{0x2a2a, 0x1301, 0x1302, 0x1303, 0xc02b, 0xc02f, 0xc02c, 0xc030, 0xcca9, 0xcca8,
+		0xc013, 0xc014, 0x009c, 0x009d, 0x002f, 0x0035}
+	exts := []testExtension{
+		emptyExtension(0x0a0a),
+		sniExtension("example.com"),
+		emptyExtension(0x0017),
+		emptyExtension(0xff01),
+		uint16ListExtension(tlsExtGroups, 0x1a1a, 0x001d, 0x0017, 0x0018),
+		pointFormatsExtension(0),
+		emptyExtension(0x0023),
+		alpnExtension("h2", "http/1.1"),
+		emptyExtension(0x0005),
+		uint16ListExtension(tlsExtSignatureAlgs, 0x0403, 0x0804, 0x0401, 0x0503, 0x0805, 0x0501, 0x0806, 0x0601),
+		emptyExtension(0x0012),
+		emptyExtension(0x0033),
+		emptyExtension(0x002d),
+		supportedVersionsExtension(0x3a3a, 0x0304, 0x0303),
+		emptyExtension(0x001b),
+		emptyExtension(0x4469),
+		emptyExtension(0x0015),
+		emptyExtension(0x4a4a),
+	}
+	return clientHelloBody(0x0303, ciphers, exts)
+}
+
+func TestJA3(t *testing.T) {
+	tests := []struct {
+		name string
+		body []byte
+		want string
+	}{
+		{
+			// JA3 README: 769,47-53-5-10-49161-49162-49171-49172-50-56-19-4,0-10-11,23-24-25,0
+			name: "published vector",
+			body: clientHelloBody(0x0301,
+				[]uint16{47, 53, 5, 10, 49161, 49162, 49171, 49172, 50, 56, 19, 4},
+				[]testExtension{sniExtension("example.com"), uint16ListExtension(tlsExtGroups, 23, 24, 25), pointFormatsExtension(0)}),
+			want: "ada70206e40642a3e4461f35503241d5",
+		},
+		{
+			name: "GREASE ignored",
+			body: clientHelloBody(0x0301,
+				[]uint16{0x0a0a, 47, 53, 5, 10, 49161, 49162, 49171, 49172, 50, 56, 19, 4},
+				[]testExtension{emptyExtension(0x1a1a), sniExtension("example.com"),
+					uint16ListExtension(tlsExtGroups, 0x2a2a, 23, 24, 25), pointFormatsExtension(0)}),
+			want: "ada70206e40642a3e4461f35503241d5",
+		},
+		{
+			// JA3 README: 769,4-5-10-9-100-98-3-6-19-18-99,,,
+			name: "no extensions",
+			body: clientHelloBody(0x0301, []uint16{4, 5, 10, 9, 100, 98, 3, 6, 19, 18, 99}, nil),
+			want: "de350869b8c85de67a350c8d186f11e6",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hello, err := parseHello(tlsClientHello, tt.body)
+			if err != nil {
+				t.Fatalf("parseHello: %v", err)
+			}
+			if got := ja3(hello); got != tt.want {
+				t.Errorf("ja3 = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJA4(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      []byte
+		transport byte
+		want      string
+	}{
+		{
+			name:      "specification example",
+			body:      ja4ClientHello(),
+			transport: 't',
+			want:      "t13d1516h2_8daaf6152771_e5627efa2ab1",
+		},
+		{
+			name:      "QUIC",
+			body:      ja4ClientHello(),
+			transport: 'q',
+			want:      "q13d1516h2_8daaf6152771_e5627efa2ab1",
+		},
+		{
+			// 没有 SNI 和 ALPN 的 TLS 1.2：c02f,c030 / 000d_0401
+			name: "TLS 1.2 without SNI and ALPN",
+			body: clientHelloBody(0x0303, []uint16{0xc030, 0xc02f},
+				[]testExtension{uint16ListExtension(tlsExtSignatureAlgs, 0x0401)}),
+			transport: 't',
+			want:      "t12i020100_04659ec43a24_032c60bb0d32",
+		},
+		{
+			name:      "no extensions",
+			body:      clientHelloBody(0x0301, []uint16{0x002f}, nil),
+			transport: 't',
+			want:      "t10i010000_ba72b8082249_000000000000",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hello, err := parseHello(tlsClientHello, tt.body)
+			if err != nil {
+				t.Fatalf("parseHello: %v", err)
+			}
+			if got := ja4(hello, tt.transport); got != tt.want {
+				t.Errorf("ja4 = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTLS(t *testing.T) {
+	client := &model.Packet{
+		Protocol: "TCP", SrcIP: "192.168.1.10", DstIP: "93.184.216.34", SrcPort: 50123, DstPort: 443,
+		Payload: tlsRecord(tlsClientHello, ja4ClientHello()),
+	}
+	server := &model.Packet{
+		Protocol: "TCP", SrcIP: "93.184.216.34", DstIP: "192.168.1.10", SrcPort: 443, DstPort: 50123,
+		// JA3S: 771,4865,43-51
+		Payload: tlsRecord(tlsServerHello, serverHelloBody(0x0303, 0x1301, []testExtension{
+			{tlsExtSupportedVers, []byte{0x03, 0x04}},
+			emptyExtension(0x0033),
+		})),
+	}
+
+	s, err := ParseTLS(client)
+	if err != nil {
+		t.Fatalf("ParseTLS(ClientHello): %v", err)
+	}
+	if s.SNI != "example.com" || s.Domain != "example.com" {
+		t.Errorf("SNI = %q, Domain = %q, want example.com", s.SNI, s.Domain)
+	}
+	if s.ALPN != "h2,http/1.1" {
+		t.Errorf("ALPN = %q, want h2,http/1.1", s.ALPN)
+	}
+	if s.TLSOfferedVersions != "TLS 1.3,TLS 1.2" {
+		t.Errorf("TLSOfferedVersions = %q, want TLS 1.3,TLS 1.2", s.TLSOfferedVersions)
+	}
+	if s.JA4 != "t13d1516h2_8daaf6152771_e5627efa2ab1" {
+		t.Errorf("JA4 = %s", s.JA4)
+	}
+	if s.FiveTuple.SrcIP != "192.168.1.10" || s.FiveTuple.DstPort != 443 {
+		t.Errorf("FiveTuple = %+v, want client -> server", s.FiveTuple)
+	}
+
+	s, err = ParseTLS(server)
+	if err != nil {
+		t.Fatalf("ParseTLS(ServerHello): %v", err)
+	}
+	if s.TLSVersion != "TLS 1.3" || s.CipherSuite != "TLS_AES_128_GCM_SHA256" {
+		t.Errorf("TLSVersion = %q, CipherSuite = %q", s.TLSVersion, s.CipherSuite)
+	}
+	if s.JA3S != "f4febc55ea12b31ae17cfb7e614afda8" {
+		t.Errorf("JA3S = %s", s.JA3S)
+	}
+	// ServerHello 的会话同样是客户端 -> 服务端方向
+	if s.FiveTuple.SrcIP != "192.168.1.10" || s.FiveTuple.DstPort != 443 {
+		t.Errorf("FiveTuple = %+v, want client -> server", s.FiveTuple)
+	}
+
+	if _, err := ParseTLS(&model.Packet{Protocol: "TCP", SrcPort: 50123, DstPort: 443, Payload: []byte("GET / HTTP/1.1\r\n")}); err == nil {
+		t.Error("ParseTLS accepted a non-TLS payload")
+	}
+}
+
+func TestReadHandshake(t *testing.T) {
+	body := ja4ClientHello()
+	record := tlsRecord(tlsClientHello, body)
+
+	// 同一握手消息拆分到两个记录中
+	msg := record[tlsRecordHeaderLen:]
+	split := append(tlsRecordHeader(msg[:100]), msg[:100]...)
+	split = append(split, tlsRecordHeader(msg[100:])...)
+	split = append(split, msg[100:]...)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr error
+	}{
+		{"single record", record, nil},
+		{"split over records", split, nil},
+		{"followed by other records", append(append([]byte(nil), record...), 0x14, 0x03, 0x03, 0x00, 0x01, 0x01), nil},
+		{"truncated record", record[:len(record)-1], errTLSIncomplete},
+		{"truncated split", split[:len(split)-10], errTLSIncomplete},
+		{"header only", record[:3], errTLSIncomplete},
+		{"not a handshake", []byte{0x17, 0x03, 0x03, 0x00, 0x10}, ErrNotTLS},
+		{"not TLS", []byte("SSH-2.0-OpenSSH_9.6\r\n"), ErrNotTLS},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msgType, got, err := readHandshake(tt.data)
+			if err != tt.wantErr {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if msgType != tlsClientHello || string(got) != string(body) {
+				t.Errorf("readHandshake = type %d, %d bytes, want ClientHello of %d bytes", msgType, len(got), len(body))
+			}
+		})
+	}
+}
+
+// tlsRecordHeader returns the header of a handshake record carrying fragment
+func tlsRecordHeader(fragment []byte) []byte {
+	return []byte{tlsRecordHandshake, 0x03, 0x01, byte(len(fragment) >> 8), byte(len(fragment))}
+}
@@ -1,6 +1,8 @@
 package router
 
 import (
+	"fmt"
+
 	"github.com/gin-gonic/gin"
 	"sniffer/internal/config"
 	"sniffer/internal/server"
@@ -106,11 +108,27 @@ func RegistRouter(r *gin.Engine, app *server.App) {
 			app.DeleteAlertRule(id)
 			c.JSON(200, nil)
 		})
+		apiGroup.GET("/downloadAlertEvidence", func(c *gin.Context) {
+			id := StrToInt64(c.Query("id"))
+			data, err := app.GetAlertEvidence(id)
+			if err != nil {
+				c.JSON(404, err.Error())
+				return
+			}
+			c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=alert_%d.pcapng", id))
+			c.Data(200, "application/octet-stream", data)
+		})
 		// TODO 下载文件
 		apiGroup.POST("/exportPCAP", func(c *gin.Context) {
-			startTime := StrToInt64(c.PostForm("startTime"))
-			endTime := StrToInt64(c.PostForm("endTime"))
-			app.ExportPCAP(startTime, endTime)
+			req := model.ExportRequest{
+				StartTime: StrToInt64(c.PostForm("startTime")),
+				EndTime:   StrToInt64(c.PostForm("endTime")),
+				Filter:    c.PostForm("filter"),
+			}
+			if _, err := app.ExportPCAP(req); err != nil {
+				c.JSON(500, err.Error())
+				return
+			}
 			c.JSON(200, nil)
 		})
 		apiGroup.GET("/getProcessStats", func(c *gin.Context) {
@@ -174,6 +192,71 @@ func RegistRouter(r *gin.Engine, app *server.App) {
 				c.JSON(500, "convert fail")
 			}
 		})
+		apiGroup.POST("/queryHTTPLatency", func(c *gin.Context) {
+			var query model.HTTPLatencyQuery
+			if err := c.ShouldBindJSON(&query); err != nil {
+				c.JSON(500, "convert fail")
+				return
+			}
+			stats, err := app.QueryHTTPLatency(query)
+			if err != nil {
+				c.JSON(500, err.Error())
+				return
+			}
+			c.JSON(200, stats)
+		})
+		apiGroup.POST("/queryDNSRecords", func(c *gin.Context) {
+			var query model.DNSRecordQuery
+			if err := c.ShouldBindJSON(&query); err != nil {
+				c.JSON(500, "convert fail")
+				return
+			}
+			result, err := app.QueryDNSRecords(query)
+			if err != nil {
+				c.JSON(500, err.Error())
+				return
+			}
+			c.JSON(200, result)
+		})
+		apiGroup.POST("/queryHosts", func(c *gin.Context) {
+			var query model.HostQuery
+			if err := c.ShouldBindJSON(&query); err != nil {
+				c.JSON(500, "convert fail")
+				return
+			}
+			result, err := app.QueryHosts(query)
+			if err != nil {
+				c.JSON(500, err.Error())
+				return
+			}
+			c.JSON(200, result)
+		})
+		apiGroup.POST("/queryDNSStats", func(c *gin.Context) {
+			var query model.DNSStatsQuery
+			if err := c.ShouldBindJSON(&query); err != nil {
+				c.JSON(500, "convert fail")
+				return
+			}
+			stats, err := app.QueryDNSStats(query)
+			if err != nil {
+				c.JSON(500, err.Error())
+				return
+			}
+			c.JSON(200, stats)
+		})
+		apiGroup.POST("/queryDNSNXDomains", func(c *gin.Context) {
+			var query model.DNSNXDomainQuery
+			if err := c.ShouldBindJSON(&query); err != nil {
+				c.JSON(500, "convert fail")
+				return
+			}
+			stats, err := app.QueryDNSNXDomains(query)
+			if err != nil {
+				c.JSON(500, err.Error())
+				return
+			}
+			c.JSON(200, stats)
+		})
 		apiGroup.GET("/isPaused", func(c *gin.Context) {
 			config := app.IsPaused()
 			c.JSON(200, config)
@@ -195,6 +278,15 @@ func RegistRouter(r *gin.Engine, app *server.App) {
 			config := app.GetMetrics()
 			c.JSON(200, config)
 		})
+		apiGroup.GET("/getARPTable", func(c *gin.Context) {
+			c.JSON(200, app.GetARPTable())
+		})
+		apiGroup.GET("/getPingStats", func(c *gin.Context) {
+			c.JSON(200, app.GetPingStats())
+		})
+		apiGroup.GET("/getTraceRoutes", func(c *gin.Context) {
+			c.JSON(200, app.GetTraceRoutes())
+		})
 		apiGroup.GET("/getLibraryVersion", func(c *gin.Context) {
 			config := app.GetLibraryVersion()
 			c.JSON(200, config)
@@ -227,9 +319,60 @@ func RegistRouter(r *gin.Engine, app *server.App) {
 		})
 		apiGroup.POST("/startCapture", func(c *gin.Context) {
 			iface := c.PostForm("iface")
-			app.StartCapture(iface)
+			filter := c.PostForm("filter")
+			stop := model.StopConditions{
+				Duration: StrToInt64(c.PostForm("stopDuration")),
+				Packets:  StrToInt64(c.PostForm("stopPackets")),
+				Bytes:    StrToInt64(c.PostForm("stopBytes")),
+				Files:    StrToInt64(c.PostForm("stopFiles")),
+			}
+			if err := app.StartCapture(iface, filter, stop); err != nil {
+				c.JSON(500, err.Error())
+				return
+			}
+			c.JSON(200, nil)
+		})
+		apiGroup.GET("/getCaptureStatus", func(c *gin.Context) {
+			c.JSON(200, app.GetCaptureStatus())
+		})
+		apiGroup.GET("/getCaptureSettings", func(c *gin.Context) {
+			c.JSON(200, app.GetCaptureSettings())
+		})
+		apiGroup.POST("/stopInterface", func(c *gin.Context) {
+			iface := c.PostForm("iface")
+			if err := app.StopInterface(iface); err != nil {
+				c.JSON(500, err.Error())
+				return
+			}
+			c.JSON(200, nil)
+		})
+		apiGroup.POST("/setCaptureFilter", func(c *gin.Context) {
+			iface := c.PostForm("iface")
+			filter := c.PostForm("filter")
+			if err := app.SetCaptureFilter(iface, filter); err != nil {
+				c.JSON(500, err.Error())
+				return
+			}
 			c.JSON(200, nil)
 		})
+		apiGroup.POST("/startReplay", func(c *gin.Context) {
+			path := c.PostForm("path")
+			speed, err := strconv.ParseFloat(c.DefaultPostForm("speed", "1"), 64)
+			if err != nil || speed < 0 {
+				c.JSON(400, "invalid speed: "+c.PostForm("speed"))
+				return
+			}
+			status, err := app.StartReplay(path, speed)
+			if err != nil {
+				c.JSON(500, err.Error())
+				return
+			}
+			c.JSON(200, status)
+		})
+		apiGroup.GET("/getReplayStatus", func(c *gin.Context) {
+			status := app.GetReplayStatus()
+			c.JSON(200, status)
+		})
 		apiGroup.GET("/getRawPackets", func(c *gin.Context) {
 			limit := StrToInt(c.Query("limit"))
 			packets, _ := app.GetRawPackets(limit)
@@ -3,24 +3,43 @@ package scheduler
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
+	"sniffer/internal/capture"
 	"sniffer/internal/config"
 	"sniffer/internal/store"
+	"sniffer/pkg/model"
 )
 
-// Scheduler manages periodic maintenance tasks
-// 调度器：定期清理和维护
+// captureController is the part of the capture engine driven by the capture windows
+type captureController interface {
+	Start(iface, filter string, stop model.StopConditions) error
+	StopInterfaceWithReason(iface, reason string) error
+	GetInterfaceNames() []string
+	GetCaptureStatus() model.CaptureStatus
+}
+
+// Scheduler manages periodic maintenance tasks and scheduled capture windows
+// 调度器：定期清理和维护，按计划窗口启停抓包
 type Scheduler struct {
-	store store.Store
-	cfg   *config.Config
+	store   store.Store
+	cfg     *config.Config
+	capture captureController
+
+	mu      sync.Mutex
+	owned   map[string]time.Time // 由计划启动的网卡 -> 窗口结束时间
+	started map[string]time.Time // 已启动过的窗口（窗口+网卡）-> 窗口结束时间
 }
 
 // New creates a new Scheduler
-func New(s store.Store, cfg *config.Config) *Scheduler {
+func New(s store.Store, cfg *config.Config, cap *capture.Capture) *Scheduler {
 	return &Scheduler{
-		store: s,
-		cfg:   cfg,
+		store:   s,
+		cfg:     cfg,
+		capture: cap,
+		owned:   make(map[string]time.Time),
+		started: make(map[string]time.Time),
 	}
 }
 
@@ -33,6 +52,9 @@ func (s *Scheduler) Run(ctx context.Context) error {
 	fmt.Printf("Scheduler started: vacuum interval = %v, retention = %d days\n",
 		interval, s.cfg.DBVacuumDay)
 
+	// 计划抓包窗口先启动，避免启动时的数据库清理（VACUUM）推迟首个窗口
+	go s.runWindows(ctx)
+
 	// Run once immediately
 	s.runMaintenance()
 
@@ -0,0 +1,149 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"sniffer/pkg/model"
+)
+
+// windowInterval is how often the capture windows are evaluated
+const windowInterval = 10 * time.Second
+
+// runWindows starts and stops capture according to the configured capture windows
+// 计划抓包：窗口开始时启动抓包，窗口结束时停止由计划启动的网卡
+func (s *Scheduler) runWindows(ctx context.Context) {
+	ticker := time.NewTicker(windowInterval)
+	defer ticker.Stop()
+
+	s.evaluateWindows(time.Now())
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.evaluateWindows(now)
+		}
+	}
+}
+
+// evaluateWindows starts the windows that are active and stops the ones that ended
+func (s *Scheduler) evaluateWindows(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	running := make(map[string]bool)
+	for _, name := range s.capture.GetInterfaceNames() {
+		running[name] = true
+	}
+	// 手动停止（或出错停止）的网卡不再由计划管理，以后的窗口可以再次启动
+	for iface := range s.owned {
+		if !running[iface] {
+			delete(s.owned, iface)
+		}
+	}
+
+	for _, w := range s.cfg.GetSchedules() {
+		start, end, ok := w.Next(now)
+		if !ok || start.After(now) {
+			continue
+		}
+
+		// 每个窗口只启动一次，窗口内手动停止后不再自动重启
+		key := w.Name + "@" + start.Format(time.RFC3339)
+		for _, iface := range w.Interfaces {
+			if owned, ok := s.owned[iface]; ok {
+				// 由计划启动的网卡被多个窗口覆盖时延长到最晚的结束时间
+				if end.After(owned) {
+					s.owned[iface] = end
+				}
+				continue
+			}
+			if _, ok := s.started[key+"/"+iface]; ok || running[iface] {
+				continue
+			}
+			s.started[key+"/"+iface] = end
+
+			filter := w.Filter
+			if filter == "" {
+				filter = s.cfg.GetBPFFilter()
+			}
+			if err := s.capture.Start(iface, filter, model.StopConditions{}); err != nil {
+				fmt.Printf("[Schedule] %s: start capture on %s failed: %v\n", w.Name, iface, err)
+				continue
+			}
+			fmt.Printf("[Schedule] %s: capture started on %s until %s\n", w.Name, iface, end.Format("2006-01-02 15:04"))
+			s.owned[iface] = end
+		}
+	}
+
+	for iface, end := range s.owned {
+		if now.Before(end) {
+			continue
+		}
+		delete(s.owned, iface)
+		if err := s.capture.StopInterfaceWithReason(iface, model.StopReasonSchedule); err == nil {
+			fmt.Printf("[Schedule] capture stopped on %s\n", iface)
+		}
+	}
+
+	// 清理已结束窗口的启动记录
+	for key, end := range s.started {
+		if !now.Before(end) {
+			delete(s.started, key)
+		}
+	}
+}
+
+// Windows returns the active capture window and the next scheduled one
+// 当前没有所处窗口时 active 为 nil
+func (s *Scheduler) Windows(now time.Time) (active, next *model.ScheduleWindow) {
+	var actives, upcoming []*model.ScheduleWindow
+	for _, w := range s.cfg.GetSchedules() {
+		start, end, ok := w.Next(now)
+		if !ok {
+			continue
+		}
+		window := &model.ScheduleWindow{
+			Name:       w.Name,
+			Interfaces: w.Interfaces,
+			Start:      start,
+			End:        end,
+		}
+		if start.After(now) {
+			upcoming = append(upcoming, window)
+			continue
+		}
+		actives = append(actives, window)
+
+		// 当前窗口之后的下一次
+		if start, end, ok := w.Next(end); ok {
+			upcoming = append(upcoming, &model.ScheduleWindow{
+				Name:       w.Name,
+				Interfaces: w.Interfaces,
+				Start:      start,
+				End:        end,
+			})
+		}
+	}
+
+	sort.Slice(actives, func(i, j int) bool { return actives[i].End.Before(actives[j].End) })
+	sort.Slice(upcoming, func(i, j int) bool { return upcoming[i].Start.Before(upcoming[j].Start) })
+	if len(actives) > 0 {
+		active = actives[0]
+	}
+	if len(upcoming) > 0 {
+		next = upcoming[0]
+	}
+	return active, next
+}
+
+// CaptureStatus returns the capture session status together with the scheduled windows
+func (s *Scheduler) CaptureStatus() model.CaptureStatus {
+	status := s.capture.GetCaptureStatus()
+	status.ActiveWindow, status.NextWindow = s.Windows(time.Now())
+	return status
+}
@@ -0,0 +1,156 @@
+package scheduler
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"sniffer/internal/config"
+	"sniffer/pkg/model"
+)
+
+// fakeCapture records the calls made by the capture windows
+type fakeCapture struct {
+	running map[string]bool
+	calls   []string
+}
+
+func (f *fakeCapture) Start(iface, filter string, stop model.StopConditions) error {
+	if f.running[iface] {
+		return fmt.Errorf("%s already running", iface)
+	}
+	f.running[iface] = true
+	f.calls = append(f.calls, "start "+iface+" "+filter)
+	return nil
+}
+
+func (f *fakeCapture) StopInterfaceWithReason(iface, reason string) error {
+	if !f.running[iface] {
+		return fmt.Errorf("%s not running", iface)
+	}
+	delete(f.running, iface)
+	f.calls = append(f.calls, "stop "+iface+" "+reason)
+	return nil
+}
+
+func (f *fakeCapture) GetInterfaceNames() []string {
+	var names []string
+	for name := range f.running {
+		names = append(names, name)
+	}
+	return names
+}
+
+func (f *fakeCapture) GetCaptureStatus() model.CaptureStatus {
+	return model.CaptureStatus{}
+}
+
+// takeCalls returns the calls made since the last call to takeCalls
+func (f *fakeCapture) takeCalls() []string {
+	calls := f.calls
+	f.calls = nil
+	return calls
+}
+
+// newTestScheduler creates a scheduler with the given schedules driving a fake capture
+func newTestScheduler(t *testing.T, schedules string) (*Scheduler, *fakeCapture) {
+	t.Helper()
+	dir := t.TempDir()
+	yaml := fmt.Sprintf("data_dir: %[1]s\npcap_dir: %[1]s/pcap\ndb_path: %[1]s/sniffer.db\nbpf_filter: tcp\nsnapshot:\n  dir: %[1]s/evidence\nschedules:\n%[2]s", dir, schedules)
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("config.Load: %v", err)
+	}
+
+	fake := &fakeCapture{running: make(map[string]bool)}
+	s := New(nil, cfg, nil)
+	s.capture = fake
+	return s, fake
+}
+
+func TestEvaluateWindows(t *testing.T) {
+	// 2024-01-01 为周一
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, 1, day, hour, minute, 0, 0, time.Local)
+	}
+	s, fake := newTestScheduler(t, `
+  - name: office
+    interfaces: [eth0]
+    days: [weekdays]
+    start: "09:00"
+    end: "18:00"
+  - name: late
+    interfaces: [eth0]
+    days: [weekdays]
+    start: "17:00"
+    end: "20:00"
+  - name: night
+    interfaces: [eth1]
+    start: "22:00"
+    end: "02:00"
+    filter: udp
+`)
+
+	steps := []struct {
+		name  string
+		now   time.Time
+		setup func()
+		want  []string
+	}{
+		{name: "before the window", now: at(1, 8, 0)},
+		{name: "window starts", now: at(1, 9, 0), want: []string{"start eth0 tcp"}},
+		{name: "inside the window", now: at(1, 12, 0)},
+		{name: "overlapping window extends the end", now: at(1, 18, 0)},
+		{name: "overlapping window ends", now: at(1, 20, 0), want: []string{"stop eth0 schedule"}},
+		{name: "overnight window starts", now: at(1, 22, 0), want: []string{"start eth1 udp"}},
+		{name: "overnight window ends", now: at(2, 2, 0), want: []string{"stop eth1 schedule"}},
+		{name: "next day", now: at(2, 9, 0), want: []string{"start eth0 tcp"}},
+		{
+			name:  "stopped by hand is not restarted in the same window",
+			now:   at(2, 10, 0),
+			setup: func() { delete(fake.running, "eth0") },
+		},
+		{name: "not stopped at the end after a manual stop", now: at(2, 20, 0)},
+		{name: "started again by the next window", now: at(3, 9, 0), want: []string{"start eth0 tcp"}},
+		{name: "stopped at the end", now: at(3, 20, 0), want: []string{"stop eth0 schedule"}},
+		{
+			name:  "already running is left alone",
+			now:   at(4, 9, 0),
+			setup: func() { fake.running["eth0"] = true },
+		},
+		{name: "not stopped when the schedule did not start it", now: at(4, 20, 0)},
+		{
+			name:  "window starts after the manual capture stopped",
+			now:   at(5, 9, 0),
+			setup: func() { delete(fake.running, "eth0") },
+			want:  []string{"start eth0 tcp"},
+		},
+		{
+			name: "restarted by hand is no longer owned",
+			now:  at(5, 12, 0),
+			setup: func() {
+				delete(fake.running, "eth0")
+				s.evaluateWindows(at(5, 11, 0))
+				fake.running["eth0"] = true
+			},
+		},
+		{name: "manual capture is not stopped", now: at(5, 20, 0)},
+	}
+
+	for _, step := range steps {
+		if step.setup != nil {
+			step.setup()
+		}
+		s.evaluateWindows(step.now)
+		if got := fake.takeCalls(); !reflect.DeepEqual(got, step.want) {
+			t.Errorf("%s: calls = %q, want %q", step.name, got, step.want)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package server
 
 import (
 	"fmt"
+	"os"
 
 	"sniffer/pkg/model"
 )
@@ -106,6 +107,26 @@ func (a *App) DeleteAlertLog(id int64) error {
 	return sqliteStore.DeleteAlertLog(id)
 }
 
+// GetAlertEvidence 获取告警快照证据文件内容 (pcapng)
+func (a *App) GetAlertEvidence(id int64) ([]byte, error) {
+	sqliteStore := a.store.GetDB()
+	if sqliteStore == nil {
+		return nil, fmt.Errorf("database not available")
+	}
+
+	path, err := sqliteStore.GetAlertEvidence(id)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read evidence file: %w", err)
+	}
+
+	return data, nil
+}
+
 // GetAlertStats 获取告警统计
 func (a *App) GetAlertStats() (map[string]interface{}, error) {
 	sqliteStore := a.store.GetDB()
@@ -77,8 +77,34 @@ func (a *App) GetNpcapDownloadURL() string {
 }
 
 // StartCapture starts packet capture on the specified interface
-func (a *App) StartCapture(iface string) error {
-	return a.capture.Start(iface)
+// filter 为空时使用配置中的默认过滤器，stop 为自动停止条件（为 0 表示不限制）
+func (a *App) StartCapture(iface, filter string, stop model.StopConditions) error {
+	if filter == "" {
+		filter = a.cfg.GetBPFFilter()
+	}
+	return a.capture.Start(iface, filter, stop)
+}
+
+// SetCaptureFilter changes the BPF filter of the running capture
+// iface 为空时应用到所有正在抓包的网卡
+func (a *App) SetCaptureFilter(iface, filter string) error {
+	if iface == "" {
+		return a.capture.SetFilter(filter)
+	}
+	return a.capture.SetInterfaceFilter(iface, filter)
+}
+
+// StartReplay replays a saved PCAP/pcapng file through the capture pipeline
+func (a *App) StartReplay(path string, speed float64) (model.ReplayStatus, error) {
+	if err := a.capture.StartFromFile(path, speed); err != nil {
+		return model.ReplayStatus{}, err
+	}
+	return a.capture.GetReplayStatus(), nil
+}
+
+// GetReplayStatus returns the progress of the current (or last) replay
+func (a *App) GetReplayStatus() model.ReplayStatus {
+	return a.capture.GetReplayStatus()
 }
 
 // StopCapture stops packet capture
@@ -86,6 +112,11 @@ func (a *App) StopCapture() error {
 	return a.capture.Stop()
 }
 
+// StopInterface stops packet capture on a single interface
+func (a *App) StopInterface(iface string) error {
+	return a.capture.StopInterface(iface)
+}
+
 // PauseCapture pauses packet capture
 func (a *App) PauseCapture() {
 	a.capture.Pause()
@@ -122,6 +153,21 @@ func (a *App) GetMetrics() model.Metrics {
 	return a.capture.GetMetrics()
 }
 
+// GetARPTable 获取从 ARP 报文学习到的 IP-MAC 绑定表
+func (a *App) GetARPTable() []model.ARPEntry {
+	return a.capture.GetARPTable()
+}
+
+// GetPingStats 获取按目的地址统计的 ICMP 回显 RTT 和丢包率
+func (a *App) GetPingStats() []model.PingStat {
+	return a.capture.GetPingStats()
+}
+
+// GetTraceRoutes 获取按目的地址发现的 traceroute 路由跳
+func (a *App) GetTraceRoutes() []model.TraceRoute {
+	return a.capture.GetTraceRoutes()
+}
+
 // GetSnapshot returns a snapshot of the specified data table
 func (a *App) GetSnapshot(table string, limit int) ([]interface{}, error) {
 	tableType := model.TableType(table)
@@ -224,12 +270,14 @@ func (a *App) UpdateConfig(newCfg *config.Config) error {
 	if newCfg.RawMax != a.cfg.RawMax || 
 	   newCfg.DNSMax != a.cfg.DNSMax ||
 	   newCfg.HTTPMax != a.cfg.HTTPMax ||
-	   newCfg.ICMPMax != a.cfg.ICMPMax {
+	   newCfg.ICMPMax != a.cfg.ICMPMax ||
+	   newCfg.SessionMax != a.cfg.SessionMax {
 		a.capture.UpdateLimits(config.Limits{
-			RawMax:  newCfg.RawMax,
-			DNSMax:  newCfg.DNSMax,
-			HTTPMax: newCfg.HTTPMax,
-			ICMPMax: newCfg.ICMPMax,
+			RawMax:     newCfg.RawMax,
+			DNSMax:     newCfg.DNSMax,
+			HTTPMax:    newCfg.HTTPMax,
+			ICMPMax:    newCfg.ICMPMax,
+			SessionMax: newCfg.SessionMax,
 		})
 	}
 
@@ -241,12 +289,12 @@ func (a *App) UpdateConfig(newCfg *config.Config) error {
 }
 
 // ExportPCAP exports packets in the time range to PCAP format
-func (a *App) ExportPCAP(startTime, endTime int64) ([]byte, error) {
-	start := time.Unix(startTime, 0)
-	end := time.Unix(endTime, 0)
+func (a *App) ExportPCAP(req model.ExportRequest) ([]byte, error) {
+	start := time.Unix(req.StartTime, 0)
+	end := time.Unix(req.EndTime, 0)
 
 	var buf bytes.Buffer
-	if err := a.store.ExportPCAP(start, end, &buf); err != nil {
+	if err := a.store.ExportPCAP(start, end, req.Filter, &buf); err != nil {
 		return nil, fmt.Errorf("export pcap: %w", err)
 	}
 
@@ -274,6 +322,16 @@ func (a *App) IsPaused() bool {
 	return a.capture.IsPaused()
 }
 
+// GetCaptureSettings returns the effective capture settings of each running interface
+func (a *App) GetCaptureSettings() []model.CaptureSettings {
+	return a.capture.GetCaptureSettings()
+}
+
+// GetCaptureStatus returns the capture session state, its stop reason and the scheduled windows
+func (a *App) GetCaptureStatus() model.CaptureStatus {
+	return a.scheduler.CaptureStatus()
+}
+
 // GetCurrentInterface returns the current capture interface name
 func (a *App) GetCurrentInterface() string {
 	return a.capture.GetInterfaceName()
@@ -338,3 +396,53 @@ func (a *App) QuerySessionFlows(opts model.SessionFlowQuery) (*model.SessionFlow
 	return sqliteStore.QuerySessionFlows(opts)
 }
 
+// QueryHTTPLatency 按主机查询 HTTP 服务端延迟百分位
+func (a *App) QueryHTTPLatency(query model.HTTPLatencyQuery) ([]model.HTTPLatencyStats, error) {
+	composite, ok := a.store.(*store.CompositeStore)
+	if !ok {
+		return nil, fmt.Errorf("store is not composite")
+	}
+
+	return composite.GetDB().QueryHTTPLatency(query)
+}
+
+// QueryDNSRecords 按名称、类型、数据检索 DNS 资源记录
+func (a *App) QueryDNSRecords(query model.DNSRecordQuery) (*model.DNSRecordResult, error) {
+	composite, ok := a.store.(*store.CompositeStore)
+	if !ok {
+		return nil, fmt.Errorf("store is not composite")
+	}
+
+	return composite.GetDB().QueryDNSRecords(query)
+}
+
+// QueryDNSStats 按 DNS 服务器或进程查询解析延迟与失败率
+func (a *App) QueryDNSStats(query model.DNSStatsQuery) ([]model.DNSStats, error) {
+	composite, ok := a.store.(*store.CompositeStore)
+	if !ok {
+		return nil, fmt.Errorf("store is not composite")
+	}
+
+	return composite.GetDB().QueryDNSStats(query)
+}
+
+// QueryHosts 查询由 DHCP 学习到的主机清单
+func (a *App) QueryHosts(query model.HostQuery) (*model.HostResult, error) {
+	composite, ok := a.store.(*store.CompositeStore)
+	if !ok {
+		return nil, fmt.Errorf("store is not composite")
+	}
+
+	return composite.GetDB().QueryHosts(query)
+}
+
+// QueryDNSNXDomains 查询返回 NXDOMAIN 最多的域名
+func (a *App) QueryDNSNXDomains(query model.DNSNXDomainQuery) ([]model.DNSNXDomainStats, error) {
+	composite, ok := a.store.(*store.CompositeStore)
+	if !ok {
+		return nil, fmt.Errorf("store is not composite")
+	}
+
+	return composite.GetDB().QueryDNSNXDomains(query)
+}
+
@@ -77,20 +77,25 @@ func (dm *DashboardManager) GetDashboardStats() (*model.DashboardStats, error) {
 	// 捕获时间
 	stats.CaptureTime = int64(time.Since(dm.startTime).Seconds())
 
-	// 协议分布 - 从session_flows按协议统计
-	dm.db.QueryRow(`SELECT COUNT(*) FROM session_flows WHERE protocol = 'TCP'`).Scan(&stats.TCPCount)
-	dm.db.QueryRow(`SELECT COUNT(*) FROM session_flows WHERE protocol = 'UDP'`).Scan(&stats.UDPCount)
-	dm.db.QueryRow(`SELECT COUNT(*) FROM session_flows WHERE protocol = 'ICMP' OR protocol = 'ICMPv6'`).Scan(&stats.ICMPCount)
-	dm.db.QueryRow(`SELECT COUNT(*) FROM session_flows WHERE protocol NOT IN ('TCP', 'UDP', 'ICMP', 'ICMPv6')`).Scan(&stats.OtherCount)
+	// 协议分布 - 从session_flows按协议统计（流采样时每条流代表 flow_weight 条流）
+	dm.db.QueryRow(`SELECT COALESCE(SUM(flow_weight), 0) FROM session_flows WHERE protocol = 'TCP'`).Scan(&stats.TCPCount)
+	dm.db.QueryRow(`SELECT COALESCE(SUM(flow_weight), 0) FROM session_flows WHERE protocol = 'UDP'`).Scan(&stats.UDPCount)
+	dm.db.QueryRow(`SELECT COALESCE(SUM(flow_weight), 0) FROM session_flows WHERE protocol = 'ICMP' OR protocol = 'ICMPv6'`).Scan(&stats.ICMPCount)
+	dm.db.QueryRow(`SELECT COALESCE(SUM(flow_weight), 0) FROM session_flows WHERE protocol NOT IN ('TCP', 'UDP', 'ICMP', 'ICMPv6')`).Scan(&stats.OtherCount)
 
 	// 会话统计 - 从专门的会话表获取
 	dm.db.QueryRow(`SELECT COUNT(*) FROM dns_sessions`).Scan(&stats.DNSSessions)
 	dm.db.QueryRow(`SELECT COUNT(*) FROM http_sessions`).Scan(&stats.HTTPSessions)
 	dm.db.QueryRow(`SELECT COUNT(*) FROM icmp_sessions`).Scan(&stats.ICMPSessions)
+	dm.db.QueryRow(`SELECT COUNT(*) FROM tls_sessions`).Scan(&stats.TLSSessions)
 	
 	// 会话流总数
 	dm.db.QueryRow(`SELECT COUNT(*) FROM session_flows`).Scan(&stats.SessionFlowsCount)
 
+	// 采样标记 - 统计中包含按采样率放大的估计值
+	dm.db.QueryRow(`SELECT COUNT(*) FROM session_flows WHERE sampled = 1`).Scan(&stats.SampledFlows)
+	stats.Sampled = stats.SampledFlows > 0
+
 	// Top 源IP（带流量统计）
 	stats.TopSrcIPs, _ = dm.getTopIPsWithBytes("src_ip", 10)
 
@@ -158,6 +163,8 @@ func (dm *DashboardManager) getTopPorts(limit int) ([]model.PortStat, error) {
 			SELECT dst_port as port, payload_size FROM dns_sessions WHERE dst_port > 0
 			UNION ALL
 			SELECT dst_port as port, payload_size FROM http_sessions WHERE dst_port > 0
+			UNION ALL
+			SELECT dst_port as port, payload_size FROM tls_sessions WHERE dst_port > 0
 		)
 		GROUP BY port
 		ORDER BY count DESC
@@ -194,6 +201,8 @@ func (dm *DashboardManager) getTopDomains(limit int) ([]model.DomainStat, error)
 			SELECT domain FROM dns_sessions WHERE domain != ''
 			UNION ALL
 			SELECT host as domain FROM http_sessions WHERE host != ''
+			UNION ALL
+			SELECT sni as domain FROM tls_sessions WHERE sni != ''
 		)
 		GROUP BY domain
 		ORDER BY count DESC
@@ -3,10 +3,12 @@ package store
 import (
 	"database/sql"
 	"fmt"
+	"os"
 	"regexp"
 	"strings"
 	"time"
 
+	"sniffer/internal/parser"
 	"sniffer/pkg/model"
 )
 
@@ -18,20 +20,25 @@ func (s *SQLiteStore) CreateAlertRule(rule *model.AlertRule) error {
 	query := `
 		INSERT INTO alert_rules (
 			name, rule_type, enabled, condition_field, condition_operator, 
-			condition_value, alert_level, description, created_at, updated_at
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			condition_value, alert_level, description,
+			snapshot_enabled, snapshot_pre_seconds, snapshot_post_seconds, created_at, updated_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	enabled := 0
 	if rule.Enabled {
 		enabled = 1
 	}
+	snapshotEnabled := 0
+	if rule.SnapshotEnabled {
+		snapshotEnabled = 1
+	}
 
 	now := time.Now()
 	result, err := s.db.Exec(query,
 		rule.Name, rule.RuleType, enabled, rule.ConditionField,
 		rule.ConditionOperator, rule.ConditionValue, rule.AlertLevel,
-		rule.Description, now, now,
+		rule.Description, snapshotEnabled, rule.SnapshotPre, rule.SnapshotPost, now, now,
 	)
 	if err != nil {
 		return fmt.Errorf("create alert rule: %w", err)
@@ -57,19 +64,25 @@ func (s *SQLiteStore) UpdateAlertRule(rule *model.AlertRule) error {
 	if rule.Enabled {
 		enabled = 1
 	}
+	snapshotEnabled := 0
+	if rule.SnapshotEnabled {
+		snapshotEnabled = 1
+	}
 
 	query := `
 		UPDATE alert_rules SET
 			name = ?, rule_type = ?, enabled = ?, condition_field = ?,
 			condition_operator = ?, condition_value = ?, alert_level = ?,
-			description = ?, updated_at = ?
+			description = ?, snapshot_enabled = ?, snapshot_pre_seconds = ?,
+			snapshot_post_seconds = ?, updated_at = ?
 		WHERE id = ?
 	`
 
 	_, err := s.db.Exec(query,
 		rule.Name, rule.RuleType, enabled, rule.ConditionField,
 		rule.ConditionOperator, rule.ConditionValue, rule.AlertLevel,
-		rule.Description, time.Now(), rule.ID,
+		rule.Description, snapshotEnabled, rule.SnapshotPre, rule.SnapshotPost,
+		time.Now(), rule.ID,
 	)
 	if err != nil {
 		return fmt.Errorf("update alert rule: %w", err)
@@ -98,24 +111,30 @@ func (s *SQLiteStore) GetAlertRule(id int64) (*model.AlertRule, error) {
 
 	query := `
 		SELECT id, name, rule_type, enabled, condition_field, condition_operator,
-			   condition_value, alert_level, description, created_at, updated_at
+			   condition_value, alert_level, description, snapshot_enabled,
+			   snapshot_pre_seconds, snapshot_post_seconds, created_at, updated_at
 		FROM alert_rules
 		WHERE id = ?
 	`
 
 	rule := &model.AlertRule{}
 	var enabled int
+	var snapshotEnabled, snapshotPre, snapshotPost sql.NullInt64
 
 	err := s.db.QueryRow(query, id).Scan(
 		&rule.ID, &rule.Name, &rule.RuleType, &enabled, &rule.ConditionField,
 		&rule.ConditionOperator, &rule.ConditionValue, &rule.AlertLevel,
-		&rule.Description, &rule.CreatedAt, &rule.UpdatedAt,
+		&rule.Description, &snapshotEnabled, &snapshotPre, &snapshotPost,
+		&rule.CreatedAt, &rule.UpdatedAt,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("get alert rule: %w", err)
 	}
 
 	rule.Enabled = enabled == 1
+	rule.SnapshotEnabled = snapshotEnabled.Int64 == 1
+	rule.SnapshotPre = int(snapshotPre.Int64)
+	rule.SnapshotPost = int(snapshotPost.Int64)
 	return rule, nil
 }
 
@@ -158,7 +177,8 @@ func (s *SQLiteStore) QueryAlertRules(q model.AlertRuleQuery) ([]*model.AlertRul
 	// 查询数据
 	query := `
 		SELECT id, name, rule_type, enabled, condition_field, condition_operator,
-			   condition_value, alert_level, description, created_at, updated_at
+			   condition_value, alert_level, description, snapshot_enabled,
+			   snapshot_pre_seconds, snapshot_post_seconds, created_at, updated_at
 		FROM alert_rules ` + whereClause + `
 		ORDER BY created_at DESC
 		LIMIT ? OFFSET ?
@@ -180,17 +200,22 @@ func (s *SQLiteStore) QueryAlertRules(q model.AlertRuleQuery) ([]*model.AlertRul
 	for rows.Next() {
 		rule := &model.AlertRule{}
 		var enabled int
+		var snapshotEnabled, snapshotPre, snapshotPost sql.NullInt64
 
 		err := rows.Scan(
 			&rule.ID, &rule.Name, &rule.RuleType, &enabled, &rule.ConditionField,
 			&rule.ConditionOperator, &rule.ConditionValue, &rule.AlertLevel,
-			&rule.Description, &rule.CreatedAt, &rule.UpdatedAt,
+			&rule.Description, &snapshotEnabled, &snapshotPre, &snapshotPost,
+			&rule.CreatedAt, &rule.UpdatedAt,
 		)
 		if err != nil {
 			continue
 		}
 
 		rule.Enabled = enabled == 1
+		rule.SnapshotEnabled = snapshotEnabled.Int64 == 1
+		rule.SnapshotPre = int(snapshotPre.Int64)
+		rule.SnapshotPost = int(snapshotPost.Int64)
 		rules = append(rules, rule)
 	}
 
@@ -204,14 +229,18 @@ func (s *SQLiteStore) CreateAlertLog(log *model.AlertLog) error {
 
 	// 检查是否存在相同的告警（未确认，且核心字段相同）
 	// 相同告警定义：同一规则、同一目标（dst_ip或domain）、未确认
+	// 没有目标的内置告警（如非法 DHCP 服务器、ARP 欺骗，rule_id 为 0）按规则类型、名称和来源去重
 	checkQuery := `
 		SELECT id, trigger_count
 		FROM alert_logs
 		WHERE rule_id = ? 
+		  AND rule_type = ?
+		  AND (rule_id != 0 OR rule_name = ?)
 		  AND acknowledged = 0
 		  AND (
 		    (dst_ip != '' AND dst_ip = ?) OR 
-		    (domain != '' AND domain = ?)
+		    (domain != '' AND domain = ?) OR
+		    (dst_ip = '' AND domain = '' AND src_ip != '' AND src_ip = ?)
 		  )
 		ORDER BY triggered_at DESC
 		LIMIT 1
@@ -219,7 +248,7 @@ func (s *SQLiteStore) CreateAlertLog(log *model.AlertLog) error {
 
 	var existingID int64
 	var triggerCount int64
-	err := s.db.QueryRow(checkQuery, log.RuleID, log.DstIP, log.Domain).Scan(&existingID, &triggerCount)
+	err := s.db.QueryRow(checkQuery, log.RuleID, log.RuleType, log.RuleName, log.DstIP, log.Domain, log.SrcIP).Scan(&existingID, &triggerCount)
 
 	if err == nil {
 		// 找到相同告警，更新触发次数和最后触发时间
@@ -294,6 +323,8 @@ func (s *SQLiteStore) DeleteAlertLog(id int64) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	s.removeEvidenceFiles("WHERE id = ?", id)
+
 	_, err := s.db.Exec("DELETE FROM alert_logs WHERE id = ?", id)
 	if err != nil {
 		return fmt.Errorf("delete alert log: %w", err)
@@ -372,7 +403,7 @@ func (s *SQLiteStore) QueryAlertLogs(q model.AlertLogQuery) ([]*model.AlertLog,
 	query := `
 		SELECT id, rule_id, rule_name, rule_type, alert_level, triggered_at, last_triggered_at, trigger_count,
 			   src_ip, dst_ip, protocol, domain, url, details,
-			   acknowledged, acknowledged_at, acknowledged_by
+			   acknowledged, acknowledged_at, acknowledged_by, evidence_path
 		FROM alert_logs ` + whereClause + `
 		ORDER BY ` + sortBy + ` ` + sortOrder + `
 		LIMIT ? OFFSET ?
@@ -397,12 +428,14 @@ func (s *SQLiteStore) QueryAlertLogs(q model.AlertLogQuery) ([]*model.AlertLog,
 		var acknowledgedAt sql.NullTime
 		var acknowledgedBy sql.NullString
 		var lastTriggeredAt sql.NullTime
+		var evidencePath sql.NullString
 
 		err := rows.Scan(
 			&log.ID, &log.RuleID, &log.RuleName, &log.RuleType, &log.AlertLevel,
 			&log.TriggeredAt, &lastTriggeredAt, &log.TriggerCount,
 			&log.SrcIP, &log.DstIP, &log.Protocol, &log.Domain,
 			&log.URL, &log.Details, &acknowledged, &acknowledgedAt, &acknowledgedBy,
+			&evidencePath,
 		)
 		if err != nil {
 			continue
@@ -415,6 +448,7 @@ func (s *SQLiteStore) QueryAlertLogs(q model.AlertLogQuery) ([]*model.AlertLog,
 		if acknowledgedBy.Valid {
 			log.AcknowledgedBy = acknowledgedBy.String
 		}
+		log.EvidencePath = evidencePath.String
 		if lastTriggeredAt.Valid {
 			log.LastTriggeredAt = lastTriggeredAt.Time
 		} else {
@@ -435,7 +469,8 @@ func (s *SQLiteStore) CheckAlertRules(pkt *model.Packet, session *model.Session)
 	// 查询所有启用的规则
 	query := `
 		SELECT id, name, rule_type, condition_field, condition_operator,
-			   condition_value, alert_level
+			   condition_value, alert_level, snapshot_enabled,
+			   snapshot_pre_seconds, snapshot_post_seconds
 		FROM alert_rules
 		WHERE enabled = 1
 	`
@@ -447,32 +482,22 @@ func (s *SQLiteStore) CheckAlertRules(pkt *model.Packet, session *model.Session)
 	}
 	defer rows.Close()
 
-	rules := []struct {
-		ID                int64
-		Name              string
-		RuleType          string
-		ConditionField    string
-		ConditionOperator string
-		ConditionValue    string
-		AlertLevel        string
-	}{}
+	rules := []*model.AlertRule{}
 
 	for rows.Next() {
-		var rule struct {
-			ID                int64
-			Name              string
-			RuleType          string
-			ConditionField    string
-			ConditionOperator string
-			ConditionValue    string
-			AlertLevel        string
-		}
+		rule := &model.AlertRule{Enabled: true}
+		var snapshotEnabled, snapshotPre, snapshotPost sql.NullInt64
 		if err := rows.Scan(&rule.ID, &rule.Name, &rule.RuleType, &rule.ConditionField,
-			&rule.ConditionOperator, &rule.ConditionValue, &rule.AlertLevel); err != nil {
+			&rule.ConditionOperator, &rule.ConditionValue, &rule.AlertLevel,
+			&snapshotEnabled, &snapshotPre, &snapshotPost); err != nil {
 			continue
 		}
+		rule.SnapshotEnabled = snapshotEnabled.Int64 == 1
+		rule.SnapshotPre = int(snapshotPre.Int64)
+		rule.SnapshotPost = int(snapshotPost.Int64)
 		rules = append(rules, rule)
 	}
+	handler := s.alertHandler
 	s.mu.RUnlock()
 
 	// 检查每个规则
@@ -511,18 +536,87 @@ func (s *SQLiteStore) CheckAlertRules(pkt *model.Packet, session *model.Session)
 			}
 
 			// 异步写入，避免阻塞
-			go s.CreateAlertLog(log)
+			go func(rule *model.AlertRule, log *model.AlertLog) {
+				if err := s.CreateAlertLog(log); err != nil {
+					return
+				}
+				// 仅首次触发（新告警记录）时回调，重复触发只累加次数
+				if handler != nil && log.TriggerCount == 1 {
+					handler(rule, log, pkt)
+				}
+			}(rule, log)
 		}
 	}
 
 	return nil
 }
 
+// AlertHandler is called after a new alert log has been created
+type AlertHandler func(rule *model.AlertRule, log *model.AlertLog, pkt *model.Packet)
+
+// SetAlertHandler 设置告警触发回调
+func (s *SQLiteStore) SetAlertHandler(handler AlertHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.alertHandler = handler
+}
+
+// SetAlertEvidence 关联告警记录的证据文件
+func (s *SQLiteStore) SetAlertEvidence(id int64, path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.db.Exec("UPDATE alert_logs SET evidence_path = ? WHERE id = ?", path, id)
+	if err != nil {
+		return fmt.Errorf("set alert evidence: %w", err)
+	}
+
+	return nil
+}
+
+// GetAlertEvidence 获取告警记录的证据文件路径
+func (s *SQLiteStore) GetAlertEvidence(id int64) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var path sql.NullString
+	err := s.db.QueryRow("SELECT evidence_path FROM alert_logs WHERE id = ?", id).Scan(&path)
+	if err != nil {
+		return "", fmt.Errorf("get alert evidence: %w", err)
+	}
+	if path.String == "" {
+		return "", fmt.Errorf("alert %d has no evidence file", id)
+	}
+
+	return path.String, nil
+}
+
+// removeEvidenceFiles 删除匹配告警记录的证据文件（调用方需持有写锁）
+func (s *SQLiteStore) removeEvidenceFiles(where string, args ...interface{}) {
+	rows, err := s.db.Query("SELECT evidence_path FROM alert_logs "+where, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var path sql.NullString
+		if err := rows.Scan(&path); err != nil || path.String == "" {
+			continue
+		}
+		if err := os.Remove(path.String); err != nil && !os.IsNotExist(err) {
+			fmt.Printf("Warning: failed to remove evidence file %s: %v\n", path.String, err)
+		}
+	}
+}
+
 // ClearAllAlerts 清空所有告警记录
 func (s *SQLiteStore) ClearAllAlerts() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	s.removeEvidenceFiles("")
+
 	_, err := s.db.Exec("DELETE FROM alert_logs")
 	if err != nil {
 		return fmt.Errorf("clear alert logs: %w", err)
@@ -543,39 +637,6 @@ func (s *SQLiteStore) matchRule(pkt *model.Packet, session *model.Session,
 		if field == "dst_ip" {
 			fieldValue = pkt.DstIP
 		}
-	case "dns":
-		if session != nil && session.Type == "DNS" {
-			if field == "domain" {
-				fieldValue = session.Domain
-			}
-		} else {
-			return false
-		}
-	case "util":
-		if session != nil && session.Type == "HTTP" {
-			if field == "domain" {
-				fieldValue = session.Domain
-			} else if field == "url" {
-				// HTTP的URL由Host和Path组成
-				if session.Host != "" {
-					fieldValue = session.Host + session.Path
-				} else {
-					fieldValue = session.Path
-				}
-			}
-		} else {
-			return false
-		}
-	case "icmp":
-		if pkt.Protocol == "ICMP" || pkt.Protocol == "ICMPv6" {
-			if field == "src_ip" {
-				fieldValue = pkt.SrcIP
-			} else if field == "dst_ip" {
-				fieldValue = pkt.DstIP
-			}
-		} else {
-			return false
-		}
 	case "process":
 		// 进程告警
 		if field == "process_name" {
@@ -590,7 +651,17 @@ func (s *SQLiteStore) matchRule(pkt *model.Packet, session *model.Session,
 			return false
 		}
 	default:
-		return false
+		// 注册的协议：规则类型为协议的表类型，字段由解析器提供（QUIC 会话属于 TLS 解析器）
+		d, ok := parser.DissectorForTable(model.TableType(ruleType))
+		if !ok || session == nil {
+			return false
+		}
+		if sd, ok := parser.DissectorForSession(session); !ok || sd.Name() != d.Name() {
+			return false
+		}
+		if fieldValue, ok = d.AlertField(session, field); !ok {
+			return false
+		}
 	}
 
 	// 根据操作符比较（忽略大小写）
@@ -607,6 +678,17 @@ func (s *SQLiteStore) matchRule(pkt *model.Packet, session *model.Session,
 		}
 		matched, err := regexp.MatchString(pattern, fieldValue)
 		return err == nil && matched
+	case "not_regex":
+		// 白名单：字段不匹配时告警（如非预期的 SSH 客户端）；字段为空（未解析到）时不告警
+		if fieldValue == "" {
+			return false
+		}
+		pattern := value
+		if !strings.HasPrefix(pattern, "(?i)") {
+			pattern = "(?i)" + pattern
+		}
+		matched, err := regexp.MatchString(pattern, fieldValue)
+		return err == nil && !matched
 	default:
 		return false
 	}
@@ -0,0 +1,52 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+
+	"sniffer/pkg/model"
+)
+
+func TestMatchRuleRegisteredTables(t *testing.T) {
+	s, err := NewSQLiteStore(filepath.Join(t.TempDir(), "test.db"), 0)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer s.Close()
+
+	httpSession := &model.Session{Type: "HTTP", Host: "example.com", Path: "/api/login"}
+	dnsSession := &model.Session{Type: "DNS", Domain: "evil.example.cn"}
+	quicSession := &model.Session{Type: "QUIC", SNI: "video.example.com"}
+
+	tests := []struct {
+		name                             string
+		session                          *model.Session
+		ruleType, field, operator, value string
+		want                             bool
+	}{
+		// 界面创建的 HTTP 规则类型为 http
+		{"http url", httpSession, "http", "url", "contains", "/api/login", true},
+		{"http domain", httpSession, "http", "domain", "equals", "other.com", false},
+		{"dns regex", dnsSession, "dns", "domain", "regex", `\.cn$`, true},
+		{"QUIC session matches TLS rules", quicSession, "tls", "sni", "contains", "video", true},
+		{"rule of another protocol", dnsSession, "http", "url", "contains", "evil", false},
+		{"unknown rule type", httpSession, "util", "url", "contains", "/api", false},
+		{"unknown field", httpSession, "http", "no_such_field", "contains", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pkt := &model.Packet{SrcIP: "10.0.0.1", DstIP: "10.0.0.2"}
+			if got := s.matchRule(pkt, tt.session, tt.ruleType, tt.field, tt.operator, tt.value); got != tt.want {
+				t.Errorf("matchRule = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	result, err := s.QuerySessions(model.QueryOptions{Table: model.TableType("http"), Limit: 10})
+	if err != nil {
+		t.Fatalf("QuerySessions(http): %v", err)
+	}
+	if result.Total != 0 {
+		t.Errorf("QuerySessions(http) total = %d", result.Total)
+	}
+}
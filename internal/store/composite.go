@@ -57,8 +57,13 @@ func (cs *CompositeStore) LoadSnapshot(table model.TableType, limit int) ([]*mod
 }
 
 // ExportPCAP exports packets from PCAP files
-func (cs *CompositeStore) ExportPCAP(start, end time.Time, w io.Writer) error {
-	return cs.pcapStore.ExportPCAP(start, end, w)
+func (cs *CompositeStore) ExportPCAP(start, end time.Time, filter string, w io.Writer) error {
+	return cs.pcapStore.ExportPCAP(start, end, filter, w)
+}
+
+// FilesCreated returns the number of PCAP files created
+func (cs *CompositeStore) FilesCreated() int64 {
+	return cs.pcapStore.FilesCreated()
 }
 
 // Vacuum removes old data from both stores
@@ -90,6 +95,8 @@ func (cs *CompositeStore) Stats() (StoreStats, error) {
 		DNSCount:      sessionStats.DNSCount,
 		HTTPCount:     sessionStats.HTTPCount,
 		ICMPCount:     sessionStats.ICMPCount,
+		TLSCount:      sessionStats.TLSCount,
+		SessionCounts: sessionStats.SessionCounts,
 		TotalSize:     pcapStats.TotalSize + sessionStats.TotalSize,
 		PcapFileCount: pcapStats.PcapFileCount,
 	}
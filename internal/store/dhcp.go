@@ -0,0 +1,115 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"sniffer/internal/parser"
+	"sniffer/pkg/model"
+)
+
+// upsertHostSQL merges a DHCP message into the host inventory; 空值不覆盖已学习到的信息
+const upsertHostSQL = `
+	INSERT INTO hosts (mac, ip, hostname, vendor_class, dhcp_server, lease_time, first_seen, last_seen)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(mac) DO UPDATE SET
+		ip = COALESCE(NULLIF(excluded.ip, ''), hosts.ip),
+		hostname = COALESCE(NULLIF(excluded.hostname, ''), hosts.hostname),
+		vendor_class = COALESCE(NULLIF(excluded.vendor_class, ''), hosts.vendor_class),
+		dhcp_server = COALESCE(NULLIF(excluded.dhcp_server, ''), hosts.dhcp_server),
+		lease_time = CASE WHEN excluded.lease_time > 0 THEN excluded.lease_time ELSE hosts.lease_time END,
+		first_seen = MIN(hosts.first_seen, excluded.first_seen),
+		last_seen = MAX(hosts.last_seen, excluded.last_seen)
+`
+
+// writeDHCPSession writes a DHCP message and updates the host inventory (调用方需持有写锁)
+// 只有服务器确认（ACK/REPLY）的地址和服务器才记入主机清单，OFFER 可能未被客户端接受
+func (s *SQLiteStore) writeDHCPSession(stmt *sql.Stmt, schema *parser.Schema, session *model.Session) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin dhcp transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Stmt(stmt).Exec(schemaValues(schema, session)...)
+	if err != nil {
+		return err
+	}
+	if id, err := result.LastInsertId(); err == nil {
+		session.ID = id
+	}
+
+	if session.ClientMAC != "" {
+		var ip, server string
+		var lease uint32
+		if session.DHCPMessageType == "ACK" || session.DHCPMessageType == "REPLY" {
+			ip, server, lease = session.AssignedIP, session.DHCPServer, session.LeaseTime
+		}
+		if _, err := tx.Exec(upsertHostSQL, session.ClientMAC, ip, session.Hostname, session.VendorClass,
+			server, lease, session.Timestamp, session.Timestamp); err != nil {
+			return fmt.Errorf("upsert host: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// QueryHosts 查询由 DHCP 学习到的主机清单
+func (s *SQLiteStore) QueryHosts(query model.HostQuery) (*model.HostResult, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	where := "1=1"
+	args := []interface{}{}
+	if query.Search != "" {
+		cols := []string{"mac", "ip", "hostname", "vendor_class", "dhcp_server"}
+		conds := make([]string, len(cols))
+		for i, col := range cols {
+			conds[i] = col + " LIKE ?"
+			args = append(args, "%"+query.Search+"%")
+		}
+		where = "(" + strings.Join(conds, " OR ") + ")"
+	}
+
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM hosts WHERE "+where, args...).Scan(&total); err != nil {
+		return nil, fmt.Errorf("count hosts: %w", err)
+	}
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+
+	rows, err := s.db.Query(`
+		SELECT mac, COALESCE(ip, ''), COALESCE(hostname, ''), COALESCE(vendor_class, ''),
+			   COALESCE(dhcp_server, ''), COALESCE(lease_time, 0), first_seen, last_seen
+		FROM hosts
+		WHERE `+where+`
+		ORDER BY last_seen DESC
+		LIMIT ? OFFSET ?
+	`, append(args, limit, query.Offset)...)
+	if err != nil {
+		return nil, fmt.Errorf("query hosts: %w", err)
+	}
+	defer rows.Close()
+
+	hosts := []*model.Host{}
+	for rows.Next() {
+		h := &model.Host{}
+		if err := rows.Scan(&h.MAC, &h.IP, &h.Hostname, &h.VendorClass,
+			&h.DHCPServer, &h.LeaseTime, &h.FirstSeen, &h.LastSeen); err != nil {
+			return nil, fmt.Errorf("scan host: %w", err)
+		}
+		hosts = append(hosts, h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return &model.HostResult{
+		Total: total,
+		Data:  hosts,
+	}, nil
+}
@@ -0,0 +1,56 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"sniffer/pkg/model"
+)
+
+func TestDHCPHostInventory(t *testing.T) {
+	s, err := NewSQLiteStore(filepath.Join(t.TempDir(), "test.db"), 0)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer s.Close()
+
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	dhcp := func(offset time.Duration, msgType, ip, hostname string) *model.Session {
+		return &model.Session{
+			Timestamp: start.Add(offset),
+			FiveTuple: model.FiveTuple{SrcIP: "192.168.1.1", DstIP: "192.168.1.100", SrcPort: 67, DstPort: 68, Protocol: "UDP"},
+			Type:      "DHCP", DHCPMessageType: msgType,
+			ClientMAC: "00:11:22:33:44:55", AssignedIP: ip, Hostname: hostname, VendorClass: "MSFT 5.0",
+			DHCPServer: "192.168.1.1", LeaseTime: 86400,
+		}
+	}
+
+	// OFFER 不记入地址；ACK 记入地址、服务器和租期；之后的 DISCOVER 不覆盖已学习到的信息
+	sessions := []*model.Session{
+		dhcp(0, "OFFER", "192.168.1.99", ""),
+		dhcp(time.Second, "ACK", "192.168.1.100", "laptop"),
+		dhcp(time.Hour, "DISCOVER", "", ""),
+	}
+	for _, session := range sessions {
+		if err := s.WriteSession(model.TableDHCP, session); err != nil {
+			t.Fatalf("WriteSession(%s): %v", session.DHCPMessageType, err)
+		}
+	}
+
+	result, err := s.QueryHosts(model.HostQuery{Search: "laptop"})
+	if err != nil {
+		t.Fatalf("QueryHosts: %v", err)
+	}
+	if result.Total != 1 || len(result.Data) != 1 {
+		t.Fatalf("QueryHosts returned %d hosts, want 1", result.Total)
+	}
+	h := result.Data[0]
+	if h.MAC != "00:11:22:33:44:55" || h.IP != "192.168.1.100" || h.Hostname != "laptop" ||
+		h.VendorClass != "MSFT 5.0" || h.DHCPServer != "192.168.1.1" || h.LeaseTime != 86400 {
+		t.Errorf("host = %+v", h)
+	}
+	if !h.FirstSeen.Equal(start) || !h.LastSeen.Equal(start.Add(time.Hour)) {
+		t.Errorf("first_seen = %v, last_seen = %v", h.FirstSeen, h.LastSeen)
+	}
+}
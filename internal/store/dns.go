@@ -0,0 +1,327 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"sniffer/internal/parser"
+	"sniffer/pkg/model"
+)
+
+// writeDNSSession writes a DNS session and its records (调用方需持有写锁)
+// 会话与资源记录在同一事务中写入，记录通过 session_id 关联会话
+func (s *SQLiteStore) writeDNSSession(stmt *sql.Stmt, schema *parser.Schema, session *model.Session) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin dns transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Stmt(stmt).Exec(schemaValues(schema, session)...)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("get last insert id: %w", err)
+	}
+	session.ID = id
+
+	if len(session.DNSRecords) > 0 {
+		recordStmt := tx.Stmt(s.dnsRecordStmt)
+		for _, r := range session.DNSRecords {
+			if _, err := recordStmt.Exec(id, r.Section, r.Name, r.Type, r.TTL, r.Data); err != nil {
+				return fmt.Errorf("insert dns record: %w", err)
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// loadDNSRecords fills the records of the given DNS sessions
+func (s *SQLiteStore) loadDNSRecords(sessions []*model.Session) error {
+	if len(sessions) == 0 {
+		return nil
+	}
+
+	byID := make(map[int64]*model.Session, len(sessions))
+	placeholders := make([]string, 0, len(sessions))
+	args := make([]interface{}, 0, len(sessions))
+	for _, session := range sessions {
+		byID[session.ID] = session
+		placeholders = append(placeholders, "?")
+		args = append(args, session.ID)
+	}
+
+	rows, err := s.db.Query(fmt.Sprintf(`
+		SELECT session_id, section, COALESCE(name, ''), COALESCE(type, ''), COALESCE(ttl, 0), COALESCE(data, '')
+		FROM dns_records
+		WHERE session_id IN (%s)
+		ORDER BY id
+	`, strings.Join(placeholders, ", ")), args...)
+	if err != nil {
+		return fmt.Errorf("query dns records: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var sessionID int64
+		var r model.DNSRecord
+		if err := rows.Scan(&sessionID, &r.Section, &r.Name, &r.Type, &r.TTL, &r.Data); err != nil {
+			return fmt.Errorf("scan dns record: %w", err)
+		}
+		if session := byID[sessionID]; session != nil {
+			session.DNSRecords = append(session.DNSRecords, r)
+		}
+	}
+	return rows.Err()
+}
+
+// QueryDNSRecords 按名称、类型、数据检索 DNS 资源记录
+// 例如查找解析到某个 IP 的所有域名（data = IP），或某个 CNAME 目标的所有别名
+func (s *SQLiteStore) QueryDNSRecords(query model.DNSRecordQuery) (*model.DNSRecordResult, error) {
+	where := []string{"1=1"}
+	args := []interface{}{}
+	if query.Name != "" {
+		where = append(where, "r.name LIKE ?")
+		args = append(args, "%"+query.Name+"%")
+	}
+	if query.Type != "" {
+		where = append(where, "r.type = ?")
+		args = append(args, strings.ToUpper(query.Type))
+	}
+	if query.Data != "" {
+		where = append(where, "r.data LIKE ?")
+		args = append(args, "%"+query.Data+"%")
+	}
+	if query.Section != "" {
+		where = append(where, "r.section = ?")
+		args = append(args, query.Section)
+	}
+	if query.StartTime > 0 {
+		where = append(where, "d.timestamp >= ?")
+		args = append(args, time.Unix(query.StartTime, 0))
+	}
+	if query.EndTime > 0 {
+		where = append(where, "d.timestamp <= ?")
+		args = append(args, time.Unix(query.EndTime, 0))
+	}
+	whereClause := strings.Join(where, " AND ")
+
+	from := `
+		FROM dns_records r
+		JOIN dns_sessions d ON d.id = r.session_id
+		WHERE ` + whereClause
+
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*) "+from, args...).Scan(&total); err != nil {
+		return nil, fmt.Errorf("count dns records: %w", err)
+	}
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+
+	rows, err := s.db.Query(`
+		SELECT r.session_id, r.section, COALESCE(r.name, ''), COALESCE(r.type, ''), COALESCE(r.ttl, 0), COALESCE(r.data, ''),
+			   d.timestamp, d.src_ip, d.dst_ip, COALESCE(d.domain, ''), COALESCE(d.rcode, ''), COALESCE(d.process_name, '')
+		`+from+`
+		ORDER BY d.timestamp DESC, r.id
+		LIMIT ? OFFSET ?
+	`, append(args, limit, query.Offset)...)
+	if err != nil {
+		return nil, fmt.Errorf("query dns records: %w", err)
+	}
+	defer rows.Close()
+
+	matches := []*model.DNSRecordMatch{}
+	for rows.Next() {
+		m := &model.DNSRecordMatch{}
+		if err := rows.Scan(&m.SessionID, &m.Section, &m.Name, &m.Type, &m.TTL, &m.Data,
+			&m.Timestamp, &m.SrcIP, &m.DstIP, &m.Domain, &m.RCode, &m.ProcessName); err != nil {
+			return nil, fmt.Errorf("scan dns record: %w", err)
+		}
+		matches = append(matches, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return &model.DNSRecordResult{
+		Total: total,
+		Data:  matches,
+	}, nil
+}
+
+// dnsTimeRange appends the time range conditions of a DNS statistics query
+func dnsTimeRange(where []string, args []interface{}, start, end int64) ([]string, []interface{}) {
+	if start > 0 {
+		where = append(where, "timestamp >= ?")
+		args = append(args, time.Unix(start, 0))
+	}
+	if end > 0 {
+		where = append(where, "timestamp <= ?")
+		args = append(args, time.Unix(end, 0))
+	}
+	return where, args
+}
+
+// QueryDNSStats 按 DNS 服务器或进程统计解析延迟与失败率
+// 只统计看到查询的事务（已配对或未响应），没有对应查询的响应不计入；百分位在内存中计算
+func (s *SQLiteStore) QueryDNSStats(query model.DNSStatsQuery) ([]model.DNSStats, error) {
+	key := "dst_ip"
+	if query.GroupBy == "process" {
+		key = "process_name"
+	}
+
+	// 查询方向的记录：已配对的事务或未响应的查询；未配对的响应和未关联时单独记录的查询不计入
+	where := []string{"(paired = 1 OR unanswered = 1)"}
+	if key == "process_name" {
+		where = append(where, "process_name != ''")
+	}
+	where, args := dnsTimeRange(where, nil, query.StartTime, query.EndTime)
+
+	rows, err := s.db.Query(fmt.Sprintf(`
+		SELECT %[1]s, COALESCE(rcode, ''), COALESCE(unanswered, 0), COALESCE(latency_ms, 0)
+		FROM dns_sessions
+		WHERE %[2]s
+		ORDER BY %[1]s, latency_ms
+	`, key, strings.Join(where, " AND ")), args...)
+	if err != nil {
+		return nil, fmt.Errorf("query dns stats: %w", err)
+	}
+	defer rows.Close()
+
+	var result []model.DNSStats
+	var latencies []float64
+	flush := func() {
+		if len(result) == 0 {
+			return
+		}
+		stats := &result[len(result)-1]
+		stats.FailureRate = float64(stats.Failures) / float64(stats.Queries)
+		if len(latencies) > 0 {
+			var sum float64
+			for _, l := range latencies {
+				sum += l
+			}
+			stats.AvgLatency = sum / float64(len(latencies))
+			stats.P50 = percentile(latencies, 50)
+			stats.P95 = percentile(latencies, 95)
+			stats.MaxLatency = latencies[len(latencies)-1]
+		}
+		latencies = latencies[:0]
+	}
+
+	for rows.Next() {
+		var k, rcode string
+		var unanswered int
+		var latency float64
+		if err := rows.Scan(&k, &rcode, &unanswered, &latency); err != nil {
+			return nil, fmt.Errorf("scan dns stats: %w", err)
+		}
+		if len(result) == 0 || result[len(result)-1].Key != k {
+			flush()
+			result = append(result, model.DNSStats{Key: k})
+		}
+
+		stats := &result[len(result)-1]
+		stats.Queries++
+		if unanswered == 1 {
+			stats.Unanswered++
+			stats.Failures++
+			continue
+		}
+		stats.Answered++
+		latencies = append(latencies, latency)
+		switch rcode {
+		case "NOERROR":
+		case "NXDOMAIN":
+			stats.NXDomain++
+		case "SERVFAIL":
+			stats.ServFail++
+			stats.Failures++
+		default:
+			stats.Failures++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	flush()
+
+	if query.MinQueries > 0 {
+		filtered := result[:0]
+		for _, stats := range result {
+			if stats.Queries >= query.MinQueries {
+				filtered = append(filtered, stats)
+			}
+		}
+		result = filtered
+	}
+
+	var less func(a, b *model.DNSStats) bool
+	switch query.SortBy {
+	case "latency":
+		less = func(a, b *model.DNSStats) bool { return a.P95 > b.P95 }
+	case "failure_rate":
+		less = func(a, b *model.DNSStats) bool { return a.FailureRate > b.FailureRate }
+	default:
+		less = func(a, b *model.DNSStats) bool { return a.Queries > b.Queries }
+	}
+	sort.SliceStable(result, func(i, j int) bool { return less(&result[i], &result[j]) })
+
+	if query.Limit > 0 && len(result) > query.Limit {
+		result = result[:query.Limit]
+	}
+	return result, nil
+}
+
+// QueryDNSNXDomains 统计返回 NXDOMAIN 最多的域名
+// 配对的事务与未配对的响应都计入，客户端为查询方（事务记录中为源地址，响应记录中为目标地址）
+func (s *SQLiteStore) QueryDNSNXDomains(query model.DNSNXDomainQuery) ([]model.DNSNXDomainStats, error) {
+	where, args := dnsTimeRange([]string{"rcode = 'NXDOMAIN'"}, nil, query.StartTime, query.EndTime)
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = 20
+	}
+
+	rows, err := s.db.Query(fmt.Sprintf(`
+		SELECT LOWER(domain) AS name,
+			   COUNT(*) AS count,
+			   COUNT(DISTINCT CASE WHEN paired = 1 THEN src_ip ELSE dst_ip END),
+			   COALESCE(GROUP_CONCAT(DISTINCT NULLIF(process_name, '')), ''),
+			   MAX(timestamp)
+		FROM dns_sessions
+		WHERE %s
+		GROUP BY name
+		ORDER BY count DESC
+		LIMIT ?
+	`, strings.Join(where, " AND ")), append(args, limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("query nxdomain stats: %w", err)
+	}
+	defer rows.Close()
+
+	result := []model.DNSNXDomainStats{}
+	for rows.Next() {
+		var stats model.DNSNXDomainStats
+		var lastSeen sql.NullString
+		if err := rows.Scan(&stats.Domain, &stats.Count, &stats.Clients, &stats.Processes, &lastSeen); err != nil {
+			return nil, fmt.Errorf("scan nxdomain stats: %w", err)
+		}
+		stats.LastSeen = lastSeen.String
+		result = append(result, stats)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,137 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"sniffer/pkg/model"
+)
+
+func TestQueryDNSStats(t *testing.T) {
+	s, err := NewSQLiteStore(filepath.Join(t.TempDir(), "test.db"), 0)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer s.Close()
+
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	n := 0
+	// query 为客户端 192.168.1.10 发往 server:port 的查询方向记录
+	query := func(server string, port uint16, domain, rcode string, latency float64) *model.Session {
+		n++
+		return &model.Session{
+			Timestamp: start.Add(time.Duration(n) * time.Second),
+			FiveTuple: model.FiveTuple{SrcIP: "192.168.1.10", DstIP: server, SrcPort: uint16(40000 + n), DstPort: port, Protocol: "UDP"},
+			Type:      "DNS", Domain: domain, QueryType: "A",
+			RCode: rcode, LatencyMs: latency, Paired: rcode != "",
+			ProcessName: "curl",
+		}
+	}
+	unanswered := query("10.0.0.53", 5353, "slow.example", "", 0)
+	unanswered.Unanswered = true
+	// 未配对的响应：服务端发往客户端
+	response := query("8.8.8.8", 53, "orphan.example", "NXDOMAIN", 0)
+	response.FiveTuple = model.FiveTuple{SrcIP: "8.8.8.8", DstIP: "192.168.1.11", SrcPort: 53, DstPort: 40999, Protocol: "UDP"}
+	response.Paired = false
+
+	sessions := []*model.Session{
+		// 非标准端口上的解析器
+		query("10.0.0.53", 5353, "a.example", "NOERROR", 10),
+		query("10.0.0.53", 5353, "b.example", "NOERROR", 30),
+		query("10.0.0.53", 5353, "missing.example", "NXDOMAIN", 20),
+		unanswered,
+		query("8.8.8.8", 53, "c.example", "SERVFAIL", 50),
+		query("8.8.8.8", 53, "missing.example", "NXDOMAIN", 40),
+		response,
+		// 未关联时单独记录的查询
+		query("8.8.8.8", 53, "d.example", "", 0),
+	}
+	for _, session := range sessions {
+		if err := s.WriteSession(model.TableDNS, session); err != nil {
+			t.Fatalf("WriteSession(%s): %v", session.Domain, err)
+		}
+	}
+
+	stats, err := s.QueryDNSStats(model.DNSStatsQuery{})
+	if err != nil {
+		t.Fatalf("QueryDNSStats: %v", err)
+	}
+	want := []model.DNSStats{
+		{Key: "10.0.0.53", Queries: 4, Answered: 3, Unanswered: 1, NXDomain: 1, Failures: 1, FailureRate: 0.25, AvgLatency: 20, P50: 20, P95: 30, MaxLatency: 30},
+		{Key: "8.8.8.8", Queries: 2, Answered: 2, NXDomain: 1, ServFail: 1, Failures: 1, FailureRate: 0.5, AvgLatency: 45, P50: 40, P95: 50, MaxLatency: 50},
+	}
+	if len(stats) != len(want) {
+		t.Fatalf("got %d groups, want %d: %+v", len(stats), len(want), stats)
+	}
+	for i := range want {
+		if stats[i] != want[i] {
+			t.Errorf("stats[%d]:\n got  %+v\n want %+v", i, stats[i], want[i])
+		}
+	}
+
+	byProcess, err := s.QueryDNSStats(model.DNSStatsQuery{GroupBy: "process"})
+	if err != nil {
+		t.Fatalf("QueryDNSStats(process): %v", err)
+	}
+	if len(byProcess) != 1 || byProcess[0].Key != "curl" || byProcess[0].Queries != 6 {
+		t.Errorf("by process = %+v", byProcess)
+	}
+
+	// 事务记录的客户端为源地址，未配对响应的客户端为目标地址
+	nx, err := s.QueryDNSNXDomains(model.DNSNXDomainQuery{})
+	if err != nil {
+		t.Fatalf("QueryDNSNXDomains: %v", err)
+	}
+	clients := make(map[string]int)
+	for _, d := range nx {
+		clients[d.Domain] = d.Clients
+	}
+	if clients["missing.example"] != 1 || clients["orphan.example"] != 1 || len(nx) != 2 {
+		t.Errorf("NXDOMAIN stats = %+v", nx)
+	}
+}
+
+func TestMigrateDNSPaired(t *testing.T) {
+	s, err := NewSQLiteStore(filepath.Join(t.TempDir(), "test.db"), 0)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer s.Close()
+
+	// 旧版本的表没有 paired 列，查询方向按服务端端口 53 识别
+	if _, err := s.db.Exec("ALTER TABLE dns_sessions DROP COLUMN paired"); err != nil {
+		t.Fatalf("drop column: %v", err)
+	}
+	for _, row := range []struct {
+		srcPort, dstPort int
+		rcode            string
+	}{
+		{40000, 53, "NOERROR"}, // 事务
+		{53, 40001, "NOERROR"}, // 未配对的响应
+		{40002, 53, ""},        // 单独记录的查询
+	} {
+		if _, err := s.db.Exec("INSERT INTO dns_sessions (timestamp, ttl, src_ip, dst_ip, src_port, dst_port, protocol, rcode) VALUES (?, ?, '192.168.1.10', '8.8.8.8', ?, ?, 'UDP', ?)",
+			time.Now(), time.Now().Add(time.Hour), row.srcPort, row.dstPort, row.rcode); err != nil {
+			t.Fatalf("insert: %v", err)
+		}
+	}
+
+	if err := s.MigrateSchema(); err != nil {
+		t.Fatalf("MigrateSchema: %v", err)
+	}
+	var paired []int
+	rows, err := s.db.Query("SELECT src_port FROM dns_sessions WHERE paired = 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var port int
+		rows.Scan(&port)
+		paired = append(paired, port)
+	}
+	if len(paired) != 1 || paired[0] != 40000 {
+		t.Errorf("paired rows = %v, want the transaction from port 40000", paired)
+	}
+}
@@ -0,0 +1,98 @@
+package store
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/gopacket"
+	"sniffer/pkg/model"
+)
+
+// EvidenceWriter writes the packets of an alert snapshot to a pcapng file
+// 告警证据文件，使用 pcapng 以支持多种链路类型和纳秒时间戳
+type EvidenceWriter struct {
+	path   string
+	file   *os.File
+	buf    *bufio.Writer
+	writer *ngWriter
+	count  int
+}
+
+// CreateEvidence creates the evidence file of an alert log in dir
+func CreateEvidence(dir string, logID int64, triggeredAt time.Time) (*EvidenceWriter, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("create evidence directory: %w", err)
+	}
+
+	// 同一告警记录（确认后再次去重合并）可能多次录制，已存在的证据文件不能被覆盖
+	base := fmt.Sprintf("alert_%d_%s", logID, triggeredAt.Format("20060102_150405"))
+	var path string
+	var file *os.File
+	for i := 0; ; i++ {
+		filename := base + ".pcapng"
+		if i > 0 {
+			filename = fmt.Sprintf("%s_%d.pcapng", base, i)
+		}
+		path = filepath.Join(dir, filename)
+
+		var err error
+		file, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			break
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("create evidence file: %w", err)
+		}
+	}
+
+	buf := bufio.NewWriter(file)
+	writer, err := newNgWriter(buf, snapLenMax)
+	if err != nil {
+		file.Close()
+		os.Remove(path)
+		return nil, err
+	}
+
+	return &EvidenceWriter{
+		path:   path,
+		file:   file,
+		buf:    buf,
+		writer: writer,
+	}, nil
+}
+
+// WritePacket writes a raw packet to the evidence file
+func (e *EvidenceWriter) WritePacket(pkt *model.Packet) error {
+	ci := gopacket.CaptureInfo{
+		Timestamp:     pkt.Timestamp,
+		CaptureLength: len(pkt.Data),
+		Length:        pkt.Length,
+	}
+	if err := e.writer.WritePacket(pkt.LinkType, ci, pkt.Data); err != nil {
+		return fmt.Errorf("write evidence packet: %w", err)
+	}
+	e.count++
+	return nil
+}
+
+// Count returns the number of packets written
+func (e *EvidenceWriter) Count() int {
+	return e.count
+}
+
+// Path returns the path of the evidence file
+func (e *EvidenceWriter) Path() string {
+	return e.path
+}
+
+// Close flushes and closes the evidence file
+func (e *EvidenceWriter) Close() error {
+	err := e.buf.Flush()
+	if err2 := e.file.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
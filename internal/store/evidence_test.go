@@ -0,0 +1,35 @@
+package store
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCreateEvidenceKeepsExistingFile(t *testing.T) {
+	dir := t.TempDir()
+	triggeredAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	var paths []string
+	for i := 0; i < 3; i++ {
+		w, err := CreateEvidence(dir, 7, triggeredAt)
+		if err != nil {
+			t.Fatalf("CreateEvidence #%d: %v", i, err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close #%d: %v", i, err)
+		}
+		paths = append(paths, w.Path())
+	}
+
+	seen := make(map[string]bool)
+	for _, p := range paths {
+		if seen[p] {
+			t.Fatalf("evidence path %s reused: %v", p, paths)
+		}
+		seen[p] = true
+		if _, err := os.Stat(p); err != nil {
+			t.Fatalf("evidence file %s: %v", p, err)
+		}
+	}
+}
@@ -2,6 +2,9 @@ package store
 
 import (
 	"fmt"
+	"strings"
+
+	"sniffer/internal/parser"
 )
 
 // MigrateSchema 数据库迁移，添加新字段
@@ -12,43 +15,85 @@ func (s *SQLiteStore) MigrateSchema() error {
 		column string
 		typ    string
 	}{
-		{"http_sessions", "content_type", "TEXT"},
-		{"http_sessions", "post_data", "TEXT"},
-		{"dns_sessions", "process_pid", "INTEGER"},
-		{"dns_sessions", "process_name", "TEXT"},
-		{"dns_sessions", "process_exe", "TEXT"},
-		{"http_sessions", "process_pid", "INTEGER"},
-		{"http_sessions", "process_name", "TEXT"},
-		{"http_sessions", "process_exe", "TEXT"},
-		{"icmp_sessions", "process_pid", "INTEGER"},
-		{"icmp_sessions", "process_name", "TEXT"},
-		{"icmp_sessions", "process_exe", "TEXT"},
 		{"alert_logs", "trigger_count", "INTEGER DEFAULT 1"},
 		{"alert_logs", "last_triggered_at", "DATETIME"},
+		{"alert_logs", "evidence_path", "TEXT"},
+		{"alert_rules", "snapshot_enabled", "INTEGER DEFAULT 0"},
+		{"alert_rules", "snapshot_pre_seconds", "INTEGER DEFAULT 0"},
+		{"alert_rules", "snapshot_post_seconds", "INTEGER DEFAULT 0"},
+		{"session_flows", "sampled", "INTEGER DEFAULT 0"},
+		{"session_flows", "flow_weight", "INTEGER DEFAULT 1"},
+		{"session_flows", "type_confidence", "REAL DEFAULT 0"},
 	}
 
 	for _, m := range migrations {
-		var hasColumn int
-		err := s.db.QueryRow(fmt.Sprintf(`
-			SELECT COUNT(*) FROM pragma_table_info('%s') 
-			WHERE name='%s'
-		`, m.table, m.column)).Scan(&hasColumn)
-		
-		if err != nil {
-			return fmt.Errorf("check %s.%s column: %w", m.table, m.column, err)
+		if err := s.addColumnIfMissing(m.table, m.column, m.typ); err != nil {
+			return err
 		}
+	}
+
+	// HTTP 的表类型曾为 util，界面按 http 创建规则，旧规则统一改为 http
+	if _, err := s.db.Exec("UPDATE alert_rules SET rule_type = 'http' WHERE rule_type = 'util'"); err != nil {
+		return fmt.Errorf("migrate http alert rules: %w", err)
+	}
 
-		if hasColumn == 0 {
-			fmt.Printf("Migrating database: adding %s.%s column...\n", m.table, m.column)
-			_, err = s.db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, m.table, m.column, m.typ))
-			if err != nil {
-				return fmt.Errorf("add %s.%s column: %w", m.table, m.column, err)
+	// DNS 事务标记：旧版本按服务端端口 53 识别查询方向，新增 paired 列时据此补齐已有记录
+	hasPaired, err := s.hasColumn("dns_sessions", "paired")
+	if err != nil {
+		return err
+	}
+
+	// 注册的协议：补齐 Schema 中新增的列
+	for _, d := range parser.Dissectors() {
+		schema := d.Schema()
+		for _, col := range schema.Columns {
+			if err := s.addColumnIfMissing(schema.Table, col.Name, col.Type); err != nil {
+				return err
 			}
 		}
 	}
 
+	if !hasPaired {
+		if _, err := s.db.Exec("UPDATE dns_sessions SET paired = 1 WHERE dst_port = 53 AND rcode != ''"); err != nil {
+			return fmt.Errorf("migrate dns_sessions.paired: %w", err)
+		}
+	}
+
 	fmt.Println("Database migration completed")
 	return nil
 }
 
+// hasColumn reports whether a table has the column
+func (s *SQLiteStore) hasColumn(table, column string) (bool, error) {
+	var count int
+	err := s.db.QueryRow(fmt.Sprintf(`
+		SELECT COUNT(*) FROM pragma_table_info('%s') 
+		WHERE name='%s'
+	`, table, column)).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("check %s.%s column: %w", table, column, err)
+	}
+	return count > 0, nil
+}
 
+// addColumnIfMissing adds a column to an existing table
+func (s *SQLiteStore) addColumnIfMissing(table, column, typ string) error {
+	hasColumn, err := s.hasColumn(table, column)
+	if err != nil {
+		return err
+	}
+
+	if !hasColumn {
+		// SQLite 不能添加没有默认值的 NOT NULL 列
+		upper := strings.ToUpper(typ)
+		if strings.Contains(upper, "NOT NULL") && !strings.Contains(upper, "DEFAULT") {
+			return fmt.Errorf("add %s.%s column: NOT NULL column requires a DEFAULT value", table, column)
+		}
+		fmt.Printf("Migrating database: adding %s.%s column...\n", table, column)
+		_, err = s.db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, typ))
+		if err != nil {
+			return fmt.Errorf("add %s.%s column: %w", table, column, err)
+		}
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package store
 
 import (
+	"bufio"
 	"compress/gzip"
 	"fmt"
 	"io"
@@ -11,8 +12,8 @@ import (
 	"time"
 
 	"github.com/google/gopacket"
-	"github.com/google/gopacket/layers"
 	"github.com/google/gopacket/pcapgo"
+	"sniffer/internal/netio"
 	"sniffer/pkg/model"
 )
 
@@ -24,9 +25,10 @@ type PcapFileStore struct {
 	maxSize      int64
 	rotateCount  int
 	compressLvl  int
-	currentFile  *pcapFile
+	currentFiles map[int]*pcapFile // 按链路层类型分别写入，每个文件只能有一种链路类型
 	files        []*pcapFileInfo
 	totalPackets int64
+	filesCreated int64 // 本次运行创建的文件数（用于按文件数自动停止）
 }
 
 // pcapFile represents an active PCAP file being written
@@ -37,6 +39,7 @@ type pcapFile struct {
 	writer   *pcapgo.Writer
 	size     int64
 	created  time.Time
+	info     *pcapFileInfo
 }
 
 // pcapFileInfo contains metadata about a PCAP file
@@ -47,6 +50,9 @@ type pcapFileInfo struct {
 	Count   int64
 }
 
+// linkTypeEthernet is LINKTYPE_ETHERNET
+const linkTypeEthernet = 1
+
 // NewPcapFileStore creates a new PCAP file store
 func NewPcapFileStore(dir string, maxSize int64, rotateCount int, compressLvl int) (*PcapFileStore, error) {
 	if err := os.MkdirAll(dir, 0755); err != nil {
@@ -54,11 +60,12 @@ func NewPcapFileStore(dir string, maxSize int64, rotateCount int, compressLvl in
 	}
 
 	store := &PcapFileStore{
-		dir:         dir,
-		maxSize:     maxSize,
-		rotateCount: rotateCount,
-		compressLvl: compressLvl,
-		files:       make([]*pcapFileInfo, 0),
+		dir:          dir,
+		maxSize:      maxSize,
+		rotateCount:  rotateCount,
+		compressLvl:  compressLvl,
+		currentFiles: make(map[int]*pcapFile),
+		files:        make([]*pcapFileInfo, 0),
 	}
 
 	// Scan existing files
@@ -67,31 +74,36 @@ func NewPcapFileStore(dir string, maxSize int64, rotateCount int, compressLvl in
 	}
 
 	// Open first file
-	if err := store.rotate(); err != nil {
+	if err := store.rotate(linkTypeEthernet); err != nil {
 		return nil, err
 	}
 
 	return store, nil
 }
 
-// WriteRaw writes a raw packet to the current PCAP file
+// WriteRaw writes a raw packet to the current PCAP file of its link type
 func (s *PcapFileStore) WriteRaw(pkt *model.Packet) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	// 每个 pcap 文件只能有一种链路类型，按数据包的链路类型选择文件
+	linkType := pkt.LinkType
+
 	// Check if rotation is needed
-	if s.currentFile != nil && s.currentFile.size >= s.maxSize {
-		if err := s.rotate(); err != nil {
+	current := s.currentFiles[linkType]
+	if current != nil && current.size >= s.maxSize {
+		if err := s.rotate(linkType); err != nil {
 			return fmt.Errorf("rotate pcap file: %w", err)
 		}
 	}
 
 	// Write packet
-	if s.currentFile == nil {
-		if err := s.rotate(); err != nil {
+	if s.currentFiles[linkType] == nil {
+		if err := s.rotate(linkType); err != nil {
 			return fmt.Errorf("create pcap file: %w", err)
 		}
 	}
+	current = s.currentFiles[linkType]
 
 	// Create packet capture info
 	ci := gopacket.CaptureInfo{
@@ -101,34 +113,37 @@ func (s *PcapFileStore) WriteRaw(pkt *model.Packet) error {
 	}
 
 	// Write packet
-	if err := s.currentFile.writer.WritePacket(ci, pkt.Data); err != nil {
+	if err := current.writer.WritePacket(ci, pkt.Data); err != nil {
 		return fmt.Errorf("write packet: %w", err)
 	}
 
 	// Update size
 	packetSize := int64(ci.CaptureLength + 16) // 16 bytes for pcap packet header
-	s.currentFile.size += packetSize
+	current.size += packetSize
 	s.totalPackets++
 
 	return nil
 }
 
-// rotate closes the current file and opens a new one
-func (s *PcapFileStore) rotate() error {
+// rotate closes the current file of the link type and opens a new one
+func (s *PcapFileStore) rotate(linkType int) error {
 	// Close current file
-	if s.currentFile != nil {
-		if err := s.closeCurrentFile(); err != nil {
+	if current := s.currentFiles[linkType]; current != nil {
+		if err := s.closeFile(current); err != nil {
 			return err
 		}
 	}
 
-	// Generate new filename with timestamp
+	// Generate new filename with timestamp (非以太网文件名附带链路类型)
 	timestamp := time.Now().Format("20060102_150405")
 	ext := ".pcap"
 	if s.compressLvl > 0 {
 		ext = ".pcap.gz"
 	}
 	filename := fmt.Sprintf("capture_%s%s", timestamp, ext)
+	if linkType != linkTypeEthernet {
+		filename = fmt.Sprintf("capture_%s_lt%d%s", timestamp, linkType, ext)
+	}
 	path := filepath.Join(s.dir, filename)
 
 	// Create file
@@ -157,8 +172,7 @@ func (s *PcapFileStore) rotate() error {
 	}
 
 	// Create PCAP writer
-	pcapWriter := pcapgo.NewWriter(w)
-	if err := pcapWriter.WriteFileHeader(65535, layers.LinkTypeEthernet); err != nil {
+	if err := writePcapHeader(w, snapLenMax, linkType); err != nil {
 		if pf.gzWriter != nil {
 			pf.gzWriter.Close()
 		}
@@ -166,52 +180,79 @@ func (s *PcapFileStore) rotate() error {
 		return fmt.Errorf("write pcap header: %w", err)
 	}
 
-	pf.writer = pcapWriter
-	s.currentFile = pf
-
-	// Add to files list
-	s.files = append(s.files, &pcapFileInfo{
+	pf.writer = pcapgo.NewWriter(w)
+	pf.info = &pcapFileInfo{
 		Path:    path,
 		Created: pf.created,
-	})
+	}
+	s.currentFiles[linkType] = pf
+	s.filesCreated++
 
-	// Cleanup old files if exceeding rotation count
+	// Add to files list
+	s.files = append(s.files, pf.info)
+
+	// Cleanup old files if exceeding rotation count (正在写入的文件不删除)
 	if len(s.files) > s.rotateCount {
-		// Remove oldest files
 		toRemove := len(s.files) - s.rotateCount
-		for i := 0; i < toRemove; i++ {
-			if err := os.Remove(s.files[i].Path); err != nil && !os.IsNotExist(err) {
-				fmt.Printf("Warning: failed to remove old pcap file %s: %v\n", s.files[i].Path, err)
+		kept := make([]*pcapFileInfo, 0, len(s.files))
+		for _, fileInfo := range s.files {
+			if toRemove > 0 && !s.isOpen(fileInfo) {
+				if err := os.Remove(fileInfo.Path); err != nil && !os.IsNotExist(err) {
+					fmt.Printf("Warning: failed to remove old pcap file %s: %v\n", fileInfo.Path, err)
+				}
+				toRemove--
+				continue
 			}
+			kept = append(kept, fileInfo)
 		}
-		s.files = s.files[toRemove:]
+		s.files = kept
 	}
 
 	return nil
 }
 
-// closeCurrentFile closes the current PCAP file
-func (s *PcapFileStore) closeCurrentFile() error {
-	if s.currentFile == nil {
-		return nil
+// isOpen reports whether the file is currently being written
+func (s *PcapFileStore) isOpen(fileInfo *pcapFileInfo) bool {
+	for _, pf := range s.currentFiles {
+		if pf.info == fileInfo {
+			return true
+		}
 	}
+	return false
+}
 
+// closeFile closes a PCAP file being written
+func (s *PcapFileStore) closeFile(pf *pcapFile) error {
 	var err error
-	if s.currentFile.gzWriter != nil {
-		err = s.currentFile.gzWriter.Close()
+	if pf.gzWriter != nil {
+		err = pf.gzWriter.Close()
 	}
 
-	if err2 := s.currentFile.file.Close(); err == nil {
+	if err2 := pf.file.Close(); err == nil {
 		err = err2
 	}
 
 	// Update file info
-	stat, _ := os.Stat(s.currentFile.path)
-	if stat != nil && len(s.files) > 0 {
-		s.files[len(s.files)-1].Size = stat.Size()
+	if stat, _ := os.Stat(pf.path); stat != nil {
+		pf.info.Size = stat.Size()
 	}
 
-	s.currentFile = nil
+	for linkType, current := range s.currentFiles {
+		if current == pf {
+			delete(s.currentFiles, linkType)
+		}
+	}
+	return err
+}
+
+// closeAllFiles closes all PCAP files being written
+func (s *PcapFileStore) closeAllFiles() error {
+	var err error
+	for _, pf := range s.currentFiles {
+		if err2 := s.closeFile(pf); err == nil {
+			err = err2
+		}
+	}
 	return err
 }
 
@@ -260,53 +301,126 @@ func (s *PcapFileStore) isPcapFile(name string) bool {
 }
 
 // ExportPCAP exports packets in the time range
-func (s *PcapFileStore) ExportPCAP(start, end time.Time, w io.Writer) error {
+// filter 为BPF过滤表达式，为空表示导出全部
+// 时间范围内只有一种链路类型时导出 pcap，多种链路类型混合时导出 pcapng
+func (s *PcapFileStore) ExportPCAP(start, end time.Time, filter string, w io.Writer) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	// Flush current file
-	if s.currentFile != nil && s.currentFile.gzWriter != nil {
-		s.currentFile.gzWriter.Flush()
-	}
-
-	// Create PCAP writer for output
-	pcapWriter := pcapgo.NewWriter(w)
-	if err := pcapWriter.WriteFileHeader(65535, layers.LinkTypeEthernet); err != nil {
-		return fmt.Errorf("write pcap header: %w", err)
+	// Flush current files
+	for _, pf := range s.currentFiles {
+		if pf.gzWriter != nil {
+			pf.gzWriter.Flush()
+		}
 	}
 
-	// Find relevant files
+	// Find relevant files and their link types
+	var paths []string
+	linkTypes := make(map[int]bool)
 	for _, fileInfo := range s.files {
 		// Simple time-based filtering (could be improved)
 		if fileInfo.Created.After(end) {
 			continue
 		}
+		linkType, err := fileLinkType(fileInfo.Path)
+		if err != nil {
+			fmt.Printf("Warning: skip pcap file %s: %v\n", fileInfo.Path, err)
+			continue
+		}
+		if filter != "" && !netio.CanFilter(linkType) {
+			fmt.Printf("Warning: skip pcap file %s: BPF filter is not supported for link type %d\n", fileInfo.Path, linkType)
+			continue
+		}
+		paths = append(paths, fileInfo.Path)
+		linkTypes[linkType] = true
+	}
 
-		// Read and filter packets from this file
-		if err := s.exportFromFile(fileInfo.Path, start, end, pcapWriter); err != nil {
-			return fmt.Errorf("export from %s: %w", fileInfo.Path, err)
+	// 过滤器按各文件的链路层类型编译，写出数据前校验
+	for linkType := range linkTypes {
+		if err := netio.ValidateBPFFilter(filter, linkType, snapLenMax); err != nil {
+			return fmt.Errorf("link type %d: %w", linkType, err)
+		}
+	}
+
+	// Create writer for output
+	var write func(linkType int, ci gopacket.CaptureInfo, data []byte) error
+	if len(linkTypes) > 1 {
+		ng, err := newNgWriter(w, snapLenMax)
+		if err != nil {
+			return err
+		}
+		write = ng.WritePacket
+	} else {
+		linkType := linkTypeEthernet
+		for lt := range linkTypes {
+			linkType = lt
+		}
+		if err := writePcapHeader(w, snapLenMax, linkType); err != nil {
+			return fmt.Errorf("write pcap header: %w", err)
+		}
+		pcapWriter := pcapgo.NewWriter(w)
+		write = func(_ int, ci gopacket.CaptureInfo, data []byte) error {
+			return pcapWriter.WritePacket(ci, data)
+		}
+	}
+
+	// Read and filter packets from each file
+	for _, path := range paths {
+		if err := s.exportFromFile(path, start, end, filter, write); err != nil {
+			return fmt.Errorf("export from %s: %w", path, err)
 		}
 	}
 
 	return nil
 }
 
-// exportFromFile exports packets from a single file
-func (s *PcapFileStore) exportFromFile(path string, start, end time.Time, writer *pcapgo.Writer) error {
+// openPcapFile opens a (possibly gzip-compressed) PCAP file for reading
+func openPcapFile(path string) (*bufio.Reader, func(), error) {
 	file, err := os.Open(path)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
-	defer file.Close()
 
 	var r io.Reader = file
+	closeFn := func() { file.Close() }
 	if filepath.Ext(path) == ".gz" {
 		gzReader, err := gzip.NewReader(file)
 		if err != nil {
-			return fmt.Errorf("create gzip reader: %w", err)
+			file.Close()
+			return nil, nil, fmt.Errorf("create gzip reader: %w", err)
 		}
-		defer gzReader.Close()
 		r = gzReader
+		closeFn = func() {
+			gzReader.Close()
+			file.Close()
+		}
+	}
+
+	return bufio.NewReader(r), closeFn, nil
+}
+
+// fileLinkType reads the link type from the header of a PCAP file
+func fileLinkType(path string) (int, error) {
+	r, closeFn, err := openPcapFile(path)
+	if err != nil {
+		return 0, err
+	}
+	defer closeFn()
+
+	return readPcapLinkType(r)
+}
+
+// exportFromFile exports packets from a single file
+func (s *PcapFileStore) exportFromFile(path string, start, end time.Time, filter string, write func(int, gopacket.CaptureInfo, []byte) error) error {
+	r, closeFn, err := openPcapFile(path)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	linkType, err := readPcapLinkType(r)
+	if err != nil {
+		return err
 	}
 
 	// Read packets
@@ -315,9 +429,19 @@ func (s *PcapFileStore) exportFromFile(path string, start, end time.Time, writer
 		return fmt.Errorf("create pcap reader: %w", err)
 	}
 
+	// BPF 按文件的链路类型编译（SLL2 转换为 SLL 后匹配）
+	var bpf *netio.BPFFilter
+	if filter != "" {
+		bpf, err = netio.NewBPFFilter(linkType, snapLenMax, filter)
+		if err != nil {
+			return fmt.Errorf("link type %d: %w", linkType, err)
+		}
+	}
+
 	for {
 		data, ci, err := pcapReader.ReadPacketData()
-		if err == io.EOF {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			// 正在写入的压缩文件末尾可能不完整
 			break
 		}
 		if err != nil {
@@ -329,8 +453,13 @@ func (s *PcapFileStore) exportFromFile(path string, start, end time.Time, writer
 			continue
 		}
 
+		// Filter by BPF expression
+		if bpf != nil && !bpf.Matches(ci, data) {
+			continue
+		}
+
 		// Write packet
-		if err := writer.WritePacket(ci, data); err != nil {
+		if err := write(linkType, ci, data); err != nil {
 			return fmt.Errorf("write packet: %w", err)
 		}
 	}
@@ -347,7 +476,7 @@ func (s *PcapFileStore) Vacuum(before time.Time) error {
 	newFiles := make([]*pcapFileInfo, 0, len(s.files))
 
 	for _, fileInfo := range s.files {
-		if fileInfo.Created.Before(before) {
+		if fileInfo.Created.Before(before) && !s.isOpen(fileInfo) {
 			if err := os.Remove(fileInfo.Path); err != nil && !os.IsNotExist(err) {
 				fmt.Printf("Warning: failed to remove old pcap file %s: %v\n", fileInfo.Path, err)
 			} else {
@@ -364,6 +493,13 @@ func (s *PcapFileStore) Vacuum(before time.Time) error {
 	return nil
 }
 
+// FilesCreated returns the number of PCAP files created since the store was opened
+func (s *PcapFileStore) FilesCreated() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.filesCreated
+}
+
 // Stats returns storage statistics
 func (s *PcapFileStore) Stats() (StoreStats, error) {
 	s.mu.Lock()
@@ -396,8 +532,8 @@ func (s *PcapFileStore) ClearAll() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	// Close current file (ignore error if no file)
-	_ = s.closeCurrentFile()
+	// Close current files (ignore error if no file)
+	_ = s.closeAllFiles()
 
 	// Delete all PCAP files in the directory
 	patterns := []string{"*.pcap", "*.pcap.gz"}
@@ -416,7 +552,6 @@ func (s *PcapFileStore) ClearAll() error {
 
 	// Reset state
 	s.files = nil
-	s.currentFile = nil
 	s.totalPackets = 0
 
 	return nil
@@ -427,6 +562,6 @@ func (s *PcapFileStore) Close() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	return s.closeCurrentFile()
+	return s.closeAllFiles()
 }
 
@@ -0,0 +1,133 @@
+package store
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/google/gopacket"
+)
+
+// gopacket 的 layers.LinkType 为 uint8，无法写出 LINUX_SLL2(276) 等链路类型，
+// 因此文件头由这里直接写出
+
+const (
+	pcapMagicMicro = 0xa1b2c3d4
+	snapLenMax     = 65535
+
+	ngBlockSectionHeader   = 0x0a0d0d0a
+	ngBlockInterface       = 0x00000001
+	ngBlockEnhancedPacket  = 0x00000006
+	ngByteOrderMagic       = 0x1a2b3c4d
+	ngOptionTimestampResol = 9
+)
+
+// writePcapHeader writes a classic pcap file header (microsecond timestamps, little endian)
+func writePcapHeader(w io.Writer, snaplen, linkType int) error {
+	var buf [24]byte
+	binary.LittleEndian.PutUint32(buf[0:4], pcapMagicMicro)
+	binary.LittleEndian.PutUint16(buf[4:6], 2)
+	binary.LittleEndian.PutUint16(buf[6:8], 4)
+	binary.LittleEndian.PutUint32(buf[16:20], uint32(snaplen))
+	binary.LittleEndian.PutUint32(buf[20:24], uint32(linkType))
+	_, err := w.Write(buf[:])
+	return err
+}
+
+// readPcapLinkType reads the link type from a classic pcap file header without consuming it
+func readPcapLinkType(r *bufio.Reader) (int, error) {
+	header, err := r.Peek(24)
+	if err != nil {
+		return 0, fmt.Errorf("read pcap header: %w", err)
+	}
+
+	var order binary.ByteOrder = binary.BigEndian
+	// 小端序文件的 magic 为 d4 c3 b2 a1 (微秒) 或 4d 3c b2 a1 (纳秒)
+	if header[0] == 0xd4 || header[0] == 0x4d {
+		order = binary.LittleEndian
+	}
+	return int(order.Uint32(header[20:24]) & 0xffff), nil
+}
+
+// ngWriter is a minimal pcapng writer used when an export mixes several link types
+// 多种链路类型混合导出时使用 pcapng，每种链路类型对应一个接口描述块
+type ngWriter struct {
+	w       io.Writer
+	snaplen int
+	ifaces  map[int]uint32 // linkType -> interface id
+}
+
+func newNgWriter(w io.Writer, snaplen int) (*ngWriter, error) {
+	var buf [28]byte
+	binary.LittleEndian.PutUint32(buf[0:4], ngBlockSectionHeader)
+	binary.LittleEndian.PutUint32(buf[4:8], 28)
+	binary.LittleEndian.PutUint32(buf[8:12], ngByteOrderMagic)
+	binary.LittleEndian.PutUint16(buf[12:14], 1)
+	binary.LittleEndian.PutUint16(buf[14:16], 0)
+	binary.LittleEndian.PutUint64(buf[16:24], ^uint64(0)) // section length unknown
+	binary.LittleEndian.PutUint32(buf[24:28], 28)
+	if _, err := w.Write(buf[:]); err != nil {
+		return nil, fmt.Errorf("write section header: %w", err)
+	}
+
+	return &ngWriter{w: w, snaplen: snaplen, ifaces: make(map[int]uint32)}, nil
+}
+
+// addInterface writes an interface description block with nanosecond timestamp resolution
+func (w *ngWriter) addInterface(linkType int) (uint32, error) {
+	if id, ok := w.ifaces[linkType]; ok {
+		return id, nil
+	}
+
+	var buf [32]byte
+	binary.LittleEndian.PutUint32(buf[0:4], ngBlockInterface)
+	binary.LittleEndian.PutUint32(buf[4:8], 32)
+	binary.LittleEndian.PutUint16(buf[8:10], uint16(linkType))
+	binary.LittleEndian.PutUint32(buf[12:16], uint32(w.snaplen))
+	// if_tsresol = 9 (10^-9)
+	binary.LittleEndian.PutUint16(buf[16:18], ngOptionTimestampResol)
+	binary.LittleEndian.PutUint16(buf[18:20], 1)
+	buf[20] = 9
+	// opt_endofopt at [24:28]
+	binary.LittleEndian.PutUint32(buf[28:32], 32)
+	if _, err := w.w.Write(buf[:]); err != nil {
+		return 0, fmt.Errorf("write interface block: %w", err)
+	}
+
+	id := uint32(len(w.ifaces))
+	w.ifaces[linkType] = id
+	return id, nil
+}
+
+// WritePacket writes an enhanced packet block on the interface of the given link type
+func (w *ngWriter) WritePacket(linkType int, ci gopacket.CaptureInfo, data []byte) error {
+	id, err := w.addInterface(linkType)
+	if err != nil {
+		return err
+	}
+
+	padding := (4 - len(data)&3) & 3
+	length := uint32(32 + len(data) + padding)
+	ts := uint64(ci.Timestamp.UnixNano())
+
+	var buf [28]byte
+	binary.LittleEndian.PutUint32(buf[0:4], ngBlockEnhancedPacket)
+	binary.LittleEndian.PutUint32(buf[4:8], length)
+	binary.LittleEndian.PutUint32(buf[8:12], id)
+	binary.LittleEndian.PutUint32(buf[12:16], uint32(ts>>32))
+	binary.LittleEndian.PutUint32(buf[16:20], uint32(ts))
+	binary.LittleEndian.PutUint32(buf[20:24], uint32(len(data)))
+	binary.LittleEndian.PutUint32(buf[24:28], uint32(ci.Length))
+	if _, err := w.w.Write(buf[:]); err != nil {
+		return err
+	}
+	if _, err := w.w.Write(data); err != nil {
+		return err
+	}
+
+	var trailer [8]byte
+	binary.LittleEndian.PutUint32(trailer[4:8], length)
+	_, err = w.w.Write(trailer[4-padding:])
+	return err
+}
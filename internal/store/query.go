@@ -3,9 +3,11 @@ package store
 import (
 	"database/sql"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
+	"sniffer/internal/parser"
 	"sniffer/pkg/model"
 )
 
@@ -54,16 +56,9 @@ func (s *SQLiteStore) QuerySessions(opts model.QueryOptions) (*model.QueryResult
 	}
 
 	// 构建查询 - 明确指定列名顺序（包含进程字段）
-	var selectColumns string
-	switch opts.Table {
-	case model.TableDNS:
-		selectColumns = "id, timestamp, src_ip, src_port, dst_ip, dst_port, protocol, domain, query_type, response_ip, payload_size, ttl, process_pid, process_name, process_exe"
-	case model.TableHTTP:
-		selectColumns = "id, timestamp, src_ip, src_port, dst_ip, dst_port, protocol, method, host, path, status_code, user_agent, payload_size, ttl, content_type, post_data, process_pid, process_name, process_exe"
-	case model.TableICMP:
-		selectColumns = "id, timestamp, src_ip, dst_ip, protocol, icmp_type, icmp_code, icmp_seq, payload_size, ttl, process_pid, process_name, process_exe"
-	default:
-		selectColumns = "*"
+	selectColumns := "*"
+	if d, ok := parser.DissectorForTable(opts.Table); ok {
+		selectColumns = selectColumnsSQL(d.Schema())
 	}
 	
 	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s ORDER BY %s %s LIMIT ? OFFSET ?", 
@@ -97,6 +92,13 @@ func (s *SQLiteStore) QuerySessions(opts model.QueryOptions) (*model.QueryResult
 		}
 		sessions = append(sessions, session)
 	}
+	rows.Close()
+
+	if opts.Table == model.TableDNS {
+		if err := s.loadDNSRecords(sessions); err != nil {
+			return nil, err
+		}
+	}
 	
 	fmt.Printf("[QuerySessions] returned %d sessions\n", len(sessions))
 
@@ -116,7 +118,7 @@ func (s *SQLiteStore) QuerySessionFlows(opts model.SessionFlowQuery) (*model.Ses
 			src_ip, dst_ip, src_port, dst_port, protocol,
 			packet_count, bytes_count,
 			first_seen, last_seen,
-			session_type,
+			session_type, type_confidence,
 			process_pid, process_name, process_exe
 		FROM session_flows
 		WHERE 1=1
@@ -283,6 +285,7 @@ func (s *SQLiteStore) QuerySessionFlows(opts model.SessionFlowQuery) (*model.Ses
 		var srcPort, dstPort sql.NullInt64
 		var processPID sql.NullInt32
 		var processName, processExe sql.NullString
+		var typeConfidence sql.NullFloat64
 		
 		err := rows.Scan(
 			&flow.SrcIP,
@@ -295,6 +298,7 @@ func (s *SQLiteStore) QuerySessionFlows(opts model.SessionFlowQuery) (*model.Ses
 			&firstSeenStr,
 			&lastSeenStr,
 			&flow.SessionType,
+			&typeConfidence,
 			&processPID,
 			&processName,
 			&processExe,
@@ -310,6 +314,7 @@ func (s *SQLiteStore) QuerySessionFlows(opts model.SessionFlowQuery) (*model.Ses
 		flow.DstPort = uint16(dstPort.Int64)
 		flow.FirstSeen = firstSeenStr
 		flow.LastSeen = lastSeenStr
+		flow.TypeConfidence = typeConfidence.Float64
 		
 		// 设置进程信息
 		if processPID.Valid {
@@ -370,16 +375,10 @@ func (s *SQLiteStore) QuerySessionFlows(opts model.SessionFlowQuery) (*model.Ses
 
 // getTableName 获取表名
 func getTableName(table model.TableType) string {
-	switch table {
-	case model.TableDNS:
-		return "dns_sessions"
-	case model.TableHTTP:
-		return "http_sessions"
-	case model.TableICMP:
-		return "icmp_sessions"
-	default:
-		return ""
+	if d, ok := parser.DissectorForTable(table); ok {
+		return d.Schema().Table
 	}
+	return ""
 }
 
 // buildSearchClause 构建搜索条件
@@ -389,28 +388,16 @@ func buildSearchClause(table model.TableType, searchType, searchText string) str
 		return "1=1"
 	}
 
+	// 注册的协议按 Schema 中声明的列搜索
+	if d, ok := parser.DissectorForTable(table); ok && searchType != "ip" && searchType != "port" {
+		return schemaSearchClause(d.Schema(), searchType)
+	}
+
 	switch searchType {
 	case "ip":
 		return "(src_ip LIKE ? OR dst_ip LIKE ?)"
 	case "port":
 		return "(src_port = ? OR dst_port = ?)"
-	case "domain":
-		if table == model.TableDNS {
-			return "domain LIKE ?"
-		} else if table == model.TableHTTP {
-			return "host LIKE ?"
-		}
-		return "1=1"
-	case "all":
-		// 全文搜索
-		switch table {
-		case model.TableDNS:
-			return "(src_ip LIKE ? OR dst_ip LIKE ? OR domain LIKE ? OR response_ip LIKE ?)"
-		case model.TableHTTP:
-			return "(src_ip LIKE ? OR dst_ip LIKE ? OR host LIKE ? OR path LIKE ? OR user_agent LIKE ?)"
-		case model.TableICMP:
-			return "(src_ip LIKE ? OR dst_ip LIKE ?)"
-		}
 	}
 
 	return "1=1"
@@ -418,105 +405,100 @@ func buildSearchClause(table model.TableType, searchType, searchText string) str
 
 // scanSession 扫描会话数据
 func scanSession(rows *sql.Rows, table model.TableType) (*model.Session, error) {
-	session := &model.Session{}
-	session.Type = string(table)
+	if d, ok := parser.DissectorForTable(table); ok {
+		return scanSchemaRow(rows, d)
+	}
 
-	switch table {
-	case model.TableDNS:
-		var processPID sql.NullInt32
-		var processName, processExe sql.NullString
-		err := rows.Scan(
-			&session.ID,
-			&session.Timestamp,
-			&session.FiveTuple.SrcIP,
-			&session.FiveTuple.SrcPort,
-			&session.FiveTuple.DstIP,
-			&session.FiveTuple.DstPort,
-			&session.FiveTuple.Protocol,
-			&session.Domain,
-			&session.QueryType,
-			&session.ResponseIP,
-			&session.PayloadSize,
-			&session.TTL,
-			&processPID,
-			&processName,
-			&processExe,
-		)
-		if err == nil {
-			if processPID.Valid {
-				session.ProcessPID = processPID.Int32
-			}
-			session.ProcessName = processName.String
-			session.ProcessExe = processExe.String
-		}
-		return session, err
+	return nil, fmt.Errorf("unknown table type: %s", table)
+}
 
-	case model.TableHTTP:
-		var contentType, postData sql.NullString
-		var processPID sql.NullInt32
-		var processName, processExe sql.NullString
-		err := rows.Scan(
-			&session.ID,
-			&session.Timestamp,
-			&session.FiveTuple.SrcIP,
-			&session.FiveTuple.SrcPort,
-			&session.FiveTuple.DstIP,
-			&session.FiveTuple.DstPort,
-			&session.FiveTuple.Protocol,
-			&session.Method,
-			&session.Host,
-			&session.Path,
-			&session.StatusCode,
-			&session.UserAgent,
-			&session.PayloadSize,
-			&session.TTL,
-			&contentType,
-			&postData,
-			&processPID,
-			&processName,
-			&processExe,
-		)
-		if err == nil {
-			session.ContentType = contentType.String
-			session.PostData = postData.String
-			if processPID.Valid {
-				session.ProcessPID = processPID.Int32
-			}
-			session.ProcessName = processName.String
-			session.ProcessExe = processExe.String
+
+
+// QueryHTTPLatency 按主机统计已配对 HTTP 事务的服务端延迟百分位
+// SQLite 没有百分位函数，按主机读取排序后的延迟在内存中计算
+func (s *SQLiteStore) QueryHTTPLatency(query model.HTTPLatencyQuery) ([]model.HTTPLatencyStats, error) {
+	where := []string{"method != ''", "status_code > 0", "latency_ms IS NOT NULL"}
+	args := []interface{}{}
+	if query.Host != "" {
+		where = append(where, "host = ?")
+		args = append(args, query.Host)
+	}
+	if query.StartTime > 0 {
+		where = append(where, "timestamp >= ?")
+		args = append(args, time.Unix(query.StartTime, 0))
+	}
+	if query.EndTime > 0 {
+		where = append(where, "timestamp <= ?")
+		args = append(args, time.Unix(query.EndTime, 0))
+	}
+
+	rows, err := s.db.Query(fmt.Sprintf(`
+		SELECT COALESCE(host, ''), status_code, latency_ms
+		FROM http_sessions
+		WHERE %s
+		ORDER BY host, latency_ms
+	`, strings.Join(where, " AND ")), args...)
+	if err != nil {
+		return nil, fmt.Errorf("query http latency: %w", err)
+	}
+	defer rows.Close()
+
+	var result []model.HTTPLatencyStats
+	var latencies []float64
+	flush := func() {
+		if len(latencies) == 0 {
+			return
+		}
+		stats := &result[len(result)-1]
+		var sum float64
+		for _, l := range latencies {
+			sum += l
 		}
-		return session, err
+		stats.Count = len(latencies)
+		stats.Avg = sum / float64(len(latencies))
+		stats.Min = latencies[0]
+		stats.Max = latencies[len(latencies)-1]
+		stats.P50 = percentile(latencies, 50)
+		stats.P90 = percentile(latencies, 90)
+		stats.P95 = percentile(latencies, 95)
+		stats.P99 = percentile(latencies, 99)
+		latencies = latencies[:0]
+	}
 
-	case model.TableICMP:
-		var processPID sql.NullInt32
-		var processName, processExe sql.NullString
-		err := rows.Scan(
-			&session.ID,
-			&session.Timestamp,
-			&session.FiveTuple.SrcIP,
-			&session.FiveTuple.DstIP,
-			&session.FiveTuple.Protocol,
-			&session.ICMPType,
-			&session.ICMPCode,
-			&session.ICMPSeq,
-			&session.PayloadSize,
-			&session.TTL,
-			&processPID,
-			&processName,
-			&processExe,
-		)
-		if err == nil {
-			if processPID.Valid {
-				session.ProcessPID = processPID.Int32
-			}
-			session.ProcessName = processName.String
-			session.ProcessExe = processExe.String
+	for rows.Next() {
+		var host string
+		var status int
+		var latency float64
+		if err := rows.Scan(&host, &status, &latency); err != nil {
+			return nil, fmt.Errorf("scan http latency: %w", err)
 		}
-		return session, err
+		if len(result) == 0 || result[len(result)-1].Host != host {
+			flush()
+			result = append(result, model.HTTPLatencyStats{Host: host})
+		}
+		latencies = append(latencies, latency)
+		if status >= 500 {
+			result[len(result)-1].Errors++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	flush()
 
-	default:
-		return nil, fmt.Errorf("unknown table type: %s", table)
+	// 按事务数排序，返回最活跃的主机
+	sort.Slice(result, func(i, j int) bool { return result[i].Count > result[j].Count })
+	if query.Limit > 0 && len(result) > query.Limit {
+		result = result[:query.Limit]
 	}
+	return result, nil
 }
 
-
+// percentile returns the p-th percentile of sorted values (nearest rank)
+func percentile(sorted []float64, p int) float64 {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,99 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+
+	"sniffer/internal/parser"
+	"sniffer/pkg/model"
+)
+
+// createTableSQL returns the statements creating the table, indexes and extra tables of a dissector schema
+func createTableSQL(schema *parser.Schema) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "CREATE TABLE IF NOT EXISTS %s (\n\t\tid INTEGER PRIMARY KEY AUTOINCREMENT", schema.Table)
+	for _, col := range schema.Columns {
+		fmt.Fprintf(&b, ",\n\t\t%s %s", col.Name, col.Type)
+	}
+	b.WriteString("\n\t);\n")
+
+	// 索引名沿用 idx_<协议>_<列> 的命名
+	prefix := strings.TrimSuffix(schema.Table, "_sessions")
+	for _, col := range schema.Indexes {
+		fmt.Fprintf(&b, "\tCREATE INDEX IF NOT EXISTS idx_%s_%s ON %s(%s);\n", prefix, col, schema.Table, col)
+	}
+	b.WriteString(schema.Extra)
+	return b.String()
+}
+
+// insertSQL returns the INSERT statement of a dissector schema
+func insertSQL(schema *parser.Schema) string {
+	names := make([]string, len(schema.Columns))
+	for i, col := range schema.Columns {
+		names[i] = col.Name
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(names)), ", ")
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", schema.Table, strings.Join(names, ", "), placeholders)
+}
+
+// selectColumnsSQL returns the column list read by scanSchemaRow
+func selectColumnsSQL(schema *parser.Schema) string {
+	names := make([]string, 0, len(schema.Columns)+1)
+	names = append(names, "id")
+	for _, col := range schema.Columns {
+		names = append(names, col.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// schemaValues returns the column values of a session in insert order
+func schemaValues(schema *parser.Schema, session *model.Session) []interface{} {
+	values := make([]interface{}, len(schema.Columns))
+	for i, col := range schema.Columns {
+		values[i] = col.Value(session)
+	}
+	return values
+}
+
+// scanSchemaRow scans a row selected with selectColumnsSQL into a new session
+func scanSchemaRow(rows interface{ Scan(...interface{}) error }, d parser.Dissector) (*model.Session, error) {
+	schema := d.Schema()
+	session := &model.Session{Type: string(d.Table())}
+	dest := make([]interface{}, 0, len(schema.Columns)+1)
+	dest = append(dest, &session.ID)
+	for _, col := range schema.Columns {
+		dest = append(dest, col.Dest(session))
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// schemaSearchClause returns the search condition of a dissector schema
+func schemaSearchClause(schema *parser.Schema, searchType string) string {
+	switch searchType {
+	case "domain":
+		if schema.DomainColumn != "" {
+			return schema.DomainColumn + " LIKE ?"
+		}
+	case "all":
+		if len(schema.SearchColumns) > 0 {
+			conds := make([]string, len(schema.SearchColumns))
+			for i, col := range schema.SearchColumns {
+				conds[i] = col + " LIKE ?"
+			}
+			return "(" + strings.Join(conds, " OR ") + ")"
+		}
+	}
+	return "1=1"
+}
+
+// sessionTableNames returns the tables of the registered dissectors
+func sessionTableNames() []string {
+	var names []string
+	for _, d := range parser.Dissectors() {
+		names = append(names, d.Schema().Table)
+	}
+	return names
+}
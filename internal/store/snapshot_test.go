@@ -0,0 +1,57 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"sniffer/internal/parser"
+	"sniffer/pkg/model"
+)
+
+func TestLoadSnapshot(t *testing.T) {
+	s, err := NewSQLiteStore(filepath.Join(t.TempDir(), "test.db"), 0)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer s.Close()
+
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, d := range parser.Dissectors() {
+		t.Run(d.Name(), func(t *testing.T) {
+			// 每个注册的表写入两条会话，按时间倒序读回
+			for i, port := range []uint16{1001, 1002} {
+				session := &model.Session{
+					Timestamp: start.Add(time.Duration(i) * time.Second),
+					FiveTuple: model.FiveTuple{SrcIP: "10.0.0.1", DstIP: "10.0.0.2", SrcPort: port, DstPort: 443, Protocol: "TCP"},
+					Type:      d.Name(),
+					TTL:       start.Add(time.Hour),
+					Domain:    "example.com",
+					ClientMAC: "00:11:22:33:44:55",
+				}
+				if err := s.WriteSession(d.Table(), session); err != nil {
+					t.Fatalf("WriteSession: %v", err)
+				}
+			}
+
+			sessions, err := s.LoadSnapshot(d.Table(), 10)
+			if err != nil {
+				t.Fatalf("LoadSnapshot: %v", err)
+			}
+			if len(sessions) != 2 {
+				t.Fatalf("got %d sessions, want 2", len(sessions))
+			}
+			latest := sessions[0]
+			if !latest.Timestamp.Equal(start.Add(time.Second)) || latest.FiveTuple.SrcIP != "10.0.0.1" || latest.FiveTuple.DstIP != "10.0.0.2" {
+				t.Errorf("latest session = %+v", latest)
+			}
+			if latest.ID == 0 || !latest.TTL.Equal(start.Add(time.Hour)) {
+				t.Errorf("ID = %d, TTL = %v", latest.ID, latest.TTL)
+			}
+		})
+	}
+
+	if _, err := s.LoadSnapshot(model.TableRaw, 10); err == nil {
+		t.Error("LoadSnapshot(raw) succeeded")
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"time"
 
 	_ "modernc.org/sqlite"
+	"sniffer/internal/config"
+	"sniffer/internal/parser"
 	"sniffer/pkg/model"
 )
 
@@ -19,6 +21,12 @@ type SQLiteStore struct {
 	dbPath      string
 	vacuumDays  int
 	insertStmts map[model.TableType]*sql.Stmt
+
+	// DNS 资源记录子表的插入语句
+	dnsRecordStmt *sql.Stmt
+
+	// 告警触发回调（用于告警快照），在告警记录写入后调用
+	alertHandler AlertHandler
 }
 
 // GetRawDB returns the underlying *sql.DB
@@ -69,73 +77,6 @@ func NewSQLiteStore(dbPath string, vacuumDays int) (*SQLiteStore, error) {
 // initSchema creates tables if they don't exist
 func (s *SQLiteStore) initSchema() error {
 	schema := `
-	CREATE TABLE IF NOT EXISTS dns_sessions (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		timestamp DATETIME NOT NULL,
-		src_ip TEXT NOT NULL,
-		dst_ip TEXT NOT NULL,
-		src_port INTEGER,
-		dst_port INTEGER,
-		protocol TEXT,
-		domain TEXT,
-		query_type TEXT,
-		response_ip TEXT,
-		payload_size INTEGER,
-		ttl DATETIME NOT NULL,
-		process_pid INTEGER,
-		process_name TEXT,
-		process_exe TEXT
-	);
-
-	CREATE INDEX IF NOT EXISTS idx_dns_timestamp ON dns_sessions(timestamp);
-	CREATE INDEX IF NOT EXISTS idx_dns_ttl ON dns_sessions(ttl);
-	CREATE INDEX IF NOT EXISTS idx_dns_domain ON dns_sessions(domain);
-
-	CREATE TABLE IF NOT EXISTS http_sessions (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		timestamp DATETIME NOT NULL,
-		src_ip TEXT NOT NULL,
-		dst_ip TEXT NOT NULL,
-		src_port INTEGER,
-		dst_port INTEGER,
-		protocol TEXT,
-		method TEXT,
-		host TEXT,
-		path TEXT,
-		status_code INTEGER,
-		user_agent TEXT,
-		content_type TEXT,
-		post_data TEXT,
-		payload_size INTEGER,
-		ttl DATETIME NOT NULL,
-		process_pid INTEGER,
-		process_name TEXT,
-		process_exe TEXT
-	);
-
-	CREATE INDEX IF NOT EXISTS idx_http_timestamp ON http_sessions(timestamp);
-	CREATE INDEX IF NOT EXISTS idx_http_ttl ON http_sessions(ttl);
-	CREATE INDEX IF NOT EXISTS idx_http_host ON http_sessions(host);
-
-	CREATE TABLE IF NOT EXISTS icmp_sessions (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		timestamp DATETIME NOT NULL,
-		src_ip TEXT NOT NULL,
-		dst_ip TEXT NOT NULL,
-		protocol TEXT,
-		icmp_type INTEGER,
-		icmp_code INTEGER,
-		icmp_seq INTEGER,
-		payload_size INTEGER,
-		ttl DATETIME NOT NULL,
-		process_pid INTEGER,
-		process_name TEXT,
-		process_exe TEXT
-	);
-
-	CREATE INDEX IF NOT EXISTS idx_icmp_timestamp ON icmp_sessions(timestamp);
-	CREATE INDEX IF NOT EXISTS idx_icmp_ttl ON icmp_sessions(ttl);
-
 	-- 通用会话流表（所有五元组连接的统计）
 	CREATE TABLE IF NOT EXISTS session_flows (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -149,9 +90,12 @@ func (s *SQLiteStore) initSchema() error {
 		first_seen DATETIME NOT NULL,
 		last_seen DATETIME NOT NULL,
 		session_type TEXT,
+		type_confidence REAL DEFAULT 0,
 		process_pid INTEGER,
 		process_name TEXT,
 		process_exe TEXT,
+		sampled INTEGER DEFAULT 0,
+		flow_weight INTEGER DEFAULT 1,
 		UNIQUE(src_ip, dst_ip, src_port, dst_port, protocol)
 	);
 
@@ -171,6 +115,9 @@ func (s *SQLiteStore) initSchema() error {
 		condition_value TEXT NOT NULL,
 		alert_level TEXT DEFAULT 'warning',
 		description TEXT,
+		snapshot_enabled INTEGER DEFAULT 0,
+		snapshot_pre_seconds INTEGER DEFAULT 0,
+		snapshot_post_seconds INTEGER DEFAULT 0,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
@@ -195,6 +142,7 @@ func (s *SQLiteStore) initSchema() error {
 		acknowledged INTEGER DEFAULT 0,
 		acknowledged_at DATETIME,
 		acknowledged_by TEXT,
+		evidence_path TEXT,
 		FOREIGN KEY(rule_id) REFERENCES alert_rules(id)
 	);
 
@@ -204,34 +152,24 @@ func (s *SQLiteStore) initSchema() error {
 	CREATE INDEX IF NOT EXISTS idx_alert_logs_level ON alert_logs(alert_level);
 	`
 
-	_, err := s.db.Exec(schema)
-	return err
+	if _, err := s.db.Exec(schema); err != nil {
+		return err
+	}
+
+	// 注册的协议由各自的 Schema 建表
+	for _, d := range parser.Dissectors() {
+		if _, err := s.db.Exec(createTableSQL(d.Schema())); err != nil {
+			return fmt.Errorf("create %s: %w", d.Schema().Table, err)
+		}
+	}
+	return nil
 }
 
 // prepareStatements prepares INSERT statements for each table
 func (s *SQLiteStore) prepareStatements() error {
-	stmts := map[model.TableType]string{
-		model.TableDNS: `
-			INSERT INTO dns_sessions (
-				timestamp, src_ip, dst_ip, src_port, dst_port, protocol,
-				domain, query_type, response_ip, payload_size, ttl,
-				process_pid, process_name, process_exe
-			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-		`,
-		model.TableHTTP: `
-			INSERT INTO http_sessions (
-				timestamp, src_ip, dst_ip, src_port, dst_port, protocol,
-				method, host, path, status_code, user_agent, content_type, post_data, payload_size, ttl,
-				process_pid, process_name, process_exe
-			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-		`,
-		model.TableICMP: `
-			INSERT INTO icmp_sessions (
-				timestamp, src_ip, dst_ip, protocol,
-				icmp_type, icmp_code, icmp_seq, payload_size, ttl,
-				process_pid, process_name, process_exe
-			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-		`,
+	stmts := map[model.TableType]string{}
+	for _, d := range parser.Dissectors() {
+		stmts[d.Table()] = insertSQL(d.Schema())
 	}
 
 	for table, query := range stmts {
@@ -242,6 +180,15 @@ func (s *SQLiteStore) prepareStatements() error {
 		s.insertStmts[table] = stmt
 	}
 
+	stmt, err := s.db.Prepare(`
+		INSERT INTO dns_records (session_id, section, name, type, ttl, data)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return fmt.Errorf("prepare statement for dns_records: %w", err)
+	}
+	s.dnsRecordStmt = stmt
+
 	return nil
 }
 
@@ -255,77 +202,34 @@ func (s *SQLiteStore) WriteSession(table model.TableType, session *model.Session
 		return fmt.Errorf("no insert statement for table %s", table)
 	}
 
-	switch table {
-	case model.TableDNS:
-		_, err := stmt.Exec(
-			session.Timestamp,
-			session.FiveTuple.SrcIP,
-			session.FiveTuple.DstIP,
-			session.FiveTuple.SrcPort,
-			session.FiveTuple.DstPort,
-			session.FiveTuple.Protocol,
-			session.Domain,
-			session.QueryType,
-			session.ResponseIP,
-			session.PayloadSize,
-			session.TTL,
-			session.ProcessPID,
-			session.ProcessName,
-			session.ProcessExe,
-		)
-		return err
-
-	case model.TableHTTP:
-		_, err := stmt.Exec(
-			session.Timestamp,
-			session.FiveTuple.SrcIP,
-			session.FiveTuple.DstIP,
-			session.FiveTuple.SrcPort,
-			session.FiveTuple.DstPort,
-			session.FiveTuple.Protocol,
-			session.Method,
-			session.Host,
-			session.Path,
-			session.StatusCode,
-			session.UserAgent,
-			session.ContentType,
-			session.PostData,
-			session.PayloadSize,
-			session.TTL,
-			session.ProcessPID,
-			session.ProcessName,
-			session.ProcessExe,
-		)
-		return err
-
-	case model.TableICMP:
-		_, err := stmt.Exec(
-			session.Timestamp,
-			session.FiveTuple.SrcIP,
-			session.FiveTuple.DstIP,
-			session.FiveTuple.Protocol,
-			session.ICMPType,
-			session.ICMPCode,
-			session.ICMPSeq,
-			session.PayloadSize,
-			session.TTL,
-			session.ProcessPID,
-			session.ProcessName,
-			session.ProcessExe,
-		)
+	if d, ok := parser.DissectorForTable(table); ok {
+		// DNS 会话与资源记录在同一事务中写入
+		if table == model.TableDNS {
+			return s.writeDNSSession(stmt, d.Schema(), session)
+		}
+		// DHCP 消息与主机清单在同一事务中更新
+		if table == model.TableDHCP {
+			return s.writeDHCPSession(stmt, d.Schema(), session)
+		}
+		_, err := stmt.Exec(schemaValues(d.Schema(), session)...)
 		return err
-
-	default:
-		return fmt.Errorf("unknown table type: %s", table)
 	}
+
+	return fmt.Errorf("unknown table type: %s", table)
 }
 
-// identifySessionType 智能识别会话类型
+// portGuessConfidence is the confidence of a session type guessed from a well-known port
+const portGuessConfidence = 0.3
+
+// identifySessionType 按协议和知名端口猜测会话类型（载荷无法识别时的兜底）
 func identifySessionType(protocol string, srcPort, dstPort uint16) string {
 	// 1. 先判断协议层
 	if protocol == "ICMP" || protocol == "ICMPv6" {
 		return "ICMP"
 	}
+	if protocol == "ARP" {
+		return "ARP"
+	}
 	
 	// 2. 基于知名端口判断应用层协议
 	// 检查双向端口（服务端口可能是源或目标）
@@ -426,28 +330,48 @@ func (s *SQLiteStore) UpsertSessionFlow(pkt *model.Packet) error {
 			srcIP, dstIP = dstIP, srcIP
 			srcPort, dstPort = dstPort, srcPort
 		}
-	} else if pkt.Protocol == "ICMP" || pkt.Protocol == "ICMPv6" {
-		// ICMP没有端口，只比较IP
+	} else if pkt.Protocol == "ICMP" || pkt.Protocol == "ICMPv6" || pkt.Protocol == "ARP" {
+		// ICMP/ARP没有端口，只比较IP
 		if srcIP > dstIP {
 			srcIP, dstIP = dstIP, srcIP
 		}
 		srcPort, dstPort = 0, 0
 	}
 
-	// 智能判断会话类型（基于协议和端口）
-	sessionType := identifySessionType(pkt.Protocol, srcPort, dstPort)
+	// 会话类型：优先使用载荷识别结果，未识别（握手包、加密流量等）时按端口猜测
+	sessionType, confidence := pkt.AppProtocol, pkt.AppConfidence
+	if sessionType == "" {
+		sessionType, confidence = identifySessionType(pkt.Protocol, srcPort, dstPort), 0
+		if sessionType != pkt.Protocol && sessionType != "Other" && sessionType != "ICMP" {
+			confidence = portGuessConfidence
+		}
+	}
+
+	// 采样时按采样率逐包放大包数和字节数（开启采样前的包不放大）；
+	// flow 采样的流在首次出现时记录代表的流数，开启采样前已出现的流仍只代表自身
+	weight, flowWeight, sampled := 1, 1, 0
+	switch pkt.SampleMode {
+	case config.SamplingCount:
+		weight, sampled = pkt.SampleRate, 1
+	case config.SamplingFlow:
+		weight, flowWeight, sampled = pkt.SampleRate, pkt.SampleRate, 1
+	}
 
 	// UPSERT: 如果存在则更新，否则插入
 	query := `
 		INSERT INTO session_flows (
 			src_ip, dst_ip, src_port, dst_port, protocol,
-			packet_count, bytes_count, first_seen, last_seen, session_type,
-			process_pid, process_name, process_exe
-		) VALUES (?, ?, ?, ?, ?, 1, ?, ?, ?, ?, ?, ?, ?)
+			packet_count, bytes_count, first_seen, last_seen, session_type, type_confidence,
+			process_pid, process_name, process_exe, sampled, flow_weight
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 		ON CONFLICT(src_ip, dst_ip, src_port, dst_port, protocol) DO UPDATE SET
-			packet_count = packet_count + 1,
+			packet_count = packet_count + ?,
 			bytes_count = bytes_count + ?,
 			last_seen = ?,
+			session_type = CASE WHEN excluded.type_confidence > COALESCE(type_confidence, 0)
+				THEN excluded.session_type ELSE session_type END,
+			type_confidence = MAX(COALESCE(type_confidence, 0), excluded.type_confidence),
+			sampled = MAX(sampled, excluded.sampled),
 			process_pid = COALESCE(excluded.process_pid, process_pid),
 			process_name = COALESCE(NULLIF(excluded.process_name, ''), process_name),
 			process_exe = COALESCE(NULLIF(excluded.process_exe, ''), process_exe)
@@ -456,97 +380,53 @@ func (s *SQLiteStore) UpsertSessionFlow(pkt *model.Packet) error {
 	_, err := s.db.Exec(query,
 		// INSERT values
 		srcIP, dstIP, srcPort, dstPort, pkt.Protocol,
-		pkt.Length, pkt.Timestamp, pkt.Timestamp, sessionType,
-		pkt.ProcessPID, pkt.ProcessName, pkt.ProcessExe,
+		weight, pkt.Length*weight, pkt.Timestamp, pkt.Timestamp, sessionType, confidence,
+		pkt.ProcessPID, pkt.ProcessName, pkt.ProcessExe, sampled, flowWeight,
 		// UPDATE values
-		pkt.Length, pkt.Timestamp,
+		weight, pkt.Length*weight, pkt.Timestamp,
 	)
 
 	return err
 }
 
 // LoadSnapshot loads recent sessions from a table
+// 列顺序和扫描目标由注册的 Dissector 的 Schema 决定，与 QuerySessions 一致
 func (s *SQLiteStore) LoadSnapshot(table model.TableType, limit int) ([]*model.Session, error) {
+	d, ok := parser.DissectorForTable(table)
+	if !ok {
+		return nil, fmt.Errorf("unknown table type: %s", table)
+	}
+
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	tableName := string(table) + "_sessions"
-	query := fmt.Sprintf("SELECT * FROM %s ORDER BY timestamp DESC LIMIT ?", tableName)
+	schema := d.Schema()
+	query := fmt.Sprintf("SELECT %s FROM %s ORDER BY timestamp DESC LIMIT ?", selectColumnsSQL(schema), schema.Table)
 
 	rows, err := s.db.Query(query, limit)
 	if err != nil {
-		return nil, fmt.Errorf("query %s: %w", tableName, err)
+		return nil, fmt.Errorf("query %s: %w", schema.Table, err)
 	}
 	defer rows.Close()
 
 	sessions := make([]*model.Session, 0, limit)
-
 	for rows.Next() {
-		session := &model.Session{Type: string(table)}
-
-		switch table {
-		case model.TableDNS:
-			err = rows.Scan(
-				&session.ID,
-				&session.Timestamp,
-				&session.FiveTuple.SrcIP,
-				&session.FiveTuple.DstIP,
-				&session.FiveTuple.SrcPort,
-				&session.FiveTuple.DstPort,
-				&session.FiveTuple.Protocol,
-				&session.Domain,
-				&session.QueryType,
-				&session.ResponseIP,
-				&session.PayloadSize,
-				&session.TTL,
-			)
-
-		case model.TableHTTP:
-			err = rows.Scan(
-				&session.ID,
-				&session.Timestamp,
-				&session.FiveTuple.SrcIP,
-				&session.FiveTuple.DstIP,
-				&session.FiveTuple.SrcPort,
-				&session.FiveTuple.DstPort,
-				&session.FiveTuple.Protocol,
-				&session.Method,
-				&session.Host,
-				&session.Path,
-				&session.StatusCode,
-				&session.UserAgent,
-				&session.ContentType,
-				&session.PostData,
-				&session.PayloadSize,
-				&session.TTL,
-			)
-
-		case model.TableICMP:
-			err = rows.Scan(
-				&session.ID,
-				&session.Timestamp,
-				&session.FiveTuple.SrcIP,
-				&session.FiveTuple.DstIP,
-				&session.FiveTuple.Protocol,
-				&session.ICMPType,
-				&session.ICMPCode,
-				&session.ICMPSeq,
-				&session.PayloadSize,
-				&session.TTL,
-			)
-		}
-
+		session, err := scanSchemaRow(rows, d)
 		if err != nil {
 			return nil, fmt.Errorf("scan row: %w", err)
 		}
-
 		sessions = append(sessions, session)
 	}
-
 	if err = rows.Err(); err != nil {
 		return nil, fmt.Errorf("rows error: %w", err)
 	}
+	rows.Close()
 
+	if table == model.TableDNS {
+		if err := s.loadDNSRecords(sessions); err != nil {
+			return nil, err
+		}
+	}
 	return sessions, nil
 }
 
@@ -555,9 +435,7 @@ func (s *SQLiteStore) Vacuum(before time.Time) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	tables := []string{"dns_sessions", "http_sessions", "icmp_sessions"}
-	
-	for _, table := range tables {
+	for _, table := range sessionTableNames() {
 		query := fmt.Sprintf("DELETE FROM %s WHERE ttl < ?", table)
 		result, err := s.db.Exec(query, before)
 		if err != nil {
@@ -570,8 +448,17 @@ func (s *SQLiteStore) Vacuum(before time.Time) error {
 		}
 	}
 
+	// 删除会话已过期的 DNS 资源记录
+	result, err := s.db.Exec("DELETE FROM dns_records WHERE session_id NOT IN (SELECT id FROM dns_sessions)")
+	if err != nil {
+		return fmt.Errorf("vacuum dns_records: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows > 0 {
+		fmt.Printf("Vacuum: removed %d rows from dns_records\n", rows)
+	}
+
 	// Run SQLite VACUUM to reclaim space
-	_, err := s.db.Exec("VACUUM")
+	_, err = s.db.Exec("VACUUM")
 	if err != nil {
 		return fmt.Errorf("sqlite vacuum: %w", err)
 	}
@@ -584,29 +471,27 @@ func (s *SQLiteStore) Stats() (StoreStats, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	stats := StoreStats{}
-
-	// Count rows in each table
-	tables := map[model.TableType]string{
-		model.TableDNS:  "dns_sessions",
-		model.TableHTTP: "http_sessions",
-		model.TableICMP: "icmp_sessions",
-	}
+	stats := StoreStats{SessionCounts: make(map[model.TableType]int64)}
 
-	for tableType, tableName := range tables {
+	// Count rows in each registered table
+	for _, d := range parser.Dissectors() {
+		tableName := d.Schema().Table
 		var count int64
 		query := fmt.Sprintf("SELECT COUNT(*) FROM %s", tableName)
 		if err := s.db.QueryRow(query).Scan(&count); err != nil {
 			return stats, fmt.Errorf("count %s: %w", tableName, err)
 		}
+		stats.SessionCounts[d.Table()] = count
 
-		switch tableType {
+		switch d.Table() {
 		case model.TableDNS:
 			stats.DNSCount = count
 		case model.TableHTTP:
 			stats.HTTPCount = count
 		case model.TableICMP:
 			stats.ICMPCount = count
+		case model.TableTLS:
+			stats.TLSCount = count
 		}
 	}
 
@@ -627,13 +512,15 @@ func (s *SQLiteStore) ClearAll() error {
 	defer s.mu.Unlock()
 
 	// 清空所有数据表
-	tables := []string{
-		"dns_sessions", 
-		"http_sessions", 
-		"icmp_sessions", 
+	// 告警记录清空前删除证据文件
+	s.removeEvidenceFiles("")
+
+	tables := append(sessionTableNames(),
+		"dns_records",
+		"hosts",
 		"session_flows",
 		"alert_logs", // 清空告警记录(但保留规则)
-	}
+	)
 	
 	for _, table := range tables {
 		_, err := s.db.Exec(fmt.Sprintf("DELETE FROM %s", table))
@@ -660,12 +547,15 @@ func (s *SQLiteStore) Close() error {
 	for _, stmt := range s.insertStmts {
 		stmt.Close()
 	}
+	if s.dnsRecordStmt != nil {
+		s.dnsRecordStmt.Close()
+	}
 
 	return s.db.Close()
 }
 
 // ExportPCAP is not implemented for SQLite store
-func (s *SQLiteStore) ExportPCAP(start, end time.Time, w io.Writer) error {
+func (s *SQLiteStore) ExportPCAP(start, end time.Time, filter string, w io.Writer) error {
 	return fmt.Errorf("PCAP export not supported for session store")
 }
 
@@ -0,0 +1,102 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"sniffer/internal/config"
+	"sniffer/pkg/model"
+)
+
+func TestUpsertSessionFlowWeights(t *testing.T) {
+	s, err := NewSQLiteStore(filepath.Join(t.TempDir(), "test.db"), 0)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer s.Close()
+
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	n := 0
+	// packet 为 192.168.1.10:port 与 10.0.0.1:443 之间的 100 字节数据包，reply 为响应方向
+	packet := func(port uint16, reply bool, mode string, rate int) *model.Packet {
+		n++
+		pkt := &model.Packet{
+			Timestamp: start.Add(time.Duration(n) * time.Second),
+			SrcIP:     "192.168.1.10", DstIP: "10.0.0.1", SrcPort: port, DstPort: 443, Protocol: "TCP",
+			Length: 100, SampleMode: mode, SampleRate: rate,
+		}
+		if reply {
+			pkt.SrcIP, pkt.DstIP = pkt.DstIP, pkt.SrcIP
+			pkt.SrcPort, pkt.DstPort = pkt.DstPort, pkt.SrcPort
+		}
+		return pkt
+	}
+
+	tests := []struct {
+		name        string
+		port        uint16
+		packets     []*model.Packet
+		wantPackets int
+		wantBytes   int
+		wantSampled int
+		wantWeight  int
+	}{
+		{
+			name:        "not sampled",
+			port:        40001,
+			packets:     []*model.Packet{packet(40001, false, "", 0), packet(40001, true, "", 0)},
+			wantPackets: 2, wantBytes: 200, wantSampled: 0, wantWeight: 1,
+		},
+		{
+			name: "count sampling starts mid-flow",
+			port: 40002,
+			packets: []*model.Packet{
+				packet(40002, false, "", 0),
+				packet(40002, true, "", 0),
+				packet(40002, false, config.SamplingCount, 4),
+			},
+			wantPackets: 6, wantBytes: 600, wantSampled: 1, wantWeight: 1,
+		},
+		{
+			name: "flow sampled from the first packet",
+			port: 40003,
+			packets: []*model.Packet{
+				packet(40003, false, config.SamplingFlow, 8),
+				packet(40003, true, config.SamplingFlow, 8),
+			},
+			wantPackets: 16, wantBytes: 1600, wantSampled: 1, wantWeight: 8,
+		},
+		{
+			// 开启采样前已出现的流仍只代表自身，之前的包不按采样率追加放大
+			name: "flow sampling starts mid-flow",
+			port: 40004,
+			packets: []*model.Packet{
+				packet(40004, false, "", 0),
+				packet(40004, true, config.SamplingFlow, 8),
+			},
+			wantPackets: 9, wantBytes: 900, wantSampled: 1, wantWeight: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, pkt := range tt.packets {
+				if err := s.UpsertSessionFlow(pkt); err != nil {
+					t.Fatalf("UpsertSessionFlow: %v", err)
+				}
+			}
+
+			var packets, bytes, sampled, weight int
+			err := s.db.QueryRow(`SELECT packet_count, bytes_count, sampled, flow_weight FROM session_flows
+				WHERE protocol = 'TCP' AND (src_port = ? OR dst_port = ?)`, tt.port, tt.port).Scan(&packets, &bytes, &sampled, &weight)
+			if err != nil {
+				t.Fatalf("query: %v", err)
+			}
+			if packets != tt.wantPackets || bytes != tt.wantBytes || sampled != tt.wantSampled || weight != tt.wantWeight {
+				t.Errorf("packets %d, bytes %d, sampled %d, flow_weight %d; want %d, %d, %d, %d",
+					packets, bytes, sampled, weight, tt.wantPackets, tt.wantBytes, tt.wantSampled, tt.wantWeight)
+			}
+		})
+	}
+}
@@ -19,8 +19,11 @@ type Store interface {
 	// LoadSnapshot loads recent sessions from a table
 	LoadSnapshot(table model.TableType, limit int) ([]*model.Session, error)
 
-	// ExportPCAP exports packets in the time range to a PCAP file
-	ExportPCAP(start, end time.Time, w io.Writer) error
+	// ExportPCAP exports packets in the time range (optionally matching a BPF filter) to a PCAP file
+	ExportPCAP(start, end time.Time, filter string, w io.Writer) error
+
+	// FilesCreated returns the number of PCAP files created since the store was opened
+	FilesCreated() int64
 
 	// Vacuum removes old data before the specified time
 	Vacuum(before time.Time) error
@@ -44,6 +47,8 @@ type StoreStats struct {
 	DNSCount      int64
 	HTTPCount     int64
 	ICMPCount     int64
+	TLSCount      int64
+	SessionCounts map[model.TableType]int64 // 每个注册协议表的会话数
 	TotalSize     int64
 	OldestPacket  time.Time
 	NewestPacket  time.Time
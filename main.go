@@ -60,7 +60,7 @@ func main() {
 	cap := capture.New(cfg, st)
 
 	// 创建调度器
-	sched := scheduler.New(st, cfg)
+	sched := scheduler.New(st, cfg, cap)
 
 	// 创建应用
 	app := server.NewApp(cfg, cap, sched, st, dashboard)
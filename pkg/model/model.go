@@ -1,6 +1,7 @@
 package model
 
 import (
+	"net"
 	"time"
 )
 
@@ -15,14 +16,37 @@ type Packet struct {
 	DstIP      string    `json:"dst_ip"`
 	SrcPort    uint16    `json:"src_port"`
 	DstPort    uint16    `json:"dst_port"`
-	Protocol   string    `json:"protocol"`   // TCP, UDP, ICMP, etc.
-	Data       []byte    `json:"-"`          // Raw packet data
-	LayerInfo  string    `json:"layer_info"` // Layer summary
+	Protocol   string    `json:"protocol"`            // TCP, UDP, ICMP, etc.
+	Data       []byte    `json:"-"`                   // Raw packet data
+	LayerInfo  string    `json:"layer_info"`          // Layer summary
+	Interface  string    `json:"interface,omitempty"` // 抓包网卡
+	LinkType   int       `json:"link_type"`           // 链路层类型 (LINKTYPE_* 值, 1=Ethernet)
+	IPTTL      uint8     `json:"ip_ttl,omitempty"`    // IPv4 TTL / IPv6 Hop Limit
+
+	// 解码结果：均指向 Data 内部（不复制），各协议解析器直接使用，不再重复解码
+	SrcMAC    net.HardwareAddr `json:"-"` // 以太网地址，其它链路类型为空
+	DstMAC    net.HardwareAddr `json:"-"`
+	SrcAddr   net.IP           `json:"-"` // IP 地址的原始字节（4 或 16 字节）
+	DstAddr   net.IP           `json:"-"`
+	Transport []byte           `json:"-"` // 传输层报文（TCP/UDP/ICMP 头部及载荷），ARP 报文为 ARP 头部
+	Payload   []byte           `json:"-"` // 应用层载荷（TCP/UDP 载荷）
+
+	// 802.1Q VLAN 标签，QinQ 时 VLANID 为外层、InnerVLANID 为内层
+	VLANID      uint16 `json:"vlan_id,omitempty"`
+	InnerVLANID uint16 `json:"inner_vlan_id,omitempty"`
 
 	// 进程关联信息 (100%准确方案)
 	ProcessPID  int32  `json:"process_pid,omitempty"`
 	ProcessName string `json:"process_name,omitempty"`
 	ProcessExe  string `json:"process_exe,omitempty"`
+
+	// 应用层协议：载荷特征识别结果（按流缓存），未识别时为空
+	AppProtocol   string  `json:"app_protocol,omitempty"`
+	AppConfidence float64 `json:"app_confidence,omitempty"`
+
+	// 采样信息：SampleRate > 1 表示该包由采样保留，代表 SampleRate 个包（count）或流（flow）
+	SampleMode string `json:"sample_mode,omitempty"`
+	SampleRate int    `json:"sample_rate,omitempty"`
 }
 
 // FiveTuple represents the 5-tuple for session identification
@@ -46,8 +70,8 @@ type Session struct {
 	ID          int64     `json:"id"`
 	Timestamp   time.Time `json:"timestamp"`
 	FiveTuple   FiveTuple `json:"five_tuple"`
-	Type        string    `json:"type"`                   // DNS, HTTP, ICMP
-	Domain      string    `json:"domain,omitempty"`       // For DNS/HTTP
+	Type        string    `json:"type"`                   // DNS, HTTP, ICMP, TLS
+	Domain      string    `json:"domain,omitempty"`       // For DNS/HTTP/TLS
 	QueryType   string    `json:"query_type,omitempty"`   // For DNS
 	ResponseIP  string    `json:"response_ip,omitempty"`  // For DNS
 	Method      string    `json:"method,omitempty"`       // For HTTP
@@ -60,22 +84,115 @@ type Session struct {
 	ICMPType    uint8     `json:"icmp_type,omitempty"`    // For ICMP
 	ICMPCode    uint8     `json:"icmp_code,omitempty"`    // For ICMP
 	ICMPSeq     uint16    `json:"icmp_seq,omitempty"`     // For ICMP
+	ICMPID      uint16    `json:"icmp_id,omitempty"`      // For ICMP, 回显标识符
 	PayloadSize int       `json:"payload_size"`
 	TTL         time.Time `json:"ttl"` // Expiration time
 
+	// DNS 报文头与记录：第一个问题保存在 Domain / QueryType，其余问题和所有应答、授权、附加记录保存在 DNSRecords
+	DNSID      uint16      `json:"dns_id,omitempty"`      // For DNS, 事务 ID
+	RCode      string      `json:"rcode,omitempty"`       // For DNS, 响应码（仅响应）, 如 NOERROR, NXDOMAIN
+	DNSFlags   string      `json:"dns_flags,omitempty"`   // For DNS, 已设置的标志位, 如 "qr rd ra"
+	CNAMEChain string      `json:"cname_chain,omitempty"` // For DNS, 从查询名开始的 CNAME 链
+	DNSRecords []DNSRecord `json:"dns_records,omitempty"` // For DNS
+	Unanswered bool        `json:"unanswered,omitempty"`  // For DNS, 超时未收到响应的查询
+	Paired     bool        `json:"paired,omitempty"`      // For DNS, 已与响应配对的查询（记录为查询方向）
+
+	// HTTP 事务：响应与请求配对后合并为一条记录，PayloadSize 为请求与响应的总字节数
+	ResponseContentType string  `json:"response_content_type,omitempty"` // For HTTP
+	ResponseSize        int     `json:"response_size,omitempty"`         // For HTTP, 响应字节数
+	LatencyMs           float64 `json:"latency_ms,omitempty"`            // For HTTP, 请求结束到响应首字节的服务端延迟; For DNS, 查询到响应的解析延迟
+
+	// TLS 握手：ClientHello 提供的参数与 ServerHello 协商的结果，Domain 同 SNI
+	// QUIC 连接（Type 为 QUIC）的 ClientHello 从解密的 Initial 包中提取，同样保存在 TLS 表
+	SNI                string `json:"sni,omitempty"`                  // For TLS
+	TLSVersion         string `json:"tls_version,omitempty"`          // For TLS, 协商的版本
+	TLSOfferedVersions string `json:"tls_offered_versions,omitempty"` // For TLS, 客户端支持的版本，逗号分隔
+	CipherSuites       string `json:"cipher_suites,omitempty"`        // For TLS, 客户端提供的密码套件，逗号分隔
+	CipherSuite        string `json:"cipher_suite,omitempty"`         // For TLS, 服务端选择的密码套件
+	ALPN               string `json:"alpn,omitempty"`                 // For TLS, 客户端提供的 ALPN，逗号分隔
+	NegotiatedALPN     string `json:"negotiated_alpn,omitempty"`      // For TLS, 服务端选择的 ALPN（TLS 1.3 中已加密，仅 TLS 1.2 及以下可见）
+	JA3                string `json:"ja3,omitempty"`                  // For TLS, 客户端指纹 (MD5)
+	JA3S               string `json:"ja3s,omitempty"`                 // For TLS, 服务端指纹 (MD5)
+	JA4                string `json:"ja4,omitempty"`                  // For TLS, 客户端指纹
+	QUICVersion        string `json:"quic_version,omitempty"`         // For QUIC, 如 QUIC v1, QUIC v2
+
+	// DHCP 消息：DHCPv4 与 DHCPv6 共用，客户端 MAC 与分配的地址用于维护主机清单
+	DHCPMessageType   string `json:"dhcp_message_type,omitempty"`   // For DHCP, 如 DISCOVER, OFFER, ACK, SOLICIT, REPLY
+	DHCPTransactionID uint32 `json:"dhcp_transaction_id,omitempty"` // For DHCP, xid
+	ClientMAC         string `json:"client_mac,omitempty"`          // For DHCP
+	AssignedIP        string `json:"assigned_ip,omitempty"`         // For DHCP, yiaddr/ciaddr 或 DHCPv6 IA_NA 地址
+	Hostname          string `json:"hostname,omitempty"`            // For DHCP, option 12/81 或 DHCPv6 option 39
+	VendorClass       string `json:"vendor_class,omitempty"`        // For DHCP, option 60 或 DHCPv6 option 16
+	DHCPServer        string `json:"dhcp_server,omitempty"`         // For DHCP, 服务器标识（option 54）或服务器源地址
+	DHCPServerMAC     string `json:"dhcp_server_mac,omitempty"`     // For DHCP, 服务器消息的源 MAC
+	LeaseTime         uint32 `json:"lease_time,omitempty"`          // For DHCP, 租期（秒）
+
+	// 明文邮件与文件传输协议（SMTP/POP3/IMAP/FTP）：每条记录为一个命令及其最终应答，SMTP 的 MAIL/RCPT/DATA 合并为一条邮件事务
+	Command       string `json:"command,omitempty"`        // 命令，如 AUTH, RETR, LOGIN, STOR；SMTP 邮件事务为 MAIL
+	Argument      string `json:"argument,omitempty"`       // 命令参数，密码已隐去
+	ReplyCode     string `json:"reply_code,omitempty"`     // 应答码，如 250, +OK, -ERR, OK, NO, BAD
+	ReplyText     string `json:"reply_text,omitempty"`     // 应答文本
+	Username      string `json:"username,omitempty"`       // 认证用户名
+	CleartextAuth bool   `json:"cleartext_auth,omitempty"` // 认证凭据以明文传输（USER/PASS、LOGIN、AUTH PLAIN/LOGIN）
+	MailFrom      string `json:"mail_from,omitempty"`      // For SMTP
+	RcptTo        string `json:"rcpt_to,omitempty"`        // For SMTP, 收件人，逗号分隔
+	Subject       string `json:"subject,omitempty"`        // For SMTP/POP3, 邮件主题
+	Attachments   string `json:"attachments,omitempty"`    // For SMTP/POP3, 附件文件名，逗号分隔
+	FileName      string `json:"file_name,omitempty"`      // For FTP, 传输的文件名
+	FileSize      int64  `json:"file_size,omitempty"`      // For FTP, 文件大小（字节），未知时为 0
+
+	// SSH：版本行和 KEXINIT 协商结果，HASSH 为客户端指纹，HASSHServer 为服务端指纹
+	ClientBanner         string `json:"client_banner,omitempty"`         // For SSH, 如 SSH-2.0-OpenSSH_9.6
+	ServerBanner         string `json:"server_banner,omitempty"`         // For SSH
+	HASSH                string `json:"hassh,omitempty"`                 // For SSH
+	HASSHServer          string `json:"hassh_server,omitempty"`          // For SSH
+	KexAlgorithm         string `json:"kex_algorithm,omitempty"`         // For SSH, 协商的密钥交换算法
+	HostKeyAlgorithm     string `json:"host_key_algorithm,omitempty"`    // For SSH
+	EncryptionAlgorithm  string `json:"encryption_algorithm,omitempty"`  // For SSH, 客户端到服务端方向
+	MACAlgorithm         string `json:"mac_algorithm,omitempty"`         // For SSH, AEAD 加密时为空
+	CompressionAlgorithm string `json:"compression_algorithm,omitempty"` // For SSH
+	SSHUsage             string `json:"ssh_usage,omitempty"`             // For SSH, interactive / bulk，数据不足时为空
+
+	// ICMP 差错报文（目的不可达、超时等）携带的原始报文头：被拒绝的流，报告者为会话的源地址
+	OrigSrcIP    string `json:"orig_src_ip,omitempty"`   // For ICMP
+	OrigDstIP    string `json:"orig_dst_ip,omitempty"`   // For ICMP
+	OrigProtocol string `json:"orig_protocol,omitempty"` // For ICMP, TCP / UDP / ICMP ...
+	OrigSrcPort  uint16 `json:"orig_src_port,omitempty"` // For ICMP, 原始报文为 ICMP 回显时为标识符
+	OrigDstPort  uint16 `json:"orig_dst_port,omitempty"` // For ICMP, 原始报文为 ICMP 回显时为序号
+	Hop          uint8  `json:"hop,omitempty"`           // For ICMP, 超时差错对应探测包的初始 TTL（跳数），未看到探测包时为 0
+
 	// 进程关联信息（从Packet继承）
 	ProcessPID  int32  `json:"process_pid,omitempty"`
 	ProcessName string `json:"process_name,omitempty"`
 	ProcessExe  string `json:"process_exe,omitempty"`
 }
 
+// DNS message sections
+const (
+	DNSSectionQuestion   = "question"
+	DNSSectionAnswer     = "answer"
+	DNSSectionAuthority  = "authority"
+	DNSSectionAdditional = "additional"
+)
+
+// DNSRecord represents a record of a DNS message
+// DNS 记录：Data 为区域文件格式中记录头之后的部分（如 MX 的 "10 mail.example.com."）
+type DNSRecord struct {
+	Section string `json:"section"` // question, answer, authority, additional
+	Name    string `json:"name"`
+	Type    string `json:"type"` // A, AAAA, CNAME, TXT, MX, SRV, HTTPS, SVCB, PTR, ...
+	TTL     uint32 `json:"ttl"`
+	Data    string `json:"data"`
+}
+
 // Metrics represents real-time capture metrics
 // 实时指标
 type Metrics struct {
 	Timestamp      time.Time `json:"timestamp"`
-	Interface      string    `json:"interface"`
+	Interface      string    `json:"interface"` // 所有抓包网卡，逗号分隔
 	IsCapturing    bool      `json:"is_capturing"`
 	IsPaused       bool      `json:"is_paused"`
+	BPFFilter      string    `json:"bpf_filter"` // 当前生效的抓包过滤器（各网卡不一致时为空）
 	PacketsTotal   int64     `json:"packets_total"`
 	PacketsDropped int64     `json:"packets_dropped"`
 	BytesTotal     int64     `json:"bytes_total"`
@@ -85,6 +202,232 @@ type Metrics struct {
 	DNSCount       int       `json:"dns_count"`
 	HTTPCount      int       `json:"http_count"`
 	ICMPCount      int       `json:"icmp_count"`
+
+	// 各会话表环形缓冲区中的会话数（按表名）
+	SessionCounts map[TableType]int `json:"session_counts"`
+
+	// 各网卡指标（顶层字段为汇总值）
+	Interfaces []InterfaceMetrics `json:"interfaces"`
+
+	// 处理流水线各阶段指标
+	Pipeline []StageMetrics `json:"pipeline"`
+
+	// 采样状态
+	Sampling SamplingStatus `json:"sampling"`
+
+	// TCP 流重组
+	Reassembly ReassemblyStats `json:"reassembly"`
+
+	// IP 分片重组
+	Defrag DefragStats `json:"defrag"`
+
+	// DNS 查询与响应配对
+	DNSTracker DNSTrackerStats `json:"dns_tracker"`
+}
+
+// SamplingStatus represents the state of packet sampling
+// 采样状态：采样期间 PacketsTotal 仍为实际抓到的包数，会话流统计为按采样率放大的估计值
+type SamplingStatus struct {
+	Mode    string     `json:"mode"`             // off, count, flow, auto
+	Active  bool       `json:"active"`           // 当前是否正在采样
+	Method  string     `json:"method,omitempty"` // 生效的采样方式: count, flow
+	Rate    int        `json:"rate"`             // 采样率 N
+	Reason  string     `json:"reason,omitempty"` // auto 模式开启采样的原因
+	Since   *time.Time `json:"since,omitempty"`  // 本次采样开始时间
+	Kept    int64      `json:"kept"`             // 采样保留的包数
+	Skipped int64      `json:"skipped"`          // 采样跳过的包数
+}
+
+// ReassemblyStats represents the TCP stream reassembly counters
+// TCP 流重组统计（累计值，Connections 为当前跟踪的连接数）
+type ReassemblyStats struct {
+	Enabled         bool  `json:"enabled"`
+	Connections     int64 `json:"connections"`      // 当前跟踪的连接数
+	Closed          int64 `json:"closed"`           // 已结束的连接数（FIN/RST 或超时）
+	Bytes           int64 `json:"bytes"`            // 按序交付给解析器的字节数
+	MissedBytes     int64 `json:"missed_bytes"`     // 无法补齐而跳过的字节数
+	OverlapBytes    int64 `json:"overlap_bytes"`    // 重传/重叠而丢弃的字节数
+	OutOfOrder      int64 `json:"out_of_order"`     // 乱序到达后重新排序的报文数
+	BufferOverflows int64 `json:"buffer_overflows"` // 解析缓存超过上限的次数
+	Sessions        int64 `json:"sessions"`         // 从重组字节流解析出的会话数
+}
+
+// DefragStats represents the IP fragment reassembly counters
+// IP 分片重组统计（累计值，Pending 和 PendingBytes 为当前未完成的数据报）
+type DefragStats struct {
+	Enabled      bool  `json:"enabled"`
+	Pending      int64 `json:"pending"`       // 等待剩余分片的数据报数
+	PendingBytes int64 `json:"pending_bytes"` // 未完成数据报缓存的分片数据字节数
+	Fragments    int64 `json:"fragments"`     // 收到的分片数
+	Reassembled  int64 `json:"reassembled"`   // 重组完成的数据报数
+	Timeouts     int64 `json:"timeouts"`      // 超时未收齐而丢弃的数据报数
+	Evicted      int64 `json:"evicted"`       // 超出内存上限而丢弃的数据报数
+	Dropped      int64 `json:"dropped"`       // 超出分片数上限而丢弃的数据报数
+	Invalid      int64 `json:"invalid"`       // 长度或偏移非法而丢弃的数据报数
+	Overlaps     int64 `json:"overlaps"`      // 分片重叠而丢弃的数据报数
+}
+
+// DNSTrackerStats represents the DNS transaction correlation counters
+// DNS 事务配对统计（累计值，Pending 为当前等待响应的查询数）
+type DNSTrackerStats struct {
+	Enabled    bool  `json:"enabled"`
+	Pending    int64 `json:"pending"`    // 等待响应的查询数
+	Answered   int64 `json:"answered"`   // 已配对的事务数
+	Unanswered int64 `json:"unanswered"` // 超时未响应的查询数
+	Unmatched  int64 `json:"unmatched"`  // 没有对应查询的响应数（抓包开始前发出的查询）
+	Duplicates int64 `json:"duplicates"` // 等待响应期间重复发送的查询数
+}
+
+// ARPEntry represents an IP-to-MAC binding learned from ARP traffic
+// ARP 表项：同一 IP 出现多个 MAC 时每个绑定一条记录，Current 标记最近一次声明的 MAC
+type ARPEntry struct {
+	IP        string    `json:"ip"`
+	MAC       string    `json:"mac"`
+	VLANID    uint16    `json:"vlan_id,omitempty"`
+	Interface string    `json:"interface,omitempty"` // 最近一次出现的抓包网卡
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	Packets   int64     `json:"packets"` // 声明该绑定的 ARP 报文数
+	Current   bool      `json:"current"` // 是否为该 IP 当前的 MAC
+	Gateway   bool      `json:"gateway"` // 该 IP 是否为配置的网关
+}
+
+// PingStat represents the echo statistics of one destination
+// 回显统计：请求与应答按标识符和序号配对，超时未应答记为丢包
+type PingStat struct {
+	Destination string    `json:"destination"`
+	Sent        int64     `json:"sent"`      // 回显请求数
+	Received    int64     `json:"received"`  // 收到应答的请求数
+	Lost        int64     `json:"lost"`      // 超时未应答的请求数，等待中的请求不计入
+	LossRate    float64   `json:"loss_rate"` // 丢包率（%），Lost / (Received + Lost)
+	MinRTT      float64   `json:"min_rtt"`   // 毫秒
+	AvgRTT      float64   `json:"avg_rtt"`
+	MaxRTT      float64   `json:"max_rtt"`
+	LastRTT     float64   `json:"last_rtt"`
+	FirstSeen   time.Time `json:"first_seen"`
+	LastSeen    time.Time `json:"last_seen"`
+}
+
+// RouteHop represents a router that answered a probe of a traceroute
+type RouteHop struct {
+	Hop      uint8     `json:"hop"`     // 探测包的初始 TTL
+	Router   string    `json:"router"`  // 返回超时差错（或最后一跳的应答）的地址
+	RTT      float64   `json:"rtt"`     // 最近一次的往返时间（毫秒）
+	Replies  int64     `json:"replies"` // 该路由器应答的探测包数
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// TraceRoute represents the hops discovered from the probes of one source to one destination
+// 同一跳出现多个路由器（等价多路径）时每个路由器一条记录
+type TraceRoute struct {
+	Source      string     `json:"source"`
+	Destination string     `json:"destination"`
+	Protocol    string     `json:"protocol"` // 探测包协议：UDP（traceroute）、ICMP（tracert）、TCP
+	Reached     bool       `json:"reached"`  // 是否收到目的地址的应答（端口不可达或回显应答）
+	Hops        []RouteHop `json:"hops"`     // 按跳数排序
+	LastSeen    time.Time  `json:"last_seen"`
+}
+
+// StageMetrics represents the queue state of a processing pipeline stage
+// 流水线阶段指标
+type StageMetrics struct {
+	Name       string `json:"name"` // decode, enrich, persist, alert
+	Workers    int    `json:"workers"`
+	QueueDepth int    `json:"queue_depth"` // 当前排队任务数
+	QueueSize  int    `json:"queue_size"`  // 队列容量
+	Processed  int64  `json:"processed"`
+	Dropped    int64  `json:"dropped"` // 队列满被丢弃的任务数
+}
+
+// InterfaceMetrics represents capture metrics of a single interface
+// 单网卡指标
+type InterfaceMetrics struct {
+	Name           string    `json:"name"`
+	Backend        string    `json:"backend"` // pcap, afpacket, file
+	Workers        int       `json:"workers"` // 抓包协程数（afpacket fanout）
+	BPFFilter      string    `json:"bpf_filter"`
+	StartedAt      time.Time `json:"started_at"`
+	PacketsTotal   int64     `json:"packets_total"`
+	PacketsDropped int64     `json:"packets_dropped"`
+	QueueFreezes   int64     `json:"queue_freezes"` // TPACKET_V3 环形缓冲区冻结次数
+	BytesTotal     int64     `json:"bytes_total"`
+	PacketsPerSec  float64   `json:"packets_per_sec"`
+	BytesPerSec    float64   `json:"bytes_per_sec"`
+}
+
+// CaptureSettings represents the effective settings of a capture handle
+// 抓包句柄实际生效的参数
+type CaptureSettings struct {
+	Interface       string `json:"interface"`
+	Backend         string `json:"backend"` // pcap, afpacket, file
+	LinkType        string `json:"link_type"`
+	SnapLen         int    `json:"snap_len"`
+	Promiscuous     bool   `json:"promiscuous"`
+	Timeout         string `json:"timeout"`
+	BufferSize      int64  `json:"buffer_size"` // 字节，0 表示系统默认值
+	ImmediateMode   bool   `json:"immediate_mode"`
+	TimestampSource string `json:"tstamp_source"`
+	Precision       string `json:"precision"` // nano, micro
+	Direction       string `json:"direction"` // in, out, both
+}
+
+// ReplayStatus represents the progress of an offline PCAP replay
+// 离线回放进度
+type ReplayStatus struct {
+	Path        string     `json:"path"`
+	Speed       float64    `json:"speed"`   // 0=尽可能快, 1=原始时序, >1=加速
+	Running     bool       `json:"running"` // 是否正在回放
+	Done        bool       `json:"done"`    // 是否已回放完成
+	PacketsRead int64      `json:"packets_read"`
+	BytesRead   int64      `json:"bytes_read"`  // 已读取的文件字节数
+	TotalBytes  int64      `json:"total_bytes"` // 文件总字节数
+	Progress    float64    `json:"progress"`    // 0-100
+	StartedAt   time.Time  `json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// StopConditions represents the auto-stop conditions of a capture session
+// 自动停止条件（类似 tshark -a），为 0 表示不限制
+type StopConditions struct {
+	Duration int64 `json:"duration"` // 抓包时长（秒）
+	Packets  int64 `json:"packets"`  // 数据包数
+	Bytes    int64 `json:"bytes"`    // 字节数
+	Files    int64 `json:"files"`    // 写满的 PCAP 文件数
+}
+
+// Capture stop reasons
+const (
+	StopReasonManual   = "manual"   // 手动停止
+	StopReasonDuration = "duration" // 达到抓包时长
+	StopReasonPackets  = "packets"  // 达到数据包数
+	StopReasonBytes    = "bytes"    // 达到字节数
+	StopReasonFiles    = "files"    // 达到文件数
+	StopReasonSchedule = "schedule" // 计划抓包窗口结束
+	StopReasonReplay   = "replay"   // 离线回放结束
+	StopReasonError    = "error"    // 出错停止
+)
+
+// ScheduleWindow represents an occurrence of a scheduled capture window
+// 计划抓包窗口
+type ScheduleWindow struct {
+	Name       string    `json:"name"`
+	Interfaces []string  `json:"interfaces"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+}
+
+// CaptureStatus represents the state of the current (or last) capture session
+// 抓包会话状态：停止条件、停止原因与计划窗口
+type CaptureStatus struct {
+	Running        bool            `json:"running"`
+	Interfaces     []string        `json:"interfaces"`
+	StartedAt      *time.Time      `json:"started_at,omitempty"`
+	StoppedAt      *time.Time      `json:"stopped_at,omitempty"`
+	StopReason     string          `json:"stop_reason,omitempty"`
+	StopConditions StopConditions  `json:"stop_conditions"`
+	ActiveWindow   *ScheduleWindow `json:"active_window,omitempty"` // 当前所处的计划窗口
+	NextWindow     *ScheduleWindow `json:"next_window,omitempty"`   // 下一个计划窗口
 }
 
 // NetworkInterface represents a network interface
@@ -113,8 +456,15 @@ type TableType string
 const (
 	TableRaw  TableType = "raw"
 	TableDNS  TableType = "dns"
-	TableHTTP TableType = "util"
+	TableHTTP TableType = "http"
 	TableICMP TableType = "icmp"
+	TableTLS  TableType = "tls"
+	TableDHCP TableType = "dhcp"
+	TableSMTP TableType = "smtp"
+	TablePOP3 TableType = "pop3"
+	TableIMAP TableType = "imap"
+	TableFTP  TableType = "ftp"
+	TableSSH  TableType = "ssh"
 )
 
 // DashboardStats represents dashboard statistics
@@ -136,8 +486,13 @@ type DashboardStats struct {
 	DNSSessions       int64 `json:"dns_sessions"`
 	HTTPSessions      int64 `json:"http_sessions"`
 	ICMPSessions      int64 `json:"icmp_sessions"`
+	TLSSessions       int64 `json:"tls_sessions"`
 	SessionFlowsCount int64 `json:"session_flows_count"` // 会话流总数
 
+	// 采样：统计中包含按采样率放大的估计值
+	Sampled      bool  `json:"sampled"`
+	SampledFlows int64 `json:"sampled_flows"` // 含采样估计值的会话流数
+
 	// Top 统计
 	TopSrcIPs  []IPStat     `json:"top_src_ips"`
 	TopDstIPs  []IPStat     `json:"top_dst_ips"`
@@ -194,6 +549,11 @@ type AlertRule struct {
 	Description       string    `json:"description"`
 	CreatedAt         time.Time `json:"created_at"`
 	UpdatedAt         time.Time `json:"updated_at"`
+
+	// 告警快照：保存触发前 N 秒和触发后 M 秒的数据包作为证据文件
+	SnapshotEnabled bool `json:"snapshot_enabled"`
+	SnapshotPre     int  `json:"snapshot_pre_seconds"`  // 触发前秒数（受 snapshot.window 限制）
+	SnapshotPost    int  `json:"snapshot_post_seconds"` // 触发后秒数
 }
 
 // AlertLog 告警记录
@@ -215,6 +575,7 @@ type AlertLog struct {
 	Acknowledged    bool       `json:"acknowledged"`
 	AcknowledgedAt  *time.Time `json:"acknowledged_at,omitempty"`
 	AcknowledgedBy  string     `json:"acknowledged_by,omitempty"`
+	EvidencePath    string     `json:"evidence_path,omitempty"` // 告警快照证据文件
 }
 
 // AlertRuleQuery 告警规则查询参数
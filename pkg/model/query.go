@@ -1,5 +1,7 @@
 package model
 
+import "time"
+
 // QueryOptions 查询选项
 type QueryOptions struct {
 	Table      TableType `json:"table"`       // 表名
@@ -39,6 +41,7 @@ type SessionFlow struct {
 	LastSeen      string    `json:"last_seen"`      // 最后出现时间
 	Duration      float64   `json:"duration"`       // 持续时间（秒）
 	SessionType   string    `json:"session_type"`   // 会话类型 (DNS/HTTP/ICMP/Other)
+	TypeConfidence float64  `json:"type_confidence"` // 会话类型置信度：载荷识别 0.5-1，端口猜测 0.3，0 表示未识别
 	
 	// 进程关联信息
 	ProcessPID    int32     `json:"process_pid,omitempty"`
@@ -53,3 +56,123 @@ type SessionFlowResult struct {
 }
 
 
+
+// HTTPLatencyQuery HTTP 延迟统计查询选项
+type HTTPLatencyQuery struct {
+	Host      string `json:"host"`       // 主机名，为空表示所有主机
+	StartTime int64  `json:"start_time"` // 开始时间（Unix 秒），0 表示不限制
+	EndTime   int64  `json:"end_time"`   // 结束时间（Unix 秒），0 表示不限制
+	Limit     int    `json:"limit"`      // 返回的主机数（按事务数排序）
+}
+
+// HTTPLatencyStats 单个主机的 HTTP 服务端延迟统计（毫秒）
+type HTTPLatencyStats struct {
+	Host   string  `json:"host"`
+	Count  int     `json:"count"`  // 已配对的事务数
+	Errors int     `json:"errors"` // 5xx 响应数
+	Avg    float64 `json:"avg"`
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	P50    float64 `json:"p50"`
+	P90    float64 `json:"p90"`
+	P95    float64 `json:"p95"`
+	P99    float64 `json:"p99"`
+}
+
+// DNSRecordQuery DNS 资源记录查询选项
+type DNSRecordQuery struct {
+	Name      string `json:"name"`       // 记录名（模糊匹配）
+	Type      string `json:"type"`       // 记录类型，如 A, CNAME, MX
+	Data      string `json:"data"`       // 记录数据（模糊匹配），如 IP 地址或 CNAME 目标
+	Section   string `json:"section"`    // 所在段: question, answer, authority, additional
+	StartTime int64  `json:"start_time"` // 开始时间（Unix 秒），0 表示不限制
+	EndTime   int64  `json:"end_time"`   // 结束时间（Unix 秒），0 表示不限制
+	Limit     int    `json:"limit"`      // 限制数量
+	Offset    int    `json:"offset"`     // 偏移量
+}
+
+// DNSRecordMatch 匹配的 DNS 记录及其所属会话
+type DNSRecordMatch struct {
+	DNSRecord
+	SessionID   int64     `json:"session_id"`
+	Timestamp   time.Time `json:"timestamp"`
+	SrcIP       string    `json:"src_ip"`
+	DstIP       string    `json:"dst_ip"`
+	Domain      string    `json:"domain"` // 会话的查询名
+	RCode       string    `json:"rcode,omitempty"`
+	ProcessName string    `json:"process_name,omitempty"`
+}
+
+// DNSRecordResult DNS 记录查询结果
+type DNSRecordResult struct {
+	Total int               `json:"total"` // 总数
+	Data  []*DNSRecordMatch `json:"data"`  // 数据
+}
+
+// DNSStatsQuery DNS 解析统计查询选项（基于已配对的 DNS 事务）
+type DNSStatsQuery struct {
+	GroupBy    string `json:"group_by"`    // resolver（按 DNS 服务器，默认）或 process（按进程）
+	SortBy     string `json:"sort_by"`     // latency（按 P95 延迟）, failure_rate, queries（默认）
+	MinQueries int    `json:"min_queries"` // 查询数少于此值的分组不返回，避免少量查询的失败率排在前面
+	StartTime  int64  `json:"start_time"`  // 开始时间（Unix 秒），0 表示不限制
+	EndTime    int64  `json:"end_time"`    // 结束时间（Unix 秒），0 表示不限制
+	Limit      int    `json:"limit"`       // 返回的分组数
+}
+
+// DNSStats 单个 DNS 服务器或进程的解析统计，延迟单位毫秒
+// Failures 为错误响应（SERVFAIL、REFUSED 等）与未响应的查询，NXDOMAIN 是正常应答，单独统计
+type DNSStats struct {
+	Key         string  `json:"key"`          // DNS 服务器 IP 或进程名
+	Queries     int     `json:"queries"`      // 查询数（已响应 + 未响应）
+	Answered    int     `json:"answered"`     // 收到响应的查询数
+	Unanswered  int     `json:"unanswered"`   // 超时未响应的查询数
+	NXDomain    int     `json:"nxdomain"`     // NXDOMAIN 响应数
+	ServFail    int     `json:"servfail"`     // SERVFAIL 响应数
+	Failures    int     `json:"failures"`     // 失败数
+	FailureRate float64 `json:"failure_rate"` // 失败率 (0-1)
+	AvgLatency  float64 `json:"avg_latency"`  // 已响应查询的平均延迟
+	P50         float64 `json:"p50"`
+	P95         float64 `json:"p95"`
+	MaxLatency  float64 `json:"max_latency"`
+}
+
+// DNSNXDomainQuery NXDOMAIN 域名统计查询选项
+type DNSNXDomainQuery struct {
+	StartTime int64 `json:"start_time"` // 开始时间（Unix 秒），0 表示不限制
+	EndTime   int64 `json:"end_time"`   // 结束时间（Unix 秒），0 表示不限制
+	Limit     int   `json:"limit"`      // 返回的域名数
+}
+
+// DNSNXDomainStats 返回 NXDOMAIN 的域名
+type DNSNXDomainStats struct {
+	Domain    string `json:"domain"`
+	Count     int    `json:"count"`               // NXDOMAIN 响应数
+	Clients   int    `json:"clients"`             // 发起查询的客户端数
+	Processes string `json:"processes,omitempty"` // 发起查询的进程，逗号分隔
+	LastSeen  string `json:"last_seen"`           // 最后出现时间
+}
+
+// Host 由 DHCP 消息学习到的主机，以客户端 MAC 标识
+type Host struct {
+	MAC         string    `json:"mac"`
+	IP          string    `json:"ip"`           // 最近一次 ACK/REPLY 分配的地址
+	Hostname    string    `json:"hostname"`     // 客户端上报的主机名
+	VendorClass string    `json:"vendor_class"` // 厂商类别，如 MSFT 5.0, android-dhcp-13
+	DHCPServer  string    `json:"dhcp_server"`  // 分配地址的 DHCP 服务器
+	LeaseTime   uint32    `json:"lease_time"`   // 租期（秒）
+	FirstSeen   time.Time `json:"first_seen"`
+	LastSeen    time.Time `json:"last_seen"`
+}
+
+// HostQuery 主机清单查询选项
+type HostQuery struct {
+	Search string `json:"search"` // 按 MAC、IP、主机名、厂商类别模糊匹配
+	Limit  int    `json:"limit"`  // 限制数量
+	Offset int    `json:"offset"` // 偏移量
+}
+
+// HostResult 主机清单查询结果
+type HostResult struct {
+	Total int     `json:"total"` // 总数
+	Data  []*Host `json:"data"`  // 数据，按最后出现时间倒序
+}